@@ -0,0 +1,211 @@
+// Copyright 2019 Fabian Wenzelmann
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gopherbouncedb
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// AttributeType is the type of a user attribute.
+type AttributeType int
+
+const (
+	// AttributeString is the type of string attributes.
+	AttributeString AttributeType = iota
+	// AttributeInt is the type of int64 attributes.
+	AttributeInt
+	// AttributeBool is the type of bool attributes.
+	AttributeBool
+	// AttributeTime is the type of time.Time attributes, times are stored in UTC.
+	AttributeTime
+	// AttributeJSON is the type of attributes that contain a JSON document.
+	AttributeJSON
+)
+
+func (t AttributeType) String() string {
+	switch t {
+	case AttributeString:
+		return "string"
+	case AttributeInt:
+		return "int"
+	case AttributeBool:
+		return "bool"
+	case AttributeTime:
+		return "time"
+	case AttributeJSON:
+		return "json"
+	default:
+		return fmt.Sprintf("AttributeType(%d)", int(t))
+	}
+}
+
+// AttributeValue is the typed value of a user attribute.
+//
+// Values are created with StringAttribute, IntAttribute, BoolAttribute,
+// TimeAttribute and JSONAttribute, the zero value is the empty string.
+type AttributeValue struct {
+	Type  AttributeType
+	value interface{}
+}
+
+// StringAttribute returns a new string value.
+func StringAttribute(val string) AttributeValue {
+	return AttributeValue{Type: AttributeString, value: val}
+}
+
+// IntAttribute returns a new int value.
+func IntAttribute(val int64) AttributeValue {
+	return AttributeValue{Type: AttributeInt, value: val}
+}
+
+// BoolAttribute returns a new bool value.
+func BoolAttribute(val bool) AttributeValue {
+	return AttributeValue{Type: AttributeBool, value: val}
+}
+
+// TimeAttribute returns a new time value, the time is converted to UTC.
+func TimeAttribute(val time.Time) AttributeValue {
+	return AttributeValue{Type: AttributeTime, value: val.UTC()}
+}
+
+// JSONAttribute returns a new JSON value, an error is returned if val is not valid
+// JSON.
+func JSONAttribute(val json.RawMessage) (AttributeValue, error) {
+	if !json.Valid(val) {
+		return AttributeValue{}, fmt.Errorf("invalid JSON attribute: %q", val)
+	}
+	return AttributeValue{Type: AttributeJSON, value: append(json.RawMessage(nil), val...)}, nil
+}
+
+// MarshalJSONAttribute returns a new JSON value with the JSON encoding of val.
+func MarshalJSONAttribute(val interface{}) (AttributeValue, error) {
+	encoded, err := json.Marshal(val)
+	if err != nil {
+		return AttributeValue{}, err
+	}
+	return AttributeValue{Type: AttributeJSON, value: json.RawMessage(encoded)}, nil
+}
+
+// AsString returns the value if it is a string attribute.
+func (v AttributeValue) AsString() (string, bool) {
+	if v.Type != AttributeString {
+		return "", false
+	}
+	res, _ := v.value.(string)
+	return res, true
+}
+
+// AsInt returns the value if it is an int attribute.
+func (v AttributeValue) AsInt() (int64, bool) {
+	res, ok := v.value.(int64)
+	return res, ok && v.Type == AttributeInt
+}
+
+// AsBool returns the value if it is a bool attribute.
+func (v AttributeValue) AsBool() (bool, bool) {
+	res, ok := v.value.(bool)
+	return res, ok && v.Type == AttributeBool
+}
+
+// AsTime returns the value if it is a time attribute.
+func (v AttributeValue) AsTime() (time.Time, bool) {
+	res, ok := v.value.(time.Time)
+	return res, ok && v.Type == AttributeTime
+}
+
+// AsJSON returns the value if it is a JSON attribute.
+func (v AttributeValue) AsJSON() (json.RawMessage, bool) {
+	res, ok := v.value.(json.RawMessage)
+	return res, ok && v.Type == AttributeJSON
+}
+
+// DecodeJSON decodes a JSON attribute into dst.
+func (v AttributeValue) DecodeJSON(dst interface{}) error {
+	raw, ok := v.AsJSON()
+	if !ok {
+		return fmt.Errorf("attribute of type %s is not a JSON attribute", v.Type)
+	}
+	return json.Unmarshal(raw, dst)
+}
+
+// Equal returns true if both values have the same type and value.
+// Times are compared with time.Equal and JSON documents byte by byte.
+func (v AttributeValue) Equal(other AttributeValue) bool {
+	if v.Type != other.Type {
+		return false
+	}
+	switch v.Type {
+	case AttributeString:
+		s1, _ := v.AsString()
+		s2, _ := other.AsString()
+		return s1 == s2
+	case AttributeTime:
+		t1, _ := v.AsTime()
+		t2, _ := other.AsTime()
+		return t1.Equal(t2)
+	case AttributeJSON:
+		j1, _ := v.AsJSON()
+		j2, _ := other.AsJSON()
+		return bytes.Equal(j1, j2)
+	default:
+		return v.value == other.value
+	}
+}
+
+func (v AttributeValue) String() string {
+	switch v.Type {
+	case AttributeTime:
+		t, _ := v.AsTime()
+		return t.Format(time.RFC3339Nano)
+	case AttributeJSON:
+		raw, _ := v.AsJSON()
+		return string(raw)
+	case AttributeString:
+		s, _ := v.AsString()
+		return s
+	default:
+		return fmt.Sprint(v.value)
+	}
+}
+
+// UserAttributes maps the names of attributes to their values.
+type UserAttributes map[string]AttributeValue
+
+// MaxAttributeNameLength is the maximal length of an attribute name.
+const MaxAttributeNameLength = 128
+
+// checkAttributeName returns an error if the name is empty or too long.
+func checkAttributeName(name string) error {
+	if name == "" || len(name) > MaxAttributeNameLength {
+		return fmt.Errorf("invalid attribute name \"%s\": must have between 1 and %d bytes",
+			name, MaxAttributeNameLength)
+	}
+	return nil
+}
+
+// Copy returns a copy of the attributes, JSON documents are copied as well.
+func (a UserAttributes) Copy() UserAttributes {
+	res := make(UserAttributes, len(a))
+	for name, val := range a {
+		if raw, isJSON := val.AsJSON(); isJSON {
+			val.value = append(json.RawMessage(nil), raw...)
+		}
+		res[name] = val
+	}
+	return res
+}
@@ -0,0 +1,234 @@
+// Copyright 2019 Fabian Wenzelmann
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gopherbouncedb
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// AuthenticationFailed is the error returned if a login failed because the user
+// doesn't exist or the password is wrong.
+// To not reveal which of the two happened the message is always the same.
+type AuthenticationFailed string
+
+// NewAuthenticationFailed returns a new AuthenticationFailed error.
+func NewAuthenticationFailed() AuthenticationFailed {
+	return AuthenticationFailed("invalid username / email or password")
+}
+
+// Error returns the error message.
+func (e AuthenticationFailed) Error() string {
+	return string(e)
+}
+
+// UserInactive is the error returned if the credentials were correct but the user
+// is not active.
+type UserInactive string
+
+// NewUserInactive returns a new UserInactive error given the user id.
+func NewUserInactive(id UserID) UserInactive {
+	return UserInactive(fmt.Sprintf("user with id %d is not active", id))
+}
+
+// Error returns the error message.
+func (e UserInactive) Error() string {
+	return string(e)
+}
+
+// NoMatchingHasher is the error returned if no hasher of the authenticator can verify
+// a hash. It is returned by VerifyPassword, Authenticate returns AuthenticationFailed
+// instead.
+type NoMatchingHasher string
+
+// NewNoMatchingHasher returns a new NoMatchingHasher error.
+func NewNoMatchingHasher() NoMatchingHasher {
+	return NoMatchingHasher("no hasher found for password hash")
+}
+
+// Error returns the error message.
+func (e NoMatchingHasher) Error() string {
+	return string(e)
+}
+
+// Authenticator hashes passwords and authenticates users from a UserStorage.
+//
+// Hasher is the preferred algorithm, it is used to hash all new passwords.
+// Legacy contains additional hashers that are only used to verify existing hashes,
+// for example hashes imported from another system.
+// If a user logs in with a hash that was created by a legacy hasher or with
+// outdated parameters (see PasswordHasher.NeedsRehash) the password is hashed again
+// with Hasher and the new hash is stored.
+type Authenticator struct {
+	Users  UserStorage
+	Hasher PasswordHasher
+	Legacy []PasswordHasher
+
+	dummyOnce sync.Once
+	dummyHash string
+}
+
+// NewAuthenticator returns a new Authenticator.
+func NewAuthenticator(users UserStorage, hasher PasswordHasher, legacy ...PasswordHasher) *Authenticator {
+	return &Authenticator{
+		Users:  users,
+		Hasher: hasher,
+		Legacy: legacy,
+	}
+}
+
+// HashPassword returns the hash of the password created with Hasher.
+func (a *Authenticator) HashPassword(password string) (string, error) {
+	return a.Hasher.Hash(password)
+}
+
+// SetPassword sets the password hash of the user model to the hash of password.
+// It does not update the user in the storage.
+func (a *Authenticator) SetPassword(u *UserModel, password string) error {
+	hash, err := a.HashPassword(password)
+	if err != nil {
+		return err
+	}
+	u.Password = hash
+	return nil
+}
+
+// hasherFor returns the hasher for the hash and true if the hash should be renewed.
+func (a *Authenticator) hasherFor(hash string) (PasswordHasher, bool, error) {
+	if a.Hasher.Matches(hash) {
+		return a.Hasher, a.Hasher.NeedsRehash(hash), nil
+	}
+	for _, hasher := range a.Legacy {
+		if hasher.Matches(hash) {
+			return hasher, true, nil
+		}
+	}
+	return nil, false, NewNoMatchingHasher()
+}
+
+// VerifyPassword tests if the password matches the password hash of the user.
+// The second return value is true if the hash should be renewed.
+func (a *Authenticator) VerifyPassword(u *UserModel, password string) (bool, bool, error) {
+	hasher, rehash, err := a.hasherFor(u.Password)
+	if err != nil {
+		return false, false, err
+	}
+	matches, verifyErr := hasher.Verify(password, u.Password)
+	if verifyErr != nil || !matches {
+		return false, false, verifyErr
+	}
+	return true, rehash, nil
+}
+
+// spendTime verifies the password against a dummy hash, it is used if a user
+// doesn't exist so that the time needed for a failed login doesn't reveal if the
+// user exists.
+func (a *Authenticator) spendTime(password string) {
+	a.dummyOnce.Do(func() {
+		a.dummyHash, _ = a.Hasher.Hash("gopherbouncedb dummy password")
+	})
+	if a.dummyHash != "" {
+		_, _ = a.Hasher.Verify(password, a.dummyHash)
+	}
+}
+
+// Authenticate looks up the user by username or email and verifies the password.
+// If login contains an "@" the user is looked up by email first, otherwise by
+// username first.
+//
+// If the user doesn't exist or the password is wrong an error of type
+// AuthenticationFailed is returned, if the user is not active an error of type
+// UserInactive.
+// On success LastLogin is set to the current date and the password hash is renewed
+// if required (see Authenticator), both changes are stored with UpdateUser.
+// Renewing the hash doesn't change PasswordChangedAt and MustChangePassword.
+// If no hasher can verify the stored hash AuthenticationFailed is returned as well.
+func (a *Authenticator) Authenticate(login, password string) (*UserModel, error) {
+	lookups := []func(string) (*UserModel, error){a.Users.GetUserByName, a.Users.GetUserByEmail}
+	if strings.Contains(login, "@") {
+		lookups[0], lookups[1] = lookups[1], lookups[0]
+	}
+	for _, lookup := range lookups {
+		u, err := lookup(login)
+		switch err.(type) {
+		case nil:
+			return a.authenticateUser(u, password)
+		case NoSuchUser:
+			continue
+		default:
+			return nil, err
+		}
+	}
+	a.spendTime(password)
+	return nil, NewAuthenticationFailed()
+}
+
+// AuthenticateByName works as Authenticate but only looks up the user by username.
+func (a *Authenticator) AuthenticateByName(username, password string) (*UserModel, error) {
+	return a.authenticateLookup(a.Users.GetUserByName, username, password)
+}
+
+// AuthenticateByEmail works as Authenticate but only looks up the user by email.
+func (a *Authenticator) AuthenticateByEmail(email, password string) (*UserModel, error) {
+	return a.authenticateLookup(a.Users.GetUserByEmail, email, password)
+}
+
+func (a *Authenticator) authenticateLookup(lookup func(string) (*UserModel, error), key, password string) (*UserModel, error) {
+	u, err := lookup(key)
+	switch err.(type) {
+	case nil:
+		return a.authenticateUser(u, password)
+	case NoSuchUser:
+		a.spendTime(password)
+		return nil, NewAuthenticationFailed()
+	default:
+		return nil, err
+	}
+}
+
+func (a *Authenticator) authenticateUser(u *UserModel, password string) (*UserModel, error) {
+	matches, rehash, err := a.VerifyPassword(u, password)
+	if _, noHasher := err.(NoMatchingHasher); noHasher {
+		// a hash in an unknown format is treated as a wrong password
+		return nil, NewAuthenticationFailed()
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !matches {
+		return nil, NewAuthenticationFailed()
+	}
+	if !u.IsActive {
+		return nil, NewUserInactive(u.ID)
+	}
+	fields := []string{"LastLogin"}
+	if rehash {
+		newHash, hashErr := a.HashPassword(password)
+		if hashErr != nil {
+			return nil, hashErr
+		}
+		// a new hash is not a new password: listing PasswordChangedAt keeps the
+		// current password change fields and doesn't add a password history entry
+		u.Password = newHash
+		fields = append(fields, "Password", "PasswordChangedAt", "MustChangePassword")
+	}
+	u.LastLogin = time.Now().UTC()
+	if updateErr := a.Users.UpdateUser(u.ID, u, fields); updateErr != nil {
+		return nil, updateErr
+	}
+	return u, nil
+}
@@ -0,0 +1,179 @@
+// Copyright 2019 Fabian Wenzelmann
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gopherbouncedb
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// BatchErr is returned by batch operations if some of the items failed.
+// It maps the index of an item to the error for this item, for example an error of
+// type UserExists if the user with index i already exists.
+// All items not contained in the map were processed successfully.
+type BatchErr map[int]error
+
+// NewBatchErr returns a new BatchErr given the errors for the failed items.
+func NewBatchErr(errs map[int]error) BatchErr {
+	return BatchErr(errs)
+}
+
+// Indices returns the indices of all failed items in increasing order.
+func (e BatchErr) Indices() []int {
+	res := make([]int, 0, len(e))
+	for i := range e {
+		res = append(res, i)
+	}
+	sort.Ints(res)
+	return res
+}
+
+// Error returns the error message.
+func (e BatchErr) Error() string {
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("batch operation failed for %d items:", len(e)))
+	for _, i := range e.Indices() {
+		sb.WriteString(fmt.Sprintf("\n   item %d: %s", i, e[i].Error()))
+	}
+	return sb.String()
+}
+
+// batchErrOrNil returns nil if errs is empty and a BatchErr otherwise.
+func batchErrOrNil(errs map[int]error) error {
+	if len(errs) == 0 {
+		return nil
+	}
+	return NewBatchErr(errs)
+}
+
+// retryItemByItem returns true if a batch that failed in a single transaction
+// should be repeated item by item to get the errors for all items.
+// This is only done for errors caused by a single item (UserExists and
+// AmbiguousCredentials) and NotSupported, the transaction was rolled back before for
+// these errors. For all other errors (for example a failed commit) it's not known
+// which items were stored, thus they're returned directly.
+func retryItemByItem(err error) bool {
+	switch err.(type) {
+	case UserExists, AmbiguousCredentials, NotSupported:
+		return true
+	default:
+		return false
+	}
+}
+
+// UserBatchStorage is implemented by user storages that support batch operations
+// natively (for example in a single transaction).
+//
+// The methods work as the corresponding methods from UserStorage on multiple users.
+// If some of the items fail all other items are still processed and an error of type
+// BatchErr is returned.
+// Other errors (for example if the database connection failed) may be returned
+// directly.
+type UserBatchStorage interface {
+	// InsertUsers inserts all users and sets their ID, DateJoined, LastLogin and
+	// PasswordChangedAt the same way as InsertUser.
+	InsertUsers(users []*UserModel) error
+	// UpdateUsers updates the fields of all users, the users are identified by their
+	// ID.
+	UpdateUsers(users []*UserModel, fields []string) error
+	// DeleteUsers deletes all users with the given ids.
+	DeleteUsers(ids []UserID) error
+}
+
+// SessionBatchStorage is implemented by session storages that support deleting
+// multiple sessions natively.
+// Errors are reported as in UserBatchStorage.
+type SessionBatchStorage interface {
+	DeleteSessions(keys []string) error
+}
+
+// InsertUsers inserts all users into the storage.
+// If the storage implements UserBatchStorage its InsertUsers method is used,
+// otherwise the users are inserted one by one.
+// If some users can't be inserted an error of type BatchErr is returned.
+func InsertUsers(storage UserStorage, users []*UserModel) error {
+	if batch, ok := storage.(UserBatchStorage); ok {
+		return batch.InsertUsers(users)
+	}
+	return insertUsersLoop(storage, users)
+}
+
+// UpdateUsers updates all users (identified by their ID) in the storage.
+// See InsertUsers for the behavior.
+func UpdateUsers(storage UserStorage, users []*UserModel, fields []string) error {
+	if batch, ok := storage.(UserBatchStorage); ok {
+		return batch.UpdateUsers(users, fields)
+	}
+	return updateUsersLoop(storage, users, fields)
+}
+
+// DeleteUsers deletes all users with the given ids.
+// See InsertUsers for the behavior.
+func DeleteUsers(storage UserStorage, ids []UserID) error {
+	if batch, ok := storage.(UserBatchStorage); ok {
+		return batch.DeleteUsers(ids)
+	}
+	return deleteUsersLoop(storage, ids)
+}
+
+// DeleteSessions deletes all sessions with the given keys.
+// See InsertUsers for the behavior.
+func DeleteSessions(storage SessionStorage, keys []string) error {
+	if batch, ok := storage.(SessionBatchStorage); ok {
+		return batch.DeleteSessions(keys)
+	}
+	return deleteSessionsLoop(storage, keys)
+}
+
+func insertUsersLoop(storage UserStorage, users []*UserModel) error {
+	errs := make(map[int]error)
+	for i, u := range users {
+		if _, err := storage.InsertUser(u); err != nil {
+			errs[i] = err
+		}
+	}
+	return batchErrOrNil(errs)
+}
+
+func updateUsersLoop(storage UserStorage, users []*UserModel, fields []string) error {
+	errs := make(map[int]error)
+	for i, u := range users {
+		if err := storage.UpdateUser(u.ID, u, fields); err != nil {
+			errs[i] = err
+		}
+	}
+	return batchErrOrNil(errs)
+}
+
+func deleteUsersLoop(storage UserStorage, ids []UserID) error {
+	errs := make(map[int]error)
+	for i, id := range ids {
+		if err := storage.DeleteUser(id); err != nil {
+			errs[i] = err
+		}
+	}
+	return batchErrOrNil(errs)
+}
+
+func deleteSessionsLoop(storage SessionStorage, keys []string) error {
+	errs := make(map[int]error)
+	for i, key := range keys {
+		if err := storage.DeleteSession(key); err != nil {
+			errs[i] = err
+		}
+	}
+	return batchErrOrNil(errs)
+}
@@ -0,0 +1,229 @@
+// Copyright 2019 Fabian Wenzelmann
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gopherbouncedb
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// PasswordBlocklist is a list of passwords that must not be used, for example
+// passwords from known breaches.
+//
+// It works completely offline: The passwords are loaded once from local files
+// (plain text or SHA-1 hashes in the format used by Have I Been Pwned) and then
+// stored as a sorted array of hash prefixes.
+// For each password only the first 8 bytes of its SHA-1 hash are stored, so each
+// entry requires 8 bytes of memory.
+// The probability of a false positive is negligible (about n / 2^64 for n entries).
+//
+// The Add methods are not safe to be called concurrently, Contains and Verifier are
+// safe to be called concurrently once all passwords were added.
+type PasswordBlocklist struct {
+	hashes []uint64
+}
+
+// NewPasswordBlocklist returns a new empty blocklist.
+func NewPasswordBlocklist() *PasswordBlocklist {
+	return &PasswordBlocklist{hashes: make([]uint64, 0)}
+}
+
+// NewCommonPasswordBlocklist returns a blocklist that contains the first n entries
+// from CommonPasswords.
+// If n < 0 or n is greater than the number of entries all entries are added.
+func NewCommonPasswordBlocklist(n int) *PasswordBlocklist {
+	if n < 0 || n > len(CommonPasswords) {
+		n = len(CommonPasswords)
+	}
+	res := NewPasswordBlocklist()
+	res.AddPasswords(CommonPasswords[:n]...)
+	return res
+}
+
+func blocklistKey(pw string) uint64 {
+	sum := sha1.Sum([]byte(pw))
+	return binary.BigEndian.Uint64(sum[:8])
+}
+
+// parseHexKey parses the first 16 hex digits of a SHA-1 hash.
+func parseHexKey(hash string) (uint64, error) {
+	if len(hash) != 2*sha1.Size {
+		return 0, fmt.Errorf("invalid SHA-1 hash \"%s\": must be of length %d", hash, 2*sha1.Size)
+	}
+	return strconv.ParseUint(hash[:16], 16, 64)
+}
+
+// Len returns the number of entries in the blocklist.
+func (l *PasswordBlocklist) Len() int {
+	return len(l.hashes)
+}
+
+// compact sorts the hashes and removes duplicates.
+func (l *PasswordBlocklist) compact() {
+	sort.Slice(l.hashes, func(i, j int) bool {
+		return l.hashes[i] < l.hashes[j]
+	})
+	if len(l.hashes) == 0 {
+		return
+	}
+	n := 1
+	for i := 1; i < len(l.hashes); i++ {
+		if l.hashes[i] != l.hashes[n-1] {
+			l.hashes[n] = l.hashes[i]
+			n++
+		}
+	}
+	l.hashes = l.hashes[:n]
+}
+
+// AddPasswords adds the clear text passwords to the blocklist.
+func (l *PasswordBlocklist) AddPasswords(passwords ...string) {
+	for _, pw := range passwords {
+		l.hashes = append(l.hashes, blocklistKey(pw))
+	}
+	l.compact()
+}
+
+// AddPlain adds all passwords from r, r must contain one clear text password
+// per line.
+// Empty lines are ignored.
+func (l *PasswordBlocklist) AddPlain(r io.Reader) error {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		pw := strings.TrimRight(scanner.Text(), "\r")
+		if pw == "" {
+			continue
+		}
+		l.hashes = append(l.hashes, blocklistKey(pw))
+	}
+	l.compact()
+	return scanner.Err()
+}
+
+// parseHIBPLine parses a line of the form "HASH:COUNT" (count is optional) and
+// returns the hash and the count (-1 if not given).
+func parseHIBPLine(line string) (string, int, error) {
+	hash, countStr := line, ""
+	if colon := strings.IndexByte(line, ':'); colon >= 0 {
+		hash, countStr = line[:colon], strings.TrimSpace(line[colon+1:])
+	}
+	if countStr == "" {
+		return hash, -1, nil
+	}
+	count, countErr := strconv.Atoi(countStr)
+	if countErr != nil {
+		return "", 0, fmt.Errorf("invalid count in line \"%s\": %w", line, countErr)
+	}
+	return hash, count, nil
+}
+
+// AddHIBP adds all hashes from r. Each line must be of the form "HASH:COUNT" where
+// HASH is the SHA-1 hash of the password in hex and COUNT the number of times it
+// was found in breaches (this is the format of the Have I Been Pwned downloads).
+// The count is optional, only entries with a count ≥ minCount are added (entries
+// without count are always added).
+//
+// If an error is returned no entries from r were added.
+func (l *PasswordBlocklist) AddHIBP(r io.Reader, minCount int) error {
+	return l.addHIBP("", r, minCount)
+}
+
+// AddHIBPRange works as AddHIBP but reads a file in the range format: prefix is the
+// first five hex digits of the hashes and each line only contains the remaining 35
+// digits (as returned by the range API of Have I Been Pwned).
+func (l *PasswordBlocklist) AddHIBPRange(prefix string, r io.Reader, minCount int) error {
+	if len(prefix) != 5 {
+		return fmt.Errorf("invalid hash prefix \"%s\": must be of length 5", prefix)
+	}
+	return l.addHIBP(prefix, r, minCount)
+}
+
+func (l *PasswordBlocklist) addHIBP(prefix string, r io.Reader, minCount int) error {
+	scanner := bufio.NewScanner(r)
+	added := make([]uint64, 0)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		hash, count, lineErr := parseHIBPLine(line)
+		if lineErr != nil {
+			return lineErr
+		}
+		if count >= 0 && count < minCount {
+			continue
+		}
+		key, keyErr := parseHexKey(prefix + hash)
+		if keyErr != nil {
+			return keyErr
+		}
+		added = append(added, key)
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	l.hashes = append(l.hashes, added...)
+	l.compact()
+	return nil
+}
+
+// Contains returns true if the password is in the blocklist.
+func (l *PasswordBlocklist) Contains(pw string) bool {
+	key := blocklistKey(pw)
+	i := sort.Search(len(l.hashes), func(i int) bool {
+		return l.hashes[i] >= key
+	})
+	return i < len(l.hashes) && l.hashes[i] == key
+}
+
+// Verifier returns a PasswordVerifier that returns true iff the password is not
+// contained in the blocklist.
+func (l *PasswordBlocklist) Verifier() PasswordVerifier {
+	return func(pw string) bool {
+		return !l.Contains(pw)
+	}
+}
+
+// CommonPasswords is a list of commonly used passwords, ordered by how common they
+// are.
+var CommonPasswords = []string{
+	"123456", "password", "12345678", "qwerty", "123456789", "12345", "1234",
+	"111111", "1234567", "dragon", "123123", "baseball", "abc123", "football",
+	"monkey", "letmein", "696969", "shadow", "master", "666666", "qwertyuiop",
+	"123321", "mustang", "1234567890", "michael", "654321", "superman",
+	"1qaz2wsx", "7777777", "121212", "000000", "qazwsx", "123qwe", "killer",
+	"trustno1", "jordan", "jennifer", "zxcvbnm", "asdfgh", "hunter", "buster",
+	"soccer", "harley", "batman", "andrew", "tigger", "sunshine", "iloveyou",
+	"2000", "charlie", "robert", "thomas", "hockey", "ranger", "daniel",
+	"starwars", "klaster", "112233", "george", "computer", "michelle",
+	"jessica", "pepper", "1111", "zxcvbn", "555555", "11111111", "131313",
+	"freedom", "777777", "pass", "maggie", "159753", "aaaaaa", "ginger",
+	"princess", "joshua", "cheese", "amanda", "summer", "love", "ashley",
+	"nicole", "chelsea", "biteme", "matthew", "access", "yankees", "987654321",
+	"dallas", "austin", "thunder", "taylor", "matrix", "welcome",
+	"password1", "Password1", "passw0rd", "p@ssw0rd", "admin", "root",
+	"login", "secret", "qwerty123", "1q2w3e4r", "1q2w3e", "qwe123",
+	"abcd1234", "letmein1", "welcome1", "changeme", "default", "guest",
+	"test", "test123", "user", "hello", "hello123", "google", "internet",
+	"whatever", "starwars1", "asdf1234", "asdfasdf", "zaq12wsx", "Passw0rd",
+	"Password123", "password123", "qwertz", "123abc", "football1",
+	"baseball1", "iloveyou1", "princess1", "sunshine1", "master1",
+}
@@ -0,0 +1,329 @@
+// Copyright 2019 Fabian Wenzelmann
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gopherbouncedb
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// TimeCodec is the part of SQLBridge that converts time.Time values, see SQLBridge
+// for the documentation of the methods.
+//
+// The codecs in this file can be combined with a DuplicateDetector to a SQLBridge
+// with NewComposedBridge.
+// All codecs return times in UTC.
+type TimeCodec interface {
+	TimeScanType() interface{}
+	ConvertTimeScanType(val interface{}) (time.Time, error)
+	ConvertTime(t time.Time) interface{}
+}
+
+// DuplicateDetector returns true if err was caused by a duplicate key.
+type DuplicateDetector func(err error) bool
+
+// ComposedBridge is a SQLBridge composed of a TimeCodec and DuplicateDetectors.
+type ComposedBridge struct {
+	TimeCodec
+	// DuplicateInsert is used by IsDuplicateInsert, if it is nil no error is a
+	// duplicate error.
+	DuplicateInsert DuplicateDetector
+	// DuplicateUpdate is used by IsDuplicateUpdate, if it is nil DuplicateInsert is
+	// used.
+	DuplicateUpdate DuplicateDetector
+}
+
+// NewComposedBridge returns a new bridge that uses duplicate for inserts and updates.
+func NewComposedBridge(codec TimeCodec, duplicate DuplicateDetector) ComposedBridge {
+	return ComposedBridge{TimeCodec: codec, DuplicateInsert: duplicate}
+}
+
+// IsDuplicateInsert calls DuplicateInsert.
+func (b ComposedBridge) IsDuplicateInsert(err error) bool {
+	return b.DuplicateInsert != nil && b.DuplicateInsert(err)
+}
+
+// IsDuplicateUpdate calls DuplicateUpdate (or DuplicateInsert if it is nil).
+func (b ComposedBridge) IsDuplicateUpdate(err error) bool {
+	if b.DuplicateUpdate != nil {
+		return b.DuplicateUpdate(err)
+	}
+	return b.IsDuplicateInsert(err)
+}
+
+// scanTypeErr returns the error for a value that is not of the expected scan type.
+func scanTypeErr(expected string, val interface{}) error {
+	return fmt.Errorf("expected value of type %s, got %v", expected, reflect.TypeOf(val))
+}
+
+// NativeTime is a TimeCodec for drivers that support time.Time directly.
+type NativeTime struct{}
+
+// TimeScanType returns a *time.Time.
+func (NativeTime) TimeScanType() interface{} {
+	return new(time.Time)
+}
+
+// ConvertTimeScanType returns the time in UTC.
+func (NativeTime) ConvertTimeScanType(val interface{}) (time.Time, error) {
+	t, ok := val.(*time.Time)
+	if !ok {
+		return time.Time{}, scanTypeErr("*time.Time", val)
+	}
+	return t.UTC(), nil
+}
+
+// ConvertTime returns the time in UTC.
+func (NativeTime) ConvertTime(t time.Time) interface{} {
+	return t.UTC()
+}
+
+// SortableRFC3339Nano is the layout used by TextTime.
+// It's RFC 3339 with nanoseconds, but in contrast to time.RFC3339Nano trailing
+// zeros are not removed. Because times are formatted in UTC all values have the
+// same length and the lexicographic order is the temporal order (for years
+// 0 - 9999), which is required for comparisons in queries.
+const SortableRFC3339Nano = "2006-01-02T15:04:05.000000000Z07:00"
+
+// TextTime is a TimeCodec that stores times as text in the SortableRFC3339Nano
+// format, all RFC 3339 times are accepted when scanning.
+type TextTime struct{}
+
+// TimeScanType returns a *string.
+func (TextTime) TimeScanType() interface{} {
+	return new(string)
+}
+
+// ConvertTimeScanType parses the time.
+func (TextTime) ConvertTimeScanType(val interface{}) (time.Time, error) {
+	s, ok := val.(*string)
+	if !ok {
+		return time.Time{}, scanTypeErr("*string", val)
+	}
+	t, err := time.Parse(time.RFC3339Nano, *s)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid time stored in database: %w", err)
+	}
+	return t.UTC(), nil
+}
+
+// ConvertTime formats the time in UTC.
+func (TextTime) ConvertTime(t time.Time) interface{} {
+	return t.UTC().Format(SortableRFC3339Nano)
+}
+
+// UnixTime is a TimeCodec that stores times as integers, the number of Units since
+// January 1, 1970 UTC. Fractions of Unit are lost.
+type UnixTime struct {
+	Unit time.Duration
+}
+
+// NewUnixSeconds returns a UnixTime that stores seconds.
+func NewUnixSeconds() UnixTime {
+	return UnixTime{Unit: time.Second}
+}
+
+// NewUnixMillis returns a UnixTime that stores milliseconds.
+func NewUnixMillis() UnixTime {
+	return UnixTime{Unit: time.Millisecond}
+}
+
+// perSecond returns the number of units in a second.
+func (c UnixTime) perSecond() int64 {
+	return int64(time.Second / c.Unit)
+}
+
+// TimeScanType returns an *int64.
+func (c UnixTime) TimeScanType() interface{} {
+	return new(int64)
+}
+
+// ConvertTimeScanType converts the integer to a time in UTC.
+func (c UnixTime) ConvertTimeScanType(val interface{}) (time.Time, error) {
+	v, ok := val.(*int64)
+	if !ok {
+		return time.Time{}, scanTypeErr("*int64", val)
+	}
+	perSecond := c.perSecond()
+	sec, rem := *v/perSecond, *v%perSecond
+	if rem < 0 {
+		sec, rem = sec-1, rem+perSecond
+	}
+	return time.Unix(sec, rem*int64(c.Unit)).UTC(), nil
+}
+
+// ConvertTime returns the time as an int64.
+// It doesn't overflow for the zero time (in contrast to time.UnixNano).
+func (c UnixTime) ConvertTime(t time.Time) interface{} {
+	return t.Unix()*c.perSecond() + int64(t.Nanosecond())/int64(c.Unit)
+}
+
+// NullTime is a TimeCodec for drivers that support time.Time that stores the zero
+// time as NULL.
+// It's useful for columns that are NULL if the event didn't happen yet (for example
+// the last login of a user that never logged in).
+type NullTime struct{}
+
+// TimeScanType returns a *sql.NullTime.
+func (NullTime) TimeScanType() interface{} {
+	return new(sql.NullTime)
+}
+
+// ConvertTimeScanType returns the zero time for NULL and the time in UTC otherwise.
+func (NullTime) ConvertTimeScanType(val interface{}) (time.Time, error) {
+	t, ok := val.(*sql.NullTime)
+	if !ok {
+		return time.Time{}, scanTypeErr("*sql.NullTime", val)
+	}
+	if !t.Valid {
+		return time.Time{}, nil
+	}
+	return t.Time.UTC(), nil
+}
+
+// ConvertTime returns nil (NULL) for the zero time and the time in UTC otherwise.
+func (NullTime) ConvertTime(t time.Time) interface{} {
+	if t.IsZero() {
+		return nil
+	}
+	return t.UTC()
+}
+
+// sqlStateErr is implemented by errors with a SQLSTATE, for example the errors of
+// the Postgres drivers lib/pq and pgx.
+type sqlStateErr interface {
+	error
+	SQLState() string
+}
+
+// DuplicateBySQLState returns a DuplicateDetector for errors that have a method
+// SQLState() string, it returns true if the state is one of codes.
+// For example for Postgres the code is "23505".
+func DuplicateBySQLState(codes ...string) DuplicateDetector {
+	return func(err error) bool {
+		var stateErr sqlStateErr
+		if !errors.As(err, &stateErr) {
+			return false
+		}
+		state := stateErr.SQLState()
+		for _, code := range codes {
+			if state == code {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// DuplicateByMessage returns a DuplicateDetector that returns true if the error
+// message contains one of the substrings, for example "UNIQUE constraint failed"
+// (SQLite) or "Duplicate entry" (MySQL).
+// This should only be used if the driver doesn't provide error codes.
+func DuplicateByMessage(substrings ...string) DuplicateDetector {
+	return func(err error) bool {
+		if err == nil {
+			return false
+		}
+		msg := err.Error()
+		for _, s := range substrings {
+			if strings.Contains(msg, s) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// AnyDuplicate returns a DuplicateDetector that returns true if one of the detectors
+// returns true.
+func AnyDuplicate(detectors ...DuplicateDetector) DuplicateDetector {
+	return func(err error) bool {
+		for _, detector := range detectors {
+			if detector(err) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// nullableScan wraps a value from TimeScanType s.t. NULL can be scanned, NULL is
+// converted to the zero time.
+// This way bridges that don't support NULL (for example NativeTime) can be used for
+// nullable columns.
+type nullableScan struct {
+	dest  interface{}
+	valid bool
+}
+
+// newNullableScan returns a nullableScan for a new value from TimeScanType.
+func newNullableScan(codec TimeCodec) *nullableScan {
+	return &nullableScan{dest: codec.TimeScanType()}
+}
+
+// Scan implements sql.Scanner.
+func (n *nullableScan) Scan(src interface{}) error {
+	n.valid = src != nil
+	if !n.valid {
+		return nil
+	}
+	return assignValue(n.dest, src)
+}
+
+// convert returns the zero time for NULL and ConvertTimeScanType otherwise.
+func (n *nullableScan) convert(codec TimeCodec) (time.Time, error) {
+	if !n.valid {
+		return time.Time{}, nil
+	}
+	return codec.ConvertTimeScanType(n.dest)
+}
+
+// assignValue assigns the value src from a driver to dest, a value from
+// TimeScanType. The conversions are done by the sql.Null* types, thus they're the
+// same as in Rows.Scan.
+func assignValue(dest, src interface{}) error {
+	switch d := dest.(type) {
+	case sql.Scanner:
+		return d.Scan(src)
+	case *interface{}:
+		// the driver may reuse the slice
+		if b, ok := src.([]byte); ok {
+			src = append([]byte(nil), b...)
+		}
+		*d = src
+		return nil
+	case *time.Time:
+		var v sql.NullTime
+		err := v.Scan(src)
+		*d = v.Time
+		return err
+	case *string:
+		var v sql.NullString
+		err := v.Scan(src)
+		*d = v.String
+		return err
+	case *int64:
+		var v sql.NullInt64
+		err := v.Scan(src)
+		*d = v.Int64
+		return err
+	default:
+		return fmt.Errorf("unsupported Scan, storing driver value of type %T into type %T", src, dest)
+	}
+}
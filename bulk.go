@@ -0,0 +1,501 @@
+// Copyright 2019 Fabian Wenzelmann
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gopherbouncedb
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// UserFormat is a file format for exporting and importing users.
+type UserFormat int
+
+const (
+	// JSONLines is the JSON Lines format: One JSON object per line.
+	JSONLines UserFormat = iota
+	// CSV is the CSV format with a header line containing the column names.
+	CSV
+)
+
+func (f UserFormat) String() string {
+	switch f {
+	case JSONLines:
+		return "jsonl"
+	case CSV:
+		return "csv"
+	default:
+		return fmt.Sprintf("UserFormat(%d)", int(f))
+	}
+}
+
+// ParseUserFormat parses "jsonl" or "csv" (case insensitive).
+func ParseUserFormat(s string) (UserFormat, error) {
+	switch strings.ToLower(s) {
+	case "jsonl":
+		return JSONLines, nil
+	case "csv":
+		return CSV, nil
+	default:
+		return -1, fmt.Errorf("unknown user format \"%s\"", s)
+	}
+}
+
+// UserExportColumns are the names of the fields in exported files (the JSON keys or
+// the CSV columns), the names are the column names from DefaultUserRowNames.
+//
+// Times are formatted according to RFC 3339 (with nanoseconds) in UTC, a zero time
+// (for example LastLogin if the user never logged in) is written as
+// "0001-01-01T00:00:00Z".
+// When importing an empty string is also read as the zero time.
+var UserExportColumns = []string{
+	"id", "username", "password", "email", "first_name", "last_name",
+	"is_superuser", "is_staff", "is_active",
+	"date_joined", "last_login", "password_changed_at", "must_change_password",
+}
+
+// userRecord is the representation of a UserModel in exported files.
+type userRecord struct {
+	ID                 UserID `json:"id"`
+	Username           string `json:"username"`
+	Password           string `json:"password"`
+	EMail              string `json:"email"`
+	FirstName          string `json:"first_name"`
+	LastName           string `json:"last_name"`
+	IsSuperUser        bool   `json:"is_superuser"`
+	IsStaff            bool   `json:"is_staff"`
+	IsActive           bool   `json:"is_active"`
+	DateJoined         string `json:"date_joined"`
+	LastLogin          string `json:"last_login"`
+	PasswordChangedAt  string `json:"password_changed_at"`
+	MustChangePassword bool   `json:"must_change_password"`
+}
+
+func formatExportTime(t time.Time) string {
+	return t.UTC().Format(time.RFC3339Nano)
+}
+
+func parseExportTime(s string) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	t, err := time.Parse(time.RFC3339Nano, s)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return t.UTC(), nil
+}
+
+func newUserRecord(u *UserModel) *userRecord {
+	return &userRecord{
+		ID:                 u.ID,
+		Username:           u.Username,
+		Password:           u.Password,
+		EMail:              u.EMail,
+		FirstName:          u.FirstName,
+		LastName:           u.LastName,
+		IsSuperUser:        u.IsSuperUser,
+		IsStaff:            u.IsStaff,
+		IsActive:           u.IsActive,
+		DateJoined:         formatExportTime(u.DateJoined),
+		LastLogin:          formatExportTime(u.LastLogin),
+		PasswordChangedAt:  formatExportTime(u.PasswordChangedAt),
+		MustChangePassword: u.MustChangePassword,
+	}
+}
+
+func (r *userRecord) toUser() (*UserModel, error) {
+	u := &UserModel{
+		ID:                 r.ID,
+		Username:           r.Username,
+		Password:           r.Password,
+		EMail:              r.EMail,
+		FirstName:          r.FirstName,
+		LastName:           r.LastName,
+		IsSuperUser:        r.IsSuperUser,
+		IsStaff:            r.IsStaff,
+		IsActive:           r.IsActive,
+		MustChangePassword: r.MustChangePassword,
+	}
+	var err error
+	if u.DateJoined, err = parseExportTime(r.DateJoined); err != nil {
+		return nil, fmt.Errorf("invalid date_joined: %w", err)
+	}
+	if u.LastLogin, err = parseExportTime(r.LastLogin); err != nil {
+		return nil, fmt.Errorf("invalid last_login: %w", err)
+	}
+	if u.PasswordChangedAt, err = parseExportTime(r.PasswordChangedAt); err != nil {
+		return nil, fmt.Errorf("invalid password_changed_at: %w", err)
+	}
+	return u, nil
+}
+
+// csvValues returns the values in the order of UserExportColumns.
+func (r *userRecord) csvValues() []string {
+	return []string{
+		strconv.FormatInt(int64(r.ID), 10), r.Username, r.Password, r.EMail,
+		r.FirstName, r.LastName,
+		strconv.FormatBool(r.IsSuperUser), strconv.FormatBool(r.IsStaff),
+		strconv.FormatBool(r.IsActive),
+		r.DateJoined, r.LastLogin, r.PasswordChangedAt,
+		strconv.FormatBool(r.MustChangePassword),
+	}
+}
+
+func (r *userRecord) setCSVValue(column, value string) error {
+	var err error
+	parseBool := func(dst *bool) {
+		if value == "" {
+			*dst = false
+			return
+		}
+		*dst, err = strconv.ParseBool(value)
+	}
+	switch column {
+	case "id":
+		if value != "" {
+			var id int64
+			id, err = strconv.ParseInt(value, 10, 64)
+			r.ID = UserID(id)
+		}
+	case "username":
+		r.Username = value
+	case "password":
+		r.Password = value
+	case "email":
+		r.EMail = value
+	case "first_name":
+		r.FirstName = value
+	case "last_name":
+		r.LastName = value
+	case "is_superuser":
+		parseBool(&r.IsSuperUser)
+	case "is_staff":
+		parseBool(&r.IsStaff)
+	case "is_active":
+		parseBool(&r.IsActive)
+	case "date_joined":
+		r.DateJoined = value
+	case "last_login":
+		r.LastLogin = value
+	case "password_changed_at":
+		r.PasswordChangedAt = value
+	case "must_change_password":
+		parseBool(&r.MustChangePassword)
+	default:
+		return fmt.Errorf("unknown column \"%s\"", column)
+	}
+	if err != nil {
+		return fmt.Errorf("invalid value for %s: %w", column, err)
+	}
+	return nil
+}
+
+// ExportUsers writes all users from the storage to w and returns the number of
+// exported users.
+// See UserExportColumns for the schema.
+func ExportUsers(storage UserStorage, w io.Writer, format UserFormat) (int, error) {
+	it, err := storage.ListUsers()
+	if err != nil {
+		return 0, err
+	}
+	defer it.Close()
+	var write func(r *userRecord) error
+	var flush func() error
+	switch format {
+	case JSONLines:
+		buf := bufio.NewWriter(w)
+		enc := json.NewEncoder(buf)
+		write = func(r *userRecord) error {
+			return enc.Encode(r)
+		}
+		flush = buf.Flush
+	case CSV:
+		csvWriter := csv.NewWriter(w)
+		if err := csvWriter.Write(UserExportColumns); err != nil {
+			return 0, err
+		}
+		write = func(r *userRecord) error {
+			return csvWriter.Write(r.csvValues())
+		}
+		flush = func() error {
+			csvWriter.Flush()
+			return csvWriter.Error()
+		}
+	default:
+		return 0, fmt.Errorf("unsupported user format %v", format)
+	}
+	n := 0
+	for it.HasNext() {
+		u, nextErr := it.Next()
+		if nextErr != nil {
+			return n, nextErr
+		}
+		if writeErr := write(newUserRecord(u)); writeErr != nil {
+			return n, writeErr
+		}
+		n++
+	}
+	if err := it.Err(); err != nil {
+		return n, err
+	}
+	return n, flush()
+}
+
+// userReader reads users from an exported file, it returns io.EOF after the last
+// user.
+type userReader func() (*UserModel, error)
+
+func newJSONLinesReader(r io.Reader) userReader {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	line := 0
+	return func() (*UserModel, error) {
+		for scanner.Scan() {
+			line++
+			text := strings.TrimSpace(scanner.Text())
+			if text == "" {
+				continue
+			}
+			var record userRecord
+			dec := json.NewDecoder(strings.NewReader(text))
+			dec.DisallowUnknownFields()
+			if err := dec.Decode(&record); err != nil {
+				return nil, fmt.Errorf("line %d: %w", line, err)
+			}
+			u, err := record.toUser()
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %w", line, err)
+			}
+			return u, nil
+		}
+		if err := scanner.Err(); err != nil {
+			return nil, err
+		}
+		return nil, io.EOF
+	}
+}
+
+// newCSVReader reads a CSV file, the first line must contain the column names.
+// Not all columns must be given, missing columns are set to their zero value.
+func newCSVReader(r io.Reader) userReader {
+	csvReader := csv.NewReader(r)
+	var header []string
+	return func() (*UserModel, error) {
+		if header == nil {
+			var err error
+			if header, err = csvReader.Read(); err != nil {
+				if err == io.EOF {
+					return nil, errors.New("csv file has no header")
+				}
+				return nil, err
+			}
+		}
+		values, err := csvReader.Read()
+		if err != nil {
+			return nil, err
+		}
+		var record userRecord
+		for i, column := range header {
+			if setErr := record.setCSVValue(column, values[i]); setErr != nil {
+				line, _ := csvReader.FieldPos(i)
+				return nil, fmt.Errorf("line %d: %w", line, setErr)
+			}
+		}
+		u, err := record.toUser()
+		if err != nil {
+			line, _ := csvReader.FieldPos(0)
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		return u, nil
+	}
+}
+
+// ConflictStrategy defines what happens on an import if a user already exists
+// (InsertUser returns UserExists).
+type ConflictStrategy int
+
+const (
+	// ConflictFail stops the import and returns the UserExists error.
+	ConflictFail ConflictStrategy = iota
+	// ConflictSkip keeps the existing user.
+	ConflictSkip
+	// ConflictOverwrite overwrites the existing user (found by username, then by
+	// email) with the imported user.
+	ConflictOverwrite
+)
+
+// DefaultImportBatchSize is the default number of users inserted at once.
+const DefaultImportBatchSize = 100
+
+// ImportOptions are the options for ImportUsers.
+//
+// BatchSize is the number of users that are inserted at once (defaults to
+// DefaultImportBatchSize), Progress (if not nil) is called after each batch.
+type ImportOptions struct {
+	Conflict  ConflictStrategy
+	BatchSize int
+	Progress  func(progress ImportProgress)
+}
+
+// ImportProgress is the progress (and the final result) of an import.
+// Processed is the number of users read, Inserted, Updated and Skipped the number
+// of users that were inserted, overwritten or skipped because of conflicts.
+type ImportProgress struct {
+	Processed, Inserted, Updated, Skipped int
+}
+
+// UserBatchImporter is implemented by storages that can insert multiple users in a
+// single transaction.
+//
+// ImportUserBatch inserts all users, in contrast to InsertUser all fields (except ID)
+// are stored as given, including DateJoined, LastLogin and PasswordChangedAt.
+// The ID of each user is set to the new id.
+// If an insert fails no user is inserted and the error is returned (UserExists if
+// the user already exists).
+type UserBatchImporter interface {
+	ImportUserBatch(users []*UserModel) error
+}
+
+// storeAllFields updates all fields of the user including PasswordChangedAt and
+// MustChangePassword, which UpdateUser normally changes if the password changes.
+func storeAllFields(storage UserStorage, id UserID, u *UserModel) error {
+	changedAt, mustChange := u.PasswordChangedAt, u.MustChangePassword
+	u.ID = id
+	if err := storage.UpdateUser(id, u, nil); err != nil {
+		return err
+	}
+	u.PasswordChangedAt, u.MustChangePassword = changedAt, mustChange
+	return storage.UpdateUser(id, u, []string{"PasswordChangedAt", "MustChangePassword"})
+}
+
+// ImportUsers reads users written by ExportUsers from r and adds them to the
+// storage.
+// The IDs from the file are ignored, the users get new ids from the storage.
+// All other fields are imported as they are.
+//
+// The users are inserted in batches, if the storage implements UserBatchImporter
+// each batch is inserted in a single transaction.
+// If a batch contains a conflict it is inserted user by user and the conflict is
+// handled as defined in options.Conflict.
+//
+// The returned progress contains the users imported until an error occurred.
+func ImportUsers(storage UserStorage, r io.Reader, format UserFormat, options ImportOptions) (ImportProgress, error) {
+	var progress ImportProgress
+	var read userReader
+	switch format {
+	case JSONLines:
+		read = newJSONLinesReader(r)
+	case CSV:
+		read = newCSVReader(r)
+	default:
+		return progress, fmt.Errorf("unsupported user format %v", format)
+	}
+	batchSize := options.BatchSize
+	if batchSize <= 0 {
+		batchSize = DefaultImportBatchSize
+	}
+	batch := make([]*UserModel, 0, batchSize)
+	for {
+		u, readErr := read()
+		if readErr != nil && readErr != io.EOF {
+			return progress, readErr
+		}
+		if u != nil {
+			batch = append(batch, u)
+		}
+		if len(batch) == batchSize || (readErr == io.EOF && len(batch) > 0) {
+			if err := importBatch(storage, batch, options.Conflict, &progress); err != nil {
+				return progress, err
+			}
+			if options.Progress != nil {
+				options.Progress(progress)
+			}
+			batch = batch[:0]
+		}
+		if readErr == io.EOF {
+			return progress, nil
+		}
+	}
+}
+
+func importBatch(storage UserStorage, batch []*UserModel, conflict ConflictStrategy, progress *ImportProgress) error {
+	if batcher, ok := storage.(UserBatchImporter); ok {
+		copies := make([]*UserModel, len(batch))
+		for i, u := range batch {
+			copies[i] = u.Copy()
+		}
+		err := batcher.ImportUserBatch(copies)
+		switch err.(type) {
+		case nil:
+			progress.Processed += len(batch)
+			progress.Inserted += len(batch)
+			return nil
+		case UserExists:
+			// insert one by one
+		default:
+			return err
+		}
+	}
+	for _, u := range batch {
+		if err := importUser(storage, u, conflict, progress); err != nil {
+			return err
+		}
+		progress.Processed++
+	}
+	return nil
+}
+
+func importUser(storage UserStorage, u *UserModel, conflict ConflictStrategy, progress *ImportProgress) error {
+	// InsertUser changes the time fields, so insert a copy
+	id, insertErr := storage.InsertUser(u.Copy())
+	switch insertErr.(type) {
+	case nil:
+		if err := storeAllFields(storage, id, u); err != nil {
+			return err
+		}
+		progress.Inserted++
+		return nil
+	case UserExists:
+	default:
+		return insertErr
+	}
+	switch conflict {
+	case ConflictSkip:
+		progress.Skipped++
+		return nil
+	case ConflictOverwrite:
+		existing, err := storage.GetUserByName(u.Username)
+		if _, noSuchUser := err.(NoSuchUser); noSuchUser {
+			existing, err = storage.GetUserByEmail(u.EMail)
+		}
+		if err != nil {
+			return err
+		}
+		if err := storeAllFields(storage, existing.ID, u); err != nil {
+			return err
+		}
+		progress.Updated++
+		return nil
+	default:
+		return insertErr
+	}
+}
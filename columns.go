@@ -0,0 +1,272 @@
+// Copyright 2019 Fabian Wenzelmann
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gopherbouncedb
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// ExtraColumnType is the type of the values of an ExtraColumn.
+type ExtraColumnType int
+
+const (
+	// ExtraString columns have values of type string.
+	ExtraString ExtraColumnType = iota
+	// ExtraInt columns have values of type int64.
+	ExtraInt
+	// ExtraBool columns have values of type bool.
+	ExtraBool
+	// ExtraTime columns have values of type time.Time, they're converted with the
+	// SQLBridge.
+	ExtraTime
+)
+
+func (t ExtraColumnType) String() string {
+	switch t {
+	case ExtraString:
+		return "string"
+	case ExtraInt:
+		return "int"
+	case ExtraBool:
+		return "bool"
+	case ExtraTime:
+		return "time"
+	default:
+		return fmt.Sprintf("ExtraColumnType(%d)", int(t))
+	}
+}
+
+// ExtraColumn is an additional application column of the users table.
+//
+// The values are stored in UserModel.Extensions with Name as key.
+// Extra columns allow NULL, a missing entry in the extensions is stored as NULL
+// and NULL is scanned as a missing entry.
+//
+// Name can be used as a field in UserStorage.UpdateUser (case insensitive).
+type ExtraColumn struct {
+	// Name is the key in UserModel.Extensions, it must not be the name of a field
+	// of UserModel (case insensitive) and must be unique.
+	Name string
+	// Column is the column name, if empty Name is used.
+	Column string
+	Type   ExtraColumnType
+	// Definition is the type of the column in CREATE TABLE statements, for example
+	// "VARCHAR(20)". If empty the type is taken from the SQLDialect.
+	Definition string
+}
+
+// ColumnName returns the name of the column.
+func (c ExtraColumn) ColumnName() string {
+	if c.Column == "" {
+		return c.Name
+	}
+	return c.Column
+}
+
+// definition returns the type used in CREATE TABLE.
+func (c ExtraColumn) definition(dialect *SQLDialect) string {
+	if c.Definition != "" {
+		return c.Definition
+	}
+	switch c.Type {
+	case ExtraInt:
+		return dialect.IntType
+	case ExtraBool:
+		return dialect.BoolType
+	case ExtraTime:
+		return dialect.TimeType
+	default:
+		return dialect.VarcharType + "(255)"
+	}
+}
+
+// scanType returns the value passed to Scan.
+func (c ExtraColumn) scanType(codec TimeCodec) interface{} {
+	switch c.Type {
+	case ExtraInt:
+		return new(sql.NullInt64)
+	case ExtraBool:
+		return new(sql.NullBool)
+	case ExtraTime:
+		return newNullableScan(codec)
+	default:
+		return new(sql.NullString)
+	}
+}
+
+// setScanned sets the extension for a value from scanType, NULL removes it.
+func (c ExtraColumn) setScanned(ext *UserExtensions, val interface{}, codec TimeCodec) error {
+	switch v := val.(type) {
+	case *sql.NullInt64:
+		if v.Valid {
+			ext.SetInt(c.Name, v.Int64)
+			return nil
+		}
+	case *sql.NullBool:
+		if v.Valid {
+			ext.SetBool(c.Name, v.Bool)
+			return nil
+		}
+	case *nullableScan:
+		if v.valid {
+			t, err := v.convert(codec)
+			if err != nil {
+				return err
+			}
+			ext.SetTime(c.Name, t.UTC())
+			return nil
+		}
+	case *sql.NullString:
+		if v.Valid {
+			ext.SetString(c.Name, v.String)
+			return nil
+		}
+	default:
+		return fmt.Errorf("invalid scan type %T for extra column %s", val, c.Name)
+	}
+	ext.Delete(c.Name)
+	return nil
+}
+
+// arg returns the argument for the extension in inserts and updates, nil if it
+// doesn't exist.
+// An error is returned if the value doesn't have the type of the column.
+func (c ExtraColumn) arg(ext UserExtensions, codec TimeCodec) (interface{}, error) {
+	val, has := ext[c.Name]
+	if !has || val == nil {
+		return nil, nil
+	}
+	var ok bool
+	switch c.Type {
+	case ExtraString:
+		_, ok = val.(string)
+	case ExtraInt:
+		switch i := val.(type) {
+		case int64:
+			ok = true
+		case int:
+			val, ok = int64(i), true
+		}
+	case ExtraBool:
+		_, ok = val.(bool)
+	case ExtraTime:
+		var t time.Time
+		if t, ok = val.(time.Time); ok {
+			val = codec.ConvertTime(t.UTC())
+		}
+	}
+	if !ok {
+		return nil, fmt.Errorf("extra column %s must be of type %s, got type %T", c.Name, c.Type, val)
+	}
+	return val, nil
+}
+
+// checkExtraColumns returns an error if a column has an empty name, a name of a
+// field of UserModel or if two columns have the same name or column name (case
+// insensitive, as the lookups in UpdateUser).
+func checkExtraColumns(columns []ExtraColumn) error {
+	names := make(map[string]struct{}, len(columns))
+	columnNames := make(map[string]struct{}, len(columns))
+	for _, column := range columns {
+		if column.Name == "" {
+			return errors.New("extra column without a name")
+		}
+		if _, err := LookupUserField(column.Name); err == nil {
+			return fmt.Errorf("invalid name for extra column: \"%s\" is a field of UserModel", column.Name)
+		}
+		name, columnName := strings.ToLower(column.Name), strings.ToLower(column.ColumnName())
+		if _, has := names[name]; has {
+			return fmt.Errorf("duplicate extra column name \"%s\"", column.Name)
+		}
+		if _, has := columnNames[columnName]; has {
+			return fmt.Errorf("duplicate extra column \"%s\"", column.ColumnName())
+		}
+		names[name], columnNames[columnName] = struct{}{}, struct{}{}
+	}
+	return nil
+}
+
+// findExtraColumn returns the column with the given name (case insensitive).
+func findExtraColumn(columns []ExtraColumn, name string) (ExtraColumn, bool) {
+	for _, c := range columns {
+		if strings.EqualFold(c.Name, name) {
+			return c, true
+		}
+	}
+	return ExtraColumn{}, false
+}
+
+// SQLTableMapping describes an existing table, it is used by GenerateMappedUserSQL
+// and GenerateMappedSessionSQL.
+// A nil mapping describes the default table.
+type SQLTableMapping struct {
+	// Schema is an optional schema qualifier for the table (for example the
+	// Postgres schema or the attached database in SQLite).
+	Schema string
+	// Table is the name of the table, if empty the default meta variable
+	// ("$USERS_TABLE_NAME$" or "$SESSIONS_TABLE_NAME$") is used.
+	Table string
+	// RowNames maps the fields to the column names, fields not contained in the map
+	// use the default column names (DefaultUserRowNames or DefaultSessionRowNames).
+	RowNames map[string]string
+}
+
+// table returns the table, defaultTable is used if Table is empty.
+func (m *SQLTableMapping) table(defaultTable string) sqlTable {
+	if m == nil {
+		return sqlTable{name: defaultTable}
+	}
+	res := sqlTable{schema: m.Schema, name: m.Table}
+	if res.name == "" {
+		res.name = defaultTable
+	}
+	return res
+}
+
+// rowNames returns the default column names updated with RowNames.
+func (m *SQLTableMapping) rowNames(defaults map[string]string) map[string]string {
+	res := make(map[string]string, len(defaults))
+	for field, row := range defaults {
+		res[field] = row
+	}
+	if m == nil {
+		return res
+	}
+	for field, row := range m.RowNames {
+		res[field] = row
+	}
+	return res
+}
+
+// sqlTable is a table name with an optional schema.
+type sqlTable struct {
+	schema, name string
+}
+
+// qualified returns the table name qualified with the schema.
+func (t sqlTable) qualified() string {
+	return qualify(t.schema, t.name)
+}
+
+func qualify(schema, name string) string {
+	if schema == "" {
+		return name
+	}
+	return schema + "." + name
+}
@@ -0,0 +1,248 @@
+// Copyright 2019 Fabian Wenzelmann
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gopherbouncedb
+
+import (
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"math/big"
+	"strconv"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/pbkdf2"
+)
+
+// The hashers in this file verify (and create) password hashes in the formats used by
+// Django (https://docs.djangoproject.com/en/stable/topics/auth/passwords/).
+// Since UserModel mirrors the Django user model users can be imported from Django
+// with their password hashes.
+// Use DjangoHashers as legacy hashers of an Authenticator, this way the hashes are
+// upgraded to the preferred algorithm on the next successful login.
+
+// DjangoHashers returns hashers for all supported Django formats: pbkdf2_sha256,
+// pbkdf2_sha1, bcrypt_sha256, bcrypt and argon2.
+func DjangoHashers() []PasswordHasher {
+	return []PasswordHasher{
+		NewDjangoPBKDF2Hasher(),
+		&DjangoPBKDF2Hasher{Algorithm: "pbkdf2_sha1", Iterations: DjangoPBKDF2Iterations, SaltLen: 22},
+		NewDjangoBcryptSHA256Hasher(),
+		&DjangoBcryptHasher{Cost: 12},
+		NewDjangoArgon2Hasher(),
+	}
+}
+
+const (
+	// DjangoPBKDF2Iterations is the number of iterations used by Django 5.0.
+	DjangoPBKDF2Iterations = 720000
+
+	djangoSaltChars = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
+)
+
+// djangoSalt returns a random salt as used by Django (letters and digits).
+func djangoSalt(n int) (string, error) {
+	var sb strings.Builder
+	max := big.NewInt(int64(len(djangoSaltChars)))
+	for i := 0; i < n; i++ {
+		idx, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return "", err
+		}
+		sb.WriteByte(djangoSaltChars[idx.Int64()])
+	}
+	return sb.String(), nil
+}
+
+// DjangoPBKDF2Hasher handles Django hashes of the form
+// "pbkdf2_sha256$iterations$salt$hash" (or pbkdf2_sha1).
+// Algorithm must be either "pbkdf2_sha256" or "pbkdf2_sha1".
+type DjangoPBKDF2Hasher struct {
+	Algorithm  string
+	Iterations int
+	SaltLen    int
+}
+
+// NewDjangoPBKDF2Hasher returns a hasher for pbkdf2_sha256 with the same parameters as
+// Django.
+func NewDjangoPBKDF2Hasher() *DjangoPBKDF2Hasher {
+	return &DjangoPBKDF2Hasher{Algorithm: "pbkdf2_sha256", Iterations: DjangoPBKDF2Iterations, SaltLen: 22}
+}
+
+func (h *DjangoPBKDF2Hasher) digest() (func() hash.Hash, int) {
+	if h.Algorithm == "pbkdf2_sha1" {
+		return sha1.New, sha1.Size
+	}
+	return sha256.New, sha256.Size
+}
+
+func (h *DjangoPBKDF2Hasher) encode(password, salt string, iterations int) string {
+	digest, size := h.digest()
+	key := pbkdf2.Key([]byte(password), []byte(salt), iterations, size, digest)
+	return fmt.Sprintf("%s$%d$%s$%s", h.Algorithm, iterations, salt,
+		base64.StdEncoding.EncodeToString(key))
+}
+
+func (h *DjangoPBKDF2Hasher) Hash(password string) (string, error) {
+	salt, err := djangoSalt(h.SaltLen)
+	if err != nil {
+		return "", err
+	}
+	return h.encode(password, salt, h.Iterations), nil
+}
+
+func (h *DjangoPBKDF2Hasher) Matches(hash string) bool {
+	return strings.HasPrefix(hash, h.Algorithm+"$")
+}
+
+func (h *DjangoPBKDF2Hasher) parse(hash string) (iterations int, salt string, err error) {
+	parts := strings.Split(hash, "$")
+	if len(parts) != 4 || parts[0] != h.Algorithm {
+		return 0, "", ErrMalformedHash
+	}
+	iterations, err = strconv.Atoi(parts[1])
+	if err != nil || iterations <= 0 {
+		return 0, "", ErrMalformedHash
+	}
+	return iterations, parts[2], nil
+}
+
+func (h *DjangoPBKDF2Hasher) Verify(password, hash string) (bool, error) {
+	iterations, salt, err := h.parse(hash)
+	if err != nil {
+		return false, err
+	}
+	computed := h.encode(password, salt, iterations)
+	return subtle.ConstantTimeCompare([]byte(computed), []byte(hash)) == 1, nil
+}
+
+func (h *DjangoPBKDF2Hasher) NeedsRehash(hash string) bool {
+	iterations, _, err := h.parse(hash)
+	return err != nil || iterations < h.Iterations
+}
+
+// DjangoBcryptHasher handles Django hashes of the form "bcrypt$<bcrypt hash>" and
+// "bcrypt_sha256$<bcrypt hash>".
+// If SHA256 is true the password is hashed with SHA-256 first (as done by the
+// Django BCryptSHA256PasswordHasher), this way passwords longer than 72 bytes are
+// supported.
+type DjangoBcryptHasher struct {
+	SHA256 bool
+	Cost   int
+}
+
+// NewDjangoBcryptSHA256Hasher returns a hasher for bcrypt_sha256 with the same cost
+// as Django.
+func NewDjangoBcryptSHA256Hasher() *DjangoBcryptHasher {
+	return &DjangoBcryptHasher{SHA256: true, Cost: 12}
+}
+
+func (h *DjangoBcryptHasher) prefix() string {
+	if h.SHA256 {
+		return "bcrypt_sha256$"
+	}
+	return "bcrypt$"
+}
+
+func (h *DjangoBcryptHasher) prepare(password string) string {
+	if !h.SHA256 {
+		return password
+	}
+	sum := sha256.Sum256([]byte(password))
+	return hex.EncodeToString(sum[:])
+}
+
+func (h *DjangoBcryptHasher) Hash(password string) (string, error) {
+	hash, err := (&BcryptHasher{Cost: h.Cost}).Hash(h.prepare(password))
+	if err != nil {
+		return "", err
+	}
+	return h.prefix() + hash, nil
+}
+
+func (h *DjangoBcryptHasher) Matches(hash string) bool {
+	return strings.HasPrefix(hash, h.prefix())
+}
+
+func (h *DjangoBcryptHasher) Verify(password, hash string) (bool, error) {
+	if !h.Matches(hash) {
+		return false, ErrMalformedHash
+	}
+	return (&BcryptHasher{Cost: h.Cost}).Verify(h.prepare(password), strings.TrimPrefix(hash, h.prefix()))
+}
+
+func (h *DjangoBcryptHasher) NeedsRehash(hash string) bool {
+	return !h.Matches(hash) || (&BcryptHasher{Cost: h.Cost}).NeedsRehash(strings.TrimPrefix(hash, h.prefix()))
+}
+
+// DjangoArgon2Hasher handles Django hashes of the form "argon2$argon2id$v=19$...".
+// New hashes are created with argon2id, for verification argon2i hashes (used by
+// older Django versions) are supported as well.
+type DjangoArgon2Hasher struct {
+	Argon2idHasher
+}
+
+// NewDjangoArgon2Hasher returns a hasher with the same parameters as Django.
+func NewDjangoArgon2Hasher() *DjangoArgon2Hasher {
+	return &DjangoArgon2Hasher{
+		Argon2idHasher: Argon2idHasher{Time: 2, Memory: 102400, Threads: 8, SaltLen: 16, KeyLen: 32},
+	}
+}
+
+const djangoArgon2Prefix = "argon2"
+
+func (h *DjangoArgon2Hasher) Hash(password string) (string, error) {
+	hash, err := h.Argon2idHasher.Hash(password)
+	if err != nil {
+		return "", err
+	}
+	return djangoArgon2Prefix + hash, nil
+}
+
+func (h *DjangoArgon2Hasher) Matches(hash string) bool {
+	return strings.HasPrefix(hash, djangoArgon2Prefix+"$argon2")
+}
+
+func (h *DjangoArgon2Hasher) Verify(password, hash string) (bool, error) {
+	if !h.Matches(hash) {
+		return false, ErrMalformedHash
+	}
+	hash = strings.TrimPrefix(hash, djangoArgon2Prefix)
+	if !strings.HasPrefix(hash, "$argon2i$") {
+		return h.Argon2idHasher.Verify(password, hash)
+	}
+	parsed, err := parsePHC(hash)
+	if err != nil {
+		return false, err
+	}
+	t, m, p, err := parsed.argon2Params()
+	if err != nil {
+		return false, err
+	}
+	key := argon2.Key([]byte(password), parsed.salt, t, m, p, uint32(len(parsed.hash)))
+	return subtle.ConstantTimeCompare(key, parsed.hash) == 1, nil
+}
+
+func (h *DjangoArgon2Hasher) NeedsRehash(hash string) bool {
+	if !strings.HasPrefix(hash, djangoArgon2Prefix+"$argon2id$") {
+		return true
+	}
+	return h.Argon2idHasher.NeedsRehash(strings.TrimPrefix(hash, djangoArgon2Prefix))
+}
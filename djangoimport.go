@@ -0,0 +1,453 @@
+// Copyright 2019 Fabian Wenzelmann
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gopherbouncedb
+
+import (
+	"bytes"
+	"compress/zlib"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// DjangoUsersQuery selects all users from a Django auth_user table.
+	// last_login is NULL in Django if the user never logged in, therefore it is
+	// replaced by date_joined and the additional column tells if the value was NULL.
+	DjangoUsersQuery = `SELECT id, password, COALESCE(last_login, date_joined), last_login IS NULL,
+is_superuser, username, first_name, last_name, email, is_staff, is_active, date_joined
+FROM $USERS_TABLE_NAME$ ORDER BY id;`
+
+	// DjangoSessionsQuery selects all sessions from a Django django_session table.
+	DjangoSessionsQuery = `SELECT session_key, session_data, expire_date FROM $DJANGO_SESSION_TABLE_NAME$;`
+)
+
+// DjangoSQLReplacer returns the default SQL replacer extended by the variable
+// "$DJANGO_SESSION_TABLE_NAME$" (defaults to "django_session").
+func DjangoSQLReplacer() *SQLTemplateReplacer {
+	res := DefaultSQLReplacer()
+	res.Set("$DJANGO_SESSION_TABLE_NAME$", "django_session")
+	return res
+}
+
+// DjangoSession is a row from the django_session table.
+type DjangoSession struct {
+	Key        string
+	Data       string
+	ExpireDate time.Time
+}
+
+// User returns the id of the user this session belongs to (the Django user id).
+// If the session is not associated with a user (anonymous session) false is returned.
+// The signature of the session data is not verified.
+func (s *DjangoSession) User() (UserID, bool, error) {
+	values, err := DecodeDjangoSessionData(s.Data)
+	if err != nil {
+		return InvalidUserID, false, err
+	}
+	id, has := values["_auth_user_id"]
+	if !has {
+		return InvalidUserID, false, nil
+	}
+	var idStr string
+	switch v := id.(type) {
+	case string:
+		idStr = v
+	case json.Number:
+		idStr = v.String()
+	default:
+		return InvalidUserID, false, fmt.Errorf("invalid user id in session data: %v", id)
+	}
+	res, parseErr := strconv.ParseInt(idStr, 10, 64)
+	if parseErr != nil {
+		return InvalidUserID, false, fmt.Errorf("invalid user id in session data: %w", parseErr)
+	}
+	return UserID(res), true, nil
+}
+
+// DecodeDjangoSessionData decodes the session_data field of a Django session.
+// It supports the format of Django ≥ 3.1 ("payload:timestamp:signature", the
+// payload possibly compressed) and the legacy format (base64 of "hash:payload").
+// Only the JSON serializer is supported, the signature / hash is not verified.
+func DecodeDjangoSessionData(data string) (map[string]interface{}, error) {
+	var payload []byte
+	if colon := strings.IndexByte(data, ':'); colon >= 0 {
+		encoded := data[:colon]
+		compressed := strings.HasPrefix(encoded, ".")
+		decoded, decodeErr := base64.RawURLEncoding.DecodeString(strings.TrimPrefix(encoded, "."))
+		if decodeErr != nil {
+			return nil, fmt.Errorf("invalid session data: %w", decodeErr)
+		}
+		payload = decoded
+		if compressed {
+			r, zlibErr := zlib.NewReader(bytes.NewReader(decoded))
+			if zlibErr != nil {
+				return nil, fmt.Errorf("invalid session data: %w", zlibErr)
+			}
+			payload, zlibErr = io.ReadAll(r)
+			if zlibErr != nil {
+				return nil, fmt.Errorf("invalid session data: %w", zlibErr)
+			}
+		}
+	} else {
+		decoded, decodeErr := base64.StdEncoding.DecodeString(data)
+		if decodeErr != nil {
+			return nil, fmt.Errorf("invalid session data: %w", decodeErr)
+		}
+		sep := bytes.IndexByte(decoded, ':')
+		if sep < 0 {
+			return nil, errors.New("invalid session data: no hash found")
+		}
+		payload = decoded[sep+1:]
+	}
+	dec := json.NewDecoder(bytes.NewReader(payload))
+	dec.UseNumber()
+	var res map[string]interface{}
+	if err := dec.Decode(&res); err != nil {
+		return nil, fmt.Errorf("invalid session data: %w", err)
+	}
+	return res, nil
+}
+
+// DjangoImportConflict describes a Django user that could not be imported because
+// a user with the same username or email already exists.
+type DjangoImportConflict struct {
+	DjangoID UserID
+	Username string
+	EMail    string
+	Err      UserExists
+}
+
+// DjangoImportResult is the report of an import.
+//
+// IDs maps the Django user ids to the ids of the imported users (in dry-run mode to
+// InvalidUserID).
+// Sessions is the number of imported sessions, SkippedSessions the number of
+// sessions that were not imported because they were expired, anonymous, could not
+// be decoded or belonged to a user that was not imported.
+// SessionErrors contains the errors of the sessions that could not be decoded.
+type DjangoImportResult struct {
+	IDs             map[UserID]UserID
+	Conflicts       []*DjangoImportConflict
+	Sessions        int
+	SkippedSessions int
+	SessionErrors   []error
+}
+
+// NewDjangoImportResult returns a new empty result.
+func NewDjangoImportResult() *DjangoImportResult {
+	return &DjangoImportResult{
+		IDs:           make(map[UserID]UserID),
+		Conflicts:     make([]*DjangoImportConflict, 0),
+		SessionErrors: make([]error, 0),
+	}
+}
+
+// djangoTimeLayouts are the formats in which Django databases return dates if the
+// driver doesn't convert them to time.Time (for example SQLite or MySQL without
+// parseTime). Dates without a zone are in UTC (Django with USE_TZ).
+var djangoTimeLayouts = []string{
+	"2006-01-02 15:04:05.999999999",
+	"2006-01-02 15:04:05.999999999Z07:00",
+	"2006-01-02T15:04:05.999999999",
+	time.RFC3339Nano,
+}
+
+// ParseDjangoTime converts a date read from a Django database to a time.Time.
+// value is the value returned by the driver, either a time.Time or a string / []byte
+// in the format Django stores dates (e.g. "2020-01-02 03:04:05.123456").
+func ParseDjangoTime(value interface{}) (time.Time, error) {
+	var str string
+	switch v := value.(type) {
+	case time.Time:
+		return v.UTC(), nil
+	case string:
+		str = v
+	case []byte:
+		str = string(v)
+	default:
+		return time.Time{}, fmt.Errorf("can't convert %T to a date", value)
+	}
+	for _, layout := range djangoTimeLayouts {
+		if t, err := time.Parse(layout, str); err == nil {
+			return t.UTC(), nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid date %q", str)
+}
+
+// DjangoImporter imports users (and optionally sessions) from the database of a
+// Django project.
+//
+// The users are read from the auth_user table with the query in UsersQuery and
+// inserted into Users.
+// The password hashes are not changed, use DjangoHashers with an Authenticator to
+// verify them.
+// DateJoined and LastLogin are taken from Django (a NULL last_login becomes the zero
+// time), PasswordChangedAt is set to the time of the import.
+// If Users implements UserBatchImporter (as SQLUserStorage does) each user is
+// inserted with all fields in one statement, otherwise the user is inserted with
+// InsertUser and the dates are restored with UpdateUser.
+// Users whose username or email already exist are not imported but reported in the
+// result.
+//
+// If Sessions is not nil all sessions that are not expired and belong to an imported
+// user are inserted into Sessions (with the new user id).
+//
+// The dates are read with ParseTime which defaults to ParseDjangoTime, thus the
+// importer doesn't depend on the format of the target storage.
+//
+// In DryRun mode nothing is written, the result reports what would happen.
+// Conflicts are then detected by looking up username and email in Users, so the dry
+// run assumes that the email is unique.
+type DjangoImporter struct {
+	DB            *sql.DB
+	ParseTime     func(value interface{}) (time.Time, error)
+	UsersQuery    string
+	SessionsQuery string
+	Users         UserStorage
+	Sessions      SessionStorage
+	DryRun        bool
+}
+
+// NewDjangoImporter returns a new importer that reads from the default Django tables
+// (auth_user and django_session). sessions can be nil.
+func NewDjangoImporter(db *sql.DB, users UserStorage, sessions SessionStorage) *DjangoImporter {
+	replacer := DjangoSQLReplacer()
+	return &DjangoImporter{
+		DB:            db,
+		ParseTime:     ParseDjangoTime,
+		UsersQuery:    replacer.Apply(DjangoUsersQuery),
+		SessionsQuery: replacer.Apply(DjangoSessionsQuery),
+		Users:         users,
+		Sessions:      sessions,
+	}
+}
+
+// Import imports all users and (if Sessions is not nil) all sessions.
+// referenceDate is used to skip expired sessions.
+// On an error the result contains everything imported so far.
+func (imp *DjangoImporter) Import(referenceDate time.Time) (*DjangoImportResult, error) {
+	res := NewDjangoImportResult()
+	rows, queryErr := imp.DB.Query(imp.UsersQuery)
+	if queryErr != nil {
+		return res, queryErr
+	}
+	if err := imp.ImportUsersFrom(&djangoUserIterator{rows: rows, parse: imp.parseTime()}, res); err != nil {
+		return res, err
+	}
+	if imp.Sessions == nil {
+		return res, nil
+	}
+	sessions, sessionsErr := imp.readSessions()
+	if sessionsErr != nil {
+		return res, sessionsErr
+	}
+	return res, imp.ImportSessionsFrom(sessions, referenceDate, res)
+}
+
+// ImportUsersFrom imports all users from the iterator and closes it.
+// The ids of the users must be the Django ids, they're added to res.IDs.
+func (imp *DjangoImporter) ImportUsersFrom(it UserIterator, res *DjangoImportResult) error {
+	defer it.Close()
+	// only used in dry-run mode to find conflicts within the import
+	names, mails := make(map[string]struct{}), make(map[string]struct{})
+	for it.HasNext() {
+		u, nextErr := it.Next()
+		if nextErr != nil {
+			return nextErr
+		}
+		djangoID := u.ID
+		var conflict error
+		if imp.DryRun {
+			conflict = imp.checkConflict(u, names, mails)
+		} else {
+			conflict = imp.insert(u)
+		}
+		switch err := conflict.(type) {
+		case nil:
+			res.IDs[djangoID] = u.ID
+		case UserExists:
+			res.Conflicts = append(res.Conflicts, &DjangoImportConflict{
+				DjangoID: djangoID,
+				Username: u.Username,
+				EMail:    u.EMail,
+				Err:      err,
+			})
+		default:
+			return err
+		}
+	}
+	return it.Err()
+}
+
+func (imp *DjangoImporter) checkConflict(u *UserModel, names, mails map[string]struct{}) error {
+	u.ID = InvalidUserID
+	if _, has := names[u.Username]; has {
+		return NewUserExists(fmt.Sprintf("user with name %s already exists", u.Username))
+	}
+	if _, has := mails[u.EMail]; has {
+		return NewUserExists(fmt.Sprintf("user with email %s already exists", u.EMail))
+	}
+	lookups := []struct {
+		lookup func(string) (*UserModel, error)
+		key    string
+	}{
+		{imp.Users.GetUserByName, u.Username},
+		{imp.Users.GetUserByEmail, u.EMail},
+	}
+	for _, l := range lookups {
+		_, err := l.lookup(l.key)
+		switch err.(type) {
+		case nil:
+			return NewUserExists(fmt.Sprintf("user %s already exists", l.key))
+		case NoSuchUser:
+		default:
+			return err
+		}
+	}
+	names[u.Username] = struct{}{}
+	mails[u.EMail] = struct{}{}
+	return nil
+}
+
+func (imp *DjangoImporter) insert(u *UserModel) error {
+	if importer, ok := imp.Users.(UserBatchImporter); ok {
+		u.SetPasswordChanged(time.Now().UTC())
+		return importer.ImportUserBatch([]*UserModel{u})
+	}
+	// InsertUser sets DateJoined and LastLogin, so restore them afterwards
+	dateJoined, lastLogin := u.DateJoined, u.LastLogin
+	id, insertErr := imp.Users.InsertUser(u)
+	if insertErr != nil {
+		return insertErr
+	}
+	u.ID = id
+	u.DateJoined, u.LastLogin = dateJoined, lastLogin
+	return imp.Users.UpdateUser(id, u, []string{"DateJoined", "LastLogin"})
+}
+
+func (imp *DjangoImporter) parseTime() func(interface{}) (time.Time, error) {
+	if imp.ParseTime == nil {
+		return ParseDjangoTime
+	}
+	return imp.ParseTime
+}
+
+func (imp *DjangoImporter) readSessions() ([]*DjangoSession, error) {
+	rows, queryErr := imp.DB.Query(imp.SessionsQuery)
+	if queryErr != nil {
+		return nil, queryErr
+	}
+	defer rows.Close()
+	parse := imp.parseTime()
+	res := make([]*DjangoSession, 0)
+	for rows.Next() {
+		var session DjangoSession
+		var expireDate interface{}
+		if scanErr := rows.Scan(&session.Key, &session.Data, &expireDate); scanErr != nil {
+			return nil, scanErr
+		}
+		ed, edErr := parse(expireDate)
+		if edErr != nil {
+			return nil, edErr
+		}
+		session.ExpireDate = ed
+		res = append(res, &session)
+	}
+	return res, rows.Err()
+}
+
+// ImportSessionsFrom imports the sessions into Sessions, the user ids are translated
+// with res.IDs (thus the users must be imported first).
+// Sessions that can't be decoded are skipped, the error is added to
+// res.SessionErrors.
+func (imp *DjangoImporter) ImportSessionsFrom(sessions []*DjangoSession, referenceDate time.Time, res *DjangoImportResult) error {
+	for _, session := range sessions {
+		if !referenceDate.Before(session.ExpireDate) {
+			res.SkippedSessions++
+			continue
+		}
+		djangoID, hasUser, userErr := session.User()
+		if userErr != nil {
+			res.SkippedSessions++
+			res.SessionErrors = append(res.SessionErrors,
+				fmt.Errorf("can't decode session %s: %w", session.Key, userErr))
+			continue
+		}
+		id, imported := res.IDs[djangoID]
+		if !hasUser || !imported {
+			res.SkippedSessions++
+			continue
+		}
+		if !imp.DryRun {
+			entry := &SessionEntry{Key: session.Key, User: id, ExpireDate: session.ExpireDate}
+			if insertErr := imp.Sessions.InsertSession(entry); insertErr != nil {
+				return insertErr
+			}
+		}
+		res.Sessions++
+	}
+	return nil
+}
+
+// djangoUserIterator reads the rows of DjangoUsersQuery.
+type djangoUserIterator struct {
+	rows  *sql.Rows
+	parse func(interface{}) (time.Time, error)
+}
+
+func (it *djangoUserIterator) HasNext() bool {
+	return it.rows.Next()
+}
+
+func (it *djangoUserIterator) Err() error {
+	return it.rows.Err()
+}
+
+func (it *djangoUserIterator) Close() error {
+	return it.rows.Close()
+}
+
+func (it *djangoUserIterator) Next() (*UserModel, error) {
+	var user UserModel
+	var neverLoggedIn bool
+	var lastLogin, dateJoined interface{}
+	scanErr := it.rows.Scan(&user.ID, &user.Password, &lastLogin, &neverLoggedIn,
+		&user.IsSuperUser, &user.Username, &user.FirstName, &user.LastName, &user.EMail,
+		&user.IsStaff, &user.IsActive, &dateJoined)
+	if scanErr != nil {
+		return nil, scanErr
+	}
+	dj, djErr := it.parse(dateJoined)
+	if djErr != nil {
+		return nil, djErr
+	}
+	user.DateJoined = dj
+	if !neverLoggedIn {
+		ll, llErr := it.parse(lastLogin)
+		if llErr != nil {
+			return nil, llErr
+		}
+		user.LastLogin = ll
+	}
+	return &user, nil
+}
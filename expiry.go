@@ -0,0 +1,193 @@
+// Copyright 2019 Fabian Wenzelmann
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gopherbouncedb
+
+import (
+	"strings"
+	"time"
+)
+
+// PasswordExpiryPolicy decides when the password of a user expires, depending on the
+// role of the user.
+//
+// SuperUserMaxAge is used for super users, StaffMaxAge for staff members that are not
+// super users and UserMaxAge for all other users.
+// A max age ≤ 0 means that the password never expires.
+// Independent of the max age a password with MustChangePassword set is always
+// expired.
+type PasswordExpiryPolicy struct {
+	UserMaxAge      time.Duration
+	StaffMaxAge     time.Duration
+	SuperUserMaxAge time.Duration
+}
+
+// NewStaffPasswordExpiryPolicy returns a policy where the passwords of staff members
+// and super users expire after maxAge, passwords of other users never expire.
+func NewStaffPasswordExpiryPolicy(maxAge time.Duration) *PasswordExpiryPolicy {
+	return &PasswordExpiryPolicy{
+		StaffMaxAge:     maxAge,
+		SuperUserMaxAge: maxAge,
+	}
+}
+
+// MaxAge returns the max age for the user depending on IsSuperUser and IsStaff.
+func (p *PasswordExpiryPolicy) MaxAge(u *UserModel) time.Duration {
+	switch {
+	case u.IsSuperUser:
+		return p.SuperUserMaxAge
+	case u.IsStaff:
+		return p.StaffMaxAge
+	default:
+		return p.UserMaxAge
+	}
+}
+
+// ExpiresAt returns the date the password of the user expires.
+// If the password never expires it returns false.
+func (p *PasswordExpiryPolicy) ExpiresAt(u *UserModel) (time.Time, bool) {
+	maxAge := p.MaxAge(u)
+	if maxAge <= 0 {
+		return time.Time{}, false
+	}
+	return u.PasswordChangedAt.Add(maxAge), true
+}
+
+// IsExpired returns true if the user must change the password, that is if
+// MustChangePassword is set or the password is older than the max age at the
+// reference date.
+func (p *PasswordExpiryPolicy) IsExpired(u *UserModel, referenceDate time.Time) bool {
+	if u.MustChangePassword {
+		return true
+	}
+	expiresAt, expires := p.ExpiresAt(u)
+	return expires && expiresAt.Before(referenceDate)
+}
+
+// Cutoffs returns the dates before which the password was changed to be expired for
+// super users, staff and other users.
+// If the password doesn't expire for a role the zero time is returned.
+// This is useful for database queries.
+func (p *PasswordExpiryPolicy) Cutoffs(referenceDate time.Time) (superUser, staff, user time.Time) {
+	cutoff := func(maxAge time.Duration) time.Time {
+		if maxAge <= 0 {
+			return time.Time{}
+		}
+		return referenceDate.Add(-maxAge)
+	}
+	return cutoff(p.SuperUserMaxAge), cutoff(p.StaffMaxAge), cutoff(p.UserMaxAge)
+}
+
+// hasField returns true if fields explicitly contains the given field (case insensitive).
+func hasField(fields []string, name string) bool {
+	for _, field := range fields {
+		if strings.EqualFold(field, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// touchesPassword returns true if fields explicitly contains the password field.
+func touchesPassword(fields []string) bool {
+	return hasField(fields, "Password")
+}
+
+// SetPasswordChanged sets PasswordChangedAt to the given date and
+// MustChangePassword to false.
+func (u *UserModel) SetPasswordChanged(changedAt time.Time) {
+	u.PasswordChangedAt = changedAt
+	u.MustChangePassword = false
+}
+
+// preparePasswordUpdate is used by the storages in UpdateUser.
+// If the update changes the password it updates the password fields in u and returns
+// the fields to update (including the password fields if fields is not empty).
+// oldPassword is the current password hash, it is only used if fields is empty.
+// If fields explicitly contains PasswordChangedAt the caller manages the password fields
+// and u is not changed.
+func preparePasswordUpdate(u *UserModel, fields []string, oldPassword string) []string {
+	switch {
+	case len(fields) == 0:
+		if u.Password != oldPassword {
+			u.SetPasswordChanged(time.Now().UTC())
+		}
+		return fields
+	case hasField(fields, "PasswordChangedAt"):
+		return fields
+	case touchesPassword(fields):
+		u.SetPasswordChanged(time.Now().UTC())
+		res := make([]string, 0, len(fields)+2)
+		for _, field := range fields {
+			switch strings.ToLower(field) {
+			case "passwordchangedat", "mustchangepassword":
+				continue
+			default:
+				res = append(res, field)
+			}
+		}
+		return append(res, "PasswordChangedAt", "MustChangePassword")
+	default:
+		return fields
+	}
+}
+
+// filterIterator is a UserIterator that only returns the users matching a predicate.
+type filterIterator struct {
+	it   UserIterator
+	pred func(u *UserModel) bool
+	next *UserModel
+	err  error
+}
+
+// FilterUsers returns an iterator that only returns the users from it for which pred
+// returns true.
+// Closing the returned iterator closes it.
+func FilterUsers(it UserIterator, pred func(u *UserModel) bool) UserIterator {
+	return &filterIterator{it: it, pred: pred}
+}
+
+func (f *filterIterator) HasNext() bool {
+	f.next = nil
+	if f.err != nil {
+		return false
+	}
+	for f.it.HasNext() {
+		u, err := f.it.Next()
+		if err != nil {
+			f.err = err
+			return false
+		}
+		if f.pred(u) {
+			f.next = u
+			return true
+		}
+	}
+	return false
+}
+
+func (f *filterIterator) Next() (*UserModel, error) {
+	return f.next, nil
+}
+
+func (f *filterIterator) Err() error {
+	if f.err != nil {
+		return f.err
+	}
+	return f.it.Err()
+}
+
+func (f *filterIterator) Close() error {
+	return f.it.Close()
+}
@@ -0,0 +1,162 @@
+// Copyright 2019 Fabian Wenzelmann
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gopherbouncedb
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// UserField describes a field of UserModel, see UserFields.
+type UserField struct {
+	// Name is the name of the field in UserModel, for example "EMail".
+	Name string
+	// Column is the default column name, see DefaultUserRowNames.
+	Column string
+	// Type is the type of the field.
+	Type reflect.Type
+	// MaxLen is the default maximal length of string fields (see
+	// DefaultUserSchemaLimits), 0 if the length is not limited.
+	MaxLen int
+	// Updatable is false for fields that can't be changed with UpdateUser.
+	Updatable bool
+	// Nullable is true if the zero value may be stored as NULL, see
+	// NullLastLoginSQL.
+	Nullable bool
+	index    int
+}
+
+var (
+	// UserFields contains all fields of UserModel in the order of declaration
+	// (except the Extensions), it is derived from the struct tags of UserModel.
+	// It must not be changed.
+	UserFields = userFields()
+
+	// userFieldsByName maps the lower case names to the fields.
+	userFieldsByName = func() map[string]*UserField {
+		res := make(map[string]*UserField, len(UserFields))
+		for _, field := range UserFields {
+			res[strings.ToLower(field.Name)] = field
+		}
+		return res
+	}()
+)
+
+// userFields parses the struct tags of UserModel.
+func userFields() []*UserField {
+	t := reflect.TypeOf(UserModel{})
+	res := make([]*UserField, 0, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		structField := t.Field(i)
+		tag := strings.Split(structField.Tag.Get(ColumnTag), ",")
+		if tag[0] == "-" {
+			continue
+		}
+		field := &UserField{
+			Name:      structField.Name,
+			Column:    tag[0],
+			Type:      structField.Type,
+			Updatable: true,
+			index:     i,
+		}
+		for _, option := range tag[1:] {
+			switch option {
+			case "readonly":
+				field.Updatable = false
+			case "nullable":
+				field.Nullable = true
+			default:
+				panic(fmt.Sprintf("invalid option \"%s\" for field %s", option, field.Name))
+			}
+		}
+		if maxLen, has := structField.Tag.Lookup("maxlen"); has {
+			var err error
+			if field.MaxLen, err = strconv.Atoi(maxLen); err != nil {
+				panic(fmt.Sprintf("invalid max length for field %s: %s", field.Name, err))
+			}
+		}
+		res = append(res, field)
+	}
+	return res
+}
+
+// userRowNames returns the default column names of the fields.
+func userRowNames() map[string]string {
+	res := make(map[string]string, len(UserFields))
+	for _, field := range UserFields {
+		res[field.Name] = field.Column
+	}
+	return res
+}
+
+// LookupUserField returns the field with the given name (case insensitive).
+// If there is no such field an error is returned.
+func LookupUserField(name string) (*UserField, error) {
+	field, has := userFieldsByName[strings.ToLower(name)]
+	if !has {
+		return nil, fmt.Errorf("invalid field name \"%s\": Must be a valid field name of the user model", name)
+	}
+	return field, nil
+}
+
+// IsTime returns true if the field is of type time.Time.
+func (f *UserField) IsTime() bool {
+	return f.Type == timeType
+}
+
+// MaxLenVar returns the meta variable of the maximal length used in the SQL
+// schema, for example "$USERNAME_MAX_LEN$" for the column "username".
+// If the length is not limited the empty string is returned.
+func (f *UserField) MaxLenVar() string {
+	if f.MaxLen == 0 {
+		return ""
+	}
+	return "$" + strings.ToUpper(f.Column) + "_MAX_LEN$"
+}
+
+// Get returns the value of the field in u.
+func (f *UserField) Get(u *UserModel) interface{} {
+	return reflect.ValueOf(u).Elem().Field(f.index).Interface()
+}
+
+// Set sets the value of the field in u.
+// val must be assignable to the type of the field, integers are converted to
+// UserID. If val has another type an error is returned.
+func (f *UserField) Set(u *UserModel, val interface{}) error {
+	v := reflect.ValueOf(val)
+	dst := reflect.ValueOf(u).Elem().Field(f.index)
+	switch {
+	case v.IsValid() && v.Type().AssignableTo(f.Type):
+		dst.Set(v)
+	case v.IsValid() && f.Type.Kind() == reflect.Int64 && v.CanInt():
+		dst.SetInt(v.Int())
+	default:
+		return fmt.Errorf("field %s must be of type %s, got type %T", f.Name, f.Type, val)
+	}
+	return nil
+}
+
+// Equal returns true if the field has the same value in u and other, times are
+// compared with time.Equal.
+func (f *UserField) Equal(u, other *UserModel) bool {
+	v1, v2 := f.Get(u), f.Get(other)
+	if f.IsTime() {
+		return v1.(time.Time).Equal(v2.(time.Time))
+	}
+	return v1 == v2
+}
@@ -15,6 +15,8 @@
 package gopherbouncedb
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"strings"
 	"time"
@@ -188,7 +190,7 @@ type UserStorage interface {
   // If an user with the given credentials already exists (name or email, depending on which are enforced to be
   // unique) it should return InvalidUserID and an error of type UserExists.
   // The fields DateJoined is set to the current date (in UTC) and LastLogin is set to
-  // the time zero value.
+  // the time zero value. PasswordChangedAt is set to the same date as DateJoined.
   // If the underlying driver does not support to get the last insert id
   // via LastInsertId InvalidUserID and an error of type NotSupported should be returned.
   // This indicates that the insertion took place but the id could not be obtained.
@@ -199,6 +201,11 @@ type UserStorage interface {
   // The fields must be a subset of the UserModel attributes.
   // If given only these fields will be updated - user id is not allowed to be changed.
   // If fields is empty (nil or empty slice) all fields will be updated.
+  // If the password is updated (fields contains "Password" or fields is empty and the
+  // password has changed) PasswordChangedAt is set to the current date (in UTC) and
+  // MustChangePassword to false, both in the database and in newCredentials.
+  // If fields explicitly contains "PasswordChangedAt" as well the values from newCredentials
+  // are stored unchanged, this is used to store a new hash of the same password.
   // If the change of values would violate a consistency constraint (email or username already in use) it should not
   // update any fields but instead return an error of type AmbiguousCredentials.
   //
@@ -225,6 +232,34 @@ type UserStorage interface {
   ListUsers() (UserIterator, error)
 }
 
+// PasswordExpiryStorage is implemented by user storages that can efficiently find
+// all users with an expired password.
+//
+// For storages that don't implement it ListPasswordExpired can be used.
+type PasswordExpiryStorage interface {
+	// ListPasswordExpired returns all users whose password is expired according to the
+	// policy at the reference date, see PasswordExpiryPolicy.IsExpired.
+	// The iterator must be used the same way as the one from ListUsers.
+	ListPasswordExpired(policy *PasswordExpiryPolicy, referenceDate time.Time) (UserIterator, error)
+}
+
+// ListPasswordExpired returns all users whose password is expired according to the
+// policy at the reference date.
+// If the storage implements PasswordExpiryStorage that implementation is used,
+// otherwise all users are filtered with FilterUsers.
+func ListPasswordExpired(storage UserStorage, policy *PasswordExpiryPolicy, referenceDate time.Time) (UserIterator, error) {
+	if expiryStorage, ok := storage.(PasswordExpiryStorage); ok {
+		return expiryStorage.ListPasswordExpired(policy, referenceDate)
+	}
+	it, err := storage.ListUsers()
+	if err != nil {
+		return nil, err
+	}
+	return FilterUsers(it, func(u *UserModel) bool {
+		return policy.IsExpired(u, referenceDate)
+	}), nil
+}
+
 // SessionStorage provides methods that are used to store and deal with auth session.
 //
 // In general if a user gets deleted all the users' sessions should be deleted as well.
@@ -259,6 +294,53 @@ type SessionStorage interface {
 	DeleteForUser(user UserID) (int64, error)
 }
 
+// PasswordHistoryStorage stores the last password hashes of each user.
+//
+// It is used to prevent that a user changes the password to one that was used
+// before, see PasswordHistoryUserStorage and CheckPasswordHistory.
+// Each implementation keeps only a limited number of entries per user, older
+// entries are removed on insert.
+type PasswordHistoryStorage interface {
+	// InitPasswordHistory is called once to make sure all tables and indexes exist in
+	// the database.
+	InitPasswordHistory() error
+	// InsertPasswordHistory adds a new entry to the history of the user.
+	// If the user has more entries than allowed the oldest entries are removed.
+	InsertPasswordHistory(entry *PasswordHistoryEntry) error
+	// GetPasswordHistory returns the history of the user, the newest entry first.
+	// If the user has no history an empty slice is returned.
+	GetPasswordHistory(user UserID) ([]*PasswordHistoryEntry, error)
+	// DeletePasswordHistory removes all entries for the given user.
+	// If no entries exist this will not be considered an error.
+	DeletePasswordHistory(user UserID) error
+}
+
+// UserAttributeStorage stores typed profile attributes of users, for example the
+// phone number, locale or timezone, see AttributeValue.
+//
+// Each user has at most one value per attribute name.
+// Attributes are not deleted automatically when a user is deleted,
+// DeleteUserAttributes must be called.
+type UserAttributeStorage interface {
+	// InitUserAttributes is called once to make sure all tables and indexes exist in
+	// the database.
+	InitUserAttributes() error
+	// GetUserAttributes returns all attributes of the user.
+	// If the user has no attributes an empty map is returned.
+	GetUserAttributes(user UserID) (UserAttributes, error)
+	// SetUserAttributes sets the given attributes of the user, existing values are
+	// replaced. Other attributes of the user are not changed.
+	SetUserAttributes(user UserID, attributes UserAttributes) error
+	// DeleteUserAttributes removes the given attributes of the user, if names is empty
+	// all attributes are removed.
+	// If an attribute doesn't exist this will not be considered an error.
+	DeleteUserAttributes(user UserID, names ...string) error
+	// FindUsersByAttribute returns the ids of all users that have the attribute with
+	// the given value (same type and value, see AttributeValue.Equal) in increasing
+	// order.
+	FindUsersByAttribute(name string, value AttributeValue) ([]UserID, error)
+}
+
 // RetryInsertErr is returned if several inserts failed (usually with RetrySessionInsert)
 // and all generated keys were invalid. This should never happen in general.
 type RetryInsertErr []error
@@ -320,9 +402,117 @@ func RetrySessionInsert(storage SessionStorage, session *SessionEntry, numTries
 	return NewRetryInsertErr(errs)
 }
 
+// ErrStorageClosed is returned by Ping and Ready if the storage was closed.
+var ErrStorageClosed = errors.New("storage is closed")
+
+// NotReady is the error returned by Ready if a storage is not ready.
+type NotReady struct {
+	cause error
+}
+
+// NewNotReady returns a new NotReady given the reason why the storage is not ready.
+func NewNotReady(cause error) NotReady {
+	return NotReady{cause: cause}
+}
+
+// Error returns the error string.
+func (e NotReady) Error() string {
+	return fmt.Sprintf("storage not ready: %v", e.cause)
+}
+
+// Unwrap returns the reason why the storage is not ready.
+func (e NotReady) Unwrap() error {
+	return e.cause
+}
+
+// StorageLifecycle is implemented by all storages in this package.
+type StorageLifecycle interface {
+	// Close releases all resources held by the storage, for the sql storages this
+	// includes the database.
+	// The storage must not be used after Close.
+	// Closing a storage multiple times is not an error.
+	Close() error
+	// Ping tests if the backend of the storage (for example the database) is
+	// reachable, it returns ErrStorageClosed if the storage was closed.
+	Ping(ctx context.Context) error
+	// Ready tests if the storage is ready to serve requests: The backend must be
+	// reachable and initialized (for example all tables must exist).
+	// If the storage is not ready an error of type NotReady is returned.
+	Ready(ctx context.Context) error
+}
+
 // Storage combines a user storage and a session storage.
 type Storage interface {
 	UserStorage
 	SessionStorage
+	StorageLifecycle
+}
+
+// combinedStorage combines a UserStorage and a SessionStorage.
+type combinedStorage struct {
+	UserStorage
+	SessionStorage
+}
+
+// NewStorage returns a Storage given a user and a session storage.
+// The lifecycle methods are called on both storages (if they implement
+// StorageLifecycle).
+func NewStorage(users UserStorage, sessions SessionStorage) Storage {
+	return combinedStorage{UserStorage: users, SessionStorage: sessions}
+}
+
+// storageGroup implements StorageLifecycle for multiple storages, the storages
+// that don't implement StorageLifecycle are ignored.
+type storageGroup []interface{}
+
+func (g storageGroup) lifecycles() []StorageLifecycle {
+	res := make([]StorageLifecycle, 0, len(g))
+	for _, storage := range g {
+		if l, ok := storage.(StorageLifecycle); ok {
+			res = append(res, l)
+		}
+	}
+	return res
+}
+
+// Close closes all storages and returns the first error.
+func (g storageGroup) Close() error {
+	var res error
+	for _, l := range g.lifecycles() {
+		if err := l.Close(); err != nil && res == nil {
+			res = err
+		}
+	}
+	return res
+}
+
+func (g storageGroup) Ping(ctx context.Context) error {
+	for _, l := range g.lifecycles() {
+		if err := l.Ping(ctx); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (g storageGroup) Ready(ctx context.Context) error {
+	for _, l := range g.lifecycles() {
+		if err := l.Ready(ctx); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s combinedStorage) Close() error {
+	return storageGroup{s.UserStorage, s.SessionStorage}.Close()
+}
+
+func (s combinedStorage) Ping(ctx context.Context) error {
+	return storageGroup{s.UserStorage, s.SessionStorage}.Ping(ctx)
+}
+
+func (s combinedStorage) Ready(ctx context.Context) error {
+	return storageGroup{s.UserStorage, s.SessionStorage}.Ready(ctx)
 }
 
@@ -0,0 +1,344 @@
+// Copyright 2019 Fabian Wenzelmann
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gopherbouncedb
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+	"golang.org/x/crypto/scrypt"
+)
+
+// PasswordHasher creates and verifies password hashes.
+//
+// The hashes are strings that contain the algorithm and all parameters, usually in
+// the PHC string format
+// (https://github.com/P-H-C/phc-string-format/blob/master/phc-sf-spec.md),
+// for example "$argon2id$v=19$m=65536,t=3,p=2$salt$hash".
+// bcrypt uses its own (modular crypt) format "$2a$cost$...".
+type PasswordHasher interface {
+	// Hash returns the hash of the clear text password.
+	Hash(password string) (string, error)
+	// Matches returns true if the hash was created by this algorithm (not
+	// necessarily with the same parameters).
+	Matches(hash string) bool
+	// Verify returns true if the password matches the hash.
+	// An error is only returned if the hash is malformed.
+	Verify(password, hash string) (bool, error)
+	// NeedsRehash returns true if the hash was created with parameters weaker than the
+	// parameters of the hasher, it should be called only if Matches returns true.
+	NeedsRehash(hash string) bool
+}
+
+// ErrMalformedHash is returned if a hash can't be parsed.
+var ErrMalformedHash = errors.New("malformed password hash")
+
+// phcHash is a parsed hash in PHC string format:
+// $<id>[$v=<version>][$<param>=<value>(,<param>=<value>)*][$<salt>[$<hash>]]
+type phcHash struct {
+	id      string
+	version string
+	params  map[string]string
+	salt    []byte
+	hash    []byte
+}
+
+var phcEncoding = base64.RawStdEncoding
+
+func parsePHC(s string) (*phcHash, error) {
+	parts := strings.Split(s, "$")
+	if len(parts) < 2 || parts[0] != "" || parts[1] == "" {
+		return nil, ErrMalformedHash
+	}
+	res := &phcHash{id: parts[1], params: make(map[string]string)}
+	parts = parts[2:]
+	if len(parts) > 0 && strings.HasPrefix(parts[0], "v=") {
+		res.version = parts[0][2:]
+		parts = parts[1:]
+	}
+	if len(parts) > 0 && strings.Contains(parts[0], "=") {
+		for _, param := range strings.Split(parts[0], ",") {
+			kv := strings.SplitN(param, "=", 2)
+			if len(kv) != 2 {
+				return nil, ErrMalformedHash
+			}
+			res.params[kv[0]] = kv[1]
+		}
+		parts = parts[1:]
+	}
+	if len(parts) != 2 {
+		return nil, ErrMalformedHash
+	}
+	var err error
+	if res.salt, err = phcEncoding.DecodeString(parts[0]); err != nil {
+		return nil, ErrMalformedHash
+	}
+	if res.hash, err = phcEncoding.DecodeString(parts[1]); err != nil {
+		return nil, ErrMalformedHash
+	}
+	// an empty hash would match every password
+	if len(res.salt) == 0 || len(res.hash) == 0 {
+		return nil, ErrMalformedHash
+	}
+	return res, nil
+}
+
+// These constants are the upper bounds for the parameters of stored hashes.
+// The parameters are taken from the hash, the bounds prevent that a hash (for example
+// from an import) makes the verification use excessive memory or time.
+const (
+	// maxHashMemory is the maximal memory in KiB used by scrypt and argon2 (1 GiB).
+	maxHashMemory = 1 << 20
+	// maxArgon2Time is the maximal number of argon2 iterations.
+	maxArgon2Time = 1000
+	// maxHashKeyLen is the maximal length of a hash in bytes.
+	maxHashKeyLen = 1024
+)
+
+// argon2Params returns the parameters m, t and p of an argon2 hash, an error is
+// returned if they're out of bounds.
+func (h *phcHash) argon2Params() (time, memory uint32, threads uint8, err error) {
+	var m, t, p uint64
+	if m, err = h.intParam("m", 32); err != nil {
+		return
+	}
+	if t, err = h.intParam("t", 32); err != nil {
+		return
+	}
+	if p, err = h.intParam("p", 8); err != nil {
+		return
+	}
+	if t == 0 || t > maxArgon2Time || p == 0 || m < 8*p || m > maxHashMemory || len(h.hash) > maxHashKeyLen {
+		err = fmt.Errorf("%w: argon2 parameters out of range", ErrMalformedHash)
+		return
+	}
+	return uint32(t), uint32(m), uint8(p), nil
+}
+
+func (h *phcHash) intParam(name string, bitSize int) (uint64, error) {
+	value, has := h.params[name]
+	if !has {
+		return 0, fmt.Errorf("%w: missing parameter %s", ErrMalformedHash, name)
+	}
+	res, err := strconv.ParseUint(value, 10, bitSize)
+	if err != nil {
+		return 0, fmt.Errorf("%w: invalid parameter %s", ErrMalformedHash, name)
+	}
+	return res, nil
+}
+
+func genSalt(n int) ([]byte, error) {
+	salt := make([]byte, n)
+	if _, err := io.ReadFull(rand.Reader, salt); err != nil {
+		return nil, err
+	}
+	return salt, nil
+}
+
+// BcryptHasher is a PasswordHasher using bcrypt.
+// Note that bcrypt only uses the first 72 bytes of a password.
+type BcryptHasher struct {
+	Cost int
+}
+
+// NewBcryptHasher returns a new BcryptHasher with the default cost of bcrypt.
+func NewBcryptHasher() *BcryptHasher {
+	return &BcryptHasher{Cost: bcrypt.DefaultCost}
+}
+
+func (h *BcryptHasher) Hash(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), h.Cost)
+	if err != nil {
+		return "", err
+	}
+	return string(hash), nil
+}
+
+func (h *BcryptHasher) Matches(hash string) bool {
+	return strings.HasPrefix(hash, "$2a$") || strings.HasPrefix(hash, "$2b$") ||
+		strings.HasPrefix(hash, "$2y$")
+}
+
+func (h *BcryptHasher) Verify(password, hash string) (bool, error) {
+	err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
+	switch err {
+	case nil:
+		return true, nil
+	case bcrypt.ErrMismatchedHashAndPassword:
+		return false, nil
+	default:
+		return false, fmt.Errorf("%w: %s", ErrMalformedHash, err.Error())
+	}
+}
+
+func (h *BcryptHasher) NeedsRehash(hash string) bool {
+	cost, err := bcrypt.Cost([]byte(hash))
+	return err != nil || cost < h.Cost
+}
+
+// ScryptHasher is a PasswordHasher using scrypt.
+//
+// LogN is the log2 of the CPU/memory cost parameter N, R and P are the block size and
+// parallelization parameters.
+// The hashes have the form "$scrypt$ln=15,r=8,p=1$salt$hash".
+type ScryptHasher struct {
+	LogN    uint8
+	R, P    int
+	SaltLen int
+	KeyLen  int
+}
+
+// NewScryptHasher returns a new ScryptHasher with the parameters recommended for
+// interactive logins (N=2^15, r=8, p=1).
+func NewScryptHasher() *ScryptHasher {
+	return &ScryptHasher{LogN: 15, R: 8, P: 1, SaltLen: 16, KeyLen: 32}
+}
+
+func (h *ScryptHasher) Hash(password string) (string, error) {
+	salt, err := genSalt(h.SaltLen)
+	if err != nil {
+		return "", err
+	}
+	key, err := scrypt.Key([]byte(password), salt, 1<<h.LogN, h.R, h.P, h.KeyLen)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("$scrypt$ln=%d,r=%d,p=%d$%s$%s", h.LogN, h.R, h.P,
+		phcEncoding.EncodeToString(salt), phcEncoding.EncodeToString(key)), nil
+}
+
+func (h *ScryptHasher) Matches(hash string) bool {
+	return strings.HasPrefix(hash, "$scrypt$")
+}
+
+func parseScrypt(hash string) (parsed *phcHash, logN uint8, r, p int, err error) {
+	parsed, err = parsePHC(hash)
+	if err != nil {
+		return
+	}
+	if parsed.id != "scrypt" {
+		err = ErrMalformedHash
+		return
+	}
+	var ln, r64, p64 uint64
+	if ln, err = parsed.intParam("ln", 6); err != nil {
+		return
+	}
+	if r64, err = parsed.intParam("r", 31); err != nil {
+		return
+	}
+	if p64, err = parsed.intParam("p", 31); err != nil {
+		return
+	}
+	// scrypt uses 128 * r * N bytes, N = 2^ln
+	if ln == 0 || ln > 30 || r64 == 0 || p64 == 0 || r64<<ln > maxHashMemory*1024/128 ||
+		r64*p64 >= 1<<30 || len(parsed.hash) > maxHashKeyLen {
+		err = fmt.Errorf("%w: scrypt parameters out of range", ErrMalformedHash)
+		return
+	}
+	return parsed, uint8(ln), int(r64), int(p64), nil
+}
+
+func (h *ScryptHasher) Verify(password, hash string) (bool, error) {
+	parsed, logN, r, p, err := parseScrypt(hash)
+	if err != nil {
+		return false, err
+	}
+	key, err := scrypt.Key([]byte(password), parsed.salt, 1<<logN, r, p, len(parsed.hash))
+	if err != nil {
+		return false, err
+	}
+	return subtle.ConstantTimeCompare(key, parsed.hash) == 1, nil
+}
+
+func (h *ScryptHasher) NeedsRehash(hash string) bool {
+	parsed, logN, r, p, err := parseScrypt(hash)
+	if err != nil {
+		return true
+	}
+	return logN < h.LogN || r < h.R || p < h.P || len(parsed.hash) < h.KeyLen
+}
+
+// Argon2idHasher is a PasswordHasher using argon2id.
+//
+// Time is the number of iterations, Memory the memory in KiB and Threads the degree
+// of parallelism.
+// The hashes have the form "$argon2id$v=19$m=65536,t=3,p=2$salt$hash".
+type Argon2idHasher struct {
+	Time    uint32
+	Memory  uint32
+	Threads uint8
+	SaltLen int
+	KeyLen  uint32
+}
+
+// NewArgon2idHasher returns a new Argon2idHasher with the parameters recommended
+// by RFC 9106 for memory constrained environments (t=3, m=64 MiB, p=4).
+func NewArgon2idHasher() *Argon2idHasher {
+	return &Argon2idHasher{Time: 3, Memory: 64 * 1024, Threads: 4, SaltLen: 16, KeyLen: 32}
+}
+
+func (h *Argon2idHasher) Hash(password string) (string, error) {
+	salt, err := genSalt(h.SaltLen)
+	if err != nil {
+		return "", err
+	}
+	key := argon2.IDKey([]byte(password), salt, h.Time, h.Memory, h.Threads, h.KeyLen)
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s", argon2.Version,
+		h.Memory, h.Time, h.Threads,
+		phcEncoding.EncodeToString(salt), phcEncoding.EncodeToString(key)), nil
+}
+
+func (h *Argon2idHasher) Matches(hash string) bool {
+	return strings.HasPrefix(hash, "$argon2id$")
+}
+
+func parseArgon2id(hash string) (parsed *phcHash, time, memory uint32, threads uint8, err error) {
+	parsed, err = parsePHC(hash)
+	if err != nil {
+		return
+	}
+	if parsed.id != "argon2id" || (parsed.version != "" && parsed.version != strconv.Itoa(argon2.Version)) {
+		err = ErrMalformedHash
+		return
+	}
+	time, memory, threads, err = parsed.argon2Params()
+	return
+}
+
+func (h *Argon2idHasher) Verify(password, hash string) (bool, error) {
+	parsed, t, m, p, err := parseArgon2id(hash)
+	if err != nil {
+		return false, err
+	}
+	key := argon2.IDKey([]byte(password), parsed.salt, t, m, p, uint32(len(parsed.hash)))
+	return subtle.ConstantTimeCompare(key, parsed.hash) == 1, nil
+}
+
+func (h *Argon2idHasher) NeedsRehash(hash string) bool {
+	parsed, t, m, p, err := parseArgon2id(hash)
+	if err != nil {
+		return true
+	}
+	return t < h.Time || m < h.Memory || p < h.Threads || uint32(len(parsed.hash)) < h.KeyLen
+}
@@ -0,0 +1,187 @@
+// Copyright 2019 Fabian Wenzelmann
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gopherbouncedb
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+const (
+	// DefaultPasswordHistorySize is the default number of password hashes stored
+	// for each user.
+	DefaultPasswordHistorySize = 5
+)
+
+// PasswordHistoryEntry is a password hash that was used by a user.
+// ChangedAt is the date the password was set.
+type PasswordHistoryEntry struct {
+	User      UserID
+	Password  string
+	ChangedAt time.Time
+}
+
+// Copy returns a copy of the entry.
+func (e *PasswordHistoryEntry) Copy() *PasswordHistoryEntry {
+	return &PasswordHistoryEntry{
+		User:      e.User,
+		Password:  e.Password,
+		ChangedAt: e.ChangedAt,
+	}
+}
+
+// PasswordComparator is used to test if a clear text password matches a password
+// hash.
+//
+// This package doesn't hash passwords, so the comparator must be provided by the
+// caller, usually a wrapper around the hashing library in use.
+// It should return true if the password matches the hash and an error only if the
+// comparison failed (for example because the hash is malformed).
+type PasswordComparator func(candidate, hash string) (bool, error)
+
+// PasswordReused is the error returned by CheckPasswordHistory if the password
+// was used before.
+type PasswordReused string
+
+// NewPasswordReused returns a new PasswordReused given the message.
+func NewPasswordReused(message string) PasswordReused {
+	return PasswordReused(message)
+}
+
+// Error returns the error message.
+func (e PasswordReused) Error() string {
+	return string(e)
+}
+
+// CheckPasswordHistory tests if the clear text password candidate matches one of the
+// hashes in the history of the user.
+// It returns nil if the password was not used before, an error of type
+// PasswordReused if it was and any other error if the lookup or comparison failed.
+func CheckPasswordHistory(history PasswordHistoryStorage, user UserID, candidate string, cmp PasswordComparator) error {
+	entries, err := history.GetPasswordHistory(user)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		matches, cmpErr := cmp(candidate, entry.Password)
+		if cmpErr != nil {
+			return cmpErr
+		}
+		if matches {
+			return NewPasswordReused(fmt.Sprintf("password was already used (changed at %s)",
+				entry.ChangedAt.Format(time.RFC3339)))
+		}
+	}
+	return nil
+}
+
+// PasswordHistoryUserStorage is a UserStorage that automatically records password
+// changes in a PasswordHistoryStorage.
+//
+// The hash of a new user is recorded on InsertUser and UpdateUser records the
+// new hash if the "Password" field is updated and has changed.
+// DeleteUser deletes the history of the user as well.
+//
+// The history is written after the user was changed, if writing the history fails
+// the change is not reverted, but the error is returned.
+type PasswordHistoryUserStorage struct {
+	UserStorage
+	History PasswordHistoryStorage
+}
+
+// NewPasswordHistoryUserStorage returns a new PasswordHistoryUserStorage.
+func NewPasswordHistoryUserStorage(users UserStorage, history PasswordHistoryStorage) *PasswordHistoryUserStorage {
+	return &PasswordHistoryUserStorage{UserStorage: users, History: history}
+}
+
+// InitUsers initializes the user storage and the history.
+func (s *PasswordHistoryUserStorage) InitUsers() error {
+	if err := s.UserStorage.InitUsers(); err != nil {
+		return err
+	}
+	return s.History.InitPasswordHistory()
+}
+
+// Close closes the user storage and the history.
+func (s *PasswordHistoryUserStorage) Close() error {
+	return storageGroup{s.UserStorage, s.History}.Close()
+}
+
+// Ping pings the user storage and the history.
+func (s *PasswordHistoryUserStorage) Ping(ctx context.Context) error {
+	return storageGroup{s.UserStorage, s.History}.Ping(ctx)
+}
+
+// Ready tests if the user storage and the history are ready.
+func (s *PasswordHistoryUserStorage) Ready(ctx context.Context) error {
+	return storageGroup{s.UserStorage, s.History}.Ready(ctx)
+}
+
+// InsertUser inserts the user and records the password hash.
+func (s *PasswordHistoryUserStorage) InsertUser(user *UserModel) (UserID, error) {
+	id, err := s.UserStorage.InsertUser(user)
+	if err != nil {
+		return id, err
+	}
+	if user.Password == "" {
+		return id, nil
+	}
+	entry := &PasswordHistoryEntry{User: id, Password: user.Password, ChangedAt: user.DateJoined}
+	return id, s.History.InsertPasswordHistory(entry)
+}
+
+// updatesPassword returns true if an update with the given fields changes the password.
+func updatesPassword(fields []string) bool {
+	return len(fields) == 0 || touchesPassword(fields)
+}
+
+// UpdateUser updates the user and records the new password hash if the password changed.
+// No entry is recorded if fields contains "PasswordChangedAt": the caller manages the
+// password fields itself, for example if only the hash of the password was renewed
+// (see Authenticator).
+func (s *PasswordHistoryUserStorage) UpdateUser(id UserID, newCredentials *UserModel, fields []string) error {
+	if !updatesPassword(fields) || hasField(fields, "PasswordChangedAt") {
+		return s.UserStorage.UpdateUser(id, newCredentials, fields)
+	}
+	old, getErr := s.UserStorage.GetUser(id)
+	if getErr != nil {
+		if _, isNoSuchUser := getErr.(NoSuchUser); !isNoSuchUser {
+			return getErr
+		}
+		old = nil
+	}
+	if err := s.UserStorage.UpdateUser(id, newCredentials, fields); err != nil {
+		return err
+	}
+	if old == nil || old.Password == newCredentials.Password || newCredentials.Password == "" {
+		return nil
+	}
+	// the storage may or may not have set the new PasswordChangedAt in newCredentials
+	changedAt := newCredentials.PasswordChangedAt
+	if !changedAt.After(old.PasswordChangedAt) {
+		changedAt = time.Now().UTC()
+	}
+	entry := &PasswordHistoryEntry{User: id, Password: newCredentials.Password, ChangedAt: changedAt}
+	return s.History.InsertPasswordHistory(entry)
+}
+
+// DeleteUser deletes the user and its history.
+func (s *PasswordHistoryUserStorage) DeleteUser(id UserID) error {
+	if err := s.UserStorage.DeleteUser(id); err != nil {
+		return err
+	}
+	return s.History.DeletePasswordHistory(id)
+}
@@ -15,15 +15,44 @@
 package gopherbouncedb
 
 import (
+	"context"
 	"fmt"
+	"sort"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
+// memdummyLifecycle implements StorageLifecycle for the memdummy storages.
+// There are no resources to release, Close only marks the storage as closed.
+type memdummyLifecycle struct {
+	closed int32
+}
+
+func (l *memdummyLifecycle) Close() error {
+	atomic.StoreInt32(&l.closed, 1)
+	return nil
+}
+
+func (l *memdummyLifecycle) Ping(ctx context.Context) error {
+	if atomic.LoadInt32(&l.closed) != 0 {
+		return ErrStorageClosed
+	}
+	return ctx.Err()
+}
+
+func (l *memdummyLifecycle) Ready(ctx context.Context) error {
+	if err := l.Ping(ctx); err != nil {
+		return NewNotReady(err)
+	}
+	return nil
+}
+
 // MemdummyUserStorage is an implementation of UserStorage using an in-memory storage.
 // It should never be used in production code, instead it serves as a reference implementation and can be used for
 // test cases.
 type MemdummyUserStorage struct {
+	memdummyLifecycle
 	mutex *sync.RWMutex
 	idMapping map[UserID]*UserModel
 	nameMapping map[string]*UserModel
@@ -100,6 +129,7 @@ func (s *MemdummyUserStorage) InsertUser(user *UserModel) (UserID, error) {
 	s.nextID++
 	user.ID = nextID
 	user.DateJoined = time.Now().UTC()
+	user.PasswordChangedAt = user.DateJoined
 	// add to mappings
 	s.idMapping[nextID] = user.Copy()
 	s.nameMapping[user.Username] = user.Copy()
@@ -111,6 +141,12 @@ func (s *MemdummyUserStorage) UpdateUser(id UserID, newCredentials *UserModel, f
 	s.mutex.Lock()
 	defer s.mutex.Unlock()
 	// fields is ignored, we just update
+	// but as in the SQL implementation fields that can't be updated are rejected
+	for _, fieldName := range fields {
+		if field, fieldErr := LookupUserField(fieldName); fieldErr == nil && !field.Updatable {
+			return fmt.Errorf("field %s can't be updated", field.Name)
+		}
+	}
 	// first find the user with the given id
 	existing, has := s.idMapping[id]
 	if !has {
@@ -128,6 +164,7 @@ func (s *MemdummyUserStorage) UpdateUser(id UserID, newCredentials *UserModel, f
 		return NewAmbiguousCredentials(fmt.Sprintf("user with email %s already exists", newCredentials.EMail))
 	}
 	// now everything is okay so we just update
+	preparePasswordUpdate(newCredentials, fields, existing.Password)
 	s.idMapping[id] = newCredentials.Copy()
 	// delete entries for username and email, they might have changed
 	delete(s.nameMapping, newCredentials.Username)
@@ -175,6 +212,8 @@ func (it *memUserIterator) Err() error {
 }
 
 func (it *memUserIterator) Close() error {
+	it.items = nil
+	it.pos = 0
 	return nil
 }
 
@@ -197,7 +236,20 @@ func (s *MemdummyUserStorage) ListUsers() (UserIterator, error) {
 	return newMemUserIterator(s), nil
 }
 
+func (s *MemdummyUserStorage) ListPasswordExpired(policy *PasswordExpiryPolicy, referenceDate time.Time) (UserIterator, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	items := make([]*UserModel, 0)
+	for _, u := range s.idMapping {
+		if policy.IsExpired(u, referenceDate) {
+			items = append(items, u.Copy())
+		}
+	}
+	return &memUserIterator{items: items, pos: 0}, nil
+}
+
 type MemdummySessionStorage struct {
+	memdummyLifecycle
 	mutex *sync.RWMutex
 	keyMapping map[string]*SessionEntry
 }
@@ -270,3 +322,143 @@ func (s *MemdummySessionStorage) DeleteForUser(user UserID) (int64, error) {
 	}
 	return delCount, nil
 }
+
+// MemdummyPasswordHistoryStorage is an implementation of PasswordHistoryStorage using
+// an in-memory storage.
+// Like the other memdummy storages it should only be used for testing.
+type MemdummyPasswordHistoryStorage struct {
+	memdummyLifecycle
+	mutex      *sync.RWMutex
+	entries    map[UserID][]*PasswordHistoryEntry
+	maxEntries int
+}
+
+// NewMemdummyPasswordHistoryStorage returns a new storage without any data that
+// stores at most maxEntries entries per user.
+func NewMemdummyPasswordHistoryStorage(maxEntries int) *MemdummyPasswordHistoryStorage {
+	return &MemdummyPasswordHistoryStorage{
+		mutex:      new(sync.RWMutex),
+		entries:    make(map[UserID][]*PasswordHistoryEntry),
+		maxEntries: maxEntries,
+	}
+}
+
+func (s *MemdummyPasswordHistoryStorage) Clear() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.entries = make(map[UserID][]*PasswordHistoryEntry)
+}
+
+func (s *MemdummyPasswordHistoryStorage) InitPasswordHistory() error {
+	return nil
+}
+
+func (s *MemdummyPasswordHistoryStorage) InsertPasswordHistory(entry *PasswordHistoryEntry) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	// newest entries first
+	history := append([]*PasswordHistoryEntry{entry.Copy()}, s.entries[entry.User]...)
+	if len(history) > s.maxEntries {
+		history = history[:s.maxEntries]
+	}
+	s.entries[entry.User] = history
+	return nil
+}
+
+func (s *MemdummyPasswordHistoryStorage) GetPasswordHistory(user UserID) ([]*PasswordHistoryEntry, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	history := s.entries[user]
+	res := make([]*PasswordHistoryEntry, len(history))
+	for i, entry := range history {
+		res[i] = entry.Copy()
+	}
+	return res, nil
+}
+
+func (s *MemdummyPasswordHistoryStorage) DeletePasswordHistory(user UserID) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	delete(s.entries, user)
+	return nil
+}
+
+// MemdummyUserAttributeStorage is an implementation of UserAttributeStorage using
+// an in-memory storage.
+// Like the other memdummy storages it should only be used for testing.
+type MemdummyUserAttributeStorage struct {
+	memdummyLifecycle
+	mutex      *sync.RWMutex
+	attributes map[UserID]UserAttributes
+}
+
+// NewMemdummyUserAttributeStorage returns a new storage without any data.
+func NewMemdummyUserAttributeStorage() *MemdummyUserAttributeStorage {
+	return &MemdummyUserAttributeStorage{
+		mutex:      new(sync.RWMutex),
+		attributes: make(map[UserID]UserAttributes),
+	}
+}
+
+func (s *MemdummyUserAttributeStorage) Clear() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.attributes = make(map[UserID]UserAttributes)
+}
+
+func (s *MemdummyUserAttributeStorage) InitUserAttributes() error {
+	return nil
+}
+
+func (s *MemdummyUserAttributeStorage) GetUserAttributes(user UserID) (UserAttributes, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return s.attributes[user].Copy(), nil
+}
+
+func (s *MemdummyUserAttributeStorage) SetUserAttributes(user UserID, attributes UserAttributes) error {
+	for name := range attributes {
+		if err := checkAttributeName(name); err != nil {
+			return err
+		}
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	existing, has := s.attributes[user]
+	if !has {
+		existing = make(UserAttributes, len(attributes))
+		s.attributes[user] = existing
+	}
+	for name, val := range attributes.Copy() {
+		existing[name] = val
+	}
+	return nil
+}
+
+func (s *MemdummyUserAttributeStorage) DeleteUserAttributes(user UserID, names ...string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if len(names) == 0 {
+		delete(s.attributes, user)
+		return nil
+	}
+	for _, name := range names {
+		delete(s.attributes[user], name)
+	}
+	return nil
+}
+
+func (s *MemdummyUserAttributeStorage) FindUsersByAttribute(name string, value AttributeValue) ([]UserID, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	res := make([]UserID, 0)
+	for user, attributes := range s.attributes {
+		if val, has := attributes[name]; has && val.Equal(value) {
+			res = append(res, user)
+		}
+	}
+	sort.Slice(res, func(i, j int) bool {
+		return res[i] < res[j]
+	})
+	return res, nil
+}
@@ -0,0 +1,114 @@
+// Copyright 2019 Fabian Wenzelmann
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mysql
+
+import (
+	"database/sql"
+
+	"github.com/FabianWe/gopherbouncedb"
+)
+
+const (
+	// MySQLUserAttributesInit is the statement to create the user attributes table.
+	// Only a prefix of the string values is indexed.
+	MySQLUserAttributesInit = "CREATE TABLE IF NOT EXISTS $USER_ATTRIBUTES_TABLE_NAME$ (\n" +
+		"	user_id BIGINT NOT NULL,\n" +
+		"	name VARCHAR(128) NOT NULL,\n" +
+		"	value_type INT NOT NULL,\n" +
+		"	string_value TEXT NULL,\n" +
+		"	int_value BIGINT NULL,\n" +
+		"	time_value DATETIME(6) NULL,\n" +
+		"	PRIMARY KEY (user_id, name),\n" +
+		"	KEY $USER_ATTRIBUTES_TABLE_NAME$_string_value_key (name, string_value(255)),\n" +
+		"	KEY $USER_ATTRIBUTES_TABLE_NAME$_int_value_key (name, int_value),\n" +
+		"	KEY $USER_ATTRIBUTES_TABLE_NAME$_time_value_key (name, time_value)\n" +
+		") $MYSQL_TABLE_OPTIONS$;"
+
+	MySQLGetUserAttributes    = "SELECT name, value_type, string_value, int_value, time_value FROM $USER_ATTRIBUTES_TABLE_NAME$ WHERE user_id=?;"
+	MySQLInsertUserAttribute  = "INSERT INTO $USER_ATTRIBUTES_TABLE_NAME$(user_id, name, value_type, string_value, int_value, time_value) VALUES(?, ?, ?, ?, ?, ?);"
+	MySQLDeleteUserAttribute  = "DELETE FROM $USER_ATTRIBUTES_TABLE_NAME$ WHERE user_id=? AND name=?;"
+	MySQLDeleteUserAttributes = "DELETE FROM $USER_ATTRIBUTES_TABLE_NAME$ WHERE user_id=?;"
+	MySQLFindUsersByString    = "SELECT user_id FROM $USER_ATTRIBUTES_TABLE_NAME$ WHERE name=? AND value_type=? AND string_value=? ORDER BY user_id;"
+	MySQLFindUsersByInt       = "SELECT user_id FROM $USER_ATTRIBUTES_TABLE_NAME$ WHERE name=? AND value_type=? AND int_value=? ORDER BY user_id;"
+	MySQLFindUsersByTime      = "SELECT user_id FROM $USER_ATTRIBUTES_TABLE_NAME$ WHERE name=? AND value_type=? AND time_value=? ORDER BY user_id;"
+)
+
+// MySQLUserAttributeQueries implements gopherbouncedb.UserAttributeSQL for MySQL.
+type MySQLUserAttributeQueries struct {
+	InitS                                  []string
+	GetS, InsertS, DeleteS, DeleteAllS     string
+	FindByStringS, FindByIntS, FindByTimeS string
+	Replacer                               *gopherbouncedb.SQLTemplateReplacer
+}
+
+// NewMySQLUserAttributeQueries returns new queries, see NewMySQLUserQueries.
+func NewMySQLUserAttributeQueries(replaceMapping map[string]string) *MySQLUserAttributeQueries {
+	replacer := newReplacer(replaceMapping)
+	return &MySQLUserAttributeQueries{
+		InitS:         []string{replacer.Apply(MySQLUserAttributesInit)},
+		GetS:          replacer.Apply(MySQLGetUserAttributes),
+		InsertS:       replacer.Apply(MySQLInsertUserAttribute),
+		DeleteS:       replacer.Apply(MySQLDeleteUserAttribute),
+		DeleteAllS:    replacer.Apply(MySQLDeleteUserAttributes),
+		FindByStringS: replacer.Apply(MySQLFindUsersByString),
+		FindByIntS:    replacer.Apply(MySQLFindUsersByInt),
+		FindByTimeS:   replacer.Apply(MySQLFindUsersByTime),
+		Replacer:      replacer,
+	}
+}
+
+func (q *MySQLUserAttributeQueries) InitUserAttributes() []string {
+	return q.InitS
+}
+
+func (q *MySQLUserAttributeQueries) GetUserAttributes() string {
+	return q.GetS
+}
+
+func (q *MySQLUserAttributeQueries) InsertUserAttribute() string {
+	return q.InsertS
+}
+
+func (q *MySQLUserAttributeQueries) DeleteUserAttribute() string {
+	return q.DeleteS
+}
+
+func (q *MySQLUserAttributeQueries) DeleteUserAttributes() string {
+	return q.DeleteAllS
+}
+
+func (q *MySQLUserAttributeQueries) FindUsersByStringAttribute() string {
+	return q.FindByStringS
+}
+
+func (q *MySQLUserAttributeQueries) FindUsersByIntAttribute() string {
+	return q.FindByIntS
+}
+
+func (q *MySQLUserAttributeQueries) FindUsersByTimeAttribute() string {
+	return q.FindByTimeS
+}
+
+// MySQLUserAttributeStorage is a user attribute storage for MySQL.
+type MySQLUserAttributeStorage struct {
+	*gopherbouncedb.SQLUserAttributeStorage
+}
+
+// NewMySQLUserAttributeStorage returns a new storage, see NewMySQLUserStorage.
+func NewMySQLUserAttributeStorage(db *sql.DB, replaceMapping map[string]string) *MySQLUserAttributeStorage {
+	queries := NewMySQLUserAttributeQueries(replaceMapping)
+	bridge := NewMySQLBridge()
+	return &MySQLUserAttributeStorage{gopherbouncedb.NewSQLUserAttributeStorage(db, queries, bridge)}
+}
@@ -0,0 +1,91 @@
+// Copyright 2019 Fabian Wenzelmann
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mysql
+
+import (
+	"database/sql"
+
+	"github.com/FabianWe/gopherbouncedb"
+)
+
+const (
+	// MySQLPasswordHistoryInit is the statement to create the password history table.
+	MySQLPasswordHistoryInit = "CREATE TABLE IF NOT EXISTS $PASSWORD_HISTORY_TABLE_NAME$ (\n" +
+		"	id BIGINT NOT NULL AUTO_INCREMENT,\n" +
+		"	user_id BIGINT NOT NULL,\n" +
+		"	password VARCHAR($PASSWORD_MAX_LEN$) NOT NULL,\n" +
+		"	changed_at DATETIME(6) NOT NULL,\n" +
+		"	PRIMARY KEY (id),\n" +
+		"	KEY $PASSWORD_HISTORY_TABLE_NAME$_user_id_key (user_id)\n" +
+		") $MYSQL_TABLE_OPTIONS$;"
+
+	MySQLInsertPasswordHistory      = "INSERT INTO $PASSWORD_HISTORY_TABLE_NAME$(user_id, password, changed_at) VALUES(?, ?, ?);"
+	MySQLGetPasswordHistory         = "SELECT id, user_id, password, changed_at FROM $PASSWORD_HISTORY_TABLE_NAME$ WHERE user_id=? ORDER BY changed_at DESC, id DESC;"
+	MySQLDeletePasswordHistoryEntry = "DELETE FROM $PASSWORD_HISTORY_TABLE_NAME$ WHERE id=?;"
+	MySQLDeletePasswordHistory      = "DELETE FROM $PASSWORD_HISTORY_TABLE_NAME$ WHERE user_id=?;"
+)
+
+// MySQLPasswordHistoryQueries implements gopherbouncedb.PasswordHistorySQL for
+// MySQL.
+type MySQLPasswordHistoryQueries struct {
+	InitS                                []string
+	InsertS, GetS, DeleteEntryS, DeleteS string
+	Replacer                             *gopherbouncedb.SQLTemplateReplacer
+}
+
+// NewMySQLPasswordHistoryQueries returns new queries, see NewMySQLUserQueries.
+func NewMySQLPasswordHistoryQueries(replaceMapping map[string]string) *MySQLPasswordHistoryQueries {
+	replacer := newReplacer(replaceMapping)
+	return &MySQLPasswordHistoryQueries{
+		InitS:        []string{replacer.Apply(MySQLPasswordHistoryInit)},
+		InsertS:      replacer.Apply(MySQLInsertPasswordHistory),
+		GetS:         replacer.Apply(MySQLGetPasswordHistory),
+		DeleteEntryS: replacer.Apply(MySQLDeletePasswordHistoryEntry),
+		DeleteS:      replacer.Apply(MySQLDeletePasswordHistory),
+		Replacer:     replacer,
+	}
+}
+
+func (q *MySQLPasswordHistoryQueries) InitPasswordHistory() []string {
+	return q.InitS
+}
+
+func (q *MySQLPasswordHistoryQueries) InsertPasswordHistory() string {
+	return q.InsertS
+}
+
+func (q *MySQLPasswordHistoryQueries) GetPasswordHistory() string {
+	return q.GetS
+}
+
+func (q *MySQLPasswordHistoryQueries) DeletePasswordHistoryEntry() string {
+	return q.DeleteEntryS
+}
+
+func (q *MySQLPasswordHistoryQueries) DeletePasswordHistory() string {
+	return q.DeleteS
+}
+
+// MySQLPasswordHistoryStorage is a password history storage for MySQL.
+type MySQLPasswordHistoryStorage struct {
+	*gopherbouncedb.SQLPasswordHistoryStorage
+}
+
+// NewMySQLPasswordHistoryStorage returns a new storage, see NewMySQLUserStorage.
+func NewMySQLPasswordHistoryStorage(db *sql.DB, replaceMapping map[string]string) *MySQLPasswordHistoryStorage {
+	queries := NewMySQLPasswordHistoryQueries(replaceMapping)
+	bridge := NewMySQLBridge()
+	return &MySQLPasswordHistoryStorage{gopherbouncedb.NewSQLPasswordHistoryStorage(db, queries, bridge)}
+}
@@ -0,0 +1,195 @@
+// Copyright 2019 Fabian Wenzelmann
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package mysql provides the queries and the SQLBridge to use the generic SQL
+// storages from gopherbouncedb with MySQL and MariaDB.
+//
+// It uses the driver github.com/go-sql-driver/mysql, the database must be opened
+// with the driver name "mysql".
+// The tables use InnoDB with utf8mb4, times are stored as DATETIME(6) in UTC.
+// The DSN may set parseTime to true or false, both are supported by the bridge.
+//
+// The tests of this package only run if the environment variable
+// GOPHERBOUNCE_MYSQL_DSN contains the DSN of a database, otherwise they're skipped.
+// The tests create their own tables and drop them afterwards. A database can be
+// started with Docker:
+//
+//	docker run -d --name gopherbounce-mysql -p 3306:3306 \
+//		-e MYSQL_ROOT_PASSWORD=secret -e MYSQL_DATABASE=gopherbounce mysql:8
+//	GOPHERBOUNCE_MYSQL_DSN='root:secret@tcp(localhost:3306)/gopherbounce?parseTime=true' \
+//		go test ./mysql
+package mysql
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/FabianWe/gopherbouncedb"
+	gomysql "github.com/go-sql-driver/mysql"
+)
+
+const (
+	// ErrDupEntry is the MySQL error number of a duplicate entry for a unique key.
+	ErrDupEntry = 1062
+
+	// DefaultMaxKeyBytes is the maximal length of an index key in bytes for InnoDB
+	// with the DYNAMIC row format (the default since MySQL 5.7 and MariaDB 10.2).
+	DefaultMaxKeyBytes = 3072
+	// CompactMaxKeyBytes is the maximal length of an index key for the COMPACT and
+	// REDUNDANT row formats.
+	CompactMaxKeyBytes = 767
+
+	// utf8mb4BytesPerChar is the maximal number of bytes of a character in utf8mb4.
+	utf8mb4BytesPerChar = 4
+
+	// TimeLayout is the layout of DATETIME(6) values returned as text (if parseTime
+	// is false).
+	TimeLayout = "2006-01-02 15:04:05.999999"
+	// zeroDate is the prefix of a zero DATETIME value.
+	zeroDate = "0000-00-00"
+)
+
+// MySQLBridge implements gopherbouncedb.SQLBridge for MySQL.
+type MySQLBridge struct{}
+
+// NewMySQLBridge returns a new bridge.
+func NewMySQLBridge() MySQLBridge {
+	return MySQLBridge{}
+}
+
+// TimeScanType returns an *interface{}, the driver returns a time.Time if
+// parseTime is true and a []byte otherwise.
+func (b MySQLBridge) TimeScanType() interface{} {
+	var res interface{}
+	return &res
+}
+
+// ConvertTimeScanType converts a time.Time, []byte or string to a time in UTC.
+// Zero dates are converted to the zero time.
+func (b MySQLBridge) ConvertTimeScanType(val interface{}) (time.Time, error) {
+	if ptr, ok := val.(*interface{}); ok {
+		val = *ptr
+	}
+	switch v := val.(type) {
+	case time.Time:
+		return v.UTC(), nil
+	case []byte:
+		return ParseDateTime(string(v))
+	case string:
+		return ParseDateTime(v)
+	default:
+		return time.Time{}, fmt.Errorf("expected time.Time, []byte or string, got %v", reflect.TypeOf(val))
+	}
+}
+
+// ParseDateTime parses a DATETIME value returned as text in UTC.
+func ParseDateTime(s string) (time.Time, error) {
+	if strings.HasPrefix(s, zeroDate) {
+		return time.Time{}, nil
+	}
+	t, err := time.ParseInLocation(TimeLayout, s, time.UTC)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid DATETIME value: %w", err)
+	}
+	return t, nil
+}
+
+// ConvertTime returns the time in UTC.
+func (b MySQLBridge) ConvertTime(t time.Time) interface{} {
+	return t.UTC()
+}
+
+// IsDuplicateInsert returns true if err is a *mysql.MySQLError with number 1062.
+func (b MySQLBridge) IsDuplicateInsert(err error) bool {
+	var mysqlErr *gomysql.MySQLError
+	return errors.As(err, &mysqlErr) && mysqlErr.Number == ErrDupEntry
+}
+
+// IsDuplicateUpdate works as IsDuplicateInsert.
+func (b MySQLBridge) IsDuplicateUpdate(err error) bool {
+	return b.IsDuplicateInsert(err)
+}
+
+// KeyPart returns the key part for an index on a VARCHAR(maxLen) column in utf8mb4.
+// If the column doesn't fit into maxKeyBytes only a prefix of the column is indexed,
+// for example "email(191)" for maxLen = 254 and maxKeyBytes = 767.
+//
+// Note that a unique prefix index requires the prefixes to be unique.
+func KeyPart(column string, maxLen, maxKeyBytes int) string {
+	if maxPrefix := maxKeyBytes / utf8mb4BytesPerChar; maxLen > maxPrefix {
+		return fmt.Sprintf("%s(%d)", column, maxPrefix)
+	}
+	return column
+}
+
+// newReplacer returns the default replacer with "$MYSQL_TABLE_OPTIONS$" set and
+// the values from replaceMapping (may be nil).
+func newReplacer(replaceMapping map[string]string) *gopherbouncedb.SQLTemplateReplacer {
+	replacer := gopherbouncedb.DefaultSQLReplacer()
+	replacer.Set("$MYSQL_TABLE_OPTIONS$", "ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_bin")
+	if replaceMapping != nil {
+		replacer.UpdateDict(replaceMapping)
+	}
+	return replacer
+}
+
+// setUserKeys sets the variables "$MYSQL_USERNAME_KEY$" and "$MYSQL_EMAIL_KEY$" (if
+// not set already) to the key definitions for the username and email, see KeyPart.
+func setUserKeys(replacer *gopherbouncedb.SQLTemplateReplacer, maxKeyBytes int) error {
+	if maxKeyBytes <= 0 {
+		maxKeyBytes = DefaultMaxKeyBytes
+	}
+	maxLen := func(key string) (int, error) {
+		res, err := strconv.Atoi(replacer.Apply(key))
+		if err != nil {
+			return 0, fmt.Errorf("invalid value for %s: %w", key, err)
+		}
+		return res, nil
+	}
+	usernameLen, err := maxLen("$USERNAME_MAX_LEN$")
+	if err != nil {
+		return err
+	}
+	emailLen, err := maxLen("$EMAIL_MAX_LEN$")
+	if err != nil {
+		return err
+	}
+	table := replacer.Apply("$USERS_TABLE_NAME$")
+	emailKey := "KEY"
+	if strings.TrimSpace(replacer.Apply("$EMAIL_UNIQUE$")) != "" {
+		emailKey = "UNIQUE KEY"
+	}
+	if !replacer.HasKey("$MYSQL_USERNAME_KEY$") {
+		replacer.Set("$MYSQL_USERNAME_KEY$", fmt.Sprintf("UNIQUE KEY %s_username_key (%s)",
+			table, KeyPart("username", usernameLen, maxKeyBytes)))
+	}
+	if !replacer.HasKey("$MYSQL_EMAIL_KEY$") {
+		replacer.Set("$MYSQL_EMAIL_KEY$", fmt.Sprintf("%s %s_email_key (%s)",
+			emailKey, table, KeyPart("email", emailLen, maxKeyBytes)))
+	}
+	return nil
+}
+
+// assignments returns the assignments "`column`=?, ..." for the columns.
+func assignments(columns []string) string {
+	res := make([]string, len(columns))
+	for i, column := range columns {
+		res[i] = "`" + column + "`=?"
+	}
+	return strings.Join(res, ", ")
+}
@@ -0,0 +1,239 @@
+// Copyright 2019 Fabian Wenzelmann
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mysql
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/FabianWe/gopherbouncedb"
+	"github.com/FabianWe/gopherbouncedb/testsuite"
+	gomysql "github.com/go-sql-driver/mysql"
+)
+
+// DSNEnv is the environment variable with the data source name of the database
+// used in the tests, for example "root:secret@/gopherbounce?parseTime=true".
+// The tests that require a database are skipped if it's not set.
+const DSNEnv = "GOPHERBOUNCE_MYSQL_DSN"
+
+var tableCount int64
+
+// openDB opens the test database and returns a replace mapping with new table names.
+// The tables are dropped after the test.
+func openDB(t *testing.T) (*sql.DB, map[string]string) {
+	dsn := os.Getenv(DSNEnv)
+	if dsn == "" {
+		t.Skipf("%s not set", DSNEnv)
+	}
+	db, err := sql.Open("mysql", dsn)
+	if err != nil {
+		t.Fatal("Can't open database:", err)
+	}
+	suffix := fmt.Sprintf("_test_%d_%d", os.Getpid(), atomic.AddInt64(&tableCount, 1))
+	mapping := map[string]string{
+		"$USERS_TABLE_NAME$":            "auth_user" + suffix,
+		"$SESSIONS_TABLE_NAME$":         "auth_session" + suffix,
+		"$PASSWORD_HISTORY_TABLE_NAME$": "auth_password_history" + suffix,
+		"$USER_ATTRIBUTES_TABLE_NAME$":  "auth_user_attribute" + suffix,
+	}
+	t.Cleanup(func() {
+		cleanupDB, err := sql.Open("mysql", dsn)
+		if err != nil {
+			t.Error("Can't open database:", err)
+			return
+		}
+		defer cleanupDB.Close()
+		for _, table := range mapping {
+			if _, err := cleanupDB.Exec("DROP TABLE IF EXISTS " + table + ";"); err != nil {
+				t.Error("Can't drop table:", err)
+			}
+		}
+	})
+	return db, mapping
+}
+
+type mysqlUserTestBinding struct {
+	t           *testing.T
+	emailUnique string
+}
+
+func (b mysqlUserTestBinding) BeginInstance() gopherbouncedb.UserStorage {
+	db, mapping := openDB(b.t)
+	mapping["$EMAIL_UNIQUE$"] = b.emailUnique
+	res, err := NewMySQLUserStorage(db, mapping, 0)
+	if err != nil {
+		b.t.Fatal("Can't create storage:", err)
+	}
+	return res
+}
+
+func (b mysqlUserTestBinding) CloseInstance(s gopherbouncedb.UserStorage) {
+	s.(*MySQLUserStorage).UserDB.Close()
+}
+
+type mysqlSessionTestBinding struct {
+	t *testing.T
+}
+
+func (b mysqlSessionTestBinding) BeginInstance() gopherbouncedb.SessionStorage {
+	db, mapping := openDB(b.t)
+	return NewMySQLSessionStorage(db, mapping)
+}
+
+func (b mysqlSessionTestBinding) CloseInstance(s gopherbouncedb.SessionStorage) {
+	s.(*MySQLSessionStorage).SessionDB.Close()
+}
+
+type mysqlHistoryTestBinding struct {
+	t *testing.T
+}
+
+func (b mysqlHistoryTestBinding) BeginInstance(maxEntries int) gopherbouncedb.PasswordHistoryStorage {
+	db, mapping := openDB(b.t)
+	res := NewMySQLPasswordHistoryStorage(db, mapping)
+	res.MaxEntries = maxEntries
+	return res
+}
+
+func (b mysqlHistoryTestBinding) CloseInstance(s gopherbouncedb.PasswordHistoryStorage) {
+	s.(*MySQLPasswordHistoryStorage).HistoryDB.Close()
+}
+
+func TestUsers(t *testing.T) {
+	b := mysqlUserTestBinding{t: t, emailUnique: "UNIQUE"}
+	testsuite.TestInitSuite(b, t)
+	testsuite.TestInsertSuite(b, true, t)
+	testsuite.TestLookupSuite(b, true, t)
+	testsuite.TestUpdateUserSuite(b, true, t)
+	testsuite.TestDeleteUserSuite(b, true, t)
+	testsuite.TestPasswordExpirySuite(b, t)
+	testsuite.TestAuthenticatorSuite(b, t)
+	testsuite.TestExportImportSuite(b, t)
+	testsuite.TestImportConflictSuite(b, t)
+	testsuite.TestBatchUserSuite(b, true, t)
+	testsuite.TestUserLifecycleSuite(b, t)
+	testsuite.TestStreamSuite(b, t)
+}
+
+func TestUsersMailNotUnique(t *testing.T) {
+	b := mysqlUserTestBinding{t: t}
+	testsuite.TestInsertSuite(b, false, t)
+	testsuite.TestLookupSuite(b, false, t)
+	testsuite.TestBatchUserSuite(b, false, t)
+}
+
+func TestSessions(t *testing.T) {
+	b := mysqlSessionTestBinding{t: t}
+	testsuite.TestInitSessionSuite(b, t)
+	testsuite.TestSessionInsert(b, t)
+	testsuite.TestSessionGet(b, t)
+	testsuite.TestSessionDelete(b, t)
+	testsuite.TestSessionCleanUp(b, t)
+	testsuite.TestSessionDeleteForUser(b, t)
+	testsuite.TestBatchSessionSuite(b, t)
+	testsuite.TestSessionLifecycleSuite(b, t)
+}
+
+type mysqlAttributeTestBinding struct {
+	t *testing.T
+}
+
+func (b mysqlAttributeTestBinding) BeginInstance() gopherbouncedb.UserAttributeStorage {
+	db, mapping := openDB(b.t)
+	return NewMySQLUserAttributeStorage(db, mapping)
+}
+
+func (b mysqlAttributeTestBinding) CloseInstance(s gopherbouncedb.UserAttributeStorage) {
+	s.(*MySQLUserAttributeStorage).AttributeDB.Close()
+}
+
+func TestPasswordHistory(t *testing.T) {
+	b := mysqlHistoryTestBinding{t: t}
+	testsuite.TestPasswordHistorySuite(b, t)
+	testsuite.TestPasswordHistoryUserStorageSuite(mysqlUserTestBinding{t: t, emailUnique: "UNIQUE"}, b, t)
+}
+
+func TestUserAttributes(t *testing.T) {
+	testsuite.TestUserAttributeSuite(mysqlAttributeTestBinding{t: t}, t)
+}
+
+func TestBridge(t *testing.T) {
+	b := NewMySQLBridge()
+	expected := time.Date(2019, 10, 1, 8, 30, 0, 123456000, time.UTC)
+	values := []interface{}{
+		expected,
+		expected.In(time.FixedZone("CEST", 2*60*60)),
+		[]byte("2019-10-01 08:30:00.123456"),
+		"2019-10-01 08:30:00.123456",
+	}
+	for _, val := range values {
+		scanned := b.TimeScanType().(*interface{})
+		*scanned = val
+		got, err := b.ConvertTimeScanType(scanned)
+		if err != nil {
+			t.Errorf("Can't convert %v: %v", val, err)
+		} else if !got.Equal(expected) || got.Location() != time.UTC {
+			t.Errorf("Expected %v for %v, got %v", expected, val, got)
+		}
+	}
+	zero := b.TimeScanType().(*interface{})
+	*zero = []byte("0000-00-00 00:00:00.000000")
+	if got, err := b.ConvertTimeScanType(zero); err != nil || !got.IsZero() {
+		t.Errorf("Expected zero time, got %v (%v)", got, err)
+	}
+	if _, err := b.ConvertTimeScanType(new(interface{})); err == nil {
+		t.Error("Expected error for nil value")
+	}
+	if !b.IsDuplicateInsert(fmt.Errorf("insert failed: %w", &gomysql.MySQLError{Number: ErrDupEntry})) {
+		t.Error("Duplicate entry not detected")
+	}
+	if b.IsDuplicateUpdate(&gomysql.MySQLError{Number: 1452}) || b.IsDuplicateInsert(sql.ErrNoRows) {
+		t.Error("Other error detected as duplicate entry")
+	}
+}
+
+func TestQueries(t *testing.T) {
+	q, err := NewMySQLUserQueries(nil, CompactMaxKeyBytes)
+	if err != nil {
+		t.Fatal("Can't create queries:", err)
+	}
+	// the default email length is too long for 767 bytes
+	for _, key := range []string{"UNIQUE KEY auth_user_username_key (username)",
+		"UNIQUE KEY auth_user_email_key (email(191))"} {
+		if !strings.Contains(q.InitS[0], key) {
+			t.Errorf("Expected key %q in %s", key, q.InitS[0])
+		}
+	}
+	q, err = NewMySQLUserQueries(map[string]string{"$EMAIL_UNIQUE$": ""}, 0)
+	if err != nil {
+		t.Fatal("Can't create queries:", err)
+	}
+	if key := "KEY auth_user_email_key (email)"; !strings.Contains(q.InitS[0], key) ||
+		strings.Contains(q.InitS[0], "UNIQUE "+key) {
+		t.Errorf("Expected non-unique key %q in %s", key, q.InitS[0])
+	}
+	expected := "UPDATE auth_user SET `last_name`=?, `email`=? WHERE id=?;"
+	if got := q.UpdateUser([]string{"LastName", "email"}); got != expected {
+		t.Errorf("Expected query %q, got %q", expected, got)
+	}
+	if _, err := NewMySQLUserQueries(map[string]string{"$EMAIL_MAX_LEN$": "foo"}, 0); err == nil {
+		t.Error("Expected error for invalid max length")
+	}
+}
@@ -0,0 +1,96 @@
+// Copyright 2019 Fabian Wenzelmann
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mysql
+
+import (
+	"database/sql"
+
+	"github.com/FabianWe/gopherbouncedb"
+)
+
+const (
+	// MySQLSessionsInit is the statement to create the sessions table.
+	MySQLSessionsInit = "CREATE TABLE IF NOT EXISTS $SESSIONS_TABLE_NAME$ (\n" +
+		"	session_key VARCHAR(128) NOT NULL,\n" +
+		"	`user` BIGINT NOT NULL,\n" +
+		"	expire_date DATETIME(6) NOT NULL,\n" +
+		"	PRIMARY KEY (session_key),\n" +
+		"	KEY $SESSIONS_TABLE_NAME$_user_key (`user`),\n" +
+		"	KEY $SESSIONS_TABLE_NAME$_expire_date_key (expire_date)\n" +
+		") $MYSQL_TABLE_OPTIONS$;"
+
+	MySQLInsertSession        = "INSERT INTO $SESSIONS_TABLE_NAME$(session_key, `user`, expire_date) VALUES(?, ?, ?);"
+	MySQLGetSession           = "SELECT session_key, `user`, expire_date FROM $SESSIONS_TABLE_NAME$ WHERE session_key=?;"
+	MySQLDeleteSession        = "DELETE FROM $SESSIONS_TABLE_NAME$ WHERE session_key=?;"
+	MySQLCleanUpSession       = "DELETE FROM $SESSIONS_TABLE_NAME$ WHERE expire_date < ?;"
+	MySQLDeleteForUserSession = "DELETE FROM $SESSIONS_TABLE_NAME$ WHERE `user`=?;"
+)
+
+// MySQLSessionQueries implements gopherbouncedb.SessionSQL for MySQL.
+type MySQLSessionQueries struct {
+	InitS []string
+	GetSessionS, InsertSessionS, DeleteSessionS,
+	CleanUpSessionS, DeleteForUserSessionS string
+	Replacer *gopherbouncedb.SQLTemplateReplacer
+}
+
+// NewMySQLSessionQueries returns new queries, see NewMySQLUserQueries.
+func NewMySQLSessionQueries(replaceMapping map[string]string) *MySQLSessionQueries {
+	replacer := newReplacer(replaceMapping)
+	res := &MySQLSessionQueries{Replacer: replacer}
+	res.InitS = []string{replacer.Apply(MySQLSessionsInit)}
+	res.GetSessionS = replacer.Apply(MySQLGetSession)
+	res.InsertSessionS = replacer.Apply(MySQLInsertSession)
+	res.DeleteSessionS = replacer.Apply(MySQLDeleteSession)
+	res.CleanUpSessionS = replacer.Apply(MySQLCleanUpSession)
+	res.DeleteForUserSessionS = replacer.Apply(MySQLDeleteForUserSession)
+	return res
+}
+
+func (q *MySQLSessionQueries) InitSessions() []string {
+	return q.InitS
+}
+
+func (q *MySQLSessionQueries) GetSession() string {
+	return q.GetSessionS
+}
+
+func (q *MySQLSessionQueries) InsertSession() string {
+	return q.InsertSessionS
+}
+
+func (q *MySQLSessionQueries) DeleteSession() string {
+	return q.DeleteSessionS
+}
+
+func (q *MySQLSessionQueries) CleanUpSession() string {
+	return q.CleanUpSessionS
+}
+
+func (q *MySQLSessionQueries) DeleteForUserSession() string {
+	return q.DeleteForUserSessionS
+}
+
+// MySQLSessionStorage is a session storage for MySQL.
+type MySQLSessionStorage struct {
+	*gopherbouncedb.SQLSessionStorage
+}
+
+// NewMySQLSessionStorage returns a new storage, see NewMySQLUserStorage.
+func NewMySQLSessionStorage(db *sql.DB, replaceMapping map[string]string) *MySQLSessionStorage {
+	queries := NewMySQLSessionQueries(replaceMapping)
+	bridge := NewMySQLBridge()
+	return &MySQLSessionStorage{gopherbouncedb.NewSQLSessionStorage(db, queries, bridge)}
+}
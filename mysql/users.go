@@ -0,0 +1,218 @@
+// Copyright 2019 Fabian Wenzelmann
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mysql
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/FabianWe/gopherbouncedb"
+)
+
+const (
+	// MySQLUsersInit is the statement to create the users table.
+	MySQLUsersInit = "CREATE TABLE IF NOT EXISTS $USERS_TABLE_NAME$ (\n" +
+		"	id BIGINT NOT NULL AUTO_INCREMENT,\n" +
+		"	username VARCHAR($USERNAME_MAX_LEN$) NOT NULL,\n" +
+		"	password VARCHAR($PASSWORD_MAX_LEN$) NOT NULL,\n" +
+		"	email VARCHAR($EMAIL_MAX_LEN$) NOT NULL,\n" +
+		"	first_name VARCHAR($FIRST_NAME_MAX_LEN$) NOT NULL,\n" +
+		"	last_name VARCHAR($LAST_NAME_MAX_LEN$) NOT NULL,\n" +
+		"	is_superuser BOOL NOT NULL,\n" +
+		"	is_staff BOOL NOT NULL,\n" +
+		"	is_active BOOL NOT NULL,\n" +
+		"	date_joined DATETIME(6) NOT NULL,\n" +
+		"	last_login DATETIME(6) NULL,\n" +
+		"	password_changed_at DATETIME(6) NOT NULL,\n" +
+		"	must_change_password BOOL NOT NULL,\n" +
+		"	PRIMARY KEY (id),\n" +
+		"	$MYSQL_USERNAME_KEY$,\n" +
+		"	$MYSQL_EMAIL_KEY$,\n" +
+		"	KEY $USERS_TABLE_NAME$_password_changed_at_key (password_changed_at)\n" +
+		") $MYSQL_TABLE_OPTIONS$;"
+
+	mysqlUserFields = "id, username, password, email, first_name, last_name, is_superuser, is_staff, is_active, date_joined, last_login, password_changed_at, must_change_password"
+
+	MySQLQueryUserID    = "SELECT " + mysqlUserFields + " FROM $USERS_TABLE_NAME$ WHERE id=?;"
+	MySQLQueryUserName  = "SELECT " + mysqlUserFields + " FROM $USERS_TABLE_NAME$ WHERE username=?;"
+	MySQLQueryUserEmail = "SELECT " + mysqlUserFields + " FROM $USERS_TABLE_NAME$ WHERE email=?;"
+	MySQLInsertUser     = "INSERT INTO $USERS_TABLE_NAME$(username, password, email, first_name, last_name, is_superuser, is_staff, is_active, date_joined, last_login, password_changed_at, must_change_password) VALUES(?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?);"
+	// MySQLUpdateUser is the update query, "$UPDATE_CONTENT$" is replaced by the
+	// assignments.
+	MySQLUpdateUser          = "UPDATE $USERS_TABLE_NAME$ SET $UPDATE_CONTENT$ WHERE id=?;"
+	MySQLDeleteUser          = "DELETE FROM $USERS_TABLE_NAME$ WHERE id=?;"
+	MySQLListUsers           = "SELECT " + mysqlUserFields + " FROM $USERS_TABLE_NAME$;"
+	MySQLListPasswordExpired = "SELECT " + mysqlUserFields + " FROM $USERS_TABLE_NAME$ WHERE " +
+		"must_change_password OR " +
+		"(is_superuser AND password_changed_at < ?) OR " +
+		"(NOT is_superuser AND is_staff AND password_changed_at < ?) OR " +
+		"(NOT is_superuser AND NOT is_staff AND password_changed_at < ?);"
+	// MySQLAllowNullLastLogin drops the NOT NULL constraint of the last login.
+	MySQLAllowNullLastLogin     = "ALTER TABLE $USERS_TABLE_NAME$ MODIFY last_login DATETIME(6) NULL;"
+	MySQLClearLastLoginSentinel = "UPDATE $USERS_TABLE_NAME$ SET last_login=NULL WHERE last_login=?;"
+	// MySQLAddPasswordColumns adds the password columns, the NOT NULL constraint
+	// of password_changed_at is added after MySQLBackfillPasswordChangedAt.
+	MySQLAddPasswordColumns = "ALTER TABLE $USERS_TABLE_NAME$ ADD COLUMN password_changed_at DATETIME(6) NULL, " +
+		"ADD COLUMN must_change_password BOOL NOT NULL DEFAULT FALSE;"
+	MySQLBackfillPasswordChangedAt = "UPDATE $USERS_TABLE_NAME$ SET password_changed_at=date_joined;"
+	MySQLRequirePasswordColumns    = "ALTER TABLE $USERS_TABLE_NAME$ MODIFY password_changed_at DATETIME(6) NOT NULL, " +
+		"ALTER COLUMN must_change_password DROP DEFAULT, " +
+		"ADD KEY $USERS_TABLE_NAME$_password_changed_at_key (password_changed_at);"
+)
+
+// MySQLUserQueries implements gopherbouncedb.UserSQL,
+// gopherbouncedb.PasswordExpirySQL, gopherbouncedb.NullLastLoginSQL and
+// gopherbouncedb.PasswordColumnsSQL for MySQL.
+//
+// Besides the variables documented in UserSQL the following variables are used:
+// "$MYSQL_TABLE_OPTIONS$" (defaults to InnoDB with utf8mb4 and the binary
+// collation, so username and email are case sensitive as with the other
+// databases), "$MYSQL_USERNAME_KEY$" and "$MYSQL_EMAIL_KEY$" (the key definitions,
+// computed with KeyPart).
+type MySQLUserQueries struct {
+	InitS []string
+	GetUserS, GetUserByNameS, GetUserByEmailS, InsertUserS,
+	UpdateUserS, DeleteUserS, ListUsersS, ListPasswordExpiredS string
+	AllowNullLastLoginS     []string
+	ClearLastLoginSentinelS string
+	AddPasswordColumnsS     []string
+	Replacer                *gopherbouncedb.SQLTemplateReplacer
+	// RowNames maps the lower case field names of UserModel to the column names.
+	RowNames map[string]string
+}
+
+// NewMySQLUserQueries returns new queries, replaceMapping (may be nil) contains
+// additional meta variables that overwrite the default values.
+//
+// maxKeyBytes is the maximal length of an index key, if username or email don't
+// fit a prefix index is used (see KeyPart). If maxKeyBytes ≤ 0 DefaultMaxKeyBytes
+// is used, use CompactMaxKeyBytes for old MySQL versions.
+// An error is returned if the max length variables are not integers.
+func NewMySQLUserQueries(replaceMapping map[string]string, maxKeyBytes int) (*MySQLUserQueries, error) {
+	replacer := newReplacer(replaceMapping)
+	if err := setUserKeys(replacer, maxKeyBytes); err != nil {
+		return nil, err
+	}
+	res := &MySQLUserQueries{Replacer: replacer}
+	res.InitS = []string{replacer.Apply(MySQLUsersInit)}
+	res.GetUserS = replacer.Apply(MySQLQueryUserID)
+	res.GetUserByNameS = replacer.Apply(MySQLQueryUserName)
+	res.GetUserByEmailS = replacer.Apply(MySQLQueryUserEmail)
+	res.InsertUserS = replacer.Apply(MySQLInsertUser)
+	res.UpdateUserS = replacer.Apply(MySQLUpdateUser)
+	res.DeleteUserS = replacer.Apply(MySQLDeleteUser)
+	res.ListUsersS = replacer.Apply(MySQLListUsers)
+	res.ListPasswordExpiredS = replacer.Apply(MySQLListPasswordExpired)
+	res.AllowNullLastLoginS = []string{replacer.Apply(MySQLAllowNullLastLogin)}
+	res.ClearLastLoginSentinelS = replacer.Apply(MySQLClearLastLoginSentinel)
+	res.AddPasswordColumnsS = []string{
+		replacer.Apply(MySQLAddPasswordColumns),
+		replacer.Apply(MySQLBackfillPasswordChangedAt),
+		replacer.Apply(MySQLRequirePasswordColumns),
+	}
+	res.RowNames = make(map[string]string, len(gopherbouncedb.DefaultUserRowNames))
+	for field, row := range gopherbouncedb.DefaultUserRowNames {
+		res.RowNames[strings.ToLower(field)] = row
+	}
+	return res, nil
+}
+
+func (q *MySQLUserQueries) InitUsers() []string {
+	return q.InitS
+}
+
+func (q *MySQLUserQueries) GetUser() string {
+	return q.GetUserS
+}
+
+func (q *MySQLUserQueries) GetUserByName() string {
+	return q.GetUserByNameS
+}
+
+func (q *MySQLUserQueries) GetUserByEmail() string {
+	return q.GetUserByEmailS
+}
+
+func (q *MySQLUserQueries) InsertUser() string {
+	return q.InsertUserS
+}
+
+// UpdateUser returns the update query for the given fields, if fields is empty all
+// fields (except the id) are updated.
+func (q *MySQLUserQueries) UpdateUser(fields []string) string {
+	if len(fields) == 0 {
+		fields = gopherbouncedb.UserUpdateFields()
+	}
+	columns := make([]string, len(fields))
+	for i, field := range fields {
+		row, has := q.RowNames[strings.ToLower(field)]
+		if !has {
+			// prepareUpdateArgs fails for invalid fields anyway, so this query is never
+			// executed
+			row = fmt.Sprintf("invalid_field_%s", field)
+		}
+		columns[i] = row
+	}
+	return strings.Replace(q.UpdateUserS, "$UPDATE_CONTENT$", assignments(columns), 1)
+}
+
+func (q *MySQLUserQueries) SupportsUserFields() bool {
+	return true
+}
+
+func (q *MySQLUserQueries) DeleteUser() string {
+	return q.DeleteUserS
+}
+
+func (q *MySQLUserQueries) ListUsers() string {
+	return q.ListUsersS
+}
+
+func (q *MySQLUserQueries) ListPasswordExpired() string {
+	return q.ListPasswordExpiredS
+}
+
+func (q *MySQLUserQueries) AllowNullLastLogin() []string {
+	return q.AllowNullLastLoginS
+}
+
+func (q *MySQLUserQueries) ClearLastLoginSentinel() string {
+	return q.ClearLastLoginSentinelS
+}
+
+func (q *MySQLUserQueries) AddPasswordColumns() []string {
+	return q.AddPasswordColumnsS
+}
+
+// MySQLUserStorage is a user storage for MySQL.
+type MySQLUserStorage struct {
+	*gopherbouncedb.SQLUserStorage
+}
+
+// NewMySQLUserStorage returns a new storage, see NewMySQLUserQueries for the
+// arguments.
+// NullLastLogin is enabled because the init queries create a last login column that
+// allows NULL.
+func NewMySQLUserStorage(db *sql.DB, replaceMapping map[string]string, maxKeyBytes int) (*MySQLUserStorage, error) {
+	queries, err := NewMySQLUserQueries(replaceMapping, maxKeyBytes)
+	if err != nil {
+		return nil, err
+	}
+	bridge := NewMySQLBridge()
+	storage := gopherbouncedb.NewSQLUserStorage(db, queries, bridge)
+	storage.NullLastLogin = true
+	return &MySQLUserStorage{storage}, nil
+}
@@ -0,0 +1,120 @@
+// Copyright 2019 Fabian Wenzelmann
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package postgres
+
+import (
+	"database/sql"
+
+	"github.com/FabianWe/gopherbouncedb"
+)
+
+const (
+	// PostgresUserAttributesInit is the statement to create the user attributes table.
+	PostgresUserAttributesInit = `CREATE TABLE IF NOT EXISTS $USER_ATTRIBUTES_TABLE_NAME$ (
+	user_id BIGINT NOT NULL,
+	name VARCHAR(128) NOT NULL,
+	value_type INTEGER NOT NULL,
+	string_value TEXT,
+	int_value BIGINT,
+	time_value TIMESTAMPTZ,
+	PRIMARY KEY (user_id, name)
+);`
+	// PostgresUserAttributesStringIndex indexes the md5 hash of the string values,
+	// this way also large (JSON) values can be stored.
+	PostgresUserAttributesStringIndex = `CREATE INDEX IF NOT EXISTS $USER_ATTRIBUTES_TABLE_NAME$_string_md5_idx ON $USER_ATTRIBUTES_TABLE_NAME$(name, md5(string_value));`
+	PostgresUserAttributesIntIndex    = `CREATE INDEX IF NOT EXISTS $USER_ATTRIBUTES_TABLE_NAME$_int_value_idx ON $USER_ATTRIBUTES_TABLE_NAME$(name, int_value);`
+	PostgresUserAttributesTimeIndex   = `CREATE INDEX IF NOT EXISTS $USER_ATTRIBUTES_TABLE_NAME$_time_value_idx ON $USER_ATTRIBUTES_TABLE_NAME$(name, time_value);`
+
+	PostgresGetUserAttributes    = `SELECT name, value_type, string_value, int_value, time_value FROM $USER_ATTRIBUTES_TABLE_NAME$ WHERE user_id=$1;`
+	PostgresInsertUserAttribute  = `INSERT INTO $USER_ATTRIBUTES_TABLE_NAME$(user_id, name, value_type, string_value, int_value, time_value) VALUES($1, $2, $3, $4, $5, $6);`
+	PostgresDeleteUserAttribute  = `DELETE FROM $USER_ATTRIBUTES_TABLE_NAME$ WHERE user_id=$1 AND name=$2;`
+	PostgresDeleteUserAttributes = `DELETE FROM $USER_ATTRIBUTES_TABLE_NAME$ WHERE user_id=$1;`
+	PostgresFindUsersByString    = `SELECT user_id FROM $USER_ATTRIBUTES_TABLE_NAME$ WHERE name=$1 AND value_type=$2 AND md5(string_value)=md5($3) AND string_value=$3 ORDER BY user_id;`
+	PostgresFindUsersByInt       = `SELECT user_id FROM $USER_ATTRIBUTES_TABLE_NAME$ WHERE name=$1 AND value_type=$2 AND int_value=$3 ORDER BY user_id;`
+	PostgresFindUsersByTime      = `SELECT user_id FROM $USER_ATTRIBUTES_TABLE_NAME$ WHERE name=$1 AND value_type=$2 AND time_value=$3 ORDER BY user_id;`
+)
+
+// PostgresUserAttributeQueries implements gopherbouncedb.UserAttributeSQL for Postgres.
+type PostgresUserAttributeQueries struct {
+	InitS                                  []string
+	GetS, InsertS, DeleteS, DeleteAllS     string
+	FindByStringS, FindByIntS, FindByTimeS string
+	Replacer                               *gopherbouncedb.SQLTemplateReplacer
+}
+
+// NewPostgresUserAttributeQueries returns new queries, see NewPostgresUserQueries.
+func NewPostgresUserAttributeQueries(replaceMapping map[string]string) *PostgresUserAttributeQueries {
+	replacer := newReplacer(replaceMapping)
+	return &PostgresUserAttributeQueries{
+		InitS: []string{
+			replacer.Apply(PostgresUserAttributesInit),
+			replacer.Apply(PostgresUserAttributesStringIndex),
+			replacer.Apply(PostgresUserAttributesIntIndex),
+			replacer.Apply(PostgresUserAttributesTimeIndex),
+		},
+		GetS:          replacer.Apply(PostgresGetUserAttributes),
+		InsertS:       replacer.Apply(PostgresInsertUserAttribute),
+		DeleteS:       replacer.Apply(PostgresDeleteUserAttribute),
+		DeleteAllS:    replacer.Apply(PostgresDeleteUserAttributes),
+		FindByStringS: replacer.Apply(PostgresFindUsersByString),
+		FindByIntS:    replacer.Apply(PostgresFindUsersByInt),
+		FindByTimeS:   replacer.Apply(PostgresFindUsersByTime),
+		Replacer:      replacer,
+	}
+}
+
+func (q *PostgresUserAttributeQueries) InitUserAttributes() []string {
+	return q.InitS
+}
+
+func (q *PostgresUserAttributeQueries) GetUserAttributes() string {
+	return q.GetS
+}
+
+func (q *PostgresUserAttributeQueries) InsertUserAttribute() string {
+	return q.InsertS
+}
+
+func (q *PostgresUserAttributeQueries) DeleteUserAttribute() string {
+	return q.DeleteS
+}
+
+func (q *PostgresUserAttributeQueries) DeleteUserAttributes() string {
+	return q.DeleteAllS
+}
+
+func (q *PostgresUserAttributeQueries) FindUsersByStringAttribute() string {
+	return q.FindByStringS
+}
+
+func (q *PostgresUserAttributeQueries) FindUsersByIntAttribute() string {
+	return q.FindByIntS
+}
+
+func (q *PostgresUserAttributeQueries) FindUsersByTimeAttribute() string {
+	return q.FindByTimeS
+}
+
+// PostgresUserAttributeStorage is a user attribute storage for Postgres.
+type PostgresUserAttributeStorage struct {
+	*gopherbouncedb.SQLUserAttributeStorage
+}
+
+// NewPostgresUserAttributeStorage returns a new storage, see NewPostgresUserStorage.
+func NewPostgresUserAttributeStorage(db *sql.DB, replaceMapping map[string]string) *PostgresUserAttributeStorage {
+	queries := NewPostgresUserAttributeQueries(replaceMapping)
+	bridge := NewPostgresBridge()
+	return &PostgresUserAttributeStorage{gopherbouncedb.NewSQLUserAttributeStorage(db, queries, bridge)}
+}
@@ -0,0 +1,93 @@
+// Copyright 2019 Fabian Wenzelmann
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package postgres
+
+import (
+	"database/sql"
+
+	"github.com/FabianWe/gopherbouncedb"
+)
+
+const (
+	// PostgresPasswordHistoryInit is the statement to create the password history table.
+	PostgresPasswordHistoryInit = `CREATE TABLE IF NOT EXISTS $PASSWORD_HISTORY_TABLE_NAME$ (
+	id BIGSERIAL PRIMARY KEY,
+	user_id BIGINT NOT NULL,
+	password VARCHAR($PASSWORD_MAX_LEN$) NOT NULL,
+	changed_at TIMESTAMPTZ NOT NULL
+);`
+	PostgresPasswordHistoryUserIndex = `CREATE INDEX IF NOT EXISTS $PASSWORD_HISTORY_TABLE_NAME$_user_id_idx ON $PASSWORD_HISTORY_TABLE_NAME$(user_id);`
+
+	PostgresInsertPasswordHistory      = `INSERT INTO $PASSWORD_HISTORY_TABLE_NAME$(user_id, password, changed_at) VALUES($1, $2, $3);`
+	PostgresGetPasswordHistory         = `SELECT id, user_id, password, changed_at FROM $PASSWORD_HISTORY_TABLE_NAME$ WHERE user_id=$1 ORDER BY changed_at DESC, id DESC;`
+	PostgresDeletePasswordHistoryEntry = `DELETE FROM $PASSWORD_HISTORY_TABLE_NAME$ WHERE id=$1;`
+	PostgresDeletePasswordHistory      = `DELETE FROM $PASSWORD_HISTORY_TABLE_NAME$ WHERE user_id=$1;`
+)
+
+// PostgresPasswordHistoryQueries implements gopherbouncedb.PasswordHistorySQL for
+// Postgres.
+type PostgresPasswordHistoryQueries struct {
+	InitS                                []string
+	InsertS, GetS, DeleteEntryS, DeleteS string
+	Replacer                             *gopherbouncedb.SQLTemplateReplacer
+}
+
+// NewPostgresPasswordHistoryQueries returns new queries, see NewPostgresUserQueries.
+func NewPostgresPasswordHistoryQueries(replaceMapping map[string]string) *PostgresPasswordHistoryQueries {
+	replacer := newReplacer(replaceMapping)
+	return &PostgresPasswordHistoryQueries{
+		InitS: []string{
+			replacer.Apply(PostgresPasswordHistoryInit),
+			replacer.Apply(PostgresPasswordHistoryUserIndex),
+		},
+		InsertS:      replacer.Apply(PostgresInsertPasswordHistory),
+		GetS:         replacer.Apply(PostgresGetPasswordHistory),
+		DeleteEntryS: replacer.Apply(PostgresDeletePasswordHistoryEntry),
+		DeleteS:      replacer.Apply(PostgresDeletePasswordHistory),
+		Replacer:     replacer,
+	}
+}
+
+func (q *PostgresPasswordHistoryQueries) InitPasswordHistory() []string {
+	return q.InitS
+}
+
+func (q *PostgresPasswordHistoryQueries) InsertPasswordHistory() string {
+	return q.InsertS
+}
+
+func (q *PostgresPasswordHistoryQueries) GetPasswordHistory() string {
+	return q.GetS
+}
+
+func (q *PostgresPasswordHistoryQueries) DeletePasswordHistoryEntry() string {
+	return q.DeleteEntryS
+}
+
+func (q *PostgresPasswordHistoryQueries) DeletePasswordHistory() string {
+	return q.DeleteS
+}
+
+// PostgresPasswordHistoryStorage is a password history storage for Postgres.
+type PostgresPasswordHistoryStorage struct {
+	*gopherbouncedb.SQLPasswordHistoryStorage
+}
+
+// NewPostgresPasswordHistoryStorage returns a new storage, see NewPostgresUserStorage.
+func NewPostgresPasswordHistoryStorage(db *sql.DB, replaceMapping map[string]string) *PostgresPasswordHistoryStorage {
+	queries := NewPostgresPasswordHistoryQueries(replaceMapping)
+	bridge := NewPostgresBridge()
+	return &PostgresPasswordHistoryStorage{gopherbouncedb.NewSQLPasswordHistoryStorage(db, queries, bridge)}
+}
@@ -0,0 +1,62 @@
+// Copyright 2019 Fabian Wenzelmann
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package postgres
+
+import (
+	"database/sql"
+
+	"github.com/FabianWe/gopherbouncedb"
+)
+
+// NewPostgresMappedUserStorage returns a storage for an existing users table described
+// by mapping, the values of the extra columns are stored in UserModel.Extensions.
+// The queries are generated with gopherbouncedb.GenerateMappedUserSQL,
+// replaceMapping (may be nil) is used as in NewPostgresUserQueries.
+func NewPostgresMappedUserStorage(db *sql.DB, mapping *gopherbouncedb.SQLTableMapping, extra []gopherbouncedb.ExtraColumn,
+	replaceMapping map[string]string) (*PostgresUserStorage, error) {
+	queries, err := gopherbouncedb.GenerateMappedUserSQL(gopherbouncedb.NewPostgresDialect(), mapping, extra, newReplacer(replaceMapping))
+	if err != nil {
+		return nil, err
+	}
+	return &PostgresUserStorage{gopherbouncedb.NewSQLUserStorage(db, queries, NewPostgresBridge())}, nil
+}
+
+// NewPostgresMappedSessionStorage returns a storage for an existing sessions table
+// described by mapping, see NewPostgresMappedUserStorage.
+func NewPostgresMappedSessionStorage(db *sql.DB, mapping *gopherbouncedb.SQLTableMapping,
+	replaceMapping map[string]string) (*PostgresSessionStorage, error) {
+	queries, err := gopherbouncedb.GenerateMappedSessionSQL(gopherbouncedb.NewPostgresDialect(), mapping, newReplacer(replaceMapping))
+	if err != nil {
+		return nil, err
+	}
+	return &PostgresSessionStorage{gopherbouncedb.NewSQLSessionStorage(db, queries, NewPostgresBridge())}, nil
+}
+
+// NewPostgresTypedUserStorage returns a storage for the application user type T, the
+// fields of T with a column tag are stored in extra columns of the table described
+// by mapping (may be nil), see gopherbouncedb.UserColumns and
+// NewPostgresMappedUserStorage.
+func NewPostgresTypedUserStorage[T any, PT gopherbouncedb.UserPtr[T]](db *sql.DB, mapping *gopherbouncedb.SQLTableMapping,
+	replaceMapping map[string]string) (*gopherbouncedb.TypedUserStorage[T, PT], error) {
+	extra, err := gopherbouncedb.UserColumns[T]()
+	if err != nil {
+		return nil, err
+	}
+	storage, err := NewPostgresMappedUserStorage(db, mapping, extra, replaceMapping)
+	if err != nil {
+		return nil, err
+	}
+	return gopherbouncedb.NewTypedUserStorage[T, PT](storage)
+}
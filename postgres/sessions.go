@@ -0,0 +1,99 @@
+// Copyright 2019 Fabian Wenzelmann
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package postgres
+
+import (
+	"database/sql"
+
+	"github.com/FabianWe/gopherbouncedb"
+)
+
+const (
+	// PostgresSessionsInit is the statement to create the sessions table.
+	PostgresSessionsInit = `CREATE TABLE IF NOT EXISTS $SESSIONS_TABLE_NAME$ (
+	session_key VARCHAR(128) NOT NULL PRIMARY KEY,
+	"user" BIGINT NOT NULL,
+	expire_date TIMESTAMPTZ NOT NULL
+);`
+	PostgresSessionsUserIndex   = `CREATE INDEX IF NOT EXISTS $SESSIONS_TABLE_NAME$_user_idx ON $SESSIONS_TABLE_NAME$("user");`
+	PostgresSessionsExpireIndex = `CREATE INDEX IF NOT EXISTS $SESSIONS_TABLE_NAME$_expire_date_idx ON $SESSIONS_TABLE_NAME$(expire_date);`
+
+	PostgresInsertSession        = `INSERT INTO $SESSIONS_TABLE_NAME$(session_key, "user", expire_date) VALUES($1, $2, $3);`
+	PostgresGetSession           = `SELECT session_key, "user", expire_date FROM $SESSIONS_TABLE_NAME$ WHERE session_key=$1;`
+	PostgresDeleteSession        = `DELETE FROM $SESSIONS_TABLE_NAME$ WHERE session_key=$1;`
+	PostgresCleanUpSession       = `DELETE FROM $SESSIONS_TABLE_NAME$ WHERE expire_date < $1;`
+	PostgresDeleteForUserSession = `DELETE FROM $SESSIONS_TABLE_NAME$ WHERE "user"=$1;`
+)
+
+// PostgresSessionQueries implements gopherbouncedb.SessionSQL for Postgres.
+type PostgresSessionQueries struct {
+	InitS []string
+	GetSessionS, InsertSessionS, DeleteSessionS,
+	CleanUpSessionS, DeleteForUserSessionS string
+	Replacer *gopherbouncedb.SQLTemplateReplacer
+}
+
+// NewPostgresSessionQueries returns new queries, see NewPostgresUserQueries.
+func NewPostgresSessionQueries(replaceMapping map[string]string) *PostgresSessionQueries {
+	replacer := newReplacer(replaceMapping)
+	res := &PostgresSessionQueries{Replacer: replacer}
+	res.InitS = []string{
+		replacer.Apply(PostgresSessionsInit),
+		replacer.Apply(PostgresSessionsUserIndex),
+		replacer.Apply(PostgresSessionsExpireIndex),
+	}
+	res.GetSessionS = replacer.Apply(PostgresGetSession)
+	res.InsertSessionS = replacer.Apply(PostgresInsertSession)
+	res.DeleteSessionS = replacer.Apply(PostgresDeleteSession)
+	res.CleanUpSessionS = replacer.Apply(PostgresCleanUpSession)
+	res.DeleteForUserSessionS = replacer.Apply(PostgresDeleteForUserSession)
+	return res
+}
+
+func (q *PostgresSessionQueries) InitSessions() []string {
+	return q.InitS
+}
+
+func (q *PostgresSessionQueries) GetSession() string {
+	return q.GetSessionS
+}
+
+func (q *PostgresSessionQueries) InsertSession() string {
+	return q.InsertSessionS
+}
+
+func (q *PostgresSessionQueries) DeleteSession() string {
+	return q.DeleteSessionS
+}
+
+func (q *PostgresSessionQueries) CleanUpSession() string {
+	return q.CleanUpSessionS
+}
+
+func (q *PostgresSessionQueries) DeleteForUserSession() string {
+	return q.DeleteForUserSessionS
+}
+
+// PostgresSessionStorage is a session storage for Postgres.
+type PostgresSessionStorage struct {
+	*gopherbouncedb.SQLSessionStorage
+}
+
+// NewPostgresSessionStorage returns a new storage, see NewPostgresUserStorage.
+func NewPostgresSessionStorage(db *sql.DB, replaceMapping map[string]string) *PostgresSessionStorage {
+	queries := NewPostgresSessionQueries(replaceMapping)
+	bridge := NewPostgresBridge()
+	return &PostgresSessionStorage{gopherbouncedb.NewSQLSessionStorage(db, queries, bridge)}
+}
@@ -0,0 +1,214 @@
+// Copyright 2019 Fabian Wenzelmann
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package postgres
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/FabianWe/gopherbouncedb"
+)
+
+const (
+	// PostgresUsersInit is the statement to create the users table.
+	PostgresUsersInit = `CREATE TABLE IF NOT EXISTS $USERS_TABLE_NAME$ (
+	id BIGSERIAL PRIMARY KEY,
+	username VARCHAR($USERNAME_MAX_LEN$) NOT NULL UNIQUE,
+	password VARCHAR($PASSWORD_MAX_LEN$) NOT NULL,
+	email VARCHAR($EMAIL_MAX_LEN$) NOT NULL $EMAIL_UNIQUE$,
+	first_name VARCHAR($FIRST_NAME_MAX_LEN$) NOT NULL,
+	last_name VARCHAR($LAST_NAME_MAX_LEN$) NOT NULL,
+	is_superuser BOOLEAN NOT NULL,
+	is_staff BOOLEAN NOT NULL,
+	is_active BOOLEAN NOT NULL,
+	date_joined TIMESTAMPTZ NOT NULL,
+	last_login TIMESTAMPTZ,
+	password_changed_at TIMESTAMPTZ NOT NULL,
+	must_change_password BOOLEAN NOT NULL
+);`
+	// PostgresUsersEmailIndex creates an index on the email, it's only used if the
+	// email is not unique (unique columns have an index anyway).
+	PostgresUsersEmailIndex = `CREATE INDEX IF NOT EXISTS $USERS_TABLE_NAME$_email_idx ON $USERS_TABLE_NAME$(email);`
+	// PostgresUsersPasswordChangedIndex creates an index used by ListPasswordExpired.
+	PostgresUsersPasswordChangedIndex = `CREATE INDEX IF NOT EXISTS $USERS_TABLE_NAME$_password_changed_at_idx ON $USERS_TABLE_NAME$(password_changed_at);`
+
+	postgresUserFields = `id, username, password, email, first_name, last_name, is_superuser, is_staff, is_active, date_joined, last_login, password_changed_at, must_change_password`
+
+	PostgresQueryUserID    = `SELECT ` + postgresUserFields + ` FROM $USERS_TABLE_NAME$ WHERE id=$1;`
+	PostgresQueryUserName  = `SELECT ` + postgresUserFields + ` FROM $USERS_TABLE_NAME$ WHERE username=$1;`
+	PostgresQueryUserEmail = `SELECT ` + postgresUserFields + ` FROM $USERS_TABLE_NAME$ WHERE email=$1;`
+	PostgresInsertUser     = `INSERT INTO $USERS_TABLE_NAME$(username, password, email, first_name, last_name, is_superuser, is_staff, is_active, date_joined, last_login, password_changed_at, must_change_password) VALUES($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12) RETURNING id;`
+	// PostgresUpdateUser is the update query, "$UPDATE_CONTENT$" is replaced by the
+	// assignments and "$ID_ARG$" by the placeholder of the id.
+	PostgresUpdateUser          = `UPDATE $USERS_TABLE_NAME$ SET $UPDATE_CONTENT$ WHERE id=$ID_ARG$;`
+	PostgresDeleteUser          = `DELETE FROM $USERS_TABLE_NAME$ WHERE id=$1;`
+	PostgresListUsers           = `SELECT ` + postgresUserFields + ` FROM $USERS_TABLE_NAME$;`
+	PostgresListPasswordExpired = `SELECT ` + postgresUserFields + ` FROM $USERS_TABLE_NAME$ WHERE
+	must_change_password OR
+	(is_superuser AND password_changed_at < $1) OR
+	(NOT is_superuser AND is_staff AND password_changed_at < $2) OR
+	(NOT is_superuser AND NOT is_staff AND password_changed_at < $3);`
+	// PostgresAllowNullLastLogin drops the NOT NULL constraint of the last login.
+	PostgresAllowNullLastLogin     = `ALTER TABLE $USERS_TABLE_NAME$ ALTER COLUMN last_login DROP NOT NULL;`
+	PostgresClearLastLoginSentinel = `UPDATE $USERS_TABLE_NAME$ SET last_login=NULL WHERE last_login=$1;`
+	// PostgresAddPasswordColumns adds the password columns, the NOT NULL constraint
+	// of password_changed_at is added after PostgresBackfillPasswordChangedAt.
+	PostgresAddPasswordColumns = `ALTER TABLE $USERS_TABLE_NAME$ ADD COLUMN password_changed_at TIMESTAMPTZ,
+	ADD COLUMN must_change_password BOOLEAN NOT NULL DEFAULT FALSE;`
+	PostgresBackfillPasswordChangedAt = `UPDATE $USERS_TABLE_NAME$ SET password_changed_at=date_joined;`
+	PostgresRequirePasswordColumns    = `ALTER TABLE $USERS_TABLE_NAME$ ALTER COLUMN password_changed_at SET NOT NULL,
+	ALTER COLUMN must_change_password DROP DEFAULT;`
+)
+
+// PostgresUserQueries implements gopherbouncedb.UserSQL,
+// gopherbouncedb.PasswordExpirySQL, gopherbouncedb.InsertReturningSQL,
+// gopherbouncedb.NullLastLoginSQL and gopherbouncedb.PasswordColumnsSQL for Postgres.
+type PostgresUserQueries struct {
+	InitS []string
+	GetUserS, GetUserByNameS, GetUserByEmailS, InsertUserS,
+	UpdateUserS, DeleteUserS, ListUsersS, ListPasswordExpiredS string
+	AllowNullLastLoginS     []string
+	ClearLastLoginSentinelS string
+	AddPasswordColumnsS     []string
+	Replacer                *gopherbouncedb.SQLTemplateReplacer
+	// RowNames maps the lower case field names of UserModel to the column names.
+	RowNames map[string]string
+}
+
+// NewPostgresUserQueries returns new queries, replaceMapping (may be nil) contains
+// additional meta variables that overwrite the default values.
+func NewPostgresUserQueries(replaceMapping map[string]string) *PostgresUserQueries {
+	replacer := newReplacer(replaceMapping)
+	res := &PostgresUserQueries{Replacer: replacer}
+	res.InitS = []string{
+		replacer.Apply(PostgresUsersInit),
+		replacer.Apply(PostgresUsersPasswordChangedIndex),
+	}
+	if strings.TrimSpace(replacer.Apply("$EMAIL_UNIQUE$")) == "" {
+		res.InitS = append(res.InitS, replacer.Apply(PostgresUsersEmailIndex))
+	}
+	res.GetUserS = replacer.Apply(PostgresQueryUserID)
+	res.GetUserByNameS = replacer.Apply(PostgresQueryUserName)
+	res.GetUserByEmailS = replacer.Apply(PostgresQueryUserEmail)
+	res.InsertUserS = replacer.Apply(PostgresInsertUser)
+	res.UpdateUserS = replacer.Apply(PostgresUpdateUser)
+	res.DeleteUserS = replacer.Apply(PostgresDeleteUser)
+	res.ListUsersS = replacer.Apply(PostgresListUsers)
+	res.ListPasswordExpiredS = replacer.Apply(PostgresListPasswordExpired)
+	res.AllowNullLastLoginS = []string{replacer.Apply(PostgresAllowNullLastLogin)}
+	res.ClearLastLoginSentinelS = replacer.Apply(PostgresClearLastLoginSentinel)
+	res.AddPasswordColumnsS = []string{
+		replacer.Apply(PostgresAddPasswordColumns),
+		replacer.Apply(PostgresBackfillPasswordChangedAt),
+		replacer.Apply(PostgresRequirePasswordColumns),
+		replacer.Apply(PostgresUsersPasswordChangedIndex),
+	}
+	res.RowNames = make(map[string]string, len(gopherbouncedb.DefaultUserRowNames))
+	for field, row := range gopherbouncedb.DefaultUserRowNames {
+		res.RowNames[strings.ToLower(field)] = row
+	}
+	return res
+}
+
+func (q *PostgresUserQueries) InitUsers() []string {
+	return q.InitS
+}
+
+func (q *PostgresUserQueries) GetUser() string {
+	return q.GetUserS
+}
+
+func (q *PostgresUserQueries) GetUserByName() string {
+	return q.GetUserByNameS
+}
+
+func (q *PostgresUserQueries) GetUserByEmail() string {
+	return q.GetUserByEmailS
+}
+
+func (q *PostgresUserQueries) InsertUser() string {
+	return q.InsertUserS
+}
+
+// InsertReturnsID returns true, the id is returned by InsertUser.
+func (q *PostgresUserQueries) InsertReturnsID() bool {
+	return true
+}
+
+// UpdateUser returns the update query for the given fields, if fields is empty all
+// fields (except the id) are updated.
+func (q *PostgresUserQueries) UpdateUser(fields []string) string {
+	if len(fields) == 0 {
+		fields = gopherbouncedb.UserUpdateFields()
+	}
+	columns := make([]string, len(fields))
+	for i, field := range fields {
+		row, has := q.RowNames[strings.ToLower(field)]
+		if !has {
+			// prepareUpdateArgs fails for invalid fields anyway, so this query is never
+			// executed
+			row = fmt.Sprintf("invalid_field_%s", field)
+		}
+		columns[i] = row
+	}
+	return strings.NewReplacer("$UPDATE_CONTENT$", assignments(columns),
+		"$ID_ARG$", fmt.Sprintf("$%d", len(columns)+1)).Replace(q.UpdateUserS)
+}
+
+func (q *PostgresUserQueries) SupportsUserFields() bool {
+	return true
+}
+
+func (q *PostgresUserQueries) DeleteUser() string {
+	return q.DeleteUserS
+}
+
+func (q *PostgresUserQueries) ListUsers() string {
+	return q.ListUsersS
+}
+
+func (q *PostgresUserQueries) ListPasswordExpired() string {
+	return q.ListPasswordExpiredS
+}
+
+func (q *PostgresUserQueries) AllowNullLastLogin() []string {
+	return q.AllowNullLastLoginS
+}
+
+func (q *PostgresUserQueries) ClearLastLoginSentinel() string {
+	return q.ClearLastLoginSentinelS
+}
+
+func (q *PostgresUserQueries) AddPasswordColumns() []string {
+	return q.AddPasswordColumnsS
+}
+
+// PostgresUserStorage is a user storage for Postgres.
+type PostgresUserStorage struct {
+	*gopherbouncedb.SQLUserStorage
+}
+
+// NewPostgresUserStorage returns a new storage, replaceMapping (may be nil) is used
+// as in NewPostgresUserQueries.
+// NullLastLogin is enabled because the init queries create a last login column that
+// allows NULL.
+func NewPostgresUserStorage(db *sql.DB, replaceMapping map[string]string) *PostgresUserStorage {
+	queries := NewPostgresUserQueries(replaceMapping)
+	bridge := NewPostgresBridge()
+	storage := gopherbouncedb.NewSQLUserStorage(db, queries, bridge)
+	storage.NullLastLogin = true
+	return &PostgresUserStorage{storage}
+}
@@ -0,0 +1,371 @@
+// Copyright 2019 Fabian Wenzelmann
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gopherbouncedb
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// PasswordRule is a single named rule of a PasswordPolicy.
+//
+// Code is a short identifier of the rule (for example "min_length") and Message a
+// human-readable description that is shown to the user if the rule is violated.
+// Verify returns true if the password fulfills the rule, the user is the user the
+// password belongs to (can be nil if unknown).
+type PasswordRule struct {
+	Code    string
+	Message string
+	Verify  func(pw string, u *UserModel) bool
+}
+
+// NewPasswordRule returns a new rule given a PasswordVerifier, the user is ignored.
+func NewPasswordRule(code, message string, verifier PasswordVerifier) PasswordRule {
+	return PasswordRule{
+		Code:    code,
+		Message: message,
+		Verify: func(pw string, u *UserModel) bool {
+			return verifier(pw)
+		},
+	}
+}
+
+// PasswordPolicyViolation describes a violated rule, see PasswordRule.
+type PasswordPolicyViolation struct {
+	Code    string
+	Message string
+}
+
+// PasswordPolicyErr is returned if a password violates one or more rules of a
+// policy, it contains all violated rules.
+type PasswordPolicyErr []PasswordPolicyViolation
+
+// Error returns the error string.
+func (e PasswordPolicyErr) Error() string {
+	messages := make([]string, len(e))
+	for i, violation := range e {
+		messages[i] = violation.Message
+	}
+	return "password policy violated: " + strings.Join(messages, "; ")
+}
+
+// Messages returns all messages of the violated rules.
+func (e PasswordPolicyErr) Messages() []string {
+	res := make([]string, len(e))
+	for i, violation := range e {
+		res[i] = violation.Message
+	}
+	return res
+}
+
+var (
+	// PasswordClasses maps the names of the rune classes that can be used in a
+	// PasswordPolicy to the class.
+	PasswordClasses = map[string]RuneClass{
+		"lower":   LowerLetterClass,
+		"upper":   UpperLetterClass,
+		"digit":   DigitClass,
+		"special": SpecialCharacterClass,
+	}
+
+	// DefaultForbiddenSequences contains some sequences that are often found in weak
+	// passwords.
+	DefaultForbiddenSequences = []string{
+		"0123", "1234", "2345", "3456", "4567", "5678", "6789",
+		"abcd", "qwert", "asdf", "yxcv", "zxcv", "password",
+	}
+)
+
+// PasswordPolicy is a named set of password rules.
+//
+// The policy is described by the exported fields, this way it can be stored in and
+// loaded from JSON, see LoadPasswordPolicy.
+// All numeric values ≤ 0 disable the rule.
+//
+// MinLength and MaxLength are the length limits (in runes), see PWLenVerifier.
+// RequiredClasses is a list of class names (keys from PasswordClasses) that all must
+// be contained in the password, see PWContainsAll.
+// Classes and MinClasses require that at least MinClasses different classes from
+// Classes are contained, see PWContainsAtLeast.
+// MaxRepeated is the maximal number a single character may be repeated in a row, for
+// example 2 forbids "aaa".
+// ForbiddenSequences contains strings that must not be contained in the password
+// (case insensitive).
+// If ForbidUserInfo is true the password must not contain the username, email,
+// first name or last name of the user.
+// MinStrength is the minimal score (1 to 4) from EstimatePasswordStrength, the user
+// information is considered guessable by the estimator.
+//
+// Additional rules that can't be serialized can be added to Extra.
+type PasswordPolicy struct {
+	Name               string         `json:"name"`
+	MinLength          int            `json:"min_length"`
+	MaxLength          int            `json:"max_length"`
+	RequiredClasses    []string       `json:"required_classes,omitempty"`
+	Classes            []string       `json:"classes,omitempty"`
+	MinClasses         int            `json:"min_classes"`
+	MaxRepeated        int            `json:"max_repeated"`
+	ForbiddenSequences []string       `json:"forbidden_sequences,omitempty"`
+	ForbidUserInfo     bool           `json:"forbid_user_info"`
+	MinStrength        int            `json:"min_strength"`
+	Extra              []PasswordRule `json:"-"`
+}
+
+// DefaultPasswordPolicy returns a policy that requires at least 8 characters, three
+// of the four classes lower, upper, digit and special, not more than three repeated
+// characters and forbids the DefaultForbiddenSequences and user information.
+func DefaultPasswordPolicy() *PasswordPolicy {
+	forbidden := make([]string, len(DefaultForbiddenSequences))
+	copy(forbidden, DefaultForbiddenSequences)
+	return &PasswordPolicy{
+		Name:               "default",
+		MinLength:          8,
+		MaxLength:          -1,
+		Classes:            []string{"lower", "upper", "digit", "special"},
+		MinClasses:         3,
+		MaxRepeated:        3,
+		ForbiddenSequences: forbidden,
+		ForbidUserInfo:     true,
+	}
+}
+
+// LoadPasswordPolicy reads a policy in JSON format from r and validates it.
+// Unknown keys are an error, this way a rule that is misspelled or not supported is
+// not silently ignored.
+func LoadPasswordPolicy(r io.Reader) (*PasswordPolicy, error) {
+	var policy PasswordPolicy
+	dec := json.NewDecoder(r)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&policy); err != nil {
+		return nil, fmt.Errorf("can't parse password policy: %w", err)
+	}
+	if err := policy.Validate(); err != nil {
+		return nil, err
+	}
+	return &policy, nil
+}
+
+// WriteJSON writes the policy in JSON format to w.
+func (p *PasswordPolicy) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(p)
+}
+
+func lookupClasses(names []string) ([]RuneClass, error) {
+	res := make([]RuneClass, len(names))
+	for i, name := range names {
+		class, has := PasswordClasses[name]
+		if !has {
+			return nil, fmt.Errorf("unknown password class \"%s\"", name)
+		}
+		res[i] = class
+	}
+	return res, nil
+}
+
+// Validate tests if the policy is consistent, for example if all class names are
+// known.
+func (p *PasswordPolicy) Validate() error {
+	if _, err := lookupClasses(p.RequiredClasses); err != nil {
+		return err
+	}
+	if _, err := lookupClasses(p.Classes); err != nil {
+		return err
+	}
+	if p.MinClasses > len(p.Classes) {
+		return fmt.Errorf("password policy requires %d classes, but only %d classes are given",
+			p.MinClasses, len(p.Classes))
+	}
+	if p.MinStrength > 4 {
+		return fmt.Errorf("password policy min strength must be between 0 and 4, got %d", p.MinStrength)
+	}
+	if p.MinLength > 0 && p.MaxLength > 0 && p.MinLength > p.MaxLength {
+		return fmt.Errorf("password policy min length %d is greater than max length %d",
+			p.MinLength, p.MaxLength)
+	}
+	return nil
+}
+
+// Rules returns all rules described by the policy, including Extra.
+// It returns an error if the policy is not valid.
+func (p *PasswordPolicy) Rules() ([]PasswordRule, error) {
+	if err := p.Validate(); err != nil {
+		return nil, err
+	}
+	res := make([]PasswordRule, 0, 8+len(p.Extra))
+	if p.MinLength > 0 {
+		res = append(res, NewPasswordRule("min_length",
+			fmt.Sprintf("password must be at least %d characters long", p.MinLength),
+			PWLenVerifier(p.MinLength, -1)))
+	}
+	if p.MaxLength > 0 {
+		res = append(res, NewPasswordRule("max_length",
+			fmt.Sprintf("password must not be longer than %d characters", p.MaxLength),
+			PWLenVerifier(-1, p.MaxLength)))
+	}
+	if len(p.RequiredClasses) > 0 {
+		classes, _ := lookupClasses(p.RequiredClasses)
+		res = append(res, NewPasswordRule("required_classes",
+			fmt.Sprintf("password must contain characters of each of the classes %s",
+				strings.Join(p.RequiredClasses, ", ")),
+			PWContainsAll(classes)))
+	}
+	if p.MinClasses > 0 {
+		classes, _ := lookupClasses(p.Classes)
+		res = append(res, NewPasswordRule("min_classes",
+			fmt.Sprintf("password must contain characters of at least %d of the classes %s",
+				p.MinClasses, strings.Join(p.Classes, ", ")),
+			PWContainsAtLeast(classes, p.MinClasses)))
+	}
+	if p.MaxRepeated > 0 {
+		res = append(res, NewPasswordRule("max_repeated",
+			fmt.Sprintf("password must not repeat a character more than %d times in a row", p.MaxRepeated),
+			PWMaxRepeated(p.MaxRepeated)))
+	}
+	if len(p.ForbiddenSequences) > 0 {
+		res = append(res, NewPasswordRule("forbidden_sequences",
+			"password must not contain common sequences",
+			PWForbiddenSequences(p.ForbiddenSequences)))
+	}
+	if p.ForbidUserInfo {
+		res = append(res, PasswordRule{
+			Code:    "user_info",
+			Message: "password must not contain the username, email or name",
+			Verify:  pwNoUserInfo,
+		})
+	}
+	if p.MinStrength > 0 {
+		minStrength := p.MinStrength
+		res = append(res, PasswordRule{
+			Code:    "min_strength",
+			Message: "password is too easy to guess",
+			Verify: func(pw string, u *UserModel) bool {
+				return EstimatePasswordStrength(pw, userInfo(u)...).Score >= minStrength
+			},
+		})
+	}
+	res = append(res, p.Extra...)
+	return res, nil
+}
+
+// Check tests the password against all rules of the policy.
+// The user is the user the password belongs to, it is only required for
+// ForbidUserInfo and can be nil.
+//
+// It returns nil if all rules are fulfilled and an error of type PasswordPolicyErr
+// containing all violated rules otherwise.
+// If the policy itself is not valid the error from Validate is returned.
+func (p *PasswordPolicy) Check(pw string, u *UserModel) error {
+	rules, rulesErr := p.Rules()
+	if rulesErr != nil {
+		return rulesErr
+	}
+	var violations PasswordPolicyErr
+	for _, rule := range rules {
+		if !rule.Verify(pw, u) {
+			violations = append(violations, PasswordPolicyViolation{Code: rule.Code, Message: rule.Message})
+		}
+	}
+	if len(violations) == 0 {
+		return nil
+	}
+	return violations
+}
+
+// Verifier returns the policy as a PasswordVerifier, rules that require a user are
+// tested without a user.
+func (p *PasswordPolicy) Verifier() PasswordVerifier {
+	return func(pw string) bool {
+		return p.Check(pw, nil) == nil
+	}
+}
+
+// PWMaxRepeated is a generator that returns a PasswordVerifier.
+//
+// The returned verifier tests that no character is repeated more than n times in a row.
+func PWMaxRepeated(n int) PasswordVerifier {
+	return func(pw string) bool {
+		var last rune
+		count := 0
+		for _, char := range pw {
+			if count > 0 && char == last {
+				count++
+			} else {
+				last = char
+				count = 1
+			}
+			if count > n {
+				return false
+			}
+		}
+		return true
+	}
+}
+
+// PWForbiddenSequences is a generator that returns a PasswordVerifier.
+//
+// The returned verifier tests that the password (case insensitive) does not contain any
+// of the sequences.
+func PWForbiddenSequences(sequences []string) PasswordVerifier {
+	lower := make([]string, 0, len(sequences))
+	for _, seq := range sequences {
+		if seq != "" {
+			lower = append(lower, strings.ToLower(seq))
+		}
+	}
+	return func(pw string) bool {
+		pw = strings.ToLower(pw)
+		for _, seq := range lower {
+			if strings.Contains(pw, seq) {
+				return false
+			}
+		}
+		return true
+	}
+}
+
+// minUserInfoLen is the minimal length of user information to be tested in
+// pwNoUserInfo, shorter parts (like a first name "Al") are ignored.
+const minUserInfoLen = 3
+
+// userInfo returns the information about a user that should not be part of the
+// password.
+func userInfo(u *UserModel) []string {
+	if u == nil {
+		return nil
+	}
+	infos := []string{u.Username, u.EMail, u.FirstName, u.LastName}
+	if at := strings.Index(u.EMail, "@"); at > 0 {
+		infos = append(infos, u.EMail[:at])
+	}
+	return infos
+}
+
+func pwNoUserInfo(pw string, u *UserModel) bool {
+	pw = strings.ToLower(pw)
+	for _, info := range userInfo(u) {
+		info = strings.ToLower(strings.TrimSpace(info))
+		if len([]rune(info)) < minUserInfoLen {
+			continue
+		}
+		if strings.Contains(pw, info) {
+			return false
+		}
+	}
+	return true
+}
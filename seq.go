@@ -0,0 +1,109 @@
+// Copyright 2019 Fabian Wenzelmann
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build go1.23
+
+package gopherbouncedb
+
+import "iter"
+
+// AllUsers returns an iterator over all users in the storage.
+//
+// The users are retrieved with ListUsers, the UserIterator is closed when the loop
+// ends (also if it is left early with break).
+// If an error occurs it is yielded with a nil user and the iteration stops.
+//
+//	for u, err := range AllUsers(storage) {
+//		if err != nil {
+//			return err
+//		}
+//		...
+//	}
+func AllUsers(storage UserStorage) iter.Seq2[*UserModel, error] {
+	return func(yield func(*UserModel, error) bool) {
+		it, err := storage.ListUsers()
+		if err != nil {
+			yield(nil, err)
+			return
+		}
+		UsersSeq(it)(yield)
+	}
+}
+
+// UsersSeq returns an iterator over all users from it, see AllUsers.
+// The returned iterator can only be used once, it is closed after the loop.
+func UsersSeq(it UserIterator) iter.Seq2[*UserModel, error] {
+	return func(yield func(*UserModel, error) bool) {
+		defer it.Close()
+		for it.HasNext() {
+			u, err := it.Next()
+			if err != nil {
+				yield(nil, err)
+				return
+			}
+			if !yield(u, nil) {
+				return
+			}
+		}
+		if err := it.Err(); err != nil {
+			yield(nil, err)
+		}
+	}
+}
+
+// seqUserIterator is a UserIterator for an iter.Seq2.
+type seqUserIterator struct {
+	next func() (*UserModel, error, bool)
+	stop func()
+	user *UserModel
+	err  error
+}
+
+// SeqUserIterator returns a UserIterator that returns the users from seq.
+// The iteration stops at the first error (returned by Err).
+// Close must be called to release the resources of seq (if the iteration is not
+// finished).
+func SeqUserIterator(seq iter.Seq2[*UserModel, error]) UserIterator {
+	next, stop := iter.Pull2(seq)
+	return &seqUserIterator{next: next, stop: stop}
+}
+
+func (it *seqUserIterator) HasNext() bool {
+	if it.err != nil {
+		return false
+	}
+	u, err, ok := it.next()
+	if !ok {
+		return false
+	}
+	if err != nil {
+		it.err = err
+		return false
+	}
+	it.user = u
+	return true
+}
+
+func (it *seqUserIterator) Next() (*UserModel, error) {
+	return it.user, nil
+}
+
+func (it *seqUserIterator) Err() error {
+	return it.err
+}
+
+func (it *seqUserIterator) Close() error {
+	it.stop()
+	return nil
+}
@@ -15,32 +15,26 @@
 package gopherbouncedb
 
 import (
+	"context"
 	"database/sql"
+	"encoding/json"
 	"fmt"
-	"reflect"
 	"strings"
+	"sync/atomic"
 	"time"
 )
 
 var (
 	// DefaultUserRowNames maps the fields from UserModel (as strings)
 	// to the default name of a sql row.
-	DefaultUserRowNames = map[string]string{
-		"ID":          "id",
-		"FirstName":   "first_name",
-		"LastName":    "last_name",
-		"Username":    "username",
-		"EMail":       "email",
-		"Password":    "password",
-		"IsActive":    "is_active",
-		"IsSuperUser": "is_superuser",
-		"IsStaff":     "is_staff",
-		"DateJoined":  "date_joined",
-		"LastLogin":   "last_login",
-	}
+	// It is used by GenerateUserSQL and for all fields not mapped in a
+	// SQLTableMapping.
+	// The names are taken from UserFields.
+	DefaultUserRowNames = userRowNames()
 
 	// DefaultSessionRowNames maps the fields from SessionEntry (as strings)
 	// to the default name of a sql row.
+	// It is used as DefaultUserRowNames.
 	DefaultSessionRowNames = map[string]string{
 		"User": "user",
 		"Key": "session_key",
@@ -77,14 +71,28 @@ func NewSQLTemplateReplacer() *SQLTemplateReplacer {
 
 // DefaultSQLReplacer returns a new SQLTemplateReplacer that takes care that all variables
 // mentioned in the documentation of UserSQL are mapped to their default values.
+// The field lengths are taken from StandardUserSchemaLimits, the limits also used by
+// the CheckXMaxLen functions.
 func DefaultSQLReplacer() *SQLTemplateReplacer {
 	res := NewSQLTemplateReplacer()
 	values := map[string]string{
 		"$USERS_TABLE_NAME$": "auth_user",
 		"$EMAIL_UNIQUE$":     "UNIQUE",
 		"$SESSIONS_TABLE_NAME$": "auth_session",
+		"$PASSWORD_HISTORY_TABLE_NAME$": "auth_password_history",
+		"$USER_ATTRIBUTES_TABLE_NAME$": "auth_user_attribute",
 	}
 	res.UpdateDict(values)
+	StandardUserSchemaLimits.ApplyTo(res)
+	return res
+}
+
+// SQLReplacerWithLimits returns the DefaultSQLReplacer but with the field lengths
+// taken from the given limits.
+// The same limits should be used to validate users before inserting them.
+func SQLReplacerWithLimits(limits *UserSchemaLimits) *SQLTemplateReplacer {
+	res := DefaultSQLReplacer()
+	limits.ApplyTo(res)
 	return res
 }
 
@@ -259,6 +267,14 @@ type SQLBridge interface {
 // as well. This should be fine with most sql implementations.
 // If not you might write your own implementation that does something different and does
 // not use "$EMAIL_UNIQUE$".
+// "$PASSWORD_HISTORY_TABLE_NAME$": Name of the password history table, see
+// PasswordHistorySQL. Defaults to "auth_password_history".
+// "$USER_ATTRIBUTES_TABLE_NAME$": Name of the user attributes table, see
+// UserAttributeSQL. Defaults to "auth_user_attribute".
+// "$USERNAME_MAX_LEN$", "$PASSWORD_MAX_LEN$", "$EMAIL_MAX_LEN$", "$FIRST_NAME_MAX_LEN$"
+// and "$LAST_NAME_MAX_LEN$": The maximal lengths of the varchar fields, they should be
+// used in the CREATE TABLE statement (for example "username VARCHAR($USERNAME_MAX_LEN$)").
+// The values are taken from a UserSchemaLimits, see SQLReplacerWithLimits.
 //
 // The replacement of the meta variables should only done once during the initialization.
 // A SQLTemplateReplacer is used to achieve this.
@@ -283,7 +299,8 @@ type UserSQL interface {
 	// GetUser is the query to return a user with a given id.
 	// It must select all fields from the user table in the following order:
 	// id, user name, password, email, first name, last name, is superuser,
-	// is staff, is active, date joined, last login.
+	// is staff, is active, date joined, last login, password changed at,
+	// must change password.
 	//
 	// Exactly one element is passed to the query and that is the user id to look for.
 	GetUser() string
@@ -298,6 +315,8 @@ type UserSQL interface {
 	//
 	// The arguments parsed into Execute are the same once (and in the same order)
 	// as in GetUser, except the id field (that is automatically generated).
+	// The id of the new user is retrieved with LastInsertId, see InsertReturningSQL
+	// for drivers that don't support this.
 	InsertUser() string
 	// UpdateUser is used to update a user.
 	// The query might depend on the fields which we want to update.
@@ -338,6 +357,30 @@ type UserSQL interface {
 	ListUsers() string
 }
 
+// closeSQL closes the statement cache (if not nil) and the database and marks the
+// storage as closed.
+func closeSQL(db *sql.DB, stmts *StmtCache, closed *int32) error {
+	atomic.StoreInt32(closed, 1)
+	var stmtErr error
+	if stmts != nil {
+		stmtErr = stmts.Close()
+	}
+	if err := db.Close(); err != nil {
+		return err
+	}
+	return stmtErr
+}
+
+// pingSQL pings the database and returns ErrStorageClosed if the storage was closed.
+// database/sql doesn't export the error for a closed database, so the storages
+// remember if they were closed.
+func pingSQL(ctx context.Context, db *sql.DB, closed *int32) error {
+	if atomic.LoadInt32(closed) != 0 {
+		return ErrStorageClosed
+	}
+	return db.PingContext(ctx)
+}
+
 // SQLUserStorage implements UserStorage by working with database/sql.
 //
 // It does not rely on a specific driver and no driver is imported; it only uses
@@ -346,10 +389,21 @@ type UserSQL interface {
 // In order to use your own implementation for these generic sql methods two things
 // must be implemented: The queries to be used of type UserSQL and the database bridge
 // of type SQLBridge.
+//
+// By default the queries are passed directly to the database, EnableStmtCache
+// enables a cache of prepared statements.
+//
+// If NullLastLogin is true a zero LastLogin is stored as NULL, otherwise the zero
+// time is stored, see NullLastLoginSQL.
 type SQLUserStorage struct {
-	UserDB      *sql.DB
-	UserQueries UserSQL
-	UserBridge  SQLBridge
+	UserDB        *sql.DB
+	UserQueries   UserSQL
+	UserBridge    SQLBridge
+	UserStmts     *StmtCache
+	NullLastLogin bool
+
+	// closed is set by Close
+	closed int32
 }
 
 // NewSQLUserStorage returns a new SQLUserStorage.
@@ -357,6 +411,44 @@ func NewSQLUserStorage(db *sql.DB, queries UserSQL, bridge SQLBridge) *SQLUserSt
 	return &SQLUserStorage{UserDB: db, UserQueries: queries, UserBridge: bridge}
 }
 
+// EnableStmtCache enables the prepared statement cache with the given size
+// (DefaultStmtCacheSize if maxSize ≤ 0).
+func (s *SQLUserStorage) EnableStmtCache(maxSize int) {
+	s.UserStmts = NewStmtCache(s.UserDB, maxSize)
+}
+
+func (s *SQLUserStorage) userDB() sqlQuerier {
+	if s.UserStmts != nil {
+		return s.UserStmts
+	}
+	return s.UserDB
+}
+
+// Close closes all cached prepared statements and the database.
+// If the database is shared with other storages (for example a SQLSessionStorage)
+// it is fine to close all of them.
+func (s *SQLUserStorage) Close() error {
+	return closeSQL(s.UserDB, s.UserStmts, &s.closed)
+}
+
+// Ping pings the database.
+func (s *SQLUserStorage) Ping(ctx context.Context) error {
+	return pingSQL(ctx, s.UserDB, &s.closed)
+}
+
+// Ready pings the database and tests if the users table exists by looking up a
+// non-existing user.
+func (s *SQLUserStorage) Ready(ctx context.Context) error {
+	if err := s.Ping(ctx); err != nil {
+		return NewNotReady(err)
+	}
+	_, err := s.GetUser(InvalidUserID)
+	if _, noSuchUser := err.(NoSuchUser); err != nil && !noSuchUser {
+		return NewNotReady(err)
+	}
+	return nil
+}
+
 // InitUsers executes all init queries in a single transaction.
 func (s *SQLUserStorage) InitUsers() error {
 	tx, err := s.UserDB.Begin()
@@ -391,47 +483,54 @@ func (s *SQLUserStorage) InitUsers() error {
 }
 
 func (s *SQLUserStorage) scanUser(row *sql.Row, noUser func() error) (*UserModel, error) {
-	var userId UserID
-	var username, password, email, firstName, lastName string
-	var isSuperuser, isStaff, isActive bool
-	var dateJoined, lastLogin interface{}
-	dateJoined, lastLogin = s.UserBridge.TimeScanType(), s.UserBridge.TimeScanType()
-	scanErr := row.Scan(&userId, &username, &password, &email,
-		&firstName, &lastName, &isSuperuser, &isStaff,
-		&isActive, dateJoined, lastLogin)
-	switch {
-	case scanErr == sql.ErrNoRows:
+	user, scanErr := scanUserRow(row.Scan, s.UserBridge, s.extraColumns())
+	if scanErr == sql.ErrNoRows {
 		return nil, noUser()
-	case scanErr != nil:
-		return nil, scanErr
 	}
+	return user, scanErr
+}
+
+// scanUserRow scans a user with the fields as described in UserSQL.GetUser followed
+// by the extra columns, scan is the Scan method of a row.
+func scanUserRow(scan func(dest ...interface{}) error, bridge SQLBridge, extra []ExtraColumn) (*UserModel, error) {
 	var user UserModel
-	user.ID = userId
-	user.FirstName = firstName
-	user.LastName = lastName
-	user.Username = username
-	user.EMail = email
-	user.Password = password
-	user.IsActive = isActive
-	user.IsSuperUser = isSuperuser
-	user.IsStaff = isStaff
-	if dj, djErr := s.UserBridge.ConvertTimeScanType(dateJoined); djErr != nil {
+	dateJoined, passwordChangedAt := bridge.TimeScanType(), bridge.TimeScanType()
+	// the last login may be NULL, see NullLastLoginSQL
+	lastLogin := newNullableScan(bridge)
+	dest := []interface{}{&user.ID, &user.Username, &user.Password, &user.EMail,
+		&user.FirstName, &user.LastName, &user.IsSuperUser, &user.IsStaff,
+		&user.IsActive, dateJoined, lastLogin, passwordChangedAt, &user.MustChangePassword}
+	for _, column := range extra {
+		dest = append(dest, column.scanType(bridge))
+	}
+	if scanErr := scan(dest...); scanErr != nil {
+		return nil, scanErr
+	}
+	if dj, djErr := bridge.ConvertTimeScanType(dateJoined); djErr != nil {
 		return nil, djErr
 	} else {
-		dj = dj.UTC()
-		user.DateJoined = dj
+		user.DateJoined = dj.UTC()
 	}
-	if ll, llErr := s.UserBridge.ConvertTimeScanType(lastLogin); llErr != nil {
+	if ll, llErr := lastLogin.convert(bridge); llErr != nil {
 		return nil, llErr
 	} else {
-		ll = ll.UTC()
-		user.LastLogin = ll
+		user.LastLogin = ll.UTC()
+	}
+	if pc, pcErr := bridge.ConvertTimeScanType(passwordChangedAt); pcErr != nil {
+		return nil, pcErr
+	} else {
+		user.PasswordChangedAt = pc.UTC()
+	}
+	for i, column := range extra {
+		if err := column.setScanned(&user.Extensions, dest[13+i], bridge); err != nil {
+			return nil, err
+		}
 	}
 	return &user, nil
 }
 
 func (s *SQLUserStorage) GetUser(id UserID) (*UserModel, error) {
-	row := s.UserDB.QueryRow(s.UserQueries.GetUser(), id)
+	row := s.userDB().QueryRow(s.UserQueries.GetUser(), id)
 	notExists := func() error {
 		return NewNoSuchUserID(id)
 	}
@@ -439,7 +538,7 @@ func (s *SQLUserStorage) GetUser(id UserID) (*UserModel, error) {
 }
 
 func (s *SQLUserStorage) GetUserByName(username string) (*UserModel, error) {
-	row := s.UserDB.QueryRow(s.UserQueries.GetUserByName(), username)
+	row := s.userDB().QueryRow(s.UserQueries.GetUserByName(), username)
 	notExists := func() error {
 		return NewNoSuchUserUsername(username)
 	}
@@ -447,7 +546,7 @@ func (s *SQLUserStorage) GetUserByName(username string) (*UserModel, error) {
 }
 
 func (s *SQLUserStorage) GetUserByEmail(email string) (*UserModel, error) {
-	row := s.UserDB.QueryRow(s.UserQueries.GetUserByEmail(), email)
+	row := s.userDB().QueryRow(s.UserQueries.GetUserByEmail(), email)
 	notExists := func() error {
 		return NewNoSuchUserMail(email)
 	}
@@ -457,64 +556,251 @@ func (s *SQLUserStorage) GetUserByEmail(email string) (*UserModel, error) {
 func (s *SQLUserStorage) InsertUser(user *UserModel) (UserID, error) {
 	user.ID = InvalidUserID
 	now := time.Now().UTC()
-	var zeroTime time.Time
-	zeroTime = zeroTime.UTC()
-	// use the bridge conversion for time
-	dateJoined := s.UserBridge.ConvertTime(now)
-	lastLogin := s.UserBridge.ConvertTime(zeroTime)
 	user.DateJoined = now
-	user.LastLogin = zeroTime
-	r, err := s.UserDB.Exec(s.UserQueries.InsertUser(),
-		user.Username, user.Password, user.EMail, user.FirstName,
-		user.LastName, user.IsSuperUser, user.IsStaff,
-		user.IsActive, dateJoined, lastLogin)
+	user.LastLogin = time.Time{}.UTC()
+	user.PasswordChangedAt = now
+	args, argsErr := s.userArgs(user)
+	if argsErr != nil {
+		return InvalidUserID, argsErr
+	}
+	db := s.userDB()
+	query := s.UserQueries.InsertUser()
+	id, err := s.execInsert(func(args ...interface{}) (sql.Result, error) {
+		return db.Exec(query, args...)
+	}, func(args ...interface{}) *sql.Row {
+		return db.QueryRow(query, args...)
+	}, args...)
+	if err != nil {
+		return InvalidUserID, err
+	}
+	user.ID = id
+	return id, nil
+}
+
+// InsertReturningSQL is an optional interface a UserSQL can implement.
+//
+// By default the id of a new user is retrieved with sql.Result.LastInsertId, but
+// some drivers (for example the Postgres drivers) don't support this.
+// If InsertReturnsID returns true the InsertUser query must return the id of the
+// new user as a single row and column (for example with "RETURNING id").
+// It is then executed with QueryRow instead of Exec.
+type InsertReturningSQL interface {
+	InsertReturnsID() bool
+}
+
+// insertReturnsID returns true if the queries implement InsertReturningSQL and
+// return the id.
+func (s *SQLUserStorage) insertReturnsID() bool {
+	returning, ok := s.UserQueries.(InsertReturningSQL)
+	return ok && returning.InsertReturnsID()
+}
+
+// ExtraColumnsSQL is an optional interface a UserSQL can implement to store
+// additional application columns in the users table, see ExtraColumn.
+//
+// The values of the extra columns are read from and written to
+// UserModel.Extensions.
+// All queries that select users must select the extra columns after the default
+// fields (in the order of ExtraColumns), InsertUser inserts them after the default
+// fields and UpdateUser(nil) updates them after the default fields.
+// If UpdateUser supports fields the names of the extra columns can be used as
+// fields.
+type ExtraColumnsSQL interface {
+	ExtraColumns() []ExtraColumn
+}
+
+// extraColumns returns the extra columns if the queries implement ExtraColumnsSQL.
+func (s *SQLUserStorage) extraColumns() []ExtraColumn {
+	if extraSQL, ok := s.UserQueries.(ExtraColumnsSQL); ok {
+		return extraSQL.ExtraColumns()
+	}
+	return nil
+}
+
+// extraArgs returns the arguments for the extra columns of the user.
+func (s *SQLUserStorage) extraArgs(u *UserModel) ([]interface{}, error) {
+	extra := s.extraColumns()
+	res := make([]interface{}, len(extra))
+	for i, column := range extra {
+		arg, err := column.arg(u.Extensions, s.UserBridge)
+		if err != nil {
+			return nil, err
+		}
+		res[i] = arg
+	}
+	return res, nil
+}
+
+// execInsert executes the InsertUser query with the given arguments and returns the
+// id of the new user, see InsertReturningSQL.
+// exec and queryRow must execute the InsertUser query, only one of them is called.
+func (s *SQLUserStorage) execInsert(exec func(args ...interface{}) (sql.Result, error),
+	queryRow func(args ...interface{}) *sql.Row, args ...interface{}) (UserID, error) {
+	var err error
+	id := InvalidUserID
+	if s.insertReturnsID() {
+		err = queryRow(args...).Scan(&id)
+	} else {
+		var r sql.Result
+		if r, err = exec(args...); err == nil {
+			lastInsertID, idErr := r.LastInsertId()
+			if idErr != nil {
+				// not all drivers allow this
+				return InvalidUserID, NewNotSupported(idErr)
+			}
+			id = UserID(lastInsertID)
+		}
+	}
 	if err != nil {
-		user.ID = InvalidUserID
 		if s.UserBridge.IsDuplicateInsert(err) {
 			return InvalidUserID,
 				NewUserExists(fmt.Sprintf("unique constraint failed: %s", err.Error()))
 		}
 		return InvalidUserID, err
 	}
-	lastInsertID, idErr := r.LastInsertId()
-	if idErr != nil {
-		// not all drivers allow this
-		return InvalidUserID, NewNotSupported(idErr)
+	return id, nil
+}
+
+// withTx runs f in a transaction, if f returns an error the transaction is rolled
+// back, otherwise committed.
+func withTx(db *sql.DB, what string, f func(tx *sql.Tx) error) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	if execErr := f(tx); execErr != nil {
+		if rollbackErr := tx.Rollback(); rollbackErr != nil {
+			return NewRollbackErr(execErr, rollbackErr)
+		}
+		return execErr
+	}
+	if commitErr := tx.Commit(); commitErr != nil {
+		return fmt.Errorf("commit of %s failed: %w", what, commitErr)
+	}
+	return nil
+}
+
+// insertTx inserts all users in a single transaction, all fields except the id are
+// inserted as they are.
+// On success the ids are set, otherwise the index of the failed user is returned.
+func (s *SQLUserStorage) insertTx(users []*UserModel) (int, error) {
+	ids := make([]UserID, len(users))
+	failed := -1
+	err := withTx(s.UserDB, "user batch", func(tx *sql.Tx) error {
+		stmt, prepareErr := tx.Prepare(s.UserQueries.InsertUser())
+		if prepareErr != nil {
+			return prepareErr
+		}
+		defer stmt.Close()
+		for i, user := range users {
+			failed = i
+			args, argsErr := s.userArgs(user)
+			if argsErr != nil {
+				return argsErr
+			}
+			id, err := s.execInsert(stmt.Exec, stmt.QueryRow, args...)
+			if err != nil {
+				return err
+			}
+			ids[i] = id
+		}
+		failed = -1
+		return nil
+	})
+	if err != nil {
+		return failed, err
+	}
+	for i, user := range users {
+		user.ID = ids[i]
+	}
+	return -1, nil
+}
+
+// ImportUserBatch implements UserBatchImporter, all users are inserted with the
+// InsertUser query in a single transaction.
+func (s *SQLUserStorage) ImportUserBatch(users []*UserModel) error {
+	_, err := s.insertTx(users)
+	return err
+}
+
+// InsertUsers implements UserBatchStorage, all users are inserted with a prepared
+// statement in a single transaction.
+// If an insert fails because a user already exists the transaction is rolled back
+// and the users are inserted one by one to get the errors for all users.
+// Other errors are returned directly.
+func (s *SQLUserStorage) InsertUsers(users []*UserModel) error {
+	now := time.Now().UTC()
+	for _, user := range users {
+		user.DateJoined = now
+		user.LastLogin = time.Time{}.UTC()
+		user.PasswordChangedAt = now
+	}
+	_, err := s.insertTx(users)
+	if err == nil || !retryItemByItem(err) {
+		return err
+	}
+	for _, user := range users {
+		user.ID = InvalidUserID
+	}
+	return insertUsersLoop(s, users)
+}
+
+// fieldArg returns the argument for a field of u, times are converted with the
+// bridge (see convertLastLogin for nullable fields).
+func (s *SQLUserStorage) fieldArg(field *UserField, u *UserModel) interface{} {
+	arg := field.Get(u)
+	if t, isTime := arg.(time.Time); isTime {
+		if field.Nullable {
+			return s.convertLastLogin(t)
+		}
+		return s.UserBridge.ConvertTime(t.UTC())
+	}
+	return arg
+}
+
+// userArgs returns the arguments for all fields except the id in the order of
+// UserSQL followed by the extra columns, as used in inserts and updates.
+func (s *SQLUserStorage) userArgs(u *UserModel) ([]interface{}, error) {
+	extraArgs, extraErr := s.extraArgs(u)
+	if extraErr != nil {
+		return nil, extraErr
+	}
+	res := make([]interface{}, 0, len(userSQLFields)+len(extraArgs))
+	for _, name := range userSQLFields[1:] {
+		field, _ := LookupUserField(name)
+		res = append(res, s.fieldArg(field, u))
 	}
-	user.ID = UserID(lastInsertID)
-	return UserID(lastInsertID), nil
+	return append(res, extraArgs...), nil
 }
 
 func (s *SQLUserStorage) prepareUpdateArgs(id UserID, u *UserModel, fields []string) ([]interface{}, error) {
-	var res []interface{}
 	if len(fields) == 0 {
-		dateJoined := s.UserBridge.ConvertTime(u.DateJoined.UTC())
-		lastLogin := s.UserBridge.ConvertTime(u.LastLogin.UTC())
-		res = []interface{}{
-			u.Username, u.Password, u.EMail, u.FirstName, u.LastName, u.IsSuperUser,
-			u.IsStaff, u.IsActive, dateJoined, lastLogin,
-			id,
+		res, err := s.userArgs(u)
+		if err != nil {
+			return nil, err
 		}
-	} else {
-		res = make([]interface{}, len(fields)+1)
-		for i, fieldName := range fields {
-			if arg, argErr := u.GetFieldByName(fieldName); argErr == nil {
-				fieldName = strings.ToLower(fieldName)
-				if fieldName == "datejoined" || fieldName == "lastlogin" {
-					if t, isTime := arg.(time.Time); isTime {
-						arg = s.UserBridge.ConvertTime(t.UTC())
-					} else {
-						return nil,
-							fmt.Errorf("DateJoined / LastLogin must be time.Time, got type %v", reflect.TypeOf(arg))
-					}
-				}
-				res[i] = arg
-			} else {
+		return append(res, id), nil
+	}
+	res := make([]interface{}, len(fields)+1)
+	for i, fieldName := range fields {
+		if column, isExtra := findExtraColumn(s.extraColumns(), fieldName); isExtra {
+			arg, argErr := column.arg(u.Extensions, s.UserBridge)
+			if argErr != nil {
 				return nil, argErr
 			}
+			res[i] = arg
+			continue
+		}
+		field, fieldErr := LookupUserField(fieldName)
+		if fieldErr != nil {
+			return nil, fieldErr
 		}
-		res[len(fields)] = id
+		if !field.Updatable {
+			return nil, fmt.Errorf("field %s can't be updated", field.Name)
+		}
+		res[i] = s.fieldArg(field, u)
 	}
+	res[len(fields)] = id
 	return res, nil
 }
 
@@ -528,7 +814,40 @@ func (s *SQLUserStorage) prepareUpdateArgs(id UserID, u *UserModel, fields []str
 // given (in the order as tehy're mentioned) and UpdateUser is called with these fields
 // and must return a query that updates these fields.
 // Again the user id is given as the last argument.
+//
+// If fields contains "Password" the fields "PasswordChangedAt" and "MustChangePassword"
+// are updated as well. If fields is empty the user is retrieved first in order to
+// test if the password changed.
 func (s *SQLUserStorage) UpdateUser(id UserID, newCredentials *UserModel, fields []string) error {
+	if len(fields) == 0 {
+		old, getErr := s.GetUser(id)
+		switch getErr.(type) {
+		case nil:
+			preparePasswordUpdate(newCredentials, fields, old.Password)
+		case NoSuchUser:
+			// nothing to update
+		default:
+			return getErr
+		}
+	} else {
+		fields = preparePasswordUpdate(newCredentials, fields, "")
+	}
+	stmt, args, argsErr := s.updateQuery(id, newCredentials, fields)
+	if argsErr != nil {
+		return argsErr
+	}
+	_, err := s.userDB().Exec(stmt, args...)
+	if err != nil {
+		if s.UserBridge.IsDuplicateUpdate(err) {
+			return NewAmbiguousCredentials(fmt.Sprintf("unique constraint failed: %s", err.Error()))
+		}
+		return err
+	}
+	return nil
+}
+
+// updateQuery returns the update statement and its arguments.
+func (s *SQLUserStorage) updateQuery(id UserID, newCredentials *UserModel, fields []string) (string, []interface{}, error) {
 	// check if it's supported to use fields, compute actual arguments depending on that
 	var stmt string
 	var args []interface{}
@@ -541,35 +860,274 @@ func (s *SQLUserStorage) UpdateUser(id UserID, newCredentials *UserModel, fields
 		args, argsErr = s.prepareUpdateArgs(id, newCredentials, nil)
 	}
 	if argsErr != nil {
-		return fmt.Errorf("can't prepare user update arguments: %s", argsErr.Error())
+		return "", nil, fmt.Errorf("can't prepare user update arguments: %s", argsErr.Error())
 	}
+	return stmt, args, nil
+}
 
-	_, err := s.UserDB.Exec(stmt, args...)
+// UpdateUsers implements UserBatchStorage, all updates are executed in a single
+// transaction.
+// If an update fails because of AmbiguousCredentials the transaction is rolled back
+// and the users are updated one by one to get the errors for all users.
+// Other errors are returned directly.
+func (s *SQLUserStorage) UpdateUsers(users []*UserModel, fields []string) error {
+	// the password fields are changed by UpdateUser, so work on copies for the
+	// transaction
+	copies := make([]*UserModel, len(users))
+	for i, user := range users {
+		copies[i] = user.Copy()
+	}
+	err := withTx(s.UserDB, "user batch", func(tx *sql.Tx) error {
+		stmts := make(map[string]*sql.Stmt)
+		defer func() {
+			for _, stmt := range stmts {
+				stmt.Close()
+			}
+		}()
+		for _, user := range copies {
+			userFields := fields
+			if len(fields) == 0 {
+				old, getErr := s.scanUser(tx.QueryRow(s.UserQueries.GetUser(), user.ID), func() error {
+					return NewNoSuchUserID(user.ID)
+				})
+				switch getErr.(type) {
+				case nil:
+					preparePasswordUpdate(user, fields, old.Password)
+				case NoSuchUser:
+					// nothing to update
+				default:
+					return getErr
+				}
+			} else {
+				userFields = preparePasswordUpdate(user, fields, "")
+			}
+			query, args, argsErr := s.updateQuery(user.ID, user, userFields)
+			if argsErr != nil {
+				return argsErr
+			}
+			stmt, prepared := stmts[query]
+			if !prepared {
+				var prepareErr error
+				if stmt, prepareErr = tx.Prepare(query); prepareErr != nil {
+					return prepareErr
+				}
+				stmts[query] = stmt
+			}
+			if _, err := stmt.Exec(args...); err != nil {
+				if s.UserBridge.IsDuplicateUpdate(err) {
+					return NewAmbiguousCredentials(fmt.Sprintf("unique constraint failed: %s", err.Error()))
+				}
+				return err
+			}
+		}
+		return nil
+	})
 	if err != nil {
-		if s.UserBridge.IsDuplicateUpdate(err) {
-			return NewAmbiguousCredentials(fmt.Sprintf("unique constraint failed: %s", err.Error()))
+		if retryItemByItem(err) {
+			return updateUsersLoop(s, users, fields)
 		}
 		return err
 	}
+	for i, user := range users {
+		*user = *copies[i]
+	}
 	return nil
 }
 
 func (s *SQLUserStorage) DeleteUser(id UserID) error {
-	_, err := s.UserDB.Exec(s.UserQueries.DeleteUser(), id)
+	_, err := s.userDB().Exec(s.UserQueries.DeleteUser(), id)
 	return err
 }
 
+// DeleteUsers implements UserBatchStorage, all users are deleted with a prepared
+// statement in a single transaction.
+// Deleting a single user doesn't fail, thus errors are returned directly.
+func (s *SQLUserStorage) DeleteUsers(ids []UserID) error {
+	return withTx(s.UserDB, "user batch", func(tx *sql.Tx) error {
+		stmt, prepareErr := tx.Prepare(s.UserQueries.DeleteUser())
+		if prepareErr != nil {
+			return prepareErr
+		}
+		defer stmt.Close()
+		for _, id := range ids {
+			if _, err := stmt.Exec(id); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
 func (s *SQLUserStorage) ListUsers() (UserIterator, error) {
-	rows, rowsErr := s.UserDB.Query(s.UserQueries.ListUsers())
+	rows, rowsErr := s.userDB().Query(s.UserQueries.ListUsers())
+	if rowsErr != nil {
+		return nil, rowsErr
+	}
+	return s.newIterator(rows), nil
+}
+
+// newIterator returns a SQLUserIterator that scans the extra columns.
+func (s *SQLUserStorage) newIterator(rows *sql.Rows) *SQLUserIterator {
+	it := NewSQLUserIterator(rows, s.UserBridge)
+	it.Extra = s.extraColumns()
+	return it
+}
+
+// PasswordExpirySQL is an optional interface a UserSQL can implement.
+// If implemented SQLUserStorage uses the query in ListPasswordExpired, otherwise all
+// users are retrieved and filtered.
+type PasswordExpirySQL interface {
+	// ListPasswordExpired returns all users that must change their password.
+	// It must select the same fields as GetUser.
+	//
+	// It gets three arguments, the cutoffs from PasswordExpiryPolicy.Cutoffs: Super users,
+	// staff members and all other users are expired if the password was changed before
+	// the respective cutoff. Users with must change password set are always returned.
+	ListPasswordExpired() string
+}
+
+// ListPasswordExpired returns all users with an expired password, see
+// PasswordExpirySQL.
+func (s *SQLUserStorage) ListPasswordExpired(policy *PasswordExpiryPolicy, referenceDate time.Time) (UserIterator, error) {
+	expirySQL, ok := s.UserQueries.(PasswordExpirySQL)
+	if !ok {
+		it, err := s.ListUsers()
+		if err != nil {
+			return nil, err
+		}
+		return FilterUsers(it, func(u *UserModel) bool {
+			return policy.IsExpired(u, referenceDate)
+		}), nil
+	}
+	superUser, staff, user := policy.Cutoffs(referenceDate.UTC())
+	rows, rowsErr := s.userDB().Query(expirySQL.ListPasswordExpired(),
+		s.UserBridge.ConvertTime(superUser.UTC()), s.UserBridge.ConvertTime(staff.UTC()),
+		s.UserBridge.ConvertTime(user.UTC()))
 	if rowsErr != nil {
 		return nil, rowsErr
 	}
-	return NewSQLUserIterator(rows, s.UserBridge), nil
+	return s.newIterator(rows), nil
+}
+
+// NullLastLoginSQL is an optional interface a UserSQL can implement.
+//
+// Users that never logged in have the zero time as LastLogin. If NullLastLogin of
+// the SQLUserStorage is false the zero time is stored as it is (converted by the
+// bridge), if it is true NULL is stored instead (the storages of the dialect
+// packages enable it). NULL is always scanned as the
+// zero time, thus both variants return the same users.
+//
+// The init queries should create a last login column that allows NULL, but tables
+// created by older versions don't allow NULL. Thus NullLastLogin must only be
+// enabled for new tables or after MigrateNullLastLogin migrated the table (set it to
+// false for older tables), this migration uses the queries of this interface.
+type NullLastLoginSQL interface {
+	// AllowNullLastLogin returns the statements to change an existing users table
+	// s.t. the last login column allows NULL. It may be empty.
+	AllowNullLastLogin() []string
+	// ClearLastLoginSentinel is the query to set the last login to NULL for all
+	// users that have the sentinel value as last login.
+	// It gets one argument, the zero time converted by the bridge.
+	ClearLastLoginSentinel() string
+}
+
+// convertLastLogin converts the last login with the bridge, the zero time is
+// converted to nil if the last login is nullable.
+func (s *SQLUserStorage) convertLastLogin(t time.Time) interface{} {
+	if t.IsZero() && s.NullLastLogin {
+		return nil
+	}
+	return s.UserBridge.ConvertTime(t.UTC())
+}
+
+// MigrateNullLastLogin migrates a users table that stores the zero time as last
+// login of users that never logged in, see NullLastLoginSQL.
+// The column is changed to allow NULL and the zero time is replaced by NULL, both
+// in a single transaction.
+// Note that MySQL commits the transaction implicitly after changing the column, so
+// on MySQL only the update of the users is part of the transaction. If the update
+// fails the column still allows NULL, the migration can simply be run again.
+// It returns the number of updated users.
+//
+// After the migration NullLastLogin should be set, the migration doesn't set it
+// because the storage might already be in use.
+//
+// If the queries don't implement NullLastLoginSQL an error of type NotSupported is
+// returned.
+func (s *SQLUserStorage) MigrateNullLastLogin() (int64, error) {
+	nullSQL, ok := s.UserQueries.(NullLastLoginSQL)
+	if !ok {
+		return 0, NewNotSupported(fmt.Errorf("user queries don't support NULL as last login"))
+	}
+	var updated int64
+	err := withTx(s.UserDB, "last login migration", func(tx *sql.Tx) error {
+		for _, stmt := range nullSQL.AllowNullLastLogin() {
+			if _, err := tx.Exec(stmt); err != nil {
+				return err
+			}
+		}
+		res, err := tx.Exec(nullSQL.ClearLastLoginSentinel(),
+			s.UserBridge.ConvertTime(time.Time{}.UTC()))
+		if err != nil {
+			return err
+		}
+		if updated, err = res.RowsAffected(); err != nil {
+			return NewNotSupported(err)
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return updated, nil
+}
+
+// PasswordColumnsSQL is an optional interface a UserSQL can implement.
+//
+// Users tables created by older versions don't have the columns for
+// PasswordChangedAt and MustChangePassword, MigratePasswordColumns adds them with
+// the statements of this interface.
+type PasswordColumnsSQL interface {
+	// AddPasswordColumns returns the statements to add the columns
+	// password_changed_at and must_change_password (and the index on
+	// password_changed_at) to an existing users table.
+	// password_changed_at must be set to date_joined and must_change_password to
+	// false for all existing users.
+	AddPasswordColumns() []string
+}
+
+// MigratePasswordColumns migrates a users table created without the columns for
+// PasswordChangedAt and MustChangePassword, see PasswordColumnsSQL.
+// The password of all existing users counts as changed when they joined, the
+// columns are added in a single transaction.
+// Note that MySQL commits the transaction implicitly after changing the table, thus
+// on MySQL a failed migration might have to be completed manually.
+// If the last login should allow NULL as well this migration must run before
+// MigrateNullLastLogin.
+//
+// If the queries don't implement PasswordColumnsSQL an error of type NotSupported is
+// returned.
+func (s *SQLUserStorage) MigratePasswordColumns() error {
+	columnsSQL, ok := s.UserQueries.(PasswordColumnsSQL)
+	if !ok {
+		return NewNotSupported(fmt.Errorf("user queries don't support adding the password columns"))
+	}
+	return withTx(s.UserDB, "password columns migration", func(tx *sql.Tx) error {
+		for _, stmt := range columnsSQL.AddPasswordColumns() {
+			if _, err := tx.Exec(stmt); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
 }
 
 type SQLUserIterator struct {
 	Rows *sql.Rows
 	Bridge SQLBridge
+	// Extra are the extra columns selected after the default fields, see
+	// ExtraColumnsSQL.
+	Extra []ExtraColumn
 }
 
 func NewSQLUserIterator(rows *sql.Rows, bridge SQLBridge) *SQLUserIterator {
@@ -588,45 +1146,11 @@ func (it *SQLUserIterator) Err() error {
 }
 
 func (it *SQLUserIterator) Close() error {
-	return it.Close()
+	return it.Rows.Close()
 }
 
 func (it *SQLUserIterator) Next() (*UserModel, error) {
-	// a bit code duplication, but well
-	var userId UserID
-	var username, password, email, firstName, lastName string
-	var isSuperuser, isStaff, isActive bool
-	var dateJoined, lastLogin interface{}
-	dateJoined, lastLogin = it.Bridge.TimeScanType(), it.Bridge.TimeScanType()
-	scanErr := it.Rows.Scan(&userId, &username, &password, &email,
-		&firstName, &lastName, &isSuperuser, &isStaff,
-		&isActive, dateJoined, lastLogin)
-	if scanErr != nil {
-		return nil, scanErr
-	}
-	var user UserModel
-	user.ID = userId
-	user.FirstName = firstName
-	user.LastName = lastName
-	user.Username = username
-	user.EMail = email
-	user.Password = password
-	user.IsActive = isActive
-	user.IsSuperUser = isSuperuser
-	user.IsStaff = isStaff
-	if dj, djErr := it.Bridge.ConvertTimeScanType(dateJoined); djErr != nil {
-		return nil, djErr
-	} else {
-		dj = dj.UTC()
-		user.DateJoined = dj
-	}
-	if ll, llErr := it.Bridge.ConvertTimeScanType(lastLogin); llErr != nil {
-		return nil, llErr
-	} else {
-		ll = ll.UTC()
-		user.LastLogin = ll
-	}
-	return &user, nil
+	return scanUserRow(it.Rows.Scan, it.Bridge, it.Extra)
 }
 
 type SessionSQL interface {
@@ -638,10 +1162,19 @@ type SessionSQL interface {
 	DeleteForUserSession() string
 }
 
+// SQLSessionStorage implements SessionStorage by working with database/sql, see
+// SQLUserStorage.
+//
+// By default the queries are passed directly to the database, EnableStmtCache
+// enables a cache of prepared statements.
 type SQLSessionStorage struct {
 	SessionDB *sql.DB
 	SessionQueries SessionSQL
 	SessionBridge SQLBridge
+	SessionStmts *StmtCache
+
+	// closed is set by Close
+	closed int32
 }
 
 func NewSQLSessionStorage(db *sql.DB, queries SessionSQL, bridge SQLBridge) *SQLSessionStorage {
@@ -653,6 +1186,43 @@ func NewSQLSessionStorage(db *sql.DB, queries SessionSQL, bridge SQLBridge) *SQL
 }
 
 
+// EnableStmtCache enables the prepared statement cache with the given size
+// (DefaultStmtCacheSize if maxSize ≤ 0).
+func (s *SQLSessionStorage) EnableStmtCache(maxSize int) {
+	s.SessionStmts = NewStmtCache(s.SessionDB, maxSize)
+}
+
+func (s *SQLSessionStorage) sessionDB() sqlQuerier {
+	if s.SessionStmts != nil {
+		return s.SessionStmts
+	}
+	return s.SessionDB
+}
+
+// Close closes all cached prepared statements and the database, see
+// SQLUserStorage.Close.
+func (s *SQLSessionStorage) Close() error {
+	return closeSQL(s.SessionDB, s.SessionStmts, &s.closed)
+}
+
+// Ping pings the database.
+func (s *SQLSessionStorage) Ping(ctx context.Context) error {
+	return pingSQL(ctx, s.SessionDB, &s.closed)
+}
+
+// Ready pings the database and tests if the sessions table exists by looking up a
+// non-existing session.
+func (s *SQLSessionStorage) Ready(ctx context.Context) error {
+	if err := s.Ping(ctx); err != nil {
+		return NewNotReady(err)
+	}
+	_, err := s.GetSession("")
+	if _, noSuchSession := err.(NoSuchSession); err != nil && !noSuchSession {
+		return NewNotReady(err)
+	}
+	return nil
+}
+
 func (s *SQLSessionStorage) InitSessions() error {
 	tx, err := s.SessionDB.Begin()
 	if err != nil {
@@ -685,7 +1255,7 @@ func (s *SQLSessionStorage) InitSessions() error {
 
 func (s *SQLSessionStorage) InsertSession(session *SessionEntry) error {
 	expireDate := s.SessionBridge.ConvertTime(session.ExpireDate)
-	_, err := s.SessionDB.Exec(s.SessionQueries.InsertSession(),
+	_, err := s.sessionDB().Exec(s.SessionQueries.InsertSession(),
 		session.Key, session.User, expireDate)
 	if err != nil {
 		if s.SessionBridge.IsDuplicateUpdate(err) {
@@ -697,7 +1267,7 @@ func (s *SQLSessionStorage) InsertSession(session *SessionEntry) error {
 }
 
 func (s *SQLSessionStorage) GetSession(key string) (*SessionEntry, error) {
-	row := s.SessionDB.QueryRow(s.SessionQueries.GetSession(), key)
+	row := s.sessionDB().QueryRow(s.SessionQueries.GetSession(), key)
 	var k string
 	var user UserID
 	expireDate := s.SessionBridge.TimeScanType()
@@ -721,13 +1291,32 @@ func (s *SQLSessionStorage) GetSession(key string) (*SessionEntry, error) {
 }
 
 func (s *SQLSessionStorage) DeleteSession(key string) error {
-	_, err := s.SessionDB.Exec(s.SessionQueries.DeleteSession(), key)
+	_, err := s.sessionDB().Exec(s.SessionQueries.DeleteSession(), key)
 	return err
 }
 
+// DeleteSessions implements SessionBatchStorage, all sessions are deleted with a
+// prepared statement in a single transaction.
+// Deleting a single session doesn't fail, thus errors are returned directly.
+func (s *SQLSessionStorage) DeleteSessions(keys []string) error {
+	return withTx(s.SessionDB, "session batch", func(tx *sql.Tx) error {
+		stmt, prepareErr := tx.Prepare(s.SessionQueries.DeleteSession())
+		if prepareErr != nil {
+			return prepareErr
+		}
+		defer stmt.Close()
+		for _, key := range keys {
+			if _, err := stmt.Exec(key); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
 func (s *SQLSessionStorage) CleanUp(referenceDate time.Time) (int64, error) {
 	t := s.SessionBridge.ConvertTime(referenceDate)
-	r, err := s.SessionDB.Exec(s.SessionQueries.CleanUpSession(), t)
+	r, err := s.sessionDB().Exec(s.SessionQueries.CleanUpSession(), t)
 	if err != nil {
 		return 0, err
 	}
@@ -739,7 +1328,7 @@ func (s *SQLSessionStorage) CleanUp(referenceDate time.Time) (int64, error) {
 }
 
 func (s *SQLSessionStorage) DeleteForUser(user UserID) (int64, error) {
-	r, err := s.SessionDB.Exec(s.SessionQueries.DeleteForUserSession(), user)
+	r, err := s.sessionDB().Exec(s.SessionQueries.DeleteForUserSession(), user)
 	if err != nil {
 		return 0, err
 	}
@@ -749,3 +1338,427 @@ func (s *SQLSessionStorage) DeleteForUser(user UserID) (int64, error) {
 	}
 	return rowsAffected, nil
 }
+
+// PasswordHistorySQL defines an interface for working with the password history in
+// a sql database.
+//
+// The same rules as in UserSQL apply, the default table name is
+// "$PASSWORD_HISTORY_TABLE_NAME$" (replaced by "auth_password_history").
+type PasswordHistorySQL interface {
+	// InitPasswordHistory returns a sequence of init actions, for example create
+	// table and create index statements.
+	InitPasswordHistory() []string
+	// InsertPasswordHistory inserts a new entry.
+	// The arguments are the user id, the password hash and the changed at date.
+	InsertPasswordHistory() string
+	// GetPasswordHistory returns all entries for a user, the newest entry first.
+	// It must select the fields id (of the entry), user id, password and changed at.
+	// Exactly one element is passed to the query and that is the user id.
+	GetPasswordHistory() string
+	// DeletePasswordHistoryEntry deletes a single entry, the argument is the id of
+	// the entry.
+	DeletePasswordHistoryEntry() string
+	// DeletePasswordHistory deletes all entries for a user, the argument is the user id.
+	DeletePasswordHistory() string
+}
+
+// SQLPasswordHistoryStorage implements PasswordHistoryStorage by working with
+// database/sql.
+//
+// MaxEntries is the number of entries stored for each user, on insert the oldest
+// entries are removed in the same transaction.
+type SQLPasswordHistoryStorage struct {
+	HistoryDB      *sql.DB
+	HistoryQueries PasswordHistorySQL
+	HistoryBridge  SQLBridge
+	MaxEntries     int
+
+	// closed is set by Close
+	closed int32
+}
+
+// NewSQLPasswordHistoryStorage returns a new SQLPasswordHistoryStorage that stores
+// DefaultPasswordHistorySize entries per user.
+func NewSQLPasswordHistoryStorage(db *sql.DB, queries PasswordHistorySQL, bridge SQLBridge) *SQLPasswordHistoryStorage {
+	return &SQLPasswordHistoryStorage{
+		HistoryDB:      db,
+		HistoryQueries: queries,
+		HistoryBridge:  bridge,
+		MaxEntries:     DefaultPasswordHistorySize,
+	}
+}
+
+// Close closes the database, see SQLUserStorage.Close.
+func (s *SQLPasswordHistoryStorage) Close() error {
+	return closeSQL(s.HistoryDB, nil, &s.closed)
+}
+
+// Ping pings the database.
+func (s *SQLPasswordHistoryStorage) Ping(ctx context.Context) error {
+	return pingSQL(ctx, s.HistoryDB, &s.closed)
+}
+
+// Ready pings the database and tests if the history table exists.
+func (s *SQLPasswordHistoryStorage) Ready(ctx context.Context) error {
+	if err := s.Ping(ctx); err != nil {
+		return NewNotReady(err)
+	}
+	if _, err := s.GetPasswordHistory(InvalidUserID); err != nil {
+		return NewNotReady(err)
+	}
+	return nil
+}
+
+// InitPasswordHistory executes all init queries in a single transaction.
+func (s *SQLPasswordHistoryStorage) InitPasswordHistory() error {
+	tx, err := s.HistoryDB.Begin()
+	if err != nil {
+		return err
+	}
+	// save exec error
+	var execErr error
+	for _, initQuery := range s.HistoryQueries.InitPasswordHistory() {
+		// execute only non-empty statements
+		if initQuery == "" {
+			continue
+		}
+		if _, err := tx.Exec(initQuery); err != nil {
+			execErr = err
+			break
+		}
+	}
+	if execErr != nil {
+		if rollbackErr := tx.Rollback(); rollbackErr != nil {
+			return NewRollbackErr(execErr, rollbackErr)
+		}
+		return execErr
+	}
+	// commit
+	if commitErr := tx.Commit(); commitErr != nil {
+		return fmt.Errorf("commit in database init failed: %w", commitErr)
+	}
+	return nil
+}
+
+type historyRow struct {
+	id    int64
+	entry *PasswordHistoryEntry
+}
+
+func (s *SQLPasswordHistoryStorage) queryHistory(q interface {
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+}, user UserID) ([]historyRow, error) {
+	rows, err := q.Query(s.HistoryQueries.GetPasswordHistory(), user)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	res := make([]historyRow, 0, s.MaxEntries)
+	for rows.Next() {
+		var id int64
+		var entry PasswordHistoryEntry
+		changedAt := s.HistoryBridge.TimeScanType()
+		if scanErr := rows.Scan(&id, &entry.User, &entry.Password, changedAt); scanErr != nil {
+			return nil, scanErr
+		}
+		if t, tErr := s.HistoryBridge.ConvertTimeScanType(changedAt); tErr != nil {
+			return nil, tErr
+		} else {
+			entry.ChangedAt = t.UTC()
+		}
+		res = append(res, historyRow{id: id, entry: &entry})
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// InsertPasswordHistory inserts the entry and removes the oldest entries of the user
+// in a single transaction.
+func (s *SQLPasswordHistoryStorage) InsertPasswordHistory(entry *PasswordHistoryEntry) error {
+	tx, err := s.HistoryDB.Begin()
+	if err != nil {
+		return err
+	}
+	execErr := func() error {
+		changedAt := s.HistoryBridge.ConvertTime(entry.ChangedAt.UTC())
+		if _, err := tx.Exec(s.HistoryQueries.InsertPasswordHistory(),
+			entry.User, entry.Password, changedAt); err != nil {
+			return err
+		}
+		rows, err := s.queryHistory(tx, entry.User)
+		if err != nil {
+			return err
+		}
+		for i := s.MaxEntries; i < len(rows); i++ {
+			if _, err := tx.Exec(s.HistoryQueries.DeletePasswordHistoryEntry(), rows[i].id); err != nil {
+				return err
+			}
+		}
+		return nil
+	}()
+	if execErr != nil {
+		if rollbackErr := tx.Rollback(); rollbackErr != nil {
+			return NewRollbackErr(execErr, rollbackErr)
+		}
+		return execErr
+	}
+	if commitErr := tx.Commit(); commitErr != nil {
+		return fmt.Errorf("commit of password history failed: %w", commitErr)
+	}
+	return nil
+}
+
+func (s *SQLPasswordHistoryStorage) GetPasswordHistory(user UserID) ([]*PasswordHistoryEntry, error) {
+	rows, err := s.queryHistory(s.HistoryDB, user)
+	if err != nil {
+		return nil, err
+	}
+	res := make([]*PasswordHistoryEntry, len(rows))
+	for i, row := range rows {
+		res[i] = row.entry
+	}
+	return res, nil
+}
+
+func (s *SQLPasswordHistoryStorage) DeletePasswordHistory(user UserID) error {
+	_, err := s.HistoryDB.Exec(s.HistoryQueries.DeletePasswordHistory(), user)
+	return err
+}
+
+// UserAttributeSQL defines an interface for working with user attributes in a sql
+// database.
+//
+// The attributes are stored in an entity-attribute-value table with one row per
+// user and attribute name. Each row has a type (the AttributeType as integer) and
+// three value columns: string values and JSON documents are stored in the string
+// column, int and bool values (as 0 / 1) in the int column and times in the time
+// column. The unused value columns are NULL.
+//
+// The same rules as in UserSQL apply, the default table name is
+// "$USER_ATTRIBUTES_TABLE_NAME$" (replaced by "auth_user_attribute").
+type UserAttributeSQL interface {
+	// InitUserAttributes returns a sequence of init actions, for example create
+	// table and create index statements.
+	InitUserAttributes() []string
+	// GetUserAttributes returns all attributes of a user.
+	// It must select the fields name, type, string value, int value and time value.
+	// Exactly one element is passed to the query and that is the user id.
+	GetUserAttributes() string
+	// InsertUserAttribute inserts a new attribute.
+	// The arguments are the user id, name, type, string value, int value and time
+	// value.
+	InsertUserAttribute() string
+	// DeleteUserAttribute deletes a single attribute, the arguments are the user id
+	// and the name.
+	DeleteUserAttribute() string
+	// DeleteUserAttributes deletes all attributes of a user, the argument is the user
+	// id.
+	DeleteUserAttributes() string
+	// FindUsersByStringAttribute selects the user ids of all users with the given
+	// attribute in increasing order.
+	// The arguments are the name, the type and the string value.
+	FindUsersByStringAttribute() string
+	// FindUsersByIntAttribute works as FindUsersByStringAttribute with the int value.
+	FindUsersByIntAttribute() string
+	// FindUsersByTimeAttribute works as FindUsersByStringAttribute with the time value.
+	FindUsersByTimeAttribute() string
+}
+
+// SQLUserAttributeStorage implements UserAttributeStorage by working with
+// database/sql.
+type SQLUserAttributeStorage struct {
+	AttributeDB      *sql.DB
+	AttributeQueries UserAttributeSQL
+	AttributeBridge  SQLBridge
+
+	// closed is set by Close
+	closed int32
+}
+
+// NewSQLUserAttributeStorage returns a new SQLUserAttributeStorage.
+func NewSQLUserAttributeStorage(db *sql.DB, queries UserAttributeSQL, bridge SQLBridge) *SQLUserAttributeStorage {
+	return &SQLUserAttributeStorage{AttributeDB: db, AttributeQueries: queries, AttributeBridge: bridge}
+}
+
+// Close closes the database, see SQLUserStorage.Close.
+func (s *SQLUserAttributeStorage) Close() error {
+	return closeSQL(s.AttributeDB, nil, &s.closed)
+}
+
+// Ping pings the database.
+func (s *SQLUserAttributeStorage) Ping(ctx context.Context) error {
+	return pingSQL(ctx, s.AttributeDB, &s.closed)
+}
+
+// Ready pings the database and tests if the attributes table exists.
+func (s *SQLUserAttributeStorage) Ready(ctx context.Context) error {
+	if err := s.Ping(ctx); err != nil {
+		return NewNotReady(err)
+	}
+	if _, err := s.GetUserAttributes(InvalidUserID); err != nil {
+		return NewNotReady(err)
+	}
+	return nil
+}
+
+// InitUserAttributes executes all init queries in a single transaction.
+func (s *SQLUserAttributeStorage) InitUserAttributes() error {
+	return withTx(s.AttributeDB, "database init", func(tx *sql.Tx) error {
+		for _, initQuery := range s.AttributeQueries.InitUserAttributes() {
+			if initQuery == "" {
+				continue
+			}
+			if _, err := tx.Exec(initQuery); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// attributeArgs returns the type and the string, int and time value of an attribute.
+func (s *SQLUserAttributeStorage) attributeArgs(val AttributeValue) (int, interface{}, interface{}, interface{}, error) {
+	switch val.Type {
+	case AttributeString:
+		str, _ := val.AsString()
+		return int(val.Type), str, nil, nil, nil
+	case AttributeJSON:
+		raw, _ := val.AsJSON()
+		return int(val.Type), string(raw), nil, nil, nil
+	case AttributeInt:
+		i, _ := val.AsInt()
+		return int(val.Type), nil, i, nil, nil
+	case AttributeBool:
+		var i int64
+		if b, _ := val.AsBool(); b {
+			i = 1
+		}
+		return int(val.Type), nil, i, nil, nil
+	case AttributeTime:
+		t, _ := val.AsTime()
+		return int(val.Type), nil, nil, s.AttributeBridge.ConvertTime(t.UTC()), nil
+	default:
+		return 0, nil, nil, nil, fmt.Errorf("invalid attribute type %v", val.Type)
+	}
+}
+
+func (s *SQLUserAttributeStorage) GetUserAttributes(user UserID) (UserAttributes, error) {
+	rows, err := s.AttributeDB.Query(s.AttributeQueries.GetUserAttributes(), user)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	res := make(UserAttributes)
+	for rows.Next() {
+		var name string
+		var attributeType AttributeType
+		var str sql.NullString
+		var i sql.NullInt64
+		t := newNullableScan(s.AttributeBridge)
+		if scanErr := rows.Scan(&name, &attributeType, &str, &i, t); scanErr != nil {
+			return nil, scanErr
+		}
+		var val AttributeValue
+		switch attributeType {
+		case AttributeString:
+			val = StringAttribute(str.String)
+		case AttributeJSON:
+			val, err = JSONAttribute(json.RawMessage(str.String))
+		case AttributeInt:
+			val = IntAttribute(i.Int64)
+		case AttributeBool:
+			val = BoolAttribute(i.Int64 != 0)
+		case AttributeTime:
+			var converted time.Time
+			if converted, err = t.convert(s.AttributeBridge); err == nil {
+				val = TimeAttribute(converted)
+			}
+		default:
+			err = fmt.Errorf("invalid type %d of attribute %s", attributeType, name)
+		}
+		if err != nil {
+			return nil, err
+		}
+		res[name] = val
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// SetUserAttributes replaces the attributes in a single transaction.
+func (s *SQLUserAttributeStorage) SetUserAttributes(user UserID, attributes UserAttributes) error {
+	for name := range attributes {
+		if err := checkAttributeName(name); err != nil {
+			return err
+		}
+	}
+	return withTx(s.AttributeDB, "user attributes", func(tx *sql.Tx) error {
+		for name, val := range attributes {
+			attributeType, str, i, t, argsErr := s.attributeArgs(val)
+			if argsErr != nil {
+				return argsErr
+			}
+			if _, err := tx.Exec(s.AttributeQueries.DeleteUserAttribute(), user, name); err != nil {
+				return err
+			}
+			if _, err := tx.Exec(s.AttributeQueries.InsertUserAttribute(),
+				user, name, attributeType, str, i, t); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (s *SQLUserAttributeStorage) DeleteUserAttributes(user UserID, names ...string) error {
+	if len(names) == 0 {
+		_, err := s.AttributeDB.Exec(s.AttributeQueries.DeleteUserAttributes(), user)
+		return err
+	}
+	return withTx(s.AttributeDB, "user attributes", func(tx *sql.Tx) error {
+		for _, name := range names {
+			if _, err := tx.Exec(s.AttributeQueries.DeleteUserAttribute(), user, name); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (s *SQLUserAttributeStorage) FindUsersByAttribute(name string, value AttributeValue) ([]UserID, error) {
+	attributeType, str, i, t, argsErr := s.attributeArgs(value)
+	if argsErr != nil {
+		return nil, argsErr
+	}
+	var query string
+	var arg interface{}
+	switch value.Type {
+	case AttributeString, AttributeJSON:
+		query, arg = s.AttributeQueries.FindUsersByStringAttribute(), str
+	case AttributeInt, AttributeBool:
+		query, arg = s.AttributeQueries.FindUsersByIntAttribute(), i
+	default:
+		query, arg = s.AttributeQueries.FindUsersByTimeAttribute(), t
+	}
+	rows, err := s.AttributeDB.Query(query, name, attributeType, arg)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	res := make([]UserID, 0)
+	for rows.Next() {
+		var id UserID
+		if scanErr := rows.Scan(&id); scanErr != nil {
+			return nil, scanErr
+		}
+		res = append(res, id)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
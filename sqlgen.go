@@ -0,0 +1,585 @@
+// Copyright 2019 Fabian Wenzelmann
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gopherbouncedb
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// PlaceholderStyle describes how the arguments of a query are referenced.
+type PlaceholderStyle int
+
+const (
+	// QuestionPlaceholder uses "?" for all arguments (SQLite, MySQL).
+	QuestionPlaceholder PlaceholderStyle = iota
+	// DollarPlaceholder uses "$1", "$2", ... (Postgres).
+	DollarPlaceholder
+	// AtPlaceholder uses "@p1", "@p2", ... (SQL Server).
+	AtPlaceholder
+)
+
+// UpsertStyle describes the syntax of an insert that updates the row if the key
+// already exists.
+type UpsertStyle int
+
+const (
+	// NoUpsert means that the database doesn't support upserts.
+	NoUpsert UpsertStyle = iota
+	// OnConflictUpsert uses "ON CONFLICT (key) DO UPDATE SET col=EXCLUDED.col"
+	// (Postgres, SQLite ≥ 3.24).
+	OnConflictUpsert
+	// OnDuplicateKeyUpsert uses "ON DUPLICATE KEY UPDATE col=VALUES(col)" (MySQL).
+	OnDuplicateKeyUpsert
+)
+
+// SQLDialect describes the syntax of a database, it is used by GenerateUserSQL and
+// GenerateSessionSQL to generate the queries.
+//
+// The packages sqlite, postgres and mysql contain hand-written queries for the same
+// tables, they are the canonical implementation for these databases and should be
+// preferred (they also implement migrations the generated queries don't support).
+// The generated queries are meant for tables with other column names (see
+// GenerateMappedUserSQL) and for databases without such a package; a change to the
+// tables must be made in both places.
+//
+// The type names are used in the CREATE TABLE statements and may contain meta
+// variables.
+type SQLDialect struct {
+	// Name is the name of the dialect, only used in error messages.
+	Name        string
+	Placeholder PlaceholderStyle
+	// IdentifierQuote is used to quote column names, for example `"` or "`".
+	// If empty column names are not quoted.
+	IdentifierQuote string
+	// IDType is the complete definition of the user id column, including the
+	// primary key and auto increment, for example "BIGSERIAL PRIMARY KEY".
+	IDType string
+	// IntType is the type of user ids that reference a user, for example "BIGINT".
+	IntType string
+	// VarcharType is the type of strings, "(n)" is appended with the max length.
+	VarcharType string
+	BoolType    string
+	TimeType    string
+	// TableOptions is appended to the CREATE TABLE statements (for example the
+	// engine and charset for MySQL).
+	TableOptions string
+	Upsert       UpsertStyle
+	// Returning is true if the database supports "INSERT ... RETURNING id", in this
+	// case the generated queries implement InsertReturningSQL.
+	Returning bool
+	// InlineIndexes is true if indexes are defined in the CREATE TABLE statement
+	// ("KEY name (column)") instead of "CREATE INDEX IF NOT EXISTS".
+	InlineIndexes bool
+	// DropNotNull is the format of the statement that allows NULL in a column, the
+	// arguments are the table, the column and the column type.
+	// If empty the table is copied to a new table instead.
+	DropNotNull string
+	// SchemaIndexNames is true if the schema of an index is given in the index name
+	// instead of the table name ("CREATE INDEX schema.name ON table", SQLite).
+	SchemaIndexNames bool
+}
+
+// NewSQLiteDialect returns the dialect for SQLite, times are stored as TEXT.
+func NewSQLiteDialect() *SQLDialect {
+	return &SQLDialect{
+		Name:             "sqlite",
+		Placeholder:      QuestionPlaceholder,
+		IdentifierQuote:  `"`,
+		IDType:           "INTEGER PRIMARY KEY AUTOINCREMENT",
+		IntType:          "INTEGER",
+		VarcharType:      "VARCHAR",
+		BoolType:         "BOOLEAN",
+		TimeType:         "TEXT",
+		Upsert:           OnConflictUpsert,
+		SchemaIndexNames: true,
+	}
+}
+
+// NewPostgresDialect returns the dialect for Postgres.
+func NewPostgresDialect() *SQLDialect {
+	return &SQLDialect{
+		Name:            "postgres",
+		Placeholder:     DollarPlaceholder,
+		IdentifierQuote: `"`,
+		IDType:          "BIGSERIAL PRIMARY KEY",
+		IntType:         "BIGINT",
+		VarcharType:     "VARCHAR",
+		BoolType:        "BOOLEAN",
+		TimeType:        "TIMESTAMPTZ",
+		Upsert:          OnConflictUpsert,
+		Returning:       true,
+		DropNotNull:     "ALTER TABLE %[1]s ALTER COLUMN %[2]s DROP NOT NULL;",
+	}
+}
+
+// NewMySQLDialect returns the dialect for MySQL and MariaDB.
+func NewMySQLDialect() *SQLDialect {
+	return &SQLDialect{
+		Name:            "mysql",
+		Placeholder:     QuestionPlaceholder,
+		IdentifierQuote: "`",
+		IDType:          "BIGINT NOT NULL AUTO_INCREMENT PRIMARY KEY",
+		IntType:         "BIGINT",
+		VarcharType:     "VARCHAR",
+		BoolType:        "BOOL",
+		TimeType:        "DATETIME(6)",
+		TableOptions:    "ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_bin",
+		Upsert:          OnDuplicateKeyUpsert,
+		InlineIndexes:   true,
+		DropNotNull:     "ALTER TABLE %[1]s MODIFY %[2]s %[3]s NULL;",
+	}
+}
+
+// Arg returns the placeholder for the i-th argument (starting with 1).
+func (d *SQLDialect) Arg(i int) string {
+	switch d.Placeholder {
+	case DollarPlaceholder:
+		return fmt.Sprintf("$%d", i)
+	case AtPlaceholder:
+		return fmt.Sprintf("@p%d", i)
+	default:
+		return "?"
+	}
+}
+
+// Quote quotes the identifier with IdentifierQuote.
+func (d *SQLDialect) Quote(identifier string) string {
+	return d.IdentifierQuote + identifier + d.IdentifierQuote
+}
+
+// args returns the placeholders for the arguments first, ..., first + n - 1.
+func (d *SQLDialect) args(first, n int) string {
+	res := make([]string, n)
+	for i := range res {
+		res[i] = d.Arg(first + i)
+	}
+	return strings.Join(res, ", ")
+}
+
+// assignments returns "col1=arg1, col2=arg2, ..." with the arguments starting at 1.
+func (d *SQLDialect) assignments(columns []string) string {
+	res := make([]string, len(columns))
+	for i, column := range columns {
+		res[i] = column + "=" + d.Arg(i+1)
+	}
+	return strings.Join(res, ", ")
+}
+
+// upsert returns the clause appended to an insert to update the columns if the key
+// already exists, or "" if upserts are not supported.
+func (d *SQLDialect) upsert(key string, columns []string) string {
+	updates := make([]string, len(columns))
+	switch d.Upsert {
+	case OnConflictUpsert:
+		for i, column := range columns {
+			updates[i] = fmt.Sprintf("%s=EXCLUDED.%s", column, column)
+		}
+		return fmt.Sprintf(" ON CONFLICT (%s) DO UPDATE SET %s", key, strings.Join(updates, ", "))
+	case OnDuplicateKeyUpsert:
+		for i, column := range columns {
+			updates[i] = fmt.Sprintf("%s=VALUES(%s)", column, column)
+		}
+		return " ON DUPLICATE KEY UPDATE " + strings.Join(updates, ", ")
+	default:
+		return ""
+	}
+}
+
+// createTable returns the init statements for a table with the given column
+// definitions and indexes (pairs of index name suffix and column, the name of an
+// index is the table name followed by the suffix).
+func (d *SQLDialect) createTable(table sqlTable, definitions []string, indexes [][2]string) []string {
+	var res []string
+	if d.InlineIndexes {
+		for _, index := range indexes {
+			definitions = append(definitions, fmt.Sprintf("KEY %s%s (%s)", table.name, index[0], index[1]))
+		}
+	}
+	create := fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s (\n\t%s\n)", table.qualified(), strings.Join(definitions, ",\n\t"))
+	if d.TableOptions != "" {
+		create += " " + d.TableOptions
+	}
+	res = append(res, create+";")
+	if !d.InlineIndexes {
+		for _, index := range indexes {
+			name, on := table.name+index[0], table.qualified()
+			if d.SchemaIndexNames {
+				name, on = qualify(table.schema, name), table.name
+			}
+			res = append(res, fmt.Sprintf("CREATE INDEX IF NOT EXISTS %s ON %s(%s);", name, on, index[1]))
+		}
+	}
+	return res
+}
+
+// userSQLFields are the fields of UserModel in the order used by UserSQL.
+var userSQLFields = []string{"ID", "Username", "Password", "EMail", "FirstName", "LastName",
+	"IsSuperUser", "IsStaff", "IsActive", "DateJoined", "LastLogin", "PasswordChangedAt",
+	"MustChangePassword"}
+
+// UserUpdateFields returns the fields updated by UserStorage.UpdateUser if no
+// fields are given, that is all fields except the id in the order used by UserSQL.
+func UserUpdateFields() []string {
+	return append([]string{}, userSQLFields[1:]...)
+}
+
+// fieldType returns the column type of a field in CREATE TABLE statements.
+func (d *SQLDialect) fieldType(field *UserField) string {
+	notNull := " NOT NULL"
+	if field.Nullable {
+		notNull = ""
+	}
+	switch {
+	case field.Type == reflect.TypeOf(InvalidUserID):
+		return d.IDType
+	case field.IsTime():
+		return d.TimeType + notNull
+	case field.Type.Kind() == reflect.Bool:
+		return d.BoolType + notNull
+	default:
+		return fmt.Sprintf("%s(%s)%s", d.VarcharType, field.MaxLenVar(), notNull)
+	}
+}
+
+// sessionSQLFields are the fields of SessionEntry in the order used by SessionSQL.
+var sessionSQLFields = []string{"Key", "User", "ExpireDate"}
+
+// columnNames returns the quoted columns for the fields, an error is returned if a
+// field is not contained in rowNames.
+func (d *SQLDialect) columnNames(rowNames map[string]string, fields []string) ([]string, error) {
+	res := make([]string, len(fields))
+	for i, field := range fields {
+		row, has := rowNames[field]
+		if !has {
+			return nil, fmt.Errorf("no column name for field %s", field)
+		}
+		res[i] = d.Quote(row)
+	}
+	return res, nil
+}
+
+// GeneratedUserSQL is a UserSQL generated by GenerateUserSQL or
+// GenerateMappedUserSQL.
+// It also implements PasswordExpirySQL, InsertReturningSQL, NullLastLoginSQL and
+// ExtraColumnsSQL.
+type GeneratedUserSQL struct {
+	Dialect *SQLDialect
+	// Columns maps the lower case field names to the quoted column names.
+	Columns map[string]string
+	InitS   []string
+	GetUserS, GetUserByNameS, GetUserByEmailS, InsertUserS,
+	DeleteUserS, ListUsersS, ListPasswordExpiredS string
+	AllowNullLastLoginS     []string
+	ClearLastLoginSentinelS string
+	// UpdatePrefix is the beginning of the update statements ("UPDATE table SET ").
+	UpdatePrefix string
+	// IDColumn is the quoted id column.
+	IDColumn string
+	Extra    []ExtraColumn
+}
+
+// GenerateUserSQL generates the user queries for a dialect.
+//
+// rowNames maps the fields of UserModel to the column names, it must contain all
+// fields from DefaultUserRowNames (which can be used if the default names should be
+// used).
+// The meta variables are replaced with replacer, see UserSQL.
+// The max length variables are used for the VARCHAR columns, username is unique and
+// email uses "$EMAIL_UNIQUE$". The last login allows NULL.
+func GenerateUserSQL(dialect *SQLDialect, rowNames map[string]string, replacer *SQLTemplateReplacer) (*GeneratedUserSQL, error) {
+	return generateUserSQL(dialect, sqlTable{name: "$USERS_TABLE_NAME$"}, rowNames, nil, replacer)
+}
+
+// GenerateMappedUserSQL works as GenerateUserSQL for an existing table described by
+// mapping and with additional columns, see ExtraColumnsSQL.
+// Fields not contained in mapping.RowNames use the column names from
+// DefaultUserRowNames.
+// An error is returned if the extra columns are invalid, see ExtraColumn.
+func GenerateMappedUserSQL(dialect *SQLDialect, mapping *SQLTableMapping, extra []ExtraColumn, replacer *SQLTemplateReplacer) (*GeneratedUserSQL, error) {
+	if err := checkExtraColumns(extra); err != nil {
+		return nil, err
+	}
+	return generateUserSQL(dialect, mapping.table("$USERS_TABLE_NAME$"),
+		mapping.rowNames(DefaultUserRowNames), extra, replacer)
+}
+
+func generateUserSQL(dialect *SQLDialect, table sqlTable, rowNames map[string]string, extra []ExtraColumn,
+	replacer *SQLTemplateReplacer) (*GeneratedUserSQL, error) {
+	columns, err := dialect.columnNames(rowNames, userSQLFields)
+	if err != nil {
+		return nil, err
+	}
+	qualified := table.qualified()
+	id, username, email := columns[0], columns[1], columns[3]
+	isSuperUser, isStaff := columns[6], columns[7]
+	lastLogin, passwordChangedAt, mustChangePassword := columns[10], columns[11], columns[12]
+	types := make([]string, len(userSQLFields))
+	for i, name := range userSQLFields {
+		field, _ := LookupUserField(name)
+		types[i] = dialect.fieldType(field)
+	}
+	types[1] += " UNIQUE"
+	types[3] += " $EMAIL_UNIQUE$"
+	for _, column := range extra {
+		columns = append(columns, dialect.Quote(column.ColumnName()))
+		types = append(types, column.definition(dialect))
+	}
+	selectAll := fmt.Sprintf("SELECT %s FROM %s", strings.Join(columns, ", "), qualified)
+	definitions := make([]string, len(columns))
+	for i, column := range columns {
+		definitions[i] = strings.TrimSpace(column + " " + types[i])
+	}
+	indexes := [][2]string{{"_password_changed_at_idx", passwordChangedAt}}
+	if strings.TrimSpace(replacer.Apply("$EMAIL_UNIQUE$")) == "" {
+		indexes = append(indexes, [2]string{"_email_idx", email})
+	}
+	insert := fmt.Sprintf("INSERT INTO %s(%s) VALUES(%s)", qualified, strings.Join(columns[1:], ", "),
+		dialect.args(1, len(columns)-1))
+	if dialect.Returning {
+		insert += " RETURNING " + id
+	}
+	expired := fmt.Sprintf("%s WHERE %s OR (%s AND %s < %s) OR (NOT %s AND %s AND %s < %s) OR (NOT %s AND NOT %s AND %s < %s);",
+		selectAll, mustChangePassword,
+		isSuperUser, passwordChangedAt, dialect.Arg(1),
+		isSuperUser, isStaff, passwordChangedAt, dialect.Arg(2),
+		isSuperUser, isStaff, passwordChangedAt, dialect.Arg(3))
+	var allowNull []string
+	if dialect.DropNotNull != "" {
+		allowNull = []string{fmt.Sprintf(dialect.DropNotNull, qualified, lastLogin, dialect.TimeType)}
+	} else {
+		// copy the table to a new table with the same indexes
+		migration := sqlTable{schema: table.schema, name: table.name + "_null_migration"}
+		columnList := strings.Join(columns, ", ")
+		allowNull = append([]string{
+			dialect.createTable(migration, definitions, nil)[0],
+			fmt.Sprintf("INSERT INTO %s(%s) SELECT %s FROM %s;", migration.qualified(), columnList, columnList, qualified),
+			fmt.Sprintf("DROP TABLE %s;", qualified),
+			fmt.Sprintf("ALTER TABLE %s RENAME TO %s;", migration.qualified(), table.name),
+		}, dialect.createTable(table, definitions, indexes)[1:]...)
+	}
+	res := &GeneratedUserSQL{
+		Dialect:              dialect,
+		Columns:              make(map[string]string, len(columns)),
+		InitS:                dialect.createTable(table, definitions, indexes),
+		GetUserS:             fmt.Sprintf("%s WHERE %s=%s;", selectAll, id, dialect.Arg(1)),
+		GetUserByNameS:       fmt.Sprintf("%s WHERE %s=%s;", selectAll, username, dialect.Arg(1)),
+		GetUserByEmailS:      fmt.Sprintf("%s WHERE %s=%s;", selectAll, email, dialect.Arg(1)),
+		InsertUserS:          insert + ";",
+		DeleteUserS:          fmt.Sprintf("DELETE FROM %s WHERE %s=%s;", qualified, id, dialect.Arg(1)),
+		ListUsersS:           selectAll + ";",
+		ListPasswordExpiredS: expired,
+		AllowNullLastLoginS:  allowNull,
+		ClearLastLoginSentinelS: fmt.Sprintf("UPDATE %s SET %s=NULL WHERE %s=%s;", qualified, lastLogin,
+			lastLogin, dialect.Arg(1)),
+		UpdatePrefix: fmt.Sprintf("UPDATE %s SET ", qualified),
+		IDColumn:     id,
+		Extra:        extra,
+	}
+	for _, statements := range [][]string{res.InitS, res.AllowNullLastLoginS} {
+		for i, stmt := range statements {
+			statements[i] = replacer.Apply(stmt)
+		}
+	}
+	for _, query := range []*string{&res.GetUserS, &res.GetUserByNameS, &res.GetUserByEmailS,
+		&res.InsertUserS, &res.DeleteUserS, &res.ListUsersS, &res.ListPasswordExpiredS,
+		&res.ClearLastLoginSentinelS, &res.UpdatePrefix} {
+		*query = replacer.Apply(*query)
+	}
+	for i, field := range userSQLFields {
+		res.Columns[strings.ToLower(field)] = columns[i]
+	}
+	for i, column := range extra {
+		res.Columns[strings.ToLower(column.Name)] = columns[len(userSQLFields)+i]
+	}
+	return res, nil
+}
+
+func (q *GeneratedUserSQL) InitUsers() []string {
+	return q.InitS
+}
+
+func (q *GeneratedUserSQL) GetUser() string {
+	return q.GetUserS
+}
+
+func (q *GeneratedUserSQL) GetUserByName() string {
+	return q.GetUserByNameS
+}
+
+func (q *GeneratedUserSQL) GetUserByEmail() string {
+	return q.GetUserByEmailS
+}
+
+func (q *GeneratedUserSQL) InsertUser() string {
+	return q.InsertUserS
+}
+
+// InsertReturnsID returns true if the dialect supports RETURNING.
+func (q *GeneratedUserSQL) InsertReturnsID() bool {
+	return q.Dialect.Returning
+}
+
+// UpdateUser returns the update statement for the fields, if fields is empty all
+// fields except the id are updated.
+// Invalid field names are ignored here, SQLUserStorage returns an error for them
+// before executing the query.
+func (q *GeneratedUserSQL) UpdateUser(fields []string) string {
+	if len(fields) == 0 {
+		fields = UserUpdateFields()
+		for _, column := range q.Extra {
+			fields = append(fields, column.Name)
+		}
+	}
+	columns := make([]string, 0, len(fields))
+	for _, field := range fields {
+		if column, has := q.Columns[strings.ToLower(field)]; has {
+			columns = append(columns, column)
+		}
+	}
+	return fmt.Sprintf("%s%s WHERE %s=%s;", q.UpdatePrefix, q.Dialect.assignments(columns),
+		q.IDColumn, q.Dialect.Arg(len(columns)+1))
+}
+
+// SupportsUserFields returns true.
+func (q *GeneratedUserSQL) SupportsUserFields() bool {
+	return true
+}
+
+func (q *GeneratedUserSQL) DeleteUser() string {
+	return q.DeleteUserS
+}
+
+func (q *GeneratedUserSQL) ListUsers() string {
+	return q.ListUsersS
+}
+
+func (q *GeneratedUserSQL) ListPasswordExpired() string {
+	return q.ListPasswordExpiredS
+}
+
+func (q *GeneratedUserSQL) AllowNullLastLogin() []string {
+	return q.AllowNullLastLoginS
+}
+
+func (q *GeneratedUserSQL) ClearLastLoginSentinel() string {
+	return q.ClearLastLoginSentinelS
+}
+
+func (q *GeneratedUserSQL) ExtraColumns() []ExtraColumn {
+	return q.Extra
+}
+
+// GeneratedSessionSQL is a SessionSQL generated by GenerateSessionSQL.
+type GeneratedSessionSQL struct {
+	Dialect *SQLDialect
+	InitS   []string
+	GetSessionS, InsertSessionS, DeleteSessionS,
+	CleanUpSessionS, DeleteForUserSessionS string
+	// UpsertSessionS is the query returned by UpsertSession.
+	UpsertSessionS string
+}
+
+// GenerateSessionSQL generates the session queries for a dialect.
+//
+// rowNames maps the fields of SessionEntry to the column names, for example
+// DefaultSessionRowNames.
+// The session key is stored as a VARCHAR(128).
+func GenerateSessionSQL(dialect *SQLDialect, rowNames map[string]string, replacer *SQLTemplateReplacer) (*GeneratedSessionSQL, error) {
+	return generateSessionSQL(dialect, sqlTable{name: "$SESSIONS_TABLE_NAME$"}, rowNames, replacer)
+}
+
+// GenerateMappedSessionSQL works as GenerateSessionSQL for an existing table
+// described by mapping.
+// Fields not contained in mapping.RowNames use the column names from
+// DefaultSessionRowNames.
+func GenerateMappedSessionSQL(dialect *SQLDialect, mapping *SQLTableMapping, replacer *SQLTemplateReplacer) (*GeneratedSessionSQL, error) {
+	return generateSessionSQL(dialect, mapping.table("$SESSIONS_TABLE_NAME$"),
+		mapping.rowNames(DefaultSessionRowNames), replacer)
+}
+
+func generateSessionSQL(dialect *SQLDialect, sessionTable sqlTable, rowNames map[string]string,
+	replacer *SQLTemplateReplacer) (*GeneratedSessionSQL, error) {
+	columns, err := dialect.columnNames(rowNames, sessionSQLFields)
+	if err != nil {
+		return nil, err
+	}
+	table := sessionTable.qualified()
+	key, user, expireDate := columns[0], columns[1], columns[2]
+	definitions := []string{
+		fmt.Sprintf("%s %s(128) NOT NULL PRIMARY KEY", key, dialect.VarcharType),
+		fmt.Sprintf("%s %s NOT NULL", user, dialect.IntType),
+		fmt.Sprintf("%s %s NOT NULL", expireDate, dialect.TimeType),
+	}
+	indexes := [][2]string{
+		{"_user_idx", user},
+		{"_expire_date_idx", expireDate},
+	}
+	insert := fmt.Sprintf("INSERT INTO %s(%s) VALUES(%s)", table, strings.Join(columns, ", "),
+		dialect.args(1, len(columns)))
+	res := &GeneratedSessionSQL{
+		Dialect:               dialect,
+		InitS:                 dialect.createTable(sessionTable, definitions, indexes),
+		GetSessionS:           fmt.Sprintf("SELECT %s FROM %s WHERE %s=%s;", strings.Join(columns, ", "), table, key, dialect.Arg(1)),
+		InsertSessionS:        insert + ";",
+		DeleteSessionS:        fmt.Sprintf("DELETE FROM %s WHERE %s=%s;", table, key, dialect.Arg(1)),
+		CleanUpSessionS:       fmt.Sprintf("DELETE FROM %s WHERE %s < %s;", table, expireDate, dialect.Arg(1)),
+		DeleteForUserSessionS: fmt.Sprintf("DELETE FROM %s WHERE %s=%s;", table, user, dialect.Arg(1)),
+	}
+	if dialect.Upsert != NoUpsert {
+		res.UpsertSessionS = insert + dialect.upsert(key, columns[1:]) + ";"
+	}
+	for i, init := range res.InitS {
+		res.InitS[i] = replacer.Apply(init)
+	}
+	for _, query := range []*string{&res.GetSessionS, &res.InsertSessionS, &res.DeleteSessionS,
+		&res.CleanUpSessionS, &res.DeleteForUserSessionS, &res.UpsertSessionS} {
+		*query = replacer.Apply(*query)
+	}
+	return res, nil
+}
+
+func (q *GeneratedSessionSQL) InitSessions() []string {
+	return q.InitS
+}
+
+func (q *GeneratedSessionSQL) GetSession() string {
+	return q.GetSessionS
+}
+
+func (q *GeneratedSessionSQL) InsertSession() string {
+	return q.InsertSessionS
+}
+
+// UpsertSession returns a query that inserts a session or updates the user and
+// expire date if a session with the key already exists.
+// The arguments are the same as for InsertSession.
+// It returns the empty string if the dialect doesn't support upserts.
+func (q *GeneratedSessionSQL) UpsertSession() string {
+	return q.UpsertSessionS
+}
+
+func (q *GeneratedSessionSQL) DeleteSession() string {
+	return q.DeleteSessionS
+}
+
+func (q *GeneratedSessionSQL) CleanUpSession() string {
+	return q.CleanUpSessionS
+}
+
+func (q *GeneratedSessionSQL) DeleteForUserSession() string {
+	return q.DeleteForUserSessionS
+}
@@ -0,0 +1,118 @@
+// Copyright 2019 Fabian Wenzelmann
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sqlite
+
+import (
+	"database/sql"
+
+	"github.com/FabianWe/gopherbouncedb"
+)
+
+const (
+	// SQLiteUserAttributesInit is the statement to create the user attributes table.
+	SQLiteUserAttributesInit = `CREATE TABLE IF NOT EXISTS $USER_ATTRIBUTES_TABLE_NAME$ (
+	user_id INTEGER NOT NULL,
+	name VARCHAR(128) NOT NULL,
+	value_type INTEGER NOT NULL,
+	string_value TEXT,
+	int_value INTEGER,
+	time_value $SQLITE_TIME_TYPE$,
+	PRIMARY KEY (user_id, name)
+);`
+	SQLiteUserAttributesStringIndex = `CREATE INDEX IF NOT EXISTS $USER_ATTRIBUTES_TABLE_NAME$_string_value_idx ON $USER_ATTRIBUTES_TABLE_NAME$(name, string_value);`
+	SQLiteUserAttributesIntIndex    = `CREATE INDEX IF NOT EXISTS $USER_ATTRIBUTES_TABLE_NAME$_int_value_idx ON $USER_ATTRIBUTES_TABLE_NAME$(name, int_value);`
+	SQLiteUserAttributesTimeIndex   = `CREATE INDEX IF NOT EXISTS $USER_ATTRIBUTES_TABLE_NAME$_time_value_idx ON $USER_ATTRIBUTES_TABLE_NAME$(name, time_value);`
+
+	SQLiteGetUserAttributes    = `SELECT name, value_type, string_value, int_value, time_value FROM $USER_ATTRIBUTES_TABLE_NAME$ WHERE user_id=?;`
+	SQLiteInsertUserAttribute  = `INSERT INTO $USER_ATTRIBUTES_TABLE_NAME$(user_id, name, value_type, string_value, int_value, time_value) VALUES(?, ?, ?, ?, ?, ?);`
+	SQLiteDeleteUserAttribute  = `DELETE FROM $USER_ATTRIBUTES_TABLE_NAME$ WHERE user_id=? AND name=?;`
+	SQLiteDeleteUserAttributes = `DELETE FROM $USER_ATTRIBUTES_TABLE_NAME$ WHERE user_id=?;`
+	SQLiteFindUsersByString    = `SELECT user_id FROM $USER_ATTRIBUTES_TABLE_NAME$ WHERE name=? AND value_type=? AND string_value=? ORDER BY user_id;`
+	SQLiteFindUsersByInt       = `SELECT user_id FROM $USER_ATTRIBUTES_TABLE_NAME$ WHERE name=? AND value_type=? AND int_value=? ORDER BY user_id;`
+	SQLiteFindUsersByTime      = `SELECT user_id FROM $USER_ATTRIBUTES_TABLE_NAME$ WHERE name=? AND value_type=? AND time_value=? ORDER BY user_id;`
+)
+
+// SQLiteUserAttributeQueries implements gopherbouncedb.UserAttributeSQL for SQLite.
+type SQLiteUserAttributeQueries struct {
+	InitS                                  []string
+	GetS, InsertS, DeleteS, DeleteAllS     string
+	FindByStringS, FindByIntS, FindByTimeS string
+	Replacer                               *gopherbouncedb.SQLTemplateReplacer
+}
+
+// NewSQLiteUserAttributeQueries returns new queries, see NewSQLiteUserQueries.
+func NewSQLiteUserAttributeQueries(replaceMapping map[string]string, format TimeFormat) *SQLiteUserAttributeQueries {
+	replacer := newReplacer(replaceMapping, format)
+	return &SQLiteUserAttributeQueries{
+		InitS: []string{
+			replacer.Apply(SQLiteUserAttributesInit),
+			replacer.Apply(SQLiteUserAttributesStringIndex),
+			replacer.Apply(SQLiteUserAttributesIntIndex),
+			replacer.Apply(SQLiteUserAttributesTimeIndex),
+		},
+		GetS:          replacer.Apply(SQLiteGetUserAttributes),
+		InsertS:       replacer.Apply(SQLiteInsertUserAttribute),
+		DeleteS:       replacer.Apply(SQLiteDeleteUserAttribute),
+		DeleteAllS:    replacer.Apply(SQLiteDeleteUserAttributes),
+		FindByStringS: replacer.Apply(SQLiteFindUsersByString),
+		FindByIntS:    replacer.Apply(SQLiteFindUsersByInt),
+		FindByTimeS:   replacer.Apply(SQLiteFindUsersByTime),
+		Replacer:      replacer,
+	}
+}
+
+func (q *SQLiteUserAttributeQueries) InitUserAttributes() []string {
+	return q.InitS
+}
+
+func (q *SQLiteUserAttributeQueries) GetUserAttributes() string {
+	return q.GetS
+}
+
+func (q *SQLiteUserAttributeQueries) InsertUserAttribute() string {
+	return q.InsertS
+}
+
+func (q *SQLiteUserAttributeQueries) DeleteUserAttribute() string {
+	return q.DeleteS
+}
+
+func (q *SQLiteUserAttributeQueries) DeleteUserAttributes() string {
+	return q.DeleteAllS
+}
+
+func (q *SQLiteUserAttributeQueries) FindUsersByStringAttribute() string {
+	return q.FindByStringS
+}
+
+func (q *SQLiteUserAttributeQueries) FindUsersByIntAttribute() string {
+	return q.FindByIntS
+}
+
+func (q *SQLiteUserAttributeQueries) FindUsersByTimeAttribute() string {
+	return q.FindByTimeS
+}
+
+// SQLiteUserAttributeStorage is a user attribute storage for SQLite.
+type SQLiteUserAttributeStorage struct {
+	*gopherbouncedb.SQLUserAttributeStorage
+}
+
+// NewSQLiteUserAttributeStorage returns a new storage, see NewSQLiteUserStorage.
+func NewSQLiteUserAttributeStorage(db *sql.DB, replaceMapping map[string]string, format TimeFormat) *SQLiteUserAttributeStorage {
+	queries := NewSQLiteUserAttributeQueries(replaceMapping, format)
+	bridge := NewSQLiteBridge(format)
+	return &SQLiteUserAttributeStorage{gopherbouncedb.NewSQLUserAttributeStorage(db, queries, bridge)}
+}
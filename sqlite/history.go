@@ -0,0 +1,93 @@
+// Copyright 2019 Fabian Wenzelmann
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sqlite
+
+import (
+	"database/sql"
+
+	"github.com/FabianWe/gopherbouncedb"
+)
+
+const (
+	// SQLitePasswordHistoryInit is the statement to create the password history table.
+	SQLitePasswordHistoryInit = `CREATE TABLE IF NOT EXISTS $PASSWORD_HISTORY_TABLE_NAME$ (
+	id INTEGER PRIMARY KEY AUTOINCREMENT NOT NULL,
+	user_id INTEGER NOT NULL,
+	password VARCHAR($PASSWORD_MAX_LEN$) NOT NULL,
+	changed_at $SQLITE_TIME_TYPE$ NOT NULL
+);`
+	SQLitePasswordHistoryUserIndex = `CREATE INDEX IF NOT EXISTS $PASSWORD_HISTORY_TABLE_NAME$_user_id_idx ON $PASSWORD_HISTORY_TABLE_NAME$(user_id);`
+
+	SQLiteInsertPasswordHistory      = `INSERT INTO $PASSWORD_HISTORY_TABLE_NAME$(user_id, password, changed_at) VALUES(?, ?, ?);`
+	SQLiteGetPasswordHistory         = `SELECT id, user_id, password, changed_at FROM $PASSWORD_HISTORY_TABLE_NAME$ WHERE user_id=? ORDER BY changed_at DESC, id DESC;`
+	SQLiteDeletePasswordHistoryEntry = `DELETE FROM $PASSWORD_HISTORY_TABLE_NAME$ WHERE id=?;`
+	SQLiteDeletePasswordHistory      = `DELETE FROM $PASSWORD_HISTORY_TABLE_NAME$ WHERE user_id=?;`
+)
+
+// SQLitePasswordHistoryQueries implements gopherbouncedb.PasswordHistorySQL for
+// SQLite.
+type SQLitePasswordHistoryQueries struct {
+	InitS                                []string
+	InsertS, GetS, DeleteEntryS, DeleteS string
+	Replacer                             *gopherbouncedb.SQLTemplateReplacer
+}
+
+// NewSQLitePasswordHistoryQueries returns new queries, see NewSQLiteUserQueries.
+func NewSQLitePasswordHistoryQueries(replaceMapping map[string]string, format TimeFormat) *SQLitePasswordHistoryQueries {
+	replacer := newReplacer(replaceMapping, format)
+	return &SQLitePasswordHistoryQueries{
+		InitS: []string{
+			replacer.Apply(SQLitePasswordHistoryInit),
+			replacer.Apply(SQLitePasswordHistoryUserIndex),
+		},
+		InsertS:      replacer.Apply(SQLiteInsertPasswordHistory),
+		GetS:         replacer.Apply(SQLiteGetPasswordHistory),
+		DeleteEntryS: replacer.Apply(SQLiteDeletePasswordHistoryEntry),
+		DeleteS:      replacer.Apply(SQLiteDeletePasswordHistory),
+		Replacer:     replacer,
+	}
+}
+
+func (q *SQLitePasswordHistoryQueries) InitPasswordHistory() []string {
+	return q.InitS
+}
+
+func (q *SQLitePasswordHistoryQueries) InsertPasswordHistory() string {
+	return q.InsertS
+}
+
+func (q *SQLitePasswordHistoryQueries) GetPasswordHistory() string {
+	return q.GetS
+}
+
+func (q *SQLitePasswordHistoryQueries) DeletePasswordHistoryEntry() string {
+	return q.DeleteEntryS
+}
+
+func (q *SQLitePasswordHistoryQueries) DeletePasswordHistory() string {
+	return q.DeleteS
+}
+
+// SQLitePasswordHistoryStorage is a password history storage for SQLite.
+type SQLitePasswordHistoryStorage struct {
+	*gopherbouncedb.SQLPasswordHistoryStorage
+}
+
+// NewSQLitePasswordHistoryStorage returns a new storage, see NewSQLiteUserStorage.
+func NewSQLitePasswordHistoryStorage(db *sql.DB, replaceMapping map[string]string, format TimeFormat) *SQLitePasswordHistoryStorage {
+	queries := NewSQLitePasswordHistoryQueries(replaceMapping, format)
+	bridge := NewSQLiteBridge(format)
+	return &SQLitePasswordHistoryStorage{gopherbouncedb.NewSQLPasswordHistoryStorage(db, queries, bridge)}
+}
@@ -0,0 +1,70 @@
+// Copyright 2019 Fabian Wenzelmann
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sqlite
+
+import (
+	"database/sql"
+
+	"github.com/FabianWe/gopherbouncedb"
+)
+
+// NewDialect returns gopherbouncedb.NewSQLiteDialect with the column type of the
+// time format.
+func NewDialect(format TimeFormat) *gopherbouncedb.SQLDialect {
+	res := gopherbouncedb.NewSQLiteDialect()
+	res.TimeType = format.ColumnType()
+	return res
+}
+
+// NewSQLiteMappedUserStorage returns a storage for an existing users table described
+// by mapping, the values of the extra columns are stored in UserModel.Extensions.
+// The queries are generated with gopherbouncedb.GenerateMappedUserSQL,
+// replaceMapping (may be nil) is used as in NewSQLiteUserQueries.
+func NewSQLiteMappedUserStorage(db *sql.DB, mapping *gopherbouncedb.SQLTableMapping, extra []gopherbouncedb.ExtraColumn,
+	replaceMapping map[string]string, format TimeFormat) (*SQLiteUserStorage, error) {
+	queries, err := gopherbouncedb.GenerateMappedUserSQL(NewDialect(format), mapping, extra, newReplacer(replaceMapping, format))
+	if err != nil {
+		return nil, err
+	}
+	return &SQLiteUserStorage{gopherbouncedb.NewSQLUserStorage(db, queries, NewSQLiteBridge(format))}, nil
+}
+
+// NewSQLiteMappedSessionStorage returns a storage for an existing sessions table
+// described by mapping, see NewSQLiteMappedUserStorage.
+func NewSQLiteMappedSessionStorage(db *sql.DB, mapping *gopherbouncedb.SQLTableMapping,
+	replaceMapping map[string]string, format TimeFormat) (*SQLiteSessionStorage, error) {
+	queries, err := gopherbouncedb.GenerateMappedSessionSQL(NewDialect(format), mapping, newReplacer(replaceMapping, format))
+	if err != nil {
+		return nil, err
+	}
+	return &SQLiteSessionStorage{gopherbouncedb.NewSQLSessionStorage(db, queries, NewSQLiteBridge(format))}, nil
+}
+
+// NewSQLiteTypedUserStorage returns a storage for the application user type T, the
+// fields of T with a column tag are stored in extra columns of the table described
+// by mapping (may be nil), see gopherbouncedb.UserColumns and
+// NewSQLiteMappedUserStorage.
+func NewSQLiteTypedUserStorage[T any, PT gopherbouncedb.UserPtr[T]](db *sql.DB, mapping *gopherbouncedb.SQLTableMapping,
+	replaceMapping map[string]string, format TimeFormat) (*gopherbouncedb.TypedUserStorage[T, PT], error) {
+	extra, err := gopherbouncedb.UserColumns[T]()
+	if err != nil {
+		return nil, err
+	}
+	storage, err := NewSQLiteMappedUserStorage(db, mapping, extra, replaceMapping, format)
+	if err != nil {
+		return nil, err
+	}
+	return gopherbouncedb.NewTypedUserStorage[T, PT](storage)
+}
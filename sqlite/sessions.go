@@ -0,0 +1,99 @@
+// Copyright 2019 Fabian Wenzelmann
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sqlite
+
+import (
+	"database/sql"
+
+	"github.com/FabianWe/gopherbouncedb"
+)
+
+const (
+	// SQLiteSessionsInit is the statement to create the sessions table.
+	SQLiteSessionsInit = `CREATE TABLE IF NOT EXISTS $SESSIONS_TABLE_NAME$ (
+	session_key VARCHAR(128) NOT NULL PRIMARY KEY,
+	user INTEGER NOT NULL,
+	expire_date $SQLITE_TIME_TYPE$ NOT NULL
+);`
+	SQLiteSessionsUserIndex   = `CREATE INDEX IF NOT EXISTS $SESSIONS_TABLE_NAME$_user_idx ON $SESSIONS_TABLE_NAME$(user);`
+	SQLiteSessionsExpireIndex = `CREATE INDEX IF NOT EXISTS $SESSIONS_TABLE_NAME$_expire_date_idx ON $SESSIONS_TABLE_NAME$(expire_date);`
+
+	SQLiteInsertSession        = `INSERT INTO $SESSIONS_TABLE_NAME$(session_key, user, expire_date) VALUES(?, ?, ?);`
+	SQLiteGetSession           = `SELECT session_key, user, expire_date FROM $SESSIONS_TABLE_NAME$ WHERE session_key=?;`
+	SQLiteDeleteSession        = `DELETE FROM $SESSIONS_TABLE_NAME$ WHERE session_key=?;`
+	SQLiteCleanUpSession       = `DELETE FROM $SESSIONS_TABLE_NAME$ WHERE expire_date < ?;`
+	SQLiteDeleteForUserSession = `DELETE FROM $SESSIONS_TABLE_NAME$ WHERE user=?;`
+)
+
+// SQLiteSessionQueries implements gopherbouncedb.SessionSQL for SQLite.
+type SQLiteSessionQueries struct {
+	InitS []string
+	GetSessionS, InsertSessionS, DeleteSessionS,
+	CleanUpSessionS, DeleteForUserSessionS string
+	Replacer *gopherbouncedb.SQLTemplateReplacer
+}
+
+// NewSQLiteSessionQueries returns new queries, see NewSQLiteUserQueries.
+func NewSQLiteSessionQueries(replaceMapping map[string]string, format TimeFormat) *SQLiteSessionQueries {
+	replacer := newReplacer(replaceMapping, format)
+	res := &SQLiteSessionQueries{Replacer: replacer}
+	res.InitS = []string{
+		replacer.Apply(SQLiteSessionsInit),
+		replacer.Apply(SQLiteSessionsUserIndex),
+		replacer.Apply(SQLiteSessionsExpireIndex),
+	}
+	res.GetSessionS = replacer.Apply(SQLiteGetSession)
+	res.InsertSessionS = replacer.Apply(SQLiteInsertSession)
+	res.DeleteSessionS = replacer.Apply(SQLiteDeleteSession)
+	res.CleanUpSessionS = replacer.Apply(SQLiteCleanUpSession)
+	res.DeleteForUserSessionS = replacer.Apply(SQLiteDeleteForUserSession)
+	return res
+}
+
+func (q *SQLiteSessionQueries) InitSessions() []string {
+	return q.InitS
+}
+
+func (q *SQLiteSessionQueries) GetSession() string {
+	return q.GetSessionS
+}
+
+func (q *SQLiteSessionQueries) InsertSession() string {
+	return q.InsertSessionS
+}
+
+func (q *SQLiteSessionQueries) DeleteSession() string {
+	return q.DeleteSessionS
+}
+
+func (q *SQLiteSessionQueries) CleanUpSession() string {
+	return q.CleanUpSessionS
+}
+
+func (q *SQLiteSessionQueries) DeleteForUserSession() string {
+	return q.DeleteForUserSessionS
+}
+
+// SQLiteSessionStorage is a session storage for SQLite.
+type SQLiteSessionStorage struct {
+	*gopherbouncedb.SQLSessionStorage
+}
+
+// NewSQLiteSessionStorage returns a new storage, see NewSQLiteUserStorage.
+func NewSQLiteSessionStorage(db *sql.DB, replaceMapping map[string]string, format TimeFormat) *SQLiteSessionStorage {
+	queries := NewSQLiteSessionQueries(replaceMapping, format)
+	bridge := NewSQLiteBridge(format)
+	return &SQLiteSessionStorage{gopherbouncedb.NewSQLSessionStorage(db, queries, bridge)}
+}
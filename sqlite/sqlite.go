@@ -0,0 +1,134 @@
+// Copyright 2019 Fabian Wenzelmann
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package sqlite provides the queries and the SQLBridge to use the generic SQL
+// storages from gopherbouncedb with SQLite.
+//
+// It uses the driver github.com/mattn/go-sqlite3, the database must be opened with
+// the driver name "sqlite3".
+//
+// SQLite has no native type for time.Time, so the bridge stores times either as
+// text (ISO 8601 in UTC with a fixed number of fractional digits s.t. the
+// lexicographic order is the temporal order) or as an integer containing the
+// Unix time in seconds, see TimeFormat.
+package sqlite
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/FabianWe/gopherbouncedb"
+	"github.com/mattn/go-sqlite3"
+)
+
+// TimeFormat describes how time.Time values are stored in the database.
+type TimeFormat int
+
+const (
+	// TimeText stores times as text, see TimeLayout.
+	TimeText TimeFormat = iota
+	// TimeUnix stores times as an integer containing the Unix time in seconds.
+	// Note that fractions of a second are lost.
+	TimeUnix
+)
+
+// TimeLayout is the layout of times stored with TimeText.
+// Times are always converted to UTC before formatting.
+const TimeLayout = gopherbouncedb.SortableRFC3339Nano
+
+// ColumnType returns the column type used for times in the CREATE TABLE statements.
+// It's the value of the meta variable "$SQLITE_TIME_TYPE$".
+func (f TimeFormat) ColumnType() string {
+	if f == TimeUnix {
+		return "INTEGER"
+	}
+	return "TEXT"
+}
+
+// Codec returns the TimeCodec for the format.
+func (f TimeFormat) Codec() gopherbouncedb.TimeCodec {
+	if f == TimeUnix {
+		return gopherbouncedb.NewUnixSeconds()
+	}
+	return gopherbouncedb.TextTime{}
+}
+
+// String returns a description of the format.
+func (f TimeFormat) String() string {
+	switch f {
+	case TimeText:
+		return "text"
+	case TimeUnix:
+		return "unix"
+	default:
+		return fmt.Sprintf("TimeFormat(%d)", int(f))
+	}
+}
+
+// SQLiteBridge implements gopherbouncedb.SQLBridge for SQLite.
+type SQLiteBridge struct {
+	Format TimeFormat
+}
+
+// NewSQLiteBridge returns a new bridge storing times with the given format.
+func NewSQLiteBridge(format TimeFormat) SQLiteBridge {
+	return SQLiteBridge{Format: format}
+}
+
+// TimeScanType returns a *string for TimeText and an *int64 for TimeUnix.
+func (b SQLiteBridge) TimeScanType() interface{} {
+	return b.Format.Codec().TimeScanType()
+}
+
+// ConvertTimeScanType converts the value from TimeScanType to a time.Time in UTC.
+func (b SQLiteBridge) ConvertTimeScanType(val interface{}) (time.Time, error) {
+	return b.Format.Codec().ConvertTimeScanType(val)
+}
+
+// ConvertTime converts t to a string (TimeText) or an int64 (TimeUnix).
+func (b SQLiteBridge) ConvertTime(t time.Time) interface{} {
+	return b.Format.Codec().ConvertTime(t)
+}
+
+// IsDuplicateInsert returns true if err is a sqlite3.Error caused by a unique or
+// primary key constraint.
+func (b SQLiteBridge) IsDuplicateInsert(err error) bool {
+	var sqliteErr sqlite3.Error
+	if !errors.As(err, &sqliteErr) || sqliteErr.Code != sqlite3.ErrConstraint {
+		return false
+	}
+	switch sqliteErr.ExtendedCode {
+	case sqlite3.ErrConstraintUnique, sqlite3.ErrConstraintPrimaryKey:
+		return true
+	default:
+		return false
+	}
+}
+
+// IsDuplicateUpdate works as IsDuplicateInsert.
+func (b SQLiteBridge) IsDuplicateUpdate(err error) bool {
+	return b.IsDuplicateInsert(err)
+}
+
+// newReplacer returns the default replacer with "$SQLITE_TIME_TYPE$" set and the
+// values from replaceMapping (may be nil).
+func newReplacer(replaceMapping map[string]string, format TimeFormat) *gopherbouncedb.SQLTemplateReplacer {
+	replacer := gopherbouncedb.DefaultSQLReplacer()
+	replacer.Set("$SQLITE_TIME_TYPE$", format.ColumnType())
+	if replaceMapping != nil {
+		replacer.UpdateDict(replaceMapping)
+	}
+	return replacer
+}
@@ -0,0 +1,657 @@
+// Copyright 2019 Fabian Wenzelmann
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sqlite
+
+import (
+	"database/sql"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/FabianWe/gopherbouncedb"
+	"github.com/FabianWe/gopherbouncedb/testsuite"
+)
+
+// openDB opens a new database in a temporary file that is removed after the test.
+func openDB(t *testing.T) *sql.DB {
+	path := filepath.Join(t.TempDir(), "gopherbounce.sqlite3")
+	db, err := sql.Open("sqlite3", path+"?_busy_timeout=5000")
+	if err != nil {
+		t.Fatal("Can't open database:", err)
+	}
+	return db
+}
+
+type sqliteUserTestBinding struct {
+	t              *testing.T
+	format         TimeFormat
+	replaceMapping map[string]string
+}
+
+func (b sqliteUserTestBinding) BeginInstance() gopherbouncedb.UserStorage {
+	return NewSQLiteUserStorage(openDB(b.t), b.replaceMapping, b.format)
+}
+
+func (b sqliteUserTestBinding) CloseInstance(s gopherbouncedb.UserStorage) {
+	if err := s.(*SQLiteUserStorage).UserDB.Close(); err != nil {
+		b.t.Error("Can't close database:", err)
+	}
+}
+
+type sqliteSessionTestBinding struct {
+	t      *testing.T
+	format TimeFormat
+}
+
+func (b sqliteSessionTestBinding) BeginInstance() gopherbouncedb.SessionStorage {
+	return NewSQLiteSessionStorage(openDB(b.t), nil, b.format)
+}
+
+func (b sqliteSessionTestBinding) CloseInstance(s gopherbouncedb.SessionStorage) {
+	if err := s.(*SQLiteSessionStorage).SessionDB.Close(); err != nil {
+		b.t.Error("Can't close database:", err)
+	}
+}
+
+type sqliteHistoryTestBinding struct {
+	t      *testing.T
+	format TimeFormat
+}
+
+func (b sqliteHistoryTestBinding) BeginInstance(maxEntries int) gopherbouncedb.PasswordHistoryStorage {
+	res := NewSQLitePasswordHistoryStorage(openDB(b.t), nil, b.format)
+	res.MaxEntries = maxEntries
+	return res
+}
+
+func (b sqliteHistoryTestBinding) CloseInstance(s gopherbouncedb.PasswordHistoryStorage) {
+	if err := s.(*SQLitePasswordHistoryStorage).HistoryDB.Close(); err != nil {
+		b.t.Error("Can't close database:", err)
+	}
+}
+
+type sqliteAttributeTestBinding struct {
+	t      *testing.T
+	format TimeFormat
+}
+
+func (b sqliteAttributeTestBinding) BeginInstance() gopherbouncedb.UserAttributeStorage {
+	return NewSQLiteUserAttributeStorage(openDB(b.t), nil, b.format)
+}
+
+func (b sqliteAttributeTestBinding) CloseInstance(s gopherbouncedb.UserAttributeStorage) {
+	if err := s.(*SQLiteUserAttributeStorage).AttributeDB.Close(); err != nil {
+		b.t.Error("Can't close database:", err)
+	}
+}
+
+var timeFormats = []TimeFormat{TimeText, TimeUnix}
+
+func TestUsers(t *testing.T) {
+	for _, format := range timeFormats {
+		t.Run(format.String(), func(t *testing.T) {
+			b := sqliteUserTestBinding{t: t, format: format}
+			testsuite.TestInitSuite(b, t)
+			testsuite.TestInsertSuite(b, true, t)
+			testsuite.TestLookupSuite(b, true, t)
+			testsuite.TestUpdateUserSuite(b, true, t)
+			testsuite.TestDeleteUserSuite(b, true, t)
+			testsuite.TestPasswordExpirySuite(b, t)
+			testsuite.TestAuthenticatorSuite(b, t)
+			testsuite.TestDjangoAuthenticatorSuite(b, t)
+			testsuite.TestExportImportSuite(b, t)
+			testsuite.TestImportConflictSuite(b, t)
+			testsuite.TestBatchUserSuite(b, true, t)
+			testsuite.TestUserLifecycleSuite(b, t)
+			testsuite.TestStreamSuite(b, t)
+		})
+	}
+}
+
+func TestUsersMailNotUnique(t *testing.T) {
+	b := sqliteUserTestBinding{t: t, replaceMapping: map[string]string{"$EMAIL_UNIQUE$": ""}}
+	testsuite.TestInsertSuite(b, false, t)
+	testsuite.TestLookupSuite(b, false, t)
+	testsuite.TestUpdateUserSuite(b, false, t)
+	testsuite.TestDeleteUserSuite(b, false, t)
+	testsuite.TestBatchUserSuite(b, false, t)
+}
+
+func TestSessions(t *testing.T) {
+	for _, format := range timeFormats {
+		t.Run(format.String(), func(t *testing.T) {
+			b := sqliteSessionTestBinding{t: t, format: format}
+			testsuite.TestInitSessionSuite(b, t)
+			testsuite.TestSessionInsert(b, t)
+			testsuite.TestSessionGet(b, t)
+			testsuite.TestSessionDelete(b, t)
+			testsuite.TestSessionCleanUp(b, t)
+			testsuite.TestSessionDeleteForUser(b, t)
+			testsuite.TestBatchSessionSuite(b, t)
+			testsuite.TestSessionLifecycleSuite(b, t)
+			testsuite.TestStorageLifecycleSuite(sqliteUserTestBinding{t: t, format: format}, b, t)
+			testsuite.TestDjangoImportSuite(sqliteUserTestBinding{t: t, format: format}, b, t)
+		})
+	}
+}
+
+func TestPasswordHistory(t *testing.T) {
+	for _, format := range timeFormats {
+		t.Run(format.String(), func(t *testing.T) {
+			b := sqliteHistoryTestBinding{t: t, format: format}
+			testsuite.TestPasswordHistorySuite(b, t)
+			testsuite.TestPasswordHistoryUserStorageSuite(sqliteUserTestBinding{t: t, format: format}, b, t)
+		})
+	}
+}
+
+func TestUserAttributes(t *testing.T) {
+	for _, format := range timeFormats {
+		t.Run(format.String(), func(t *testing.T) {
+			testsuite.TestUserAttributeSuite(sqliteAttributeTestBinding{t: t, format: format}, t)
+		})
+	}
+}
+
+// generatedTestBinding uses the queries from GenerateUserSQL and GenerateSessionSQL.
+type generatedTestBinding struct {
+	t *testing.T
+}
+
+func (b generatedTestBinding) BeginInstance() gopherbouncedb.UserStorage {
+	queries, err := gopherbouncedb.GenerateUserSQL(gopherbouncedb.NewSQLiteDialect(),
+		gopherbouncedb.DefaultUserRowNames, gopherbouncedb.DefaultSQLReplacer())
+	if err != nil {
+		b.t.Fatal("Can't generate queries:", err)
+	}
+	return gopherbouncedb.NewSQLUserStorage(openDB(b.t), queries, NewSQLiteBridge(TimeText))
+}
+
+func (b generatedTestBinding) CloseInstance(s gopherbouncedb.UserStorage) {
+	s.(*gopherbouncedb.SQLUserStorage).UserDB.Close()
+}
+
+type generatedSessionTestBinding struct {
+	t *testing.T
+}
+
+func (b generatedSessionTestBinding) BeginInstance() gopherbouncedb.SessionStorage {
+	queries, err := gopherbouncedb.GenerateSessionSQL(gopherbouncedb.NewSQLiteDialect(),
+		gopherbouncedb.DefaultSessionRowNames, gopherbouncedb.DefaultSQLReplacer())
+	if err != nil {
+		b.t.Fatal("Can't generate queries:", err)
+	}
+	return gopherbouncedb.NewSQLSessionStorage(openDB(b.t), queries, NewSQLiteBridge(TimeText))
+}
+
+func (b generatedSessionTestBinding) CloseInstance(s gopherbouncedb.SessionStorage) {
+	s.(*gopherbouncedb.SQLSessionStorage).SessionDB.Close()
+}
+
+func TestGeneratedQueries(t *testing.T) {
+	b := generatedTestBinding{t: t}
+	testsuite.TestInitSuite(b, t)
+	testsuite.TestInsertSuite(b, true, t)
+	testsuite.TestLookupSuite(b, true, t)
+	testsuite.TestUpdateUserSuite(b, true, t)
+	testsuite.TestDeleteUserSuite(b, true, t)
+	testsuite.TestPasswordExpirySuite(b, t)
+	testsuite.TestBatchUserSuite(b, true, t)
+	sb := generatedSessionTestBinding{t: t}
+	testsuite.TestInitSessionSuite(sb, t)
+	testsuite.TestSessionInsert(sb, t)
+	testsuite.TestSessionGet(sb, t)
+	testsuite.TestSessionDelete(sb, t)
+	testsuite.TestSessionCleanUp(sb, t)
+	testsuite.TestSessionDeleteForUser(sb, t)
+}
+
+func TestGeneratedUpsert(t *testing.T) {
+	queries, err := gopherbouncedb.GenerateSessionSQL(gopherbouncedb.NewSQLiteDialect(),
+		gopherbouncedb.DefaultSessionRowNames, gopherbouncedb.DefaultSQLReplacer())
+	if err != nil {
+		t.Fatal("Can't generate queries:", err)
+	}
+	storage := gopherbouncedb.NewSQLSessionStorage(openDB(t), queries, NewSQLiteBridge(TimeText))
+	defer storage.Close()
+	if err := storage.InitSessions(); err != nil {
+		t.Fatal("Init failed:", err)
+	}
+	for _, user := range []gopherbouncedb.UserID{1, 2} {
+		if _, err := storage.SessionDB.Exec(queries.UpsertSession(), "key", user, "2019-10-01T00:00:00.000000000Z"); err != nil {
+			t.Fatal("Upsert failed:", err)
+		}
+	}
+	session, err := storage.GetSession("key")
+	if err != nil {
+		t.Fatal("GetSession failed:", err)
+	}
+	if session.User != 2 {
+		t.Errorf("Expected user 2 after upsert, got %d", session.User)
+	}
+}
+
+func TestTimeCodecs(t *testing.T) {
+	db := openDB(t)
+	defer db.Close()
+	codecs := []struct {
+		codec      gopherbouncedb.TimeCodec
+		columnType string
+		precision  time.Duration
+	}{
+		{TimeText.Codec(), "TEXT", time.Nanosecond},
+		{TimeUnix.Codec(), "INTEGER", time.Second},
+		{gopherbouncedb.NewUnixMillis(), "INTEGER", time.Millisecond},
+		// the driver supports time.Time for DATETIME columns
+		{gopherbouncedb.NativeTime{}, "DATETIME", time.Nanosecond},
+		{gopherbouncedb.NullTime{}, "DATETIME", time.Nanosecond},
+	}
+	times := []time.Time{
+		time.Date(2019, 10, 1, 10, 30, 15, 987654321, time.FixedZone("CEST", 2*60*60)),
+		time.Date(1969, 12, 31, 23, 59, 59, 999999999, time.UTC),
+	}
+	for i, c := range codecs {
+		table := fmt.Sprintf("codec_%d", i)
+		if _, err := db.Exec(fmt.Sprintf("CREATE TABLE %s (id INTEGER PRIMARY KEY, t %s);", table, c.columnType)); err != nil {
+			t.Fatal("Can't create table:", err)
+		}
+		for id, original := range times {
+			if _, err := db.Exec(fmt.Sprintf("INSERT INTO %s VALUES(?, ?);", table), id, c.codec.ConvertTime(original)); err != nil {
+				t.Fatal("Insert failed:", err)
+			}
+			dest := c.codec.TimeScanType()
+			if err := db.QueryRow(fmt.Sprintf("SELECT t FROM %s WHERE id=?;", table), id).Scan(dest); err != nil {
+				t.Fatalf("%T: scan failed: %v", c.codec, err)
+			}
+			got, err := c.codec.ConvertTimeScanType(dest)
+			expected := original.Truncate(c.precision).UTC()
+			if err != nil || !got.Equal(expected) || got.Location() != time.UTC {
+				t.Errorf("%T: expected %v, got %v (%v)", c.codec, expected, got, err)
+			}
+		}
+	}
+	if _, err := db.Exec("INSERT INTO codec_4 VALUES(?, ?);", 42, gopherbouncedb.NullTime{}.ConvertTime(time.Time{})); err != nil {
+		t.Fatal("Insert failed:", err)
+	}
+	var isNull bool
+	if err := db.QueryRow("SELECT t IS NULL FROM codec_4 WHERE id=42;").Scan(&isNull); err != nil || !isNull {
+		t.Errorf("Zero time not stored as NULL (%v)", err)
+	}
+}
+
+// notNullLastLogin matches the last login column definition in the init queries.
+var notNullLastLogin = regexp.MustCompile(`(last_login"? (TEXT|INTEGER)),`)
+
+// testNullLastLogin creates a users table with the zero time sentinel (as before
+// last login allowed NULL), migrates it and checks that NULL is used afterwards.
+func testNullLastLogin(storage *gopherbouncedb.SQLUserStorage, t *testing.T) {
+	for _, init := range storage.UserQueries.InitUsers() {
+		if _, err := storage.UserDB.Exec(notNullLastLogin.ReplaceAllString(init, "$1 NOT NULL,")); err != nil {
+			t.Fatal("Can't create old table:", err)
+		}
+	}
+	// with NullLastLogin disabled the sentinel is stored, so the old table still works
+	storage.NullLastLogin = false
+	if _, err := storage.InsertUser(&gopherbouncedb.UserModel{Username: "foo", EMail: "foo@example.com",
+		Password: "secret"}); err != nil {
+		t.Fatal("Insert with sentinel failed:", err)
+	}
+	isNull := func(id gopherbouncedb.UserID) bool {
+		var res bool
+		if err := storage.UserDB.QueryRow("SELECT last_login IS NULL FROM auth_user WHERE id=?;", id).Scan(&res); err != nil {
+			t.Fatal("Can't query last login:", err)
+		}
+		return res
+	}
+	migrated, err := storage.MigrateNullLastLogin()
+	if err != nil || migrated != 1 {
+		t.Fatalf("Expected 1 migrated user, got %d (%v)", migrated, err)
+	}
+	old, err := storage.GetUserByName("foo")
+	if err != nil {
+		t.Fatal("GetUser after migration failed:", err)
+	}
+	if !old.LastLogin.IsZero() || !isNull(old.ID) {
+		t.Error("Sentinel not replaced by NULL:", old.LastLogin)
+	}
+	storage.NullLastLogin = true
+	u := &gopherbouncedb.UserModel{Username: "bar", EMail: "bar@example.com", Password: "secret"}
+	if _, err := storage.InsertUser(u); err != nil {
+		t.Fatal("Insert after migration failed:", err)
+	}
+	if !isNull(u.ID) {
+		t.Error("Zero last login not inserted as NULL")
+	}
+	u.LastLogin = time.Now()
+	if err := storage.UpdateUser(u.ID, u, []string{"LastLogin"}); err != nil || isNull(u.ID) {
+		t.Error("Can't set last login:", err)
+	}
+	u.LastLogin = time.Time{}
+	if err := storage.UpdateUser(u.ID, u, nil); err != nil || !isNull(u.ID) {
+		t.Error("Zero last login not updated to NULL:", err)
+	}
+	// users with a NULL last login are listed
+	it, err := storage.ListUsers()
+	if err != nil {
+		t.Fatal("ListUsers failed:", err)
+	}
+	defer it.Close()
+	count := 0
+	for it.HasNext() {
+		listed, err := it.Next()
+		if err != nil {
+			t.Fatal("Next failed:", err)
+		}
+		if !listed.LastLogin.IsZero() {
+			t.Error("Expected zero last login, got", listed.LastLogin)
+		}
+		count++
+	}
+	if err := it.Err(); err != nil || count != 2 {
+		t.Errorf("Expected 2 users, got %d (%v)", count, err)
+	}
+	// the migration can be run again
+	if migrated, err := storage.MigrateNullLastLogin(); err != nil || migrated != 0 {
+		t.Errorf("Expected 0 migrated users, got %d (%v)", migrated, err)
+	}
+}
+
+func TestNullLastLogin(t *testing.T) {
+	for _, format := range []TimeFormat{TimeText, TimeUnix} {
+		t.Run(format.String(), func(t *testing.T) {
+			storage := NewSQLiteUserStorage(openDB(t), nil, format)
+			defer storage.Close()
+			testNullLastLogin(storage.SQLUserStorage, t)
+		})
+	}
+	t.Run("generated", func(t *testing.T) {
+		storage := generatedTestBinding{t: t}.BeginInstance().(*gopherbouncedb.SQLUserStorage)
+		defer storage.Close()
+		testNullLastLogin(storage, t)
+	})
+}
+
+// passwordColumns matches the password columns in the init queries.
+var passwordColumns = regexp.MustCompile(`,\s*password_changed_at [^\n]*\n\s*must_change_password [^\n]*`)
+
+// TestMigratePasswordColumns creates a users table without the password columns,
+// migrates it and checks the migrated users.
+func TestMigratePasswordColumns(t *testing.T) {
+	for _, format := range []TimeFormat{TimeText, TimeUnix} {
+		t.Run(format.String(), func(t *testing.T) {
+			storage := NewSQLiteUserStorage(openDB(t), nil, format)
+			defer storage.Close()
+			oldInit := passwordColumns.ReplaceAllString(storage.UserQueries.InitUsers()[0], "")
+			if _, err := storage.UserDB.Exec(oldInit); err != nil {
+				t.Fatal("Can't create old table:", err)
+			}
+			joined := time.Date(2019, 5, 6, 7, 8, 9, 0, time.UTC)
+			_, err := storage.UserDB.Exec(`INSERT INTO auth_user(username, password, email, first_name, last_name,
+is_superuser, is_staff, is_active, date_joined, last_login) VALUES('foo', 'secret', 'foo@example.com', '', '', 0, 0, 1, ?, NULL);`,
+				storage.UserBridge.ConvertTime(joined))
+			if err != nil {
+				t.Fatal("Can't insert into old table:", err)
+			}
+			if err := storage.MigratePasswordColumns(); err != nil {
+				t.Fatal("Migration failed:", err)
+			}
+			old, err := storage.GetUserByName("foo")
+			if err != nil {
+				t.Fatal("GetUser after migration failed:", err)
+			}
+			if !old.PasswordChangedAt.Equal(joined) || old.MustChangePassword {
+				t.Errorf("Expected password changed at %v, got %v (must change %v)",
+					joined, old.PasswordChangedAt, old.MustChangePassword)
+			}
+			if err := storage.InitUsers(); err != nil {
+				t.Fatal("Init after migration failed:", err)
+			}
+			u := &gopherbouncedb.UserModel{Username: "bar", EMail: "bar@example.com", Password: "secret"}
+			if _, err := storage.InsertUser(u); err != nil {
+				t.Fatal("Insert after migration failed:", err)
+			}
+			policy := &gopherbouncedb.PasswordExpiryPolicy{UserMaxAge: time.Hour}
+			it, err := storage.ListPasswordExpired(policy, time.Now())
+			if err != nil {
+				t.Fatal("ListPasswordExpired failed:", err)
+			}
+			defer it.Close()
+			var expired []string
+			for it.HasNext() {
+				listed, err := it.Next()
+				if err != nil {
+					t.Fatal("Next failed:", err)
+				}
+				expired = append(expired, listed.Username)
+			}
+			if len(expired) != 1 || expired[0] != "foo" {
+				t.Errorf("Expected expired users [foo], got %v", expired)
+			}
+		})
+	}
+}
+
+// mappedTestBinding uses an existing table with renamed columns and extra columns.
+type mappedTestBinding struct {
+	t *testing.T
+}
+
+var testMapping = &gopherbouncedb.SQLTableMapping{
+	Schema:   "main",
+	Table:    "accounts",
+	RowNames: map[string]string{"Username": "login", "EMail": "mail"},
+}
+
+func (b mappedTestBinding) BeginInstance() gopherbouncedb.UserStorage {
+	storage, err := NewSQLiteMappedUserStorage(openDB(b.t), testMapping, testsuite.ExtraTestColumns, nil, TimeUnix)
+	if err != nil {
+		b.t.Fatal("Can't create storage:", err)
+	}
+	return storage
+}
+
+func (b mappedTestBinding) CloseInstance(s gopherbouncedb.UserStorage) {
+	s.(*SQLiteUserStorage).UserDB.Close()
+}
+
+func TestMappedStorage(t *testing.T) {
+	b := mappedTestBinding{t: t}
+	testsuite.TestInsertSuite(b, true, t)
+	testsuite.TestLookupSuite(b, true, t)
+	testsuite.TestUpdateUserSuite(b, true, t)
+	testsuite.TestBatchUserSuite(b, true, t)
+	testsuite.TestExtraColumnsSuite(b, t)
+	testsuite.TestTypedUserSuite(b, t)
+
+	storage := b.BeginInstance().(*SQLiteUserStorage)
+	defer b.CloseInstance(storage)
+	if err := storage.InitUsers(); err != nil {
+		t.Fatal("Init failed:", err)
+	}
+	u := &gopherbouncedb.UserModel{Username: "foo", EMail: "foo@example.com"}
+	u.Extensions = gopherbouncedb.UserExtensions{"LoginCount": "42"}
+	if _, err := storage.InsertUser(u); err == nil {
+		t.Error("Expected error for extension with wrong type")
+	}
+	u.Extensions = gopherbouncedb.UserExtensions{"LoginCount": 42}
+	if _, err := storage.InsertUser(u); err != nil {
+		t.Fatal("Insert failed:", err)
+	}
+	var login string
+	var count int64
+	if err := storage.UserDB.QueryRow("SELECT login, login_count FROM main.accounts WHERE mail=?;", u.EMail).Scan(&login, &count); err != nil ||
+		login != u.Username || count != 42 {
+		t.Errorf("Unexpected row: %s, %d (%v)", login, count, err)
+	}
+	if err := storage.UpdateUser(u.ID, u, []string{"ID"}); err == nil {
+		t.Error("Expected error for update of the id")
+	}
+
+	sessions, err := NewSQLiteMappedSessionStorage(storage.UserDB, &gopherbouncedb.SQLTableMapping{
+		Table:    "logins",
+		RowNames: map[string]string{"Key": "token"},
+	}, nil, TimeUnix)
+	if err != nil {
+		t.Fatal("Can't create session storage:", err)
+	}
+	if err := sessions.InitSessions(); err != nil {
+		t.Fatal("Init failed:", err)
+	}
+	session := &gopherbouncedb.SessionEntry{Key: "key", User: u.ID, ExpireDate: time.Now().Add(time.Hour)}
+	if err := sessions.InsertSession(session); err != nil {
+		t.Fatal("Insert session failed:", err)
+	}
+	if _, err := sessions.GetSession("key"); err != nil {
+		t.Error("GetSession failed:", err)
+	}
+}
+
+func TestTypedStorage(t *testing.T) {
+	db := openDB(t)
+	defer db.Close()
+	storage, err := NewSQLiteTypedUserStorage[testsuite.TypedTestUser](db, nil, nil, TimeText)
+	if err != nil {
+		t.Fatal("Can't create storage:", err)
+	}
+	if err := storage.InitUsers(); err != nil {
+		t.Fatal("Init failed:", err)
+	}
+	u := &testsuite.TypedTestUser{Phone: "+49 123", LoginCount: 21}
+	u.Username, u.EMail = "typed", "typed@example.com"
+	if _, err := storage.InsertUser(u); err != nil {
+		t.Fatal("Insert failed:", err)
+	}
+	var phone string
+	var count int64
+	if err := db.QueryRow("SELECT Phone, login_count FROM auth_user WHERE id=?;", u.ID).Scan(&phone, &count); err != nil ||
+		phone != u.Phone || count != 21 {
+		t.Errorf("Unexpected row: %s, %d (%v)", phone, count, err)
+	}
+	got, err := storage.GetUser(u.ID)
+	if err != nil {
+		t.Fatal("GetUser failed:", err)
+	}
+	if got.Phone != u.Phone || got.LoginCount != u.LoginCount || got.Verified != nil {
+		t.Errorf("Expected user %+v, got %+v", u, got)
+	}
+}
+
+// TestBatchErrors tests that only errors of single users lead to a BatchErr, other
+// errors are returned directly.
+func TestBatchErrors(t *testing.T) {
+	storage := NewSQLiteUserStorage(openDB(t), nil, TimeText)
+	defer storage.Close()
+	if err := storage.InitUsers(); err != nil {
+		t.Fatal("Init failed:", err)
+	}
+	if _, err := storage.UserDB.Exec("DROP TABLE auth_user;"); err != nil {
+		t.Fatal("Can't drop table:", err)
+	}
+	users := []*gopherbouncedb.UserModel{
+		{Username: "foo", EMail: "foo@example.com", Password: "secret"},
+		{Username: "bar", EMail: "bar@example.com", Password: "secret"},
+	}
+	err := storage.InsertUsers(users)
+	if _, isBatchErr := err.(gopherbouncedb.BatchErr); err == nil || isBatchErr {
+		t.Error("Expected error from the transaction, got", err)
+	}
+	err = storage.UpdateUsers(users, []string{"Username"})
+	if _, isBatchErr := err.(gopherbouncedb.BatchErr); err == nil || isBatchErr {
+		t.Error("Expected error from the transaction, got", err)
+	}
+}
+
+// djangoSchema is the schema Django creates for users and sessions in SQLite.
+const djangoSchema = `CREATE TABLE "auth_user" ("id" integer NOT NULL PRIMARY KEY AUTOINCREMENT,
+"password" varchar(128) NOT NULL, "last_login" datetime NULL, "is_superuser" bool NOT NULL,
+"username" varchar(150) NOT NULL UNIQUE, "last_name" varchar(150) NOT NULL,
+"email" varchar(254) NOT NULL, "is_staff" bool NOT NULL, "is_active" bool NOT NULL,
+"date_joined" datetime NOT NULL, "first_name" varchar(150) NOT NULL);
+CREATE TABLE "django_session" ("session_key" varchar(40) NOT NULL PRIMARY KEY,
+"session_data" text NOT NULL, "expire_date" datetime NOT NULL);`
+
+// TestDjangoImport imports from a database with the tables and date format of a
+// Django SQLite database.
+func TestDjangoImport(t *testing.T) {
+	django := openDB(t)
+	defer django.Close()
+	if _, err := django.Exec(djangoSchema); err != nil {
+		t.Fatal("Can't create Django tables:", err)
+	}
+	statements := []string{
+		`INSERT INTO auth_user VALUES (2, 'pbkdf2_sha256$1$salt$hash', '2020-01-02 03:04:05.123456',
+0, 'alice', 'Doe', 'alice@example.com', 0, 1, '2019-05-06 07:08:09.5', 'Alice');`,
+		`INSERT INTO auth_user VALUES (3, 'pbkdf2_sha256$1$salt$hash', NULL,
+1, 'bob', 'Doe', 'bob@example.com', 1, 1, '2019-05-06 07:08:09', 'Bob');`,
+		// belongs to alice
+		`INSERT INTO django_session VALUES ('valid', 'MDEyMzQ1Njc4OWFiY2RlZjp7Il9hdXRoX3VzZXJfaWQiOiAyfQ==',
+'2100-01-01 00:00:00.000001');`,
+		`INSERT INTO django_session VALUES ('expired', 'MDEyMzQ1Njc4OWFiY2RlZjp7Il9hdXRoX3VzZXJfaWQiOiAyfQ==',
+'2000-01-01 00:00:00');`,
+		`INSERT INTO django_session VALUES ('broken', '!!!', '2100-01-01 00:00:00');`,
+	}
+	for _, stmt := range statements {
+		if _, err := django.Exec(stmt); err != nil {
+			t.Fatal("Can't insert Django data:", err)
+		}
+	}
+
+	db := openDB(t)
+	users := NewSQLiteUserStorage(db, nil, TimeText)
+	defer users.Close()
+	sessions := NewSQLiteSessionStorage(db, nil, TimeText)
+	defer sessions.Close()
+	if err := users.InitUsers(); err != nil {
+		t.Fatal("Init failed:", err)
+	}
+	if err := sessions.InitSessions(); err != nil {
+		t.Fatal("Init failed:", err)
+	}
+	res, err := gopherbouncedb.NewDjangoImporter(django, users, sessions).Import(time.Now().UTC())
+	if err != nil {
+		t.Fatal("Import failed:", err)
+	}
+	if len(res.IDs) != 2 || len(res.Conflicts) != 0 || res.Sessions != 1 ||
+		res.SkippedSessions != 2 || len(res.SessionErrors) != 1 {
+		t.Fatalf("Unexpected result: %d users, %d conflicts, %d sessions, %d skipped, %d errors",
+			len(res.IDs), len(res.Conflicts), res.Sessions, res.SkippedSessions, len(res.SessionErrors))
+	}
+	alice, aliceErr := users.GetUser(res.IDs[2])
+	if aliceErr != nil {
+		t.Fatal("Can't get imported user:", aliceErr)
+	}
+	if expected := time.Date(2020, 1, 2, 3, 4, 5, 123456000, time.UTC); !alice.LastLogin.Equal(expected) {
+		t.Errorf("Expected last login %v, got %v", expected, alice.LastLogin)
+	}
+	if expected := time.Date(2019, 5, 6, 7, 8, 9, 500000000, time.UTC); !alice.DateJoined.Equal(expected) {
+		t.Errorf("Expected date joined %v, got %v", expected, alice.DateJoined)
+	}
+	bob, bobErr := users.GetUser(res.IDs[3])
+	if bobErr != nil {
+		t.Fatal("Can't get imported user:", bobErr)
+	}
+	if !bob.IsSuperUser || !bob.LastLogin.IsZero() {
+		t.Errorf("Unexpected imported user: superuser %v, last login %v", bob.IsSuperUser, bob.LastLogin)
+	}
+	session, sessionErr := sessions.GetSession("valid")
+	if sessionErr != nil {
+		t.Fatal("Can't get imported session:", sessionErr)
+	}
+	if session.User != res.IDs[2] {
+		t.Errorf("Expected session of user %d, got %d", res.IDs[2], session.User)
+	}
+}
@@ -0,0 +1,224 @@
+// Copyright 2019 Fabian Wenzelmann
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sqlite
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/FabianWe/gopherbouncedb"
+)
+
+const (
+	// SQLiteUsersInit is the statement to create the users table.
+	SQLiteUsersInit = `CREATE TABLE IF NOT EXISTS $USERS_TABLE_NAME$ (
+	id INTEGER PRIMARY KEY AUTOINCREMENT NOT NULL,
+	username VARCHAR($USERNAME_MAX_LEN$) NOT NULL UNIQUE,
+	password VARCHAR($PASSWORD_MAX_LEN$) NOT NULL,
+	email VARCHAR($EMAIL_MAX_LEN$) NOT NULL $EMAIL_UNIQUE$,
+	first_name VARCHAR($FIRST_NAME_MAX_LEN$) NOT NULL,
+	last_name VARCHAR($LAST_NAME_MAX_LEN$) NOT NULL,
+	is_superuser BOOLEAN NOT NULL,
+	is_staff BOOLEAN NOT NULL,
+	is_active BOOLEAN NOT NULL,
+	date_joined $SQLITE_TIME_TYPE$ NOT NULL,
+	last_login $SQLITE_TIME_TYPE$,
+	password_changed_at $SQLITE_TIME_TYPE$ NOT NULL,
+	must_change_password BOOLEAN NOT NULL
+);`
+	// SQLiteUsersEmailIndex creates an index on the email, it's only used if the
+	// email is not unique (unique columns have an index anyway).
+	SQLiteUsersEmailIndex = `CREATE INDEX IF NOT EXISTS $USERS_TABLE_NAME$_email_idx ON $USERS_TABLE_NAME$(email);`
+	// SQLiteUsersPasswordChangedIndex creates an index used by ListPasswordExpired.
+	SQLiteUsersPasswordChangedIndex = `CREATE INDEX IF NOT EXISTS $USERS_TABLE_NAME$_password_changed_at_idx ON $USERS_TABLE_NAME$(password_changed_at);`
+
+	sqliteUserFields = `id, username, password, email, first_name, last_name, is_superuser, is_staff, is_active, date_joined, last_login, password_changed_at, must_change_password`
+
+	SQLiteQueryUserID         = `SELECT ` + sqliteUserFields + ` FROM $USERS_TABLE_NAME$ WHERE id=?;`
+	SQLiteQueryUserName       = `SELECT ` + sqliteUserFields + ` FROM $USERS_TABLE_NAME$ WHERE username=?;`
+	SQLiteQueryUserEmail      = `SELECT ` + sqliteUserFields + ` FROM $USERS_TABLE_NAME$ WHERE email=?;`
+	SQLiteInsertUser          = `INSERT INTO $USERS_TABLE_NAME$(username, password, email, first_name, last_name, is_superuser, is_staff, is_active, date_joined, last_login, password_changed_at, must_change_password) VALUES(?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?);`
+	SQLiteUpdateUser          = `UPDATE $USERS_TABLE_NAME$ SET $UPDATE_CONTENT$ WHERE id=?;`
+	SQLiteDeleteUser          = `DELETE FROM $USERS_TABLE_NAME$ WHERE id=?;`
+	SQLiteListUsers           = `SELECT ` + sqliteUserFields + ` FROM $USERS_TABLE_NAME$;`
+	SQLiteListPasswordExpired = `SELECT ` + sqliteUserFields + ` FROM $USERS_TABLE_NAME$ WHERE
+	must_change_password OR
+	(is_superuser AND password_changed_at < ?) OR
+	(NOT is_superuser AND is_staff AND password_changed_at < ?) OR
+	(NOT is_superuser AND NOT is_staff AND password_changed_at < ?);`
+	SQLiteClearLastLoginSentinel = `UPDATE $USERS_TABLE_NAME$ SET last_login=NULL WHERE last_login=?;`
+	// SQLite can't add a NOT NULL column without a default, the default is replaced
+	// by SQLiteBackfillPasswordChangedAt.
+	SQLiteAddPasswordChangedAt      = `ALTER TABLE $USERS_TABLE_NAME$ ADD COLUMN password_changed_at $SQLITE_TIME_TYPE$ NOT NULL DEFAULT 0;`
+	SQLiteAddMustChangePassword     = `ALTER TABLE $USERS_TABLE_NAME$ ADD COLUMN must_change_password BOOLEAN NOT NULL DEFAULT 0;`
+	SQLiteBackfillPasswordChangedAt = `UPDATE $USERS_TABLE_NAME$ SET password_changed_at=date_joined;`
+
+	// sqliteMigrationTable is the name of the temporary table used in
+	// AllowNullLastLogin.
+	sqliteMigrationTable = `$USERS_TABLE_NAME$_null_migration`
+	// SQLite can't drop a NOT NULL constraint, instead the table is copied to a new
+	// table that is renamed afterwards.
+	sqliteCopyUsers = `INSERT INTO ` + sqliteMigrationTable + `(` + sqliteUserFields + `) SELECT ` +
+		sqliteUserFields + ` FROM $USERS_TABLE_NAME$;`
+	sqliteDropUsers   = `DROP TABLE $USERS_TABLE_NAME$;`
+	sqliteRenameUsers = `ALTER TABLE ` + sqliteMigrationTable + ` RENAME TO $USERS_TABLE_NAME$;`
+)
+
+// SQLiteUserQueries implements gopherbouncedb.UserSQL,
+// gopherbouncedb.PasswordExpirySQL, gopherbouncedb.NullLastLoginSQL and
+// gopherbouncedb.PasswordColumnsSQL for SQLite.
+// The last login column allows NULL, see gopherbouncedb.NullLastLoginSQL.
+//
+// The queries are created once with the meta variables replaced.
+// Besides the variables documented in UserSQL the variable "$SQLITE_TIME_TYPE$"
+// is used for the column type of times, see TimeFormat.
+type SQLiteUserQueries struct {
+	InitS []string
+	GetUserS, GetUserByNameS, GetUserByEmailS, InsertUserS,
+	UpdateUserS, DeleteUserS, ListUsersS, ListPasswordExpiredS string
+	AllowNullLastLoginS     []string
+	ClearLastLoginSentinelS string
+	AddPasswordColumnsS     []string
+	Replacer                *gopherbouncedb.SQLTemplateReplacer
+	// RowNames maps the lower case field names of UserModel to the column names.
+	RowNames map[string]string
+}
+
+// NewSQLiteUserQueries returns new queries, replaceMapping (may be nil) contains
+// additional meta variables that overwrite the default values.
+func NewSQLiteUserQueries(replaceMapping map[string]string, format TimeFormat) *SQLiteUserQueries {
+	replacer := newReplacer(replaceMapping, format)
+	res := &SQLiteUserQueries{Replacer: replacer}
+	res.InitS = []string{
+		replacer.Apply(SQLiteUsersInit),
+		replacer.Apply(SQLiteUsersPasswordChangedIndex),
+	}
+	if strings.TrimSpace(replacer.Apply("$EMAIL_UNIQUE$")) == "" {
+		res.InitS = append(res.InitS, replacer.Apply(SQLiteUsersEmailIndex))
+	}
+	res.GetUserS = replacer.Apply(SQLiteQueryUserID)
+	res.GetUserByNameS = replacer.Apply(SQLiteQueryUserName)
+	res.GetUserByEmailS = replacer.Apply(SQLiteQueryUserEmail)
+	res.InsertUserS = replacer.Apply(SQLiteInsertUser)
+	res.UpdateUserS = replacer.Apply(SQLiteUpdateUser)
+	res.DeleteUserS = replacer.Apply(SQLiteDeleteUser)
+	res.ListUsersS = replacer.Apply(SQLiteListUsers)
+	res.ListPasswordExpiredS = replacer.Apply(SQLiteListPasswordExpired)
+	res.AllowNullLastLoginS = append([]string{
+		replacer.Apply(strings.Replace(SQLiteUsersInit, "$USERS_TABLE_NAME$", sqliteMigrationTable, 1)),
+		replacer.Apply(sqliteCopyUsers),
+		replacer.Apply(sqliteDropUsers),
+		replacer.Apply(sqliteRenameUsers),
+	}, res.InitS[1:]...)
+	res.ClearLastLoginSentinelS = replacer.Apply(SQLiteClearLastLoginSentinel)
+	res.AddPasswordColumnsS = []string{
+		replacer.Apply(SQLiteAddPasswordChangedAt),
+		replacer.Apply(SQLiteAddMustChangePassword),
+		replacer.Apply(SQLiteBackfillPasswordChangedAt),
+		replacer.Apply(SQLiteUsersPasswordChangedIndex),
+	}
+	res.RowNames = make(map[string]string, len(gopherbouncedb.DefaultUserRowNames))
+	for field, row := range gopherbouncedb.DefaultUserRowNames {
+		res.RowNames[strings.ToLower(field)] = row
+	}
+	return res
+}
+
+func (q *SQLiteUserQueries) InitUsers() []string {
+	return q.InitS
+}
+
+func (q *SQLiteUserQueries) GetUser() string {
+	return q.GetUserS
+}
+
+func (q *SQLiteUserQueries) GetUserByName() string {
+	return q.GetUserByNameS
+}
+
+func (q *SQLiteUserQueries) GetUserByEmail() string {
+	return q.GetUserByEmailS
+}
+
+func (q *SQLiteUserQueries) InsertUser() string {
+	return q.InsertUserS
+}
+
+// UpdateUser returns the update query for the given fields, if fields is empty all
+// fields (except the id) are updated.
+func (q *SQLiteUserQueries) UpdateUser(fields []string) string {
+	if len(fields) == 0 {
+		fields = gopherbouncedb.UserUpdateFields()
+	}
+	updates := make([]string, len(fields))
+	for i, field := range fields {
+		row, has := q.RowNames[strings.ToLower(field)]
+		if !has {
+			// prepareUpdateArgs fails for invalid fields anyway, so this query is never
+			// executed
+			row = fmt.Sprintf("invalid_field_%s", field)
+		}
+		updates[i] = row + "=?"
+	}
+	return strings.Replace(q.UpdateUserS, "$UPDATE_CONTENT$", strings.Join(updates, ", "), 1)
+}
+
+func (q *SQLiteUserQueries) SupportsUserFields() bool {
+	return true
+}
+
+func (q *SQLiteUserQueries) DeleteUser() string {
+	return q.DeleteUserS
+}
+
+func (q *SQLiteUserQueries) ListUsers() string {
+	return q.ListUsersS
+}
+
+func (q *SQLiteUserQueries) ListPasswordExpired() string {
+	return q.ListPasswordExpiredS
+}
+
+// AllowNullLastLogin returns the statements to rebuild a users table created with
+// a NOT NULL last login, the indexes are created again.
+func (q *SQLiteUserQueries) AllowNullLastLogin() []string {
+	return q.AllowNullLastLoginS
+}
+
+func (q *SQLiteUserQueries) ClearLastLoginSentinel() string {
+	return q.ClearLastLoginSentinelS
+}
+
+func (q *SQLiteUserQueries) AddPasswordColumns() []string {
+	return q.AddPasswordColumnsS
+}
+
+// SQLiteUserStorage is a user storage for SQLite.
+type SQLiteUserStorage struct {
+	*gopherbouncedb.SQLUserStorage
+}
+
+// NewSQLiteUserStorage returns a new storage, replaceMapping (may be nil) is used
+// as in NewSQLiteUserQueries.
+// NullLastLogin is enabled because the init queries create a last login column that
+// allows NULL.
+func NewSQLiteUserStorage(db *sql.DB, replaceMapping map[string]string, format TimeFormat) *SQLiteUserStorage {
+	queries := NewSQLiteUserQueries(replaceMapping, format)
+	bridge := NewSQLiteBridge(format)
+	storage := gopherbouncedb.NewSQLUserStorage(db, queries, bridge)
+	storage.NullLastLogin = true
+	return &SQLiteUserStorage{storage}
+}
@@ -0,0 +1,201 @@
+// Copyright 2019 Fabian Wenzelmann
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gopherbouncedb
+
+import (
+	"container/list"
+	"database/sql"
+	"sync"
+)
+
+// DefaultStmtCacheSize is the default number of statements kept in a StmtCache.
+// It's large enough for all static queries and a number of dynamic update queries.
+const DefaultStmtCacheSize = 64
+
+// sqlQuerier is implemented by *sql.DB and *StmtCache.
+type sqlQuerier interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+// StmtCache is a cache of prepared statements keyed by the query string.
+//
+// Statements are prepared lazily the first time a query is used.
+// The cache contains at most MaxSize statements, if it is full the least recently
+// used statement is removed.
+// This way also dynamic queries (for example the UpdateUser queries that depend on
+// the updated fields) can be cached.
+//
+// The statements are reference counted: a removed statement is closed once no
+// goroutine executes it any more. Rows returned by Query and QueryRow stay valid
+// after the statement is closed (database/sql closes the statement after the rows).
+// Connections that went bad are handled by database/sql which prepares the
+// statement again on another connection.
+//
+// A StmtCache is safe for concurrent use.
+type StmtCache struct {
+	DB      *sql.DB
+	MaxSize int
+
+	mutex sync.Mutex
+	stmts map[string]*list.Element
+	lru   *list.List
+}
+
+type stmtCacheEntry struct {
+	query string
+	stmt  *sql.Stmt
+	// refs is the number of running executions, removed is true if the entry is no
+	// longer in the cache and must be closed by the last execution
+	refs    int
+	removed bool
+}
+
+// NewStmtCache returns a new StmtCache, if maxSize ≤ 0 DefaultStmtCacheSize is used.
+func NewStmtCache(db *sql.DB, maxSize int) *StmtCache {
+	if maxSize <= 0 {
+		maxSize = DefaultStmtCacheSize
+	}
+	return &StmtCache{
+		DB:      db,
+		MaxSize: maxSize,
+		stmts:   make(map[string]*list.Element),
+		lru:     list.New(),
+	}
+}
+
+// Len returns the number of cached statements.
+func (c *StmtCache) Len() int {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.lru.Len()
+}
+
+// acquire returns the cache entry for the query, the statement is prepared if it
+// is not in the cache.
+// The statement is not closed before release is called.
+// The statement is prepared without holding the mutex, so other queries are not
+// blocked by the database. If another goroutine prepared the same query in the
+// meantime its statement is used and the new one is closed.
+func (c *StmtCache) acquire(query string) (*stmtCacheEntry, error) {
+	c.mutex.Lock()
+	entry := c.cached(query)
+	c.mutex.Unlock()
+	if entry != nil {
+		return entry, nil
+	}
+	stmt, err := c.DB.Prepare(query)
+	if err != nil {
+		return nil, err
+	}
+	c.mutex.Lock()
+	if entry := c.cached(query); entry != nil {
+		c.mutex.Unlock()
+		_ = stmt.Close()
+		return entry, nil
+	}
+	defer c.mutex.Unlock()
+	entry = &stmtCacheEntry{query: query, stmt: stmt, refs: 1}
+	c.stmts[query] = c.lru.PushFront(entry)
+	for c.lru.Len() > c.MaxSize {
+		_ = c.removeElement(c.lru.Back())
+	}
+	return entry, nil
+}
+
+// cached returns the cache entry for the query with refs incremented, nil if the
+// query is not in the cache. The mutex must be held.
+func (c *StmtCache) cached(query string) *stmtCacheEntry {
+	elem, has := c.stmts[query]
+	if !has {
+		return nil
+	}
+	c.lru.MoveToFront(elem)
+	entry := elem.Value.(*stmtCacheEntry)
+	entry.refs++
+	return entry
+}
+
+// release ends an execution of a statement returned by acquire.
+func (c *StmtCache) release(entry *stmtCacheEntry) {
+	c.mutex.Lock()
+	entry.refs--
+	closeStmt := entry.removed && entry.refs == 0
+	c.mutex.Unlock()
+	if closeStmt {
+		_ = entry.stmt.Close()
+	}
+}
+
+// removeElement removes the statement and closes it if it is not in use, the mutex
+// must be held.
+func (c *StmtCache) removeElement(elem *list.Element) error {
+	entry := elem.Value.(*stmtCacheEntry)
+	c.lru.Remove(elem)
+	delete(c.stmts, entry.query)
+	entry.removed = true
+	if entry.refs > 0 {
+		return nil
+	}
+	return entry.stmt.Close()
+}
+
+// Close removes all statements from the cache and closes them, statements still in
+// use are closed once their execution is done.
+// The cache can still be used afterwards, the database is not closed.
+func (c *StmtCache) Close() error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	var res error
+	for c.lru.Len() > 0 {
+		if err := c.removeElement(c.lru.Front()); err != nil && res == nil {
+			res = err
+		}
+	}
+	return res
+}
+
+// Exec executes the prepared statement for query.
+func (c *StmtCache) Exec(query string, args ...interface{}) (sql.Result, error) {
+	entry, err := c.acquire(query)
+	if err != nil {
+		return nil, err
+	}
+	defer c.release(entry)
+	return entry.stmt.Exec(args...)
+}
+
+// Query executes the prepared statement for query.
+func (c *StmtCache) Query(query string, args ...interface{}) (*sql.Rows, error) {
+	entry, err := c.acquire(query)
+	if err != nil {
+		return nil, err
+	}
+	defer c.release(entry)
+	return entry.stmt.Query(args...)
+}
+
+// QueryRow executes the prepared statement for query.
+// If the statement can't be prepared the query is executed without a prepared
+// statement (and the error is returned by Scan).
+func (c *StmtCache) QueryRow(query string, args ...interface{}) *sql.Row {
+	entry, err := c.acquire(query)
+	if err != nil {
+		return c.DB.QueryRow(query, args...)
+	}
+	defer c.release(entry)
+	return entry.stmt.QueryRow(args...)
+}
@@ -0,0 +1,127 @@
+// Copyright 2019 Fabian Wenzelmann
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gopherbouncedb
+
+import "context"
+
+// UserResult is an element sent by StreamUsers, either User or Err is set.
+type UserResult struct {
+	User *UserModel
+	Err  error
+}
+
+// StreamUsers sends all users from it on the returned channel, buffer is the buffer
+// size of the channel.
+//
+// The users are read in a new goroutine, the channel is closed after the last user
+// and it is closed.
+// If an error occurs it is sent as the last element.
+// If ctx is canceled the goroutine stops and closes the channel, the receiver
+// should check ctx.Err() in this case.
+// The receiver must either read all elements or cancel ctx, otherwise the goroutine
+// leaks.
+func StreamUsers(ctx context.Context, it UserIterator, buffer int) <-chan UserResult {
+	ch := make(chan UserResult, buffer)
+	go func() {
+		defer close(ch)
+		defer it.Close()
+		send := func(res UserResult) bool {
+			select {
+			case ch <- res:
+				return true
+			case <-ctx.Done():
+				return false
+			}
+		}
+		for it.HasNext() {
+			if ctx.Err() != nil {
+				return
+			}
+			u, err := it.Next()
+			if err != nil {
+				send(UserResult{Err: err})
+				return
+			}
+			if !send(UserResult{User: u}) {
+				return
+			}
+		}
+		if err := it.Err(); err != nil {
+			send(UserResult{Err: err})
+		}
+	}()
+	return ch
+}
+
+// StreamAllUsers streams all users from the storage, see StreamUsers.
+func StreamAllUsers(ctx context.Context, storage UserStorage, buffer int) <-chan UserResult {
+	it, err := storage.ListUsers()
+	if err != nil {
+		ch := make(chan UserResult, 1)
+		ch <- UserResult{Err: err}
+		close(ch)
+		return ch
+	}
+	return StreamUsers(ctx, it, buffer)
+}
+
+// chanUserIterator is a UserIterator reading from a channel.
+type chanUserIterator struct {
+	ch     <-chan UserResult
+	cancel context.CancelFunc
+	user   *UserModel
+	err    error
+}
+
+// ChanUserIterator returns a UserIterator that reads the users from ch (as returned
+// by StreamUsers).
+// cancel should cancel the context of the sender, it is called on Close (it may be
+// nil). Close also drains the channel so that the sender is not blocked.
+func ChanUserIterator(ch <-chan UserResult, cancel context.CancelFunc) UserIterator {
+	return &chanUserIterator{ch: ch, cancel: cancel}
+}
+
+func (it *chanUserIterator) HasNext() bool {
+	if it.err != nil {
+		return false
+	}
+	res, ok := <-it.ch
+	if !ok {
+		return false
+	}
+	if res.Err != nil {
+		it.err = res.Err
+		return false
+	}
+	it.user = res.User
+	return true
+}
+
+func (it *chanUserIterator) Next() (*UserModel, error) {
+	return it.user, nil
+}
+
+func (it *chanUserIterator) Err() error {
+	return it.err
+}
+
+func (it *chanUserIterator) Close() error {
+	if it.cancel != nil {
+		it.cancel()
+	}
+	for range it.ch {
+	}
+	return nil
+}
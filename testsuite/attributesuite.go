@@ -0,0 +1,192 @@
+// Copyright 2019 Fabian Wenzelmann
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package testsuite
+
+import (
+	"encoding/json"
+	"math/rand"
+	"reflect"
+	"testing"
+
+	"github.com/FabianWe/gopherbouncedb"
+)
+
+// UserAttributeTestSuiteBinding is used to create new user attribute storages.
+type UserAttributeTestSuiteBinding interface {
+	BeginInstance() gopherbouncedb.UserAttributeStorage
+	CloseInstance(s gopherbouncedb.UserAttributeStorage)
+}
+
+// compareAttributes returns true if both attribute maps contain the same values.
+func compareAttributes(expected, got gopherbouncedb.UserAttributes) bool {
+	if len(expected) != len(got) {
+		return false
+	}
+	for name, val := range expected {
+		if other, has := got[name]; !has || !val.Equal(other) {
+			return false
+		}
+	}
+	return true
+}
+
+func TestUserAttributeSuite(suite UserAttributeTestSuiteBinding, t *testing.T) {
+	inst := suite.BeginInstance()
+	defer suite.CloseInstance(inst)
+	if initErr := inst.InitUserAttributes(); initErr != nil {
+		t.Fatal("Init failed:", initErr)
+	}
+	settings, jsonErr := gopherbouncedb.MarshalJSONAttribute(map[string]interface{}{"theme": "dark", "size": 12})
+	if jsonErr != nil {
+		t.Fatal("Can't create JSON attribute:", jsonErr)
+	}
+	birthday := parseTime("21-03-1990")
+	attributes := gopherbouncedb.UserAttributes{
+		"city":       gopherbouncedb.StringAttribute("Freiburg"),
+		"empty":      gopherbouncedb.StringAttribute(""),
+		"logins":     gopherbouncedb.IntAttribute(-42),
+		"newsletter": gopherbouncedb.BoolAttribute(true),
+		"birthday":   gopherbouncedb.TimeAttribute(birthday),
+		"settings":   settings,
+	}
+	if setErr := inst.SetUserAttributes(1, attributes); setErr != nil {
+		t.Fatal("Can't set attributes:", setErr)
+	}
+	got, getErr := inst.GetUserAttributes(1)
+	if getErr != nil {
+		t.Fatal("Can't get attributes:", getErr)
+	}
+	if !compareAttributes(attributes, got) {
+		t.Errorf("Expected attributes %v, got %v", attributes, got)
+	}
+	var decoded map[string]interface{}
+	if err := got["settings"].DecodeJSON(&decoded); err != nil {
+		t.Error("Can't decode JSON attribute:", err)
+	} else if expected := map[string]interface{}{"theme": "dark", "size": float64(12)}; !reflect.DeepEqual(expected, decoded) {
+		t.Errorf("Expected decoded JSON %v, got %v", expected, decoded)
+	}
+
+	// only the given attributes are replaced
+	update := gopherbouncedb.UserAttributes{
+		"city":       gopherbouncedb.StringAttribute("Berlin"),
+		"newsletter": gopherbouncedb.IntAttribute(0),
+	}
+	if setErr := inst.SetUserAttributes(1, update); setErr != nil {
+		t.Fatal("Can't set attributes:", setErr)
+	}
+	attributes["city"] = update["city"]
+	attributes["newsletter"] = update["newsletter"]
+	if got, getErr = inst.GetUserAttributes(1); getErr != nil {
+		t.Fatal("Can't get attributes:", getErr)
+	}
+	if !compareAttributes(attributes, got) {
+		t.Errorf("Expected attributes %v, got %v", attributes, got)
+	}
+
+	// a large value that doesn't fit into a database index entry
+	profileData := make([]int64, 1000)
+	rnd := rand.New(rand.NewSource(42))
+	for i := range profileData {
+		profileData[i] = rnd.Int63()
+	}
+	profile, profileErr := gopherbouncedb.MarshalJSONAttribute(profileData)
+	if profileErr != nil {
+		t.Fatal("Can't create JSON attribute:", profileErr)
+	}
+	other := gopherbouncedb.UserAttributes{
+		"city":     gopherbouncedb.StringAttribute("Berlin"),
+		"logins":   gopherbouncedb.IntAttribute(-42),
+		"birthday": gopherbouncedb.TimeAttribute(birthday),
+		"profile":  profile,
+	}
+	for _, user := range []gopherbouncedb.UserID{3, 2} {
+		if setErr := inst.SetUserAttributes(user, other); setErr != nil {
+			t.Fatal("Can't set attributes:", setErr)
+		}
+	}
+	findTests := []struct {
+		name     string
+		value    gopherbouncedb.AttributeValue
+		expected []gopherbouncedb.UserID
+	}{
+		{"city", gopherbouncedb.StringAttribute("Berlin"), []gopherbouncedb.UserID{1, 2, 3}},
+		{"city", gopherbouncedb.StringAttribute("Freiburg"), []gopherbouncedb.UserID{}},
+		{"logins", gopherbouncedb.IntAttribute(-42), []gopherbouncedb.UserID{1, 2, 3}},
+		{"birthday", gopherbouncedb.TimeAttribute(birthday), []gopherbouncedb.UserID{1, 2, 3}},
+		{"settings", settings, []gopherbouncedb.UserID{1}},
+		{"profile", profile, []gopherbouncedb.UserID{2, 3}},
+		{"newsletter", gopherbouncedb.IntAttribute(0), []gopherbouncedb.UserID{1}},
+		// the type must match as well
+		{"newsletter", gopherbouncedb.BoolAttribute(false), []gopherbouncedb.UserID{}},
+		{"logins", gopherbouncedb.StringAttribute("-42"), []gopherbouncedb.UserID{}},
+	}
+	for _, test := range findTests {
+		users, findErr := inst.FindUsersByAttribute(test.name, test.value)
+		if findErr != nil {
+			t.Errorf("Can't find users by attribute %s: %s", test.name, findErr)
+			continue
+		}
+		if !reflect.DeepEqual(test.expected, users) {
+			t.Errorf("Expected users %v for %s=%v, got %v", test.expected, test.name, test.value, users)
+		}
+	}
+
+	// delete some and all attributes
+	if deleteErr := inst.DeleteUserAttributes(1, "city", "settings", "unknown"); deleteErr != nil {
+		t.Fatal("Can't delete attributes:", deleteErr)
+	}
+	delete(attributes, "city")
+	delete(attributes, "settings")
+	if got, getErr = inst.GetUserAttributes(1); getErr != nil {
+		t.Fatal("Can't get attributes:", getErr)
+	}
+	if !compareAttributes(attributes, got) {
+		t.Errorf("Expected attributes %v, got %v", attributes, got)
+	}
+	if deleteErr := inst.DeleteUserAttributes(2); deleteErr != nil {
+		t.Fatal("Can't delete attributes:", deleteErr)
+	}
+	if got, getErr = inst.GetUserAttributes(2); getErr != nil {
+		t.Fatal("Can't get attributes:", getErr)
+	}
+	if len(got) != 0 {
+		t.Errorf("Expected no attributes after delete, got %v", got)
+	}
+	users, findErr := inst.FindUsersByAttribute("city", gopherbouncedb.StringAttribute("Berlin"))
+	if findErr != nil {
+		t.Fatal("Can't find users by attribute:", findErr)
+	}
+	if expected := []gopherbouncedb.UserID{3}; !reflect.DeepEqual(expected, users) {
+		t.Errorf("Expected users %v, got %v", expected, users)
+	}
+
+	// invalid names are rejected and nothing is stored
+	invalid := gopherbouncedb.UserAttributes{
+		"valid": gopherbouncedb.StringAttribute("foo"),
+		"":      gopherbouncedb.StringAttribute("bar"),
+	}
+	if setErr := inst.SetUserAttributes(4, invalid); setErr == nil {
+		t.Error("Expected error for empty attribute name")
+	}
+	if got, getErr = inst.GetUserAttributes(4); getErr != nil {
+		t.Fatal("Can't get attributes:", getErr)
+	}
+	if len(got) != 0 {
+		t.Errorf("Expected no attributes after invalid set, got %v", got)
+	}
+	if _, err := gopherbouncedb.JSONAttribute(json.RawMessage("{invalid")); err == nil {
+		t.Error("Expected error for invalid JSON")
+	}
+}
@@ -0,0 +1,243 @@
+// Copyright 2019 Fabian Wenzelmann
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package testsuite
+
+import (
+	"encoding/base64"
+	"strings"
+	"testing"
+
+	"github.com/FabianWe/gopherbouncedb"
+	"golang.org/x/crypto/argon2"
+)
+
+// weak parameters to keep the tests fast
+func testHashers() (*gopherbouncedb.Argon2idHasher, *gopherbouncedb.ScryptHasher, *gopherbouncedb.BcryptHasher) {
+	return &gopherbouncedb.Argon2idHasher{Time: 1, Memory: 64, Threads: 1, SaltLen: 16, KeyLen: 32},
+		&gopherbouncedb.ScryptHasher{LogN: 4, R: 8, P: 1, SaltLen: 16, KeyLen: 32},
+		&gopherbouncedb.BcryptHasher{Cost: 4}
+}
+
+func TestHasherSuite(t *testing.T) {
+	argon, scrypt, bcrypt := testHashers()
+	for _, hasher := range []gopherbouncedb.PasswordHasher{argon, scrypt, bcrypt} {
+		hash, hashErr := hasher.Hash("secret")
+		if hashErr != nil {
+			t.Fatal("Hash failed:", hashErr)
+		}
+		if !hasher.Matches(hash) {
+			t.Errorf("Hasher doesn't match own hash %s", hash)
+		}
+		if ok, err := hasher.Verify("secret", hash); !ok || err != nil {
+			t.Errorf("Verify of correct password failed for %s: %v", hash, err)
+		}
+		if ok, err := hasher.Verify("Secret", hash); ok || err != nil {
+			t.Errorf("Verify of wrong password succeeded for %s: %v", hash, err)
+		}
+		if hasher.NeedsRehash(hash) {
+			t.Errorf("Hash %s needs rehash with same parameters", hash)
+		}
+	}
+	hash, _ := argon.Hash("secret")
+	stronger := *argon
+	stronger.Time = 2
+	if !stronger.NeedsRehash(hash) {
+		t.Error("Expected rehash for argon2id with more iterations")
+	}
+	if _, err := argon.Verify("secret", "$argon2id$v=19$m=64,t=1$abc"); err == nil {
+		t.Error("Expected error for malformed hash")
+	}
+}
+
+func TestAuthenticatorSuite(suite UserTestSuiteBinding, t *testing.T) {
+	restoreDefaults()
+	inst := suite.BeginInstance()
+	defer suite.CloseInstance(inst)
+	if initErr := inst.InitUsers(); initErr != nil {
+		t.Fatal("Init failed:", initErr)
+	}
+	argon, scrypt, bcrypt := testHashers()
+	auth := gopherbouncedb.NewAuthenticator(inst, argon, scrypt, bcrypt)
+	legacy := gopherbouncedb.NewAuthenticator(inst, bcrypt)
+	u1, u2 := users[0], users[1]
+	// u1 uses a legacy hash, u2 is inactive
+	if err := legacy.SetPassword(u1, "pw-one"); err != nil {
+		t.Fatal("SetPassword failed:", err)
+	}
+	if err := auth.SetPassword(u2, "pw-two"); err != nil {
+		t.Fatal("SetPassword failed:", err)
+	}
+	u2.IsActive = false
+	u1.MustChangePassword = true
+	// u3 has a hash no hasher understands
+	u3 := users[2]
+	u3.Password = "unknown$hash"
+	insertSuccess(inst, t)
+	changedAt := u1.PasswordChangedAt
+
+	u, authErr := auth.Authenticate(u1.Username, "pw-one")
+	if authErr != nil {
+		t.Fatal("Authenticate failed:", authErr)
+	}
+	if u.LastLogin.IsZero() {
+		t.Error("LastLogin not set by Authenticate")
+	}
+	if !strings.HasPrefix(u.Password, "$argon2id$") {
+		t.Errorf("Expected password to be rehashed with argon2id, got %s", u.Password)
+	}
+	stored, getErr := inst.GetUser(u1.ID)
+	if getErr != nil {
+		t.Fatal("GetUser failed:", getErr)
+	}
+	if stored.Password != u.Password || !compareTime(stored.LastLogin, u.LastLogin) {
+		t.Error("Rehashed password / LastLogin not stored")
+	}
+	if !compareTime(stored.PasswordChangedAt, changedAt) || !stored.MustChangePassword {
+		t.Error("Rehash changed PasswordChangedAt / MustChangePassword")
+	}
+	// login with email and the new hash
+	if _, authErr := auth.Authenticate(u1.EMail, "pw-one"); authErr != nil {
+		t.Error("Authenticate with email failed:", authErr)
+	}
+	failures := []struct {
+		login, password string
+	}{
+		{u1.Username, "wrong"},
+		{"nonexistent", "pw-one"},
+		{"nobody@nowhere.org", "pw-one"},
+		{u3.Username, "unknown"},
+	}
+	for _, failure := range failures {
+		_, authErr := auth.Authenticate(failure.login, failure.password)
+		if _, isFailed := authErr.(gopherbouncedb.AuthenticationFailed); !isFailed {
+			t.Errorf("Expected AuthenticationFailed for %s, got %v", failure.login, authErr)
+		}
+	}
+	if _, authErr := auth.AuthenticateByName(u2.Username, "pw-two"); authErr == nil {
+		t.Error("Authenticate of inactive user succeeded")
+	} else if _, isInactive := authErr.(gopherbouncedb.UserInactive); !isInactive {
+		t.Error("Expected UserInactive, got", authErr)
+	}
+}
+
+// hashes created by Django for the password "secret"
+var djangoHashes = []string{
+	"pbkdf2_sha256$1000$salt1234$2tjePw+gSKhtB2TFS6VlSFYq2tEh1WFJW6S9ujWrfbM=",
+	"pbkdf2_sha1$1000$salt1234$mZZ4QV9Vs67xBl8MbDU/Yaacybg=",
+	"argon2$argon2id$v=19$m=102400,t=2,p=8$Y041dExhNkljRUUy$TMa6A8fPJhCAUXRhJXCXdw",
+}
+
+func TestDjangoHasherSuite(t *testing.T) {
+	hashers := gopherbouncedb.DjangoHashers()
+	// hashes created by older Django versions with argon2i
+	salt := []byte("somesalt")
+	key := argon2.Key([]byte("secret"), salt, 1, 8, 1, 16)
+	argon2i := "argon2$argon2i$v=19$m=8,t=1,p=1$" + base64.RawStdEncoding.EncodeToString(salt) +
+		"$" + base64.RawStdEncoding.EncodeToString(key)
+	for _, hash := range append(djangoHashes, argon2i) {
+		var hasher gopherbouncedb.PasswordHasher
+		for _, h := range hashers {
+			if h.Matches(hash) {
+				hasher = h
+				break
+			}
+		}
+		if hasher == nil {
+			t.Errorf("No Django hasher matches %s", hash)
+			continue
+		}
+		if ok, err := hasher.Verify("secret", hash); !ok || err != nil {
+			t.Errorf("Verify of correct password failed for %s: %v", hash, err)
+		}
+		if ok, err := hasher.Verify("Secret", hash); ok || err != nil {
+			t.Errorf("Verify of wrong password succeeded for %s: %v", hash, err)
+		}
+	}
+	// round trips with weak parameters
+	weak := []gopherbouncedb.PasswordHasher{
+		&gopherbouncedb.DjangoPBKDF2Hasher{Algorithm: "pbkdf2_sha256", Iterations: 1000, SaltLen: 22},
+		&gopherbouncedb.DjangoPBKDF2Hasher{Algorithm: "pbkdf2_sha1", Iterations: 1000, SaltLen: 22},
+		&gopherbouncedb.DjangoBcryptHasher{SHA256: true, Cost: 4},
+		&gopherbouncedb.DjangoBcryptHasher{Cost: 4},
+		&gopherbouncedb.DjangoArgon2Hasher{
+			Argon2idHasher: gopherbouncedb.Argon2idHasher{Time: 1, Memory: 64, Threads: 1, SaltLen: 16, KeyLen: 32},
+		},
+	}
+	for _, hasher := range weak {
+		hash, hashErr := hasher.Hash("secret")
+		if hashErr != nil {
+			t.Fatal("Hash failed:", hashErr)
+		}
+		if !hasher.Matches(hash) {
+			t.Errorf("Hasher doesn't match own hash %s", hash)
+		}
+		if ok, err := hasher.Verify("secret", hash); !ok || err != nil {
+			t.Errorf("Verify of correct password failed for %s: %v", hash, err)
+		}
+		if ok, err := hasher.Verify("Secret", hash); ok || err != nil {
+			t.Errorf("Verify of wrong password succeeded for %s: %v", hash, err)
+		}
+		if hasher.NeedsRehash(hash) {
+			t.Errorf("Hash %s needs rehash with same parameters", hash)
+		}
+	}
+	// bcrypt_sha256 supports passwords longer than 72 bytes
+	long := strings.Repeat("a", 72)
+	hash, _ := weak[2].Hash(long + "b")
+	if ok, _ := weak[2].Verify(long+"c", hash); ok {
+		t.Error("bcrypt_sha256 ignored characters after 72 bytes")
+	}
+	if !hashers[0].NeedsRehash(djangoHashes[0]) {
+		t.Error("Expected rehash for pbkdf2_sha256 with fewer iterations")
+	}
+}
+
+func TestDjangoAuthenticatorSuite(suite UserTestSuiteBinding, t *testing.T) {
+	restoreDefaults()
+	inst := suite.BeginInstance()
+	defer suite.CloseInstance(inst)
+	if initErr := inst.InitUsers(); initErr != nil {
+		t.Fatal("Init failed:", initErr)
+	}
+	argon, _, _ := testHashers()
+	auth := gopherbouncedb.NewAuthenticator(inst, argon, gopherbouncedb.DjangoHashers()...)
+	// users imported from Django with their hashes
+	users[0].Password = djangoHashes[0]
+	users[1].Password = djangoHashes[1]
+	users[2].Password = djangoHashes[0]
+	insertSuccess(inst, t)
+	for _, imported := range users[:2] {
+		u, authErr := auth.AuthenticateByName(imported.Username, "secret")
+		if authErr != nil {
+			t.Fatalf("Authenticate with Django hash %s failed: %v", imported.Password, authErr)
+		}
+		if !strings.HasPrefix(u.Password, "$argon2id$") {
+			t.Errorf("Expected Django hash to be upgraded to argon2id, got %s", u.Password)
+		}
+		if _, authErr := auth.AuthenticateByName(imported.Username, "secret"); authErr != nil {
+			t.Error("Authenticate with upgraded hash failed:", authErr)
+		}
+	}
+	// if the Django hasher is the preferred hasher the hash is kept
+	weak := &gopherbouncedb.DjangoPBKDF2Hasher{Algorithm: "pbkdf2_sha256", Iterations: 1000, SaltLen: 22}
+	keep := gopherbouncedb.NewAuthenticator(inst, weak)
+	u, authErr := keep.AuthenticateByName(users[2].Username, "secret")
+	if authErr != nil {
+		t.Fatal("Authenticate with Django hash failed:", authErr)
+	}
+	if u.Password != djangoHashes[0] {
+		t.Errorf("Django hash was changed to %s", u.Password)
+	}
+}
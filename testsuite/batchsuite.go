@@ -0,0 +1,113 @@
+// Copyright 2019 Fabian Wenzelmann
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package testsuite
+
+import (
+	"testing"
+
+	"github.com/FabianWe/gopherbouncedb"
+)
+
+func TestBatchUserSuite(suite UserTestSuiteBinding, mailUnique bool, t *testing.T) {
+	restoreDefaults()
+	inst := suite.BeginInstance()
+	defer suite.CloseInstance(inst)
+	if initErr := inst.InitUsers(); initErr != nil {
+		t.Fatal("Init failed:", initErr)
+	}
+	// users[3] has the same name as users[0], users[4] the same email as users[2]
+	insertErr := gopherbouncedb.InsertUsers(inst, users)
+	batchErr, isBatchErr := insertErr.(gopherbouncedb.BatchErr)
+	if !isBatchErr {
+		t.Fatal("Expected BatchErr, got", insertErr)
+	}
+	expectedFailed := 1
+	if mailUnique {
+		expectedFailed = 2
+	}
+	if len(batchErr) != expectedFailed {
+		t.Errorf("Expected %d failed inserts, got %v", expectedFailed, batchErr)
+	}
+	if _, isExists := batchErr[3].(gopherbouncedb.UserExists); !isExists {
+		t.Errorf("Expected UserExists for index 3, got %v", batchErr[3])
+	}
+	if mailUnique {
+		if _, isExists := batchErr[4].(gopherbouncedb.UserExists); !isExists {
+			t.Errorf("Expected UserExists for index 4, got %v", batchErr[4])
+		}
+	}
+	doLookupTests(inst, mailUnique, nil, t)
+
+	inserted := getInsertOK()
+	for _, u := range inserted {
+		u.LastName = "Batch"
+	}
+	if err := gopherbouncedb.UpdateUsers(inst, inserted, []string{"LastName"}); err != nil {
+		t.Fatal("UpdateUsers failed:", err)
+	}
+	for _, u := range inserted {
+		stored, getErr := inst.GetUser(u.ID)
+		if getErr != nil {
+			t.Fatal("GetUser failed:", getErr)
+		}
+		if stored.LastName != "Batch" {
+			t.Errorf("LastName of user %d not updated", u.ID)
+		}
+	}
+	// users[1] gets the name of users[0]
+	inserted[1].Username = inserted[0].Username
+	updateErr := gopherbouncedb.UpdateUsers(inst, inserted[:2], nil)
+	if batchErr, isBatchErr := updateErr.(gopherbouncedb.BatchErr); !isBatchErr || len(batchErr) != 1 {
+		t.Error("Expected BatchErr with one error, got", updateErr)
+	} else if _, isAmbiguous := batchErr[1].(gopherbouncedb.AmbiguousCredentials); !isAmbiguous {
+		t.Errorf("Expected AmbiguousCredentials for index 1, got %v", batchErr[1])
+	}
+
+	ids := []gopherbouncedb.UserID{inserted[0].ID, inserted[2].ID}
+	if err := gopherbouncedb.DeleteUsers(inst, ids); err != nil {
+		t.Fatal("DeleteUsers failed:", err)
+	}
+	for _, id := range ids {
+		if _, getErr := inst.GetUser(id); getErr == nil {
+			t.Errorf("User %d not deleted", id)
+		}
+	}
+	if _, getErr := inst.GetUser(inserted[1].ID); getErr != nil {
+		t.Error("Wrong user deleted:", getErr)
+	}
+}
+
+func TestBatchSessionSuite(suite SessionTestSuiteBinding, t *testing.T) {
+	restoreDefaultsSession()
+	inst := suite.BeginInstance()
+	defer suite.CloseInstance(inst)
+	if initErr := inst.InitSessions(); initErr != nil {
+		t.Fatal("Init failed:", initErr)
+	}
+	insertSessionsOkay(inst, t)
+	// deleting a non-existing key is not an error
+	keys := []string{sessions[0].Key, sessions[2].Key, "nonexistent"}
+	if err := gopherbouncedb.DeleteSessions(inst, keys); err != nil {
+		t.Fatal("DeleteSessions failed:", err)
+	}
+	for _, key := range keys[:2] {
+		if _, getErr := inst.GetSession(key); getErr == nil {
+			t.Errorf("Session %s not deleted", key)
+		}
+	}
+	if _, getErr := inst.GetSession(sessions[1].Key); getErr != nil {
+		t.Error("Wrong session deleted:", getErr)
+	}
+}
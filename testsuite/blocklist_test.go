@@ -0,0 +1,91 @@
+// Copyright 2019 Fabian Wenzelmann
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package testsuite
+
+import (
+	"crypto/sha1"
+	"fmt"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/FabianWe/gopherbouncedb"
+)
+
+func hibpLine(pw string, count int) string {
+	return fmt.Sprintf("%X:%d", sha1.Sum([]byte(pw)), count)
+}
+
+func TestBlocklistFormats(t *testing.T) {
+	l := gopherbouncedb.NewPasswordBlocklist()
+	if err := l.AddPlain(strings.NewReader("foo\r\nbar\n\nfoo\n")); err != nil {
+		t.Fatal("AddPlain failed:", err)
+	}
+	hibp := strings.Join([]string{hibpLine("rare", 1), hibpLine("often", 42)}, "\n")
+	if err := l.AddHIBP(strings.NewReader(hibp), 10); err != nil {
+		t.Fatal("AddHIBP failed:", err)
+	}
+	full := fmt.Sprintf("%X", sha1.Sum([]byte("ranged")))
+	if err := l.AddHIBPRange(full[:5], strings.NewReader(full[5:]+":3"), 0); err != nil {
+		t.Fatal("AddHIBPRange failed:", err)
+	}
+	if l.Len() != 4 {
+		t.Errorf("Expected 4 entries in blocklist, got %d", l.Len())
+	}
+	for _, pw := range []string{"foo", "bar", "often", "ranged"} {
+		if !l.Contains(pw) {
+			t.Errorf("Expected %s to be blocked", pw)
+		}
+	}
+	for _, pw := range []string{"rare", "Foo", "correct horse battery staple"} {
+		if l.Contains(pw) {
+			t.Errorf("Expected %s not to be blocked", pw)
+		}
+	}
+	if err := l.AddHIBP(strings.NewReader("ABC:1"), 0); err == nil {
+		t.Error("Expected AddHIBP to fail on invalid hash")
+	}
+}
+
+func TestCommonPasswordBlocklist(t *testing.T) {
+	verifier := gopherbouncedb.NewCommonPasswordBlocklist(-1).Verifier()
+	if verifier("password") {
+		t.Error("Expected \"password\" to be rejected")
+	}
+	if !verifier("2dX!v9-Lq#e0") {
+		t.Error("Expected random password to be accepted")
+	}
+}
+
+func benchmarkBlocklist(n int, b *testing.B) {
+	l := gopherbouncedb.NewPasswordBlocklist()
+	passwords := make([]string, n)
+	for i := range passwords {
+		passwords[i] = "pw" + strconv.Itoa(i)
+	}
+	l.AddPasswords(passwords...)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		l.Contains(passwords[i%n])
+	}
+}
+
+func BenchmarkBlocklist1K(b *testing.B) {
+	benchmarkBlocklist(1000, b)
+}
+
+func BenchmarkBlocklist1M(b *testing.B) {
+	benchmarkBlocklist(1000000, b)
+}
@@ -0,0 +1,137 @@
+// Copyright 2019 Fabian Wenzelmann
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+
+package testsuite
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/FabianWe/gopherbouncedb"
+)
+
+// bridgeTimes are the times used in the round-trip tests.
+var bridgeTimes = []time.Time{
+	time.Date(2019, 10, 1, 8, 30, 15, 123456789, time.UTC),
+	time.Date(2019, 10, 1, 10, 30, 15, 987654321, time.FixedZone("CEST", 2*60*60)),
+	time.Date(1969, 12, 31, 23, 59, 59, 999999999, time.UTC),
+	time.Date(2038, 1, 19, 3, 14, 8, 0, time.UTC),
+	{},
+}
+
+// scanValue simulates the Scan of a driver: value (as returned by ConvertTime) is
+// assigned to dest (as returned by TimeScanType).
+func scanValue(dest, value interface{}) error {
+	if scanner, ok := dest.(sql.Scanner); ok {
+		return scanner.Scan(value)
+	}
+	v := reflect.ValueOf(value)
+	elem := reflect.ValueOf(dest).Elem()
+	if !v.Type().AssignableTo(elem.Type()) {
+		return fmt.Errorf("can't assign %v to %v", v.Type(), elem.Type())
+	}
+	elem.Set(v)
+	return nil
+}
+
+func TestTimeCodecs(t *testing.T) {
+	codecs := []struct {
+		codec     gopherbouncedb.TimeCodec
+		precision time.Duration
+	}{
+		{gopherbouncedb.NativeTime{}, time.Nanosecond},
+		{gopherbouncedb.TextTime{}, time.Nanosecond},
+		{gopherbouncedb.NewUnixSeconds(), time.Second},
+		{gopherbouncedb.NewUnixMillis(), time.Millisecond},
+		{gopherbouncedb.NullTime{}, time.Nanosecond},
+	}
+	for _, c := range codecs {
+		for _, original := range bridgeTimes {
+			converted := c.codec.ConvertTime(original)
+			dest := c.codec.TimeScanType()
+			if err := scanValue(dest, converted); err != nil {
+				t.Fatalf("%T: %v", c.codec, err)
+			}
+			got, err := c.codec.ConvertTimeScanType(dest)
+			if err != nil {
+				t.Errorf("%T: can't convert %v: %v", c.codec, original, err)
+				continue
+			}
+			// truncation rounds towards the zero time, not towards 1970
+			expected := original.Truncate(c.precision).UTC()
+			if !got.Equal(expected) || got.Location() != time.UTC {
+				t.Errorf("%T: expected %v, got %v", c.codec, expected, got)
+			}
+		}
+		if _, err := c.codec.ConvertTimeScanType(new(bool)); err == nil {
+			t.Errorf("%T: expected error for invalid scan type", c.codec)
+		}
+	}
+	if (gopherbouncedb.NullTime{}).ConvertTime(time.Time{}) != nil {
+		t.Error("NullTime: zero time not converted to NULL")
+	}
+	// the text format is sortable
+	before := gopherbouncedb.TextTime{}.ConvertTime(time.Date(2019, 10, 1, 8, 30, 15, 0, time.UTC)).(string)
+	after := gopherbouncedb.TextTime{}.ConvertTime(time.Date(2019, 10, 1, 8, 30, 15, 500000000, time.UTC)).(string)
+	if before >= after {
+		t.Errorf("Text times not sortable: %s >= %s", before, after)
+	}
+}
+
+// stateErr is an error with a SQLSTATE.
+type stateErr string
+
+func (e stateErr) Error() string {
+	return "error with state " + string(e)
+}
+
+func (e stateErr) SQLState() string {
+	return string(e)
+}
+
+func TestComposedBridge(t *testing.T) {
+	byState := gopherbouncedb.DuplicateBySQLState("23505")
+	byMessage := gopherbouncedb.DuplicateByMessage("UNIQUE constraint failed", "Duplicate entry")
+	bridge := gopherbouncedb.NewComposedBridge(gopherbouncedb.NativeTime{},
+		gopherbouncedb.AnyDuplicate(byState, byMessage))
+	duplicates := []error{
+		stateErr("23505"),
+		fmt.Errorf("insert failed: %w", stateErr("23505")),
+		errors.New("UNIQUE constraint failed: auth_user.username"),
+		errors.New("Error 1062: Duplicate entry 'foo' for key 'username'"),
+	}
+	for _, err := range duplicates {
+		if !bridge.IsDuplicateInsert(err) || !bridge.IsDuplicateUpdate(err) {
+			t.Errorf("Duplicate not detected: %v", err)
+		}
+	}
+	for _, err := range []error{nil, stateErr("23503"), sql.ErrNoRows} {
+		if bridge.IsDuplicateInsert(err) {
+			t.Errorf("Error detected as duplicate: %v", err)
+		}
+	}
+	bridge.DuplicateUpdate = byState
+	if bridge.IsDuplicateUpdate(duplicates[2]) || !bridge.IsDuplicateInsert(duplicates[2]) {
+		t.Error("DuplicateUpdate not used")
+	}
+	var noDetector gopherbouncedb.ComposedBridge
+	if noDetector.IsDuplicateInsert(duplicates[0]) {
+		t.Error("Bridge without detector detected duplicate")
+	}
+}
@@ -0,0 +1,151 @@
+// Copyright 2019 Fabian Wenzelmann
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package testsuite
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/FabianWe/gopherbouncedb"
+)
+
+// exportUsers inserts the default users, sets some fields that InsertUser doesn't
+// set and returns the export.
+func exportUsers(inst gopherbouncedb.UserStorage, format gopherbouncedb.UserFormat, t *testing.T) []byte {
+	insertSuccess(inst, t)
+	users[0].DateJoined = time.Date(2015, 3, 1, 12, 0, 0, 0, time.UTC)
+	users[0].LastLogin = time.Date(2019, 10, 1, 8, 30, 0, 0, time.UTC)
+	users[1].MustChangePassword = true
+	for _, u := range users[:2] {
+		if err := inst.UpdateUser(u.ID, u, []string{"DateJoined", "LastLogin", "MustChangePassword"}); err != nil {
+			t.Fatal("Update failed:", err)
+		}
+	}
+	var buf bytes.Buffer
+	n, err := gopherbouncedb.ExportUsers(inst, &buf, format)
+	if err != nil {
+		t.Fatal("Export failed:", err)
+	}
+	if n != 3 {
+		t.Errorf("Expected 3 exported users, got %d", n)
+	}
+	return buf.Bytes()
+}
+
+func TestExportImportSuite(suite UserTestSuiteBinding, t *testing.T) {
+	for _, format := range []gopherbouncedb.UserFormat{gopherbouncedb.JSONLines, gopherbouncedb.CSV} {
+		restoreDefaults()
+		source := suite.BeginInstance()
+		if initErr := source.InitUsers(); initErr != nil {
+			t.Fatal("Init failed:", initErr)
+		}
+		data := exportUsers(source, format, t)
+		suite.CloseInstance(source)
+
+		target := suite.BeginInstance()
+		if initErr := target.InitUsers(); initErr != nil {
+			t.Fatal("Init failed:", initErr)
+		}
+		calls := 0
+		progress, importErr := gopherbouncedb.ImportUsers(target, bytes.NewReader(data), format,
+			gopherbouncedb.ImportOptions{
+				BatchSize: 2,
+				Progress: func(gopherbouncedb.ImportProgress) {
+					calls++
+				},
+			})
+		if importErr != nil {
+			t.Fatalf("Import of %v failed: %v", format, importErr)
+		}
+		if progress.Processed != 3 || progress.Inserted != 3 || calls != 2 {
+			t.Errorf("Unexpected progress for %v: %+v (%d calls)", format, progress, calls)
+		}
+		for _, u := range users[:3] {
+			imported, getErr := target.GetUserByName(u.Username)
+			if getErr != nil {
+				t.Fatal("GetUserByName failed:", getErr)
+			}
+			imported.ID = u.ID
+			if !compareUsers(imported, u) {
+				t.Errorf("Imported user %v doesn't match exported user %v", imported, u)
+			}
+			if u.LastLogin.IsZero() != imported.LastLogin.IsZero() {
+				t.Error("Zero LastLogin not preserved")
+			}
+		}
+		suite.CloseInstance(target)
+	}
+}
+
+func TestImportConflictSuite(suite UserTestSuiteBinding, t *testing.T) {
+	restoreDefaults()
+	inst := suite.BeginInstance()
+	defer suite.CloseInstance(inst)
+	if initErr := inst.InitUsers(); initErr != nil {
+		t.Fatal("Init failed:", initErr)
+	}
+	insertSuccess(inst, t)
+	// user1 exists, new is new
+	data := "username,email,first_name,is_active\n" +
+		"new,new@example.com,New,true\n" +
+		"user1,user1@foo.com,Changed,false\n"
+	if _, err := gopherbouncedb.ImportUsers(inst, strings.NewReader(data), gopherbouncedb.CSV,
+		gopherbouncedb.ImportOptions{Conflict: gopherbouncedb.ConflictFail}); err == nil {
+		t.Error("Expected UserExists error with ConflictFail")
+	} else if _, isExists := err.(gopherbouncedb.UserExists); !isExists {
+		t.Error("Expected UserExists error, got", err)
+	}
+	progress, err := gopherbouncedb.ImportUsers(inst, strings.NewReader(data), gopherbouncedb.CSV,
+		gopherbouncedb.ImportOptions{Conflict: gopherbouncedb.ConflictSkip})
+	if err != nil {
+		t.Fatal("Import failed:", err)
+	}
+	// new was inserted by the failed import
+	if progress.Skipped != 2 || progress.Inserted != 0 {
+		t.Errorf("Unexpected progress with ConflictSkip: %+v", progress)
+	}
+	progress, err = gopherbouncedb.ImportUsers(inst, strings.NewReader(data), gopherbouncedb.CSV,
+		gopherbouncedb.ImportOptions{Conflict: gopherbouncedb.ConflictOverwrite})
+	if err != nil {
+		t.Fatal("Import failed:", err)
+	}
+	if progress.Updated != 2 {
+		t.Errorf("Unexpected progress with ConflictOverwrite: %+v", progress)
+	}
+	u, getErr := inst.GetUser(users[0].ID)
+	if getErr != nil {
+		t.Fatal("GetUser failed:", getErr)
+	}
+	if u.FirstName != "Changed" || u.IsActive {
+		t.Errorf("User not overwritten: %v", u)
+	}
+	invalid := []string{
+		"username,unknown\nfoo,bar\n",
+		"username,is_active\nfoo,maybe\n",
+		"username,last_login\nfoo,yesterday\n",
+	}
+	for _, data := range invalid {
+		if _, err := gopherbouncedb.ImportUsers(inst, strings.NewReader(data), gopherbouncedb.CSV,
+			gopherbouncedb.ImportOptions{}); err == nil {
+			t.Errorf("Expected error for invalid input %q", data)
+		}
+	}
+	if _, err := gopherbouncedb.ImportUsers(inst, strings.NewReader(`{"username": "x", "foo": 1}`),
+		gopherbouncedb.JSONLines, gopherbouncedb.ImportOptions{}); err == nil {
+		t.Error("Expected error for unknown JSON field")
+	}
+}
@@ -0,0 +1,166 @@
+// Copyright 2019 Fabian Wenzelmann
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package testsuite
+
+import (
+	"testing"
+	"time"
+
+	"github.com/FabianWe/gopherbouncedb"
+)
+
+// session data as created by Django: compressed (Django ≥ 3.1), uncompressed
+// without user and the legacy format
+var djangoSessionData = []struct {
+	data    string
+	user    gopherbouncedb.UserID
+	hasUser bool
+}{
+	{".eJyrVopPLC3JiC8tTi2Kz0xRslIyMVLSQRZMSkzOTs0DyaRkJeal5-sl5-eVFGUm6YGU6EFli_V881NSc5ygalEMyEgszgDqNk0zSUlONk4yTUw0NzNNMTNMsTA2Mk9JTbKwMEpOs7RUqgUAm7gvtA:1tXyZa:sig",
+		42, true},
+	{"eyJmb28iOiJiYXIifQ:1tXyZa:sig", gopherbouncedb.InvalidUserID, false},
+	{"MDEyMzQ1Njc4OWFiY2RlZjp7Il9hdXRoX3VzZXJfaWQiOiA3fQ==", 7, true},
+}
+
+func TestDjangoSessionDataSuite(t *testing.T) {
+	for _, tc := range djangoSessionData {
+		session := gopherbouncedb.DjangoSession{Key: "key", Data: tc.data}
+		user, hasUser, err := session.User()
+		if err != nil {
+			t.Errorf("Decoding session data %s failed: %v", tc.data, err)
+			continue
+		}
+		if user != tc.user || hasUser != tc.hasUser {
+			t.Errorf("Expected user %d (%v) for session data %s, got %d (%v)",
+				tc.user, tc.hasUser, tc.data, user, hasUser)
+		}
+	}
+	for _, invalid := range []string{"!!!:1tXyZa:sig", ".eyJmb28iOiJiYXIifQ:1tXyZa:sig", "bm9oYXNo"} {
+		if _, err := gopherbouncedb.DecodeDjangoSessionData(invalid); err == nil {
+			t.Errorf("Expected error for invalid session data %s", invalid)
+		}
+	}
+}
+
+// djangoSource returns a storage containing the users from the Django database,
+// the ids of the storage are used as Django ids.
+func djangoSource(t *testing.T) (*gopherbouncedb.MemdummyUserStorage, []*gopherbouncedb.UserModel) {
+	source := gopherbouncedb.NewMemdummyUserStorage()
+	djangoUsers := []*gopherbouncedb.UserModel{
+		{Username: "alice", EMail: "alice@example.com", Password: djangoHashes[0], IsActive: true},
+		{Username: "bob", EMail: "bob@example.com", Password: djangoHashes[1], IsActive: true, IsStaff: true},
+		// conflicts with users[0]
+		{Username: "user1", EMail: "other@example.com", Password: djangoHashes[0]},
+	}
+	joined := time.Date(2015, 3, 1, 12, 0, 0, 0, time.UTC)
+	for _, u := range djangoUsers {
+		if _, err := source.InsertUser(u); err != nil {
+			t.Fatal("Insert failed:", err)
+		}
+		u.DateJoined = joined
+		if err := source.UpdateUser(u.ID, u, []string{"DateJoined"}); err != nil {
+			t.Fatal("Update failed:", err)
+		}
+	}
+	djangoUsers[0].LastLogin = joined.Add(time.Hour)
+	if err := source.UpdateUser(djangoUsers[0].ID, djangoUsers[0], []string{"LastLogin"}); err != nil {
+		t.Fatal("Update failed:", err)
+	}
+	return source, djangoUsers
+}
+
+func TestDjangoImportSuite(suite UserTestSuiteBinding, sessionSuite SessionTestSuiteBinding, t *testing.T) {
+	restoreDefaults()
+	inst := suite.BeginInstance()
+	defer suite.CloseInstance(inst)
+	sessionInst := sessionSuite.BeginInstance()
+	defer sessionSuite.CloseInstance(sessionInst)
+	if initErr := inst.InitUsers(); initErr != nil {
+		t.Fatal("Init failed:", initErr)
+	}
+	if initErr := sessionInst.InitSessions(); initErr != nil {
+		t.Fatal("Init failed:", initErr)
+	}
+	insertSuccess(inst, t)
+	source, djangoUsers := djangoSource(t)
+	now := time.Now().UTC()
+	sessions := []*gopherbouncedb.DjangoSession{
+		// belongs to bob
+		{Key: "valid", Data: "MDEyMzQ1Njc4OWFiY2RlZjp7Il9hdXRoX3VzZXJfaWQiOiAyfQ==", ExpireDate: now.Add(time.Hour)},
+		{Key: "expired", Data: "MDEyMzQ1Njc4OWFiY2RlZjp7Il9hdXRoX3VzZXJfaWQiOiAyfQ==", ExpireDate: now.Add(-time.Hour)},
+		{Key: "anonymous", Data: djangoSessionData[1].data, ExpireDate: now.Add(time.Hour)},
+	}
+	imp := &gopherbouncedb.DjangoImporter{Users: inst, Sessions: sessionInst}
+
+	// dry run: nothing is written
+	imp.DryRun = true
+	dryRes := gopherbouncedb.NewDjangoImportResult()
+	it, _ := source.ListUsers()
+	if err := imp.ImportUsersFrom(it, dryRes); err != nil {
+		t.Fatal("Dry run failed:", err)
+	}
+	if err := imp.ImportSessionsFrom(sessions, now, dryRes); err != nil {
+		t.Fatal("Dry run failed:", err)
+	}
+	if len(dryRes.IDs) != 2 || len(dryRes.Conflicts) != 1 || dryRes.Sessions != 1 || dryRes.SkippedSessions != 2 {
+		t.Errorf("Unexpected dry run result: %d users, %d conflicts, %d sessions, %d skipped",
+			len(dryRes.IDs), len(dryRes.Conflicts), dryRes.Sessions, dryRes.SkippedSessions)
+	}
+	if _, err := inst.GetUserByName("alice"); err == nil {
+		t.Error("Dry run inserted a user")
+	}
+	if _, err := sessionInst.GetSession("valid"); err == nil {
+		t.Error("Dry run inserted a session")
+	}
+
+	imp.DryRun = false
+	res := gopherbouncedb.NewDjangoImportResult()
+	it, _ = source.ListUsers()
+	if err := imp.ImportUsersFrom(it, res); err != nil {
+		t.Fatal("Import failed:", err)
+	}
+	if err := imp.ImportSessionsFrom(sessions, now, res); err != nil {
+		t.Fatal("Import failed:", err)
+	}
+	if len(res.Conflicts) != 1 || res.Conflicts[0].Username != "user1" {
+		t.Errorf("Expected conflict for user1, got %v", res.Conflicts)
+	}
+	for _, djangoUser := range djangoUsers[:2] {
+		id, imported := res.IDs[djangoUser.ID]
+		if !imported {
+			t.Errorf("User %s not imported", djangoUser.Username)
+			continue
+		}
+		u, getErr := inst.GetUser(id)
+		if getErr != nil {
+			t.Fatal("GetUser failed:", getErr)
+		}
+		if u.Username != djangoUser.Username || u.Password != djangoUser.Password ||
+			u.IsStaff != djangoUser.IsStaff || !compareTime(u.DateJoined, djangoUser.DateJoined) ||
+			!compareTime(u.LastLogin, djangoUser.LastLogin) || u.PasswordChangedAt.IsZero() {
+			t.Errorf("Imported user %v doesn't match Django user %v", u, djangoUser)
+		}
+	}
+	session, sessionErr := sessionInst.GetSession("valid")
+	if sessionErr != nil {
+		t.Fatal("Session not imported:", sessionErr)
+	}
+	if session.User != res.IDs[djangoUsers[1].ID] {
+		t.Errorf("Imported session belongs to user %d, expected %d", session.User, res.IDs[djangoUsers[1].ID])
+	}
+	if res.Sessions != 1 || res.SkippedSessions != 2 {
+		t.Errorf("Expected 1 imported and 2 skipped sessions, got %d and %d", res.Sessions, res.SkippedSessions)
+	}
+}
@@ -0,0 +1,122 @@
+// Copyright 2019 Fabian Wenzelmann
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+
+package testsuite
+
+import (
+	"testing"
+	"time"
+
+	"github.com/FabianWe/gopherbouncedb"
+)
+
+// ExtraTestColumns are the extra columns used by TestExtraColumnsSuite, the
+// storage must store these columns (for example with GenerateMappedUserSQL).
+var ExtraTestColumns = []gopherbouncedb.ExtraColumn{
+	{Name: "Phone", Type: gopherbouncedb.ExtraString},
+	{Name: "LoginCount", Column: "login_count", Type: gopherbouncedb.ExtraInt},
+	{Name: "Verified", Type: gopherbouncedb.ExtraBool},
+	{Name: "VerifiedAt", Column: "verified_at", Type: gopherbouncedb.ExtraTime},
+}
+
+// compareExtensions returns true if both extensions contain the same values, times
+// are compared with compareTime.
+func compareExtensions(e1, e2 gopherbouncedb.UserExtensions) bool {
+	if len(e1) != len(e2) {
+		return false
+	}
+	for name, v1 := range e1 {
+		v2, has := e2[name]
+		if t1, isTime := v1.(time.Time); isTime {
+			t2, isTime := v2.(time.Time)
+			if !isTime || !compareTime(t1, t2) {
+				return false
+			}
+		} else if !has || v1 != v2 {
+			return false
+		}
+	}
+	return true
+}
+
+func getExtensions(inst gopherbouncedb.UserStorage, id gopherbouncedb.UserID, expected gopherbouncedb.UserExtensions, t *testing.T) *gopherbouncedb.UserModel {
+	u, err := inst.GetUser(id)
+	if err != nil {
+		t.Fatal("GetUser failed:", err)
+	}
+	if !compareExtensions(u.Extensions, expected) {
+		t.Errorf("Expected extensions %v, got %v", expected, u.Extensions)
+	}
+	return u
+}
+
+func TestExtraColumnsSuite(suite UserTestSuiteBinding, t *testing.T) {
+	inst := suite.BeginInstance()
+	defer suite.CloseInstance(inst)
+	if initErr := inst.InitUsers(); initErr != nil {
+		t.Fatal("Init failed:", initErr)
+	}
+	u := &gopherbouncedb.UserModel{Username: "extra", EMail: "extra@example.com", Password: "secret"}
+	u.Extensions.SetString("Phone", "+49 123")
+	u.Extensions.SetInt("LoginCount", 42)
+	u.Extensions.SetBool("Verified", true)
+	u.Extensions.SetTime("VerifiedAt", time.Date(2019, 10, 1, 12, 0, 0, 0, time.UTC))
+	if _, err := inst.InsertUser(u); err != nil {
+		t.Fatal("Insert failed:", err)
+	}
+	other := &gopherbouncedb.UserModel{Username: "plain", EMail: "plain@example.com", Password: "secret"}
+	if _, err := inst.InsertUser(other); err != nil {
+		t.Fatal("Insert failed:", err)
+	}
+	stored := getExtensions(inst, u.ID, u.Extensions, t)
+	getExtensions(inst, other.ID, nil, t)
+
+	// update only some of the extensions, a deleted extension is removed
+	stored.Extensions.SetString("Phone", "+49 456")
+	stored.Extensions.Delete("Verified")
+	if err := inst.UpdateUser(u.ID, stored, []string{"phone", "Verified"}); err != nil {
+		t.Fatal("Update failed:", err)
+	}
+	stored = getExtensions(inst, u.ID, stored.Extensions, t)
+	if n, _ := stored.Extensions.GetInt("LoginCount"); n != 42 {
+		t.Error("Expected LoginCount 42, got", n)
+	}
+
+	// the extensions are listed
+	users, err := gopherbouncedb.AsUsersSlice(mustListUsers(inst, t))
+	if err != nil || len(users) != 2 {
+		t.Fatalf("Expected 2 users, got %d (%v)", len(users), err)
+	}
+	for _, listed := range users {
+		if listed.ID == u.ID && !compareExtensions(listed.Extensions, stored.Extensions) {
+			t.Errorf("Expected extensions %v, got %v", stored.Extensions, listed.Extensions)
+		}
+	}
+
+	// updating all fields removes all extensions
+	stored.Extensions = nil
+	if err := inst.UpdateUser(u.ID, stored, nil); err != nil {
+		t.Fatal("Update failed:", err)
+	}
+	getExtensions(inst, u.ID, nil, t)
+}
+
+func mustListUsers(inst gopherbouncedb.UserStorage, t *testing.T) gopherbouncedb.UserIterator {
+	it, err := inst.ListUsers()
+	if err != nil {
+		t.Fatal("ListUsers failed:", err)
+	}
+	return it
+}
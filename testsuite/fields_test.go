@@ -0,0 +1,121 @@
+// Copyright 2019 Fabian Wenzelmann
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package testsuite
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/FabianWe/gopherbouncedb"
+)
+
+func TestUserFields(t *testing.T) {
+	if len(gopherbouncedb.UserFields) != 13 {
+		t.Fatalf("Expected 13 fields, got %d", len(gopherbouncedb.UserFields))
+	}
+	email, err := gopherbouncedb.LookupUserField("email")
+	if err != nil {
+		t.Fatal("Lookup failed:", err)
+	}
+	if email.Name != "EMail" || email.Column != "email" || email.MaxLen != 254 || !email.Updatable ||
+		email.MaxLenVar() != "$EMAIL_MAX_LEN$" || email.Type != reflect.TypeOf("") {
+		t.Errorf("Unexpected field: %+v", email)
+	}
+	if id, _ := gopherbouncedb.LookupUserField("ID"); id.Updatable || id.MaxLenVar() != "" {
+		t.Errorf("Unexpected field: %+v", id)
+	}
+	if lastLogin, _ := gopherbouncedb.LookupUserField("LastLogin"); !lastLogin.Nullable || !lastLogin.IsTime() {
+		t.Errorf("Unexpected field: %+v", lastLogin)
+	}
+	if _, err := gopherbouncedb.LookupUserField("Extensions"); err == nil {
+		t.Error("Expected error for Extensions")
+	}
+	if got := gopherbouncedb.DefaultUserRowNames["PasswordChangedAt"]; got != "password_changed_at" {
+		t.Error("Unexpected default row name:", got)
+	}
+	expectedLimits := &gopherbouncedb.UserSchemaLimits{
+		UsernameMaxLen: 150, PasswordMaxLen: 270, EMailMaxLen: 254, FirstNameMaxLen: 50, LastNameMaxLen: 150,
+	}
+	limits := gopherbouncedb.DefaultUserSchemaLimits()
+	if !reflect.DeepEqual(expectedLimits, limits) {
+		t.Errorf("Expected limits %+v, got %+v", expectedLimits, limits)
+	}
+	limits.FirstNameMaxLen = 20
+	expectedReplacements := map[string]string{
+		"$USERNAME_MAX_LEN$": "150", "$PASSWORD_MAX_LEN$": "270", "$EMAIL_MAX_LEN$": "254",
+		"$FIRST_NAME_MAX_LEN$": "20", "$LAST_NAME_MAX_LEN$": "150",
+	}
+	if got := limits.Replacements(); !reflect.DeepEqual(expectedReplacements, got) {
+		t.Errorf("Expected replacements %v, got %v", expectedReplacements, got)
+	}
+	u := &gopherbouncedb.UserModel{FirstName: "abcdefghijklmnopqrstuvwxyz"}
+	if err := limits.VerifyMaxLens(u); !errors.Is(err, gopherbouncedb.ErrFirstNameTooLong) {
+		t.Error("Expected ErrFirstNameTooLong, got", err)
+	}
+}
+
+func TestSetFieldByName(t *testing.T) {
+	u := &gopherbouncedb.UserModel{}
+	now := time.Now()
+	tests := []struct {
+		name string
+		val  interface{}
+	}{
+		{"username", "foo"},
+		{"IsStaff", true},
+		{"lastlogin", now},
+		{"ID", gopherbouncedb.UserID(42)},
+	}
+	for _, test := range tests {
+		if err := u.SetFieldByName(test.name, test.val); err != nil {
+			t.Errorf("Can't set %s: %s", test.name, err)
+			continue
+		}
+		if got, _ := u.GetFieldByName(test.name); got != test.val {
+			t.Errorf("Expected %v for %s, got %v", test.val, test.name, got)
+		}
+	}
+	if err := u.SetFieldByName("id", 21); err != nil || u.ID != 21 {
+		t.Errorf("Expected id 21, got %d (%v)", u.ID, err)
+	}
+	if err := u.SetFieldByName("IsStaff", "true"); err == nil {
+		t.Error("Expected error for value of wrong type")
+	}
+	if err := u.SetFieldByName("nickname", "foo"); err == nil {
+		t.Error("Expected error for invalid field")
+	}
+}
+
+func TestDiffFields(t *testing.T) {
+	now := time.Now()
+	u := &gopherbouncedb.UserModel{ID: 1, Username: "foo", LastLogin: now}
+	other := u.Copy()
+	other.LastLogin = now.In(time.FixedZone("other", 3600))
+	if diff := u.DiffFields(other); len(diff) != 0 {
+		t.Error("Expected no differences, got", diff)
+	}
+	other.Username = "bar"
+	other.IsActive = true
+	other.PasswordChangedAt = now
+	other.Extensions.SetString("Phone", "123")
+	// the id can't be updated and is not compared
+	other.ID = 2
+	expected := []string{"Username", "IsActive", "PasswordChangedAt"}
+	if diff := u.DiffFields(other); !reflect.DeepEqual(expected, diff) {
+		t.Errorf("Expected differences %v, got %v", expected, diff)
+	}
+}
@@ -0,0 +1,64 @@
+// Copyright 2019 Fabian Wenzelmann
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package testsuite
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/FabianWe/gopherbouncedb"
+)
+
+func TestHashers(t *testing.T) {
+	TestHasherSuite(t)
+}
+
+func TestDjangoHashers(t *testing.T) {
+	TestDjangoHasherSuite(t)
+}
+
+func TestMalformedHashes(t *testing.T) {
+	argon, scrypt, _ := testHashers()
+	django := gopherbouncedb.NewDjangoArgon2Hasher()
+	tests := []struct {
+		hasher gopherbouncedb.PasswordHasher
+		hash   string
+	}{
+		// empty salt or hash
+		{scrypt, "$scrypt$ln=4,r=8,p=1$c2FsdA$"},
+		{scrypt, "$scrypt$ln=4,r=8,p=1$$aGFzaA"},
+		{argon, "$argon2id$v=19$m=64,t=1,p=1$c2FsdA$"},
+		// parameters out of range
+		{scrypt, "$scrypt$ln=0,r=8,p=1$c2FsdA$aGFzaA"},
+		{scrypt, "$scrypt$ln=4,r=0,p=1$c2FsdA$aGFzaA"},
+		{scrypt, "$scrypt$ln=4,r=8,p=0$c2FsdA$aGFzaA"},
+		{scrypt, "$scrypt$ln=40,r=8,p=1$c2FsdA$aGFzaA"},
+		{scrypt, "$scrypt$ln=20,r=1024,p=1$c2FsdA$aGFzaA"},
+		{argon, "$argon2id$v=19$m=64,t=0,p=1$c2FsdA$aGFzaA"},
+		{argon, "$argon2id$v=19$m=64,t=1,p=0$c2FsdA$aGFzaA"},
+		{argon, "$argon2id$v=19$m=4294967295,t=1,p=1$c2FsdA$aGFzaA"},
+		{argon, "$argon2id$v=19$m=64,t=4294967295,p=1$c2FsdA$aGFzaA"},
+		{django, "argon2$argon2i$v=19$m=64,t=0,p=1$c2FsdA$aGFzaA"},
+		{django, "argon2$argon2i$v=19$m=64,t=1,p=0$c2FsdA$aGFzaA"},
+		{django, "argon2$argon2i$v=19$m=64,t=1,p=1$c2FsdA$"},
+		{django, "argon2$argon2id$v=19$m=64,t=1,p=0$c2FsdA$aGFzaA"},
+	}
+	for _, tc := range tests {
+		ok, err := tc.hasher.Verify("anything", tc.hash)
+		if ok || !errors.Is(err, gopherbouncedb.ErrMalformedHash) {
+			t.Errorf("Expected ErrMalformedHash for %s, got %v, %v", tc.hash, ok, err)
+		}
+	}
+}
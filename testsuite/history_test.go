@@ -0,0 +1,73 @@
+// Copyright 2019 Fabian Wenzelmann
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package testsuite
+
+import (
+	"testing"
+
+	"github.com/FabianWe/gopherbouncedb"
+)
+
+// copyingUserStorage works on copies of the users, so the caller doesn't see the
+// password fields the wrapped storage sets in UpdateUser (the memdummy storage
+// returns its own instances).
+type copyingUserStorage struct {
+	gopherbouncedb.UserStorage
+}
+
+func (s copyingUserStorage) GetUser(id gopherbouncedb.UserID) (*gopherbouncedb.UserModel, error) {
+	u, err := s.UserStorage.GetUser(id)
+	if err != nil {
+		return nil, err
+	}
+	res := *u
+	return &res, nil
+}
+
+func (s copyingUserStorage) UpdateUser(id gopherbouncedb.UserID, newCredentials *gopherbouncedb.UserModel, fields []string) error {
+	u := *newCredentials
+	return s.UserStorage.UpdateUser(id, &u, fields)
+}
+
+// TestPasswordHistoryWithoutSideEffects tests that the history doesn't depend on the
+// changes the wrapped storage makes to the updated user.
+func TestPasswordHistoryWithoutSideEffects(t *testing.T) {
+	history := gopherbouncedb.NewMemdummyPasswordHistoryStorage(gopherbouncedb.DefaultPasswordHistorySize)
+	inst := gopherbouncedb.NewPasswordHistoryUserStorage(copyingUserStorage{gopherbouncedb.NewMemdummyUserStorage()}, history)
+	if initErr := inst.InitUsers(); initErr != nil {
+		t.Fatal("Init failed:", initErr)
+	}
+	u := getInsertOK()[0]
+	u.Password = "first"
+	id, insertErr := inst.InsertUser(u)
+	if insertErr != nil {
+		t.Fatal("Insert failed:", insertErr)
+	}
+	stored, getErr := inst.GetUser(id)
+	if getErr != nil {
+		t.Fatal("GetUser failed:", getErr)
+	}
+	stored.Password = "second"
+	if updateErr := inst.UpdateUser(id, stored, []string{"Password"}); updateErr != nil {
+		t.Fatal("Update failed:", updateErr)
+	}
+	entries, historyErr := history.GetPasswordHistory(id)
+	if historyErr != nil {
+		t.Fatal("Get password history failed:", historyErr)
+	}
+	if len(entries) != 2 || entries[0].Password != "second" || entries[1].Password != "first" {
+		t.Errorf("Expected history [second first], got %v", entries)
+	}
+}
@@ -0,0 +1,146 @@
+// Copyright 2019 Fabian Wenzelmann
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package testsuite
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/FabianWe/gopherbouncedb"
+)
+
+// PasswordHistoryTestSuiteBinding is used to create new history storages.
+// BeginInstance must return a storage that stores at most maxEntries per user.
+type PasswordHistoryTestSuiteBinding interface {
+	BeginInstance(maxEntries int) gopherbouncedb.PasswordHistoryStorage
+	CloseInstance(s gopherbouncedb.PasswordHistoryStorage)
+}
+
+// plainComparator compares the "hashes" by equality.
+func plainComparator(candidate, hash string) (bool, error) {
+	return candidate == hash, nil
+}
+
+func TestPasswordHistorySuite(suite PasswordHistoryTestSuiteBinding, t *testing.T) {
+	inst := suite.BeginInstance(3)
+	defer suite.CloseInstance(inst)
+	if initErr := inst.InitPasswordHistory(); initErr != nil {
+		t.Fatal("Init failed:", initErr)
+	}
+	start := parseTime("01-09-2019")
+	for i := 0; i < 5; i++ {
+		entry := &gopherbouncedb.PasswordHistoryEntry{
+			User:      1,
+			Password:  fmt.Sprintf("hash%d", i),
+			ChangedAt: start.Add(time.Duration(i) * 24 * time.Hour),
+		}
+		if insertErr := inst.InsertPasswordHistory(entry); insertErr != nil {
+			t.Fatal("Insert in password history failed:", insertErr)
+		}
+	}
+	other := &gopherbouncedb.PasswordHistoryEntry{User: 2, Password: "other", ChangedAt: start}
+	if insertErr := inst.InsertPasswordHistory(other); insertErr != nil {
+		t.Fatal("Insert in password history failed:", insertErr)
+	}
+	history, getErr := inst.GetPasswordHistory(1)
+	if getErr != nil {
+		t.Fatal("Get password history failed:", getErr)
+	}
+	if len(history) != 3 {
+		t.Fatalf("Expected 3 entries in password history, got %d", len(history))
+	}
+	for i, entry := range history {
+		expected := fmt.Sprintf("hash%d", 4-i)
+		if entry.Password != expected || entry.User != 1 {
+			t.Errorf("Expected entry %d in history to be %s for user 1, got %s for user %d",
+				i, expected, entry.Password, entry.User)
+		}
+		if !compareTime(entry.ChangedAt, start.Add(time.Duration(4-i)*24*time.Hour)) {
+			t.Errorf("Wrong date for entry %d in history: %v", i, entry.ChangedAt)
+		}
+	}
+	// check the comparison
+	if err := gopherbouncedb.CheckPasswordHistory(inst, 1, "hash3", plainComparator); err == nil {
+		t.Error("Expected hash3 to be reused")
+	} else if _, isReused := err.(gopherbouncedb.PasswordReused); !isReused {
+		t.Error("Expected PasswordReused, got error:", err)
+	}
+	if err := gopherbouncedb.CheckPasswordHistory(inst, 1, "hash0", plainComparator); err != nil {
+		t.Error("Expected hash0 to be removed from history, got error:", err)
+	}
+	// delete and check that the other user is still there
+	if delErr := inst.DeletePasswordHistory(1); delErr != nil {
+		t.Fatal("Delete of password history failed:", delErr)
+	}
+	if history, _ := inst.GetPasswordHistory(1); len(history) != 0 {
+		t.Errorf("Expected empty history after delete, got %d entries", len(history))
+	}
+	if history, _ := inst.GetPasswordHistory(2); len(history) != 1 {
+		t.Errorf("Expected one entry for user 2, got %d entries", len(history))
+	}
+}
+
+func TestPasswordHistoryUserStorageSuite(userSuite UserTestSuiteBinding, historySuite PasswordHistoryTestSuiteBinding, t *testing.T) {
+	restoreDefaults()
+	users := userSuite.BeginInstance()
+	defer userSuite.CloseInstance(users)
+	history := historySuite.BeginInstance(gopherbouncedb.DefaultPasswordHistorySize)
+	defer historySuite.CloseInstance(history)
+	inst := gopherbouncedb.NewPasswordHistoryUserStorage(users, history)
+	if initErr := inst.InitUsers(); initErr != nil {
+		t.Fatal("Init failed:", initErr)
+	}
+	u := getInsertOK()[0]
+	u.Password = "first"
+	if _, insertErr := inst.InsertUser(u); insertErr != nil {
+		t.Fatal("Insert failed:", insertErr)
+	}
+	// update without password, then with password
+	u.FirstName = "Bar"
+	if updateErr := inst.UpdateUser(u.ID, u, []string{"FirstName"}); updateErr != nil {
+		t.Fatal("Update failed:", updateErr)
+	}
+	u.Password = "second"
+	if updateErr := inst.UpdateUser(u.ID, u, []string{"Password"}); updateErr != nil {
+		t.Fatal("Update failed:", updateErr)
+	}
+	// same password again must not create a new entry
+	if updateErr := inst.UpdateUser(u.ID, u, nil); updateErr != nil {
+		t.Fatal("Update failed:", updateErr)
+	}
+	// a new hash that keeps PasswordChangedAt must not create a new entry
+	stored, getUserErr := inst.GetUser(u.ID)
+	if getUserErr != nil {
+		t.Fatal("GetUser failed:", getUserErr)
+	}
+	stored.Password = "second-rehashed"
+	if updateErr := inst.UpdateUser(u.ID, stored, []string{"Password", "PasswordChangedAt", "MustChangePassword"}); updateErr != nil {
+		t.Fatal("Update failed:", updateErr)
+	}
+	entries, getErr := history.GetPasswordHistory(u.ID)
+	if getErr != nil {
+		t.Fatal("Get password history failed:", getErr)
+	}
+	if len(entries) != 2 || entries[0].Password != "second" || entries[1].Password != "first" {
+		t.Errorf("Expected history [second first], got %v", entries)
+	}
+	if deleteErr := inst.DeleteUser(u.ID); deleteErr != nil {
+		t.Fatal("Delete failed:", deleteErr)
+	}
+	if entries, _ := history.GetPasswordHistory(u.ID); len(entries) != 0 {
+		t.Errorf("Expected empty history after delete, got %d entries", len(entries))
+	}
+}
@@ -0,0 +1,57 @@
+// Copyright 2019 Fabian Wenzelmann
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package testsuite
+
+import (
+	"testing"
+
+	"github.com/FabianWe/gopherbouncedb"
+)
+
+// insertQueries is a UserSQL that only supports InsertUser.
+type insertQueries struct {
+	gopherbouncedb.UserSQL
+	returnsID bool
+}
+
+func (q insertQueries) InsertUser() string {
+	return "INSERT INTO auth_user VALUES(?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?) RETURNING id;"
+}
+
+func (q insertQueries) InsertReturnsID() bool {
+	return q.returnsID
+}
+
+func TestInsertReturningID(t *testing.T) {
+	db, d := openCountingDB(t)
+	defer db.Close()
+	// the counting driver doesn't support LastInsertId
+	storage := gopherbouncedb.NewSQLUserStorage(db, insertQueries{}, nativeTimeBridge{})
+	_, err := storage.InsertUser(&gopherbouncedb.UserModel{Username: "foo"})
+	if _, notSupported := err.(gopherbouncedb.NotSupported); !notSupported {
+		t.Error("Expected NotSupported, got", err)
+	}
+	// the query returns 42
+	storage = gopherbouncedb.NewSQLUserStorage(db, insertQueries{returnsID: true}, nativeTimeBridge{})
+	u := &gopherbouncedb.UserModel{Username: "foo"}
+	id, err := storage.InsertUser(u)
+	if err != nil {
+		t.Fatal("InsertUser failed:", err)
+	}
+	if id != 42 || u.ID != 42 {
+		t.Errorf("Expected id 42, got %d (user: %d)", id, u.ID)
+	}
+	checkNoLeakedRows(db, d, t)
+}
@@ -0,0 +1,91 @@
+// Copyright 2019 Fabian Wenzelmann
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package testsuite
+
+import (
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/FabianWe/gopherbouncedb"
+)
+
+// nativeTimeBridge is a SQLBridge for drivers that support time.Time.
+type nativeTimeBridge struct{}
+
+func (nativeTimeBridge) TimeScanType() interface{} {
+	return new(time.Time)
+}
+
+func (nativeTimeBridge) ConvertTimeScanType(val interface{}) (time.Time, error) {
+	return *val.(*time.Time), nil
+}
+
+func (nativeTimeBridge) IsDuplicateInsert(err error) bool {
+	return false
+}
+
+func (nativeTimeBridge) IsDuplicateUpdate(err error) bool {
+	return false
+}
+
+func (nativeTimeBridge) ConvertTime(t time.Time) interface{} {
+	return t
+}
+
+// checkNoLeakedRows fails if rows or connections of the database are still in use.
+func checkNoLeakedRows(db *sql.DB, d *countingDriver, t *testing.T) {
+	t.Helper()
+	if d.openRows != 0 {
+		t.Errorf("%d rows not closed", d.openRows)
+	}
+	if inUse := db.Stats().InUse; inUse != 0 {
+		t.Errorf("%d connections still in use", inUse)
+	}
+}
+
+func TestSQLUserIteratorClose(t *testing.T) {
+	db, d := openCountingDB(t)
+	defer db.Close()
+	iterators := []func(rows *sql.Rows) gopherbouncedb.UserIterator{
+		func(rows *sql.Rows) gopherbouncedb.UserIterator {
+			return gopherbouncedb.NewSQLUserIterator(rows, nativeTimeBridge{})
+		},
+		func(rows *sql.Rows) gopherbouncedb.UserIterator {
+			return gopherbouncedb.FilterUsers(gopherbouncedb.NewSQLUserIterator(rows, nativeTimeBridge{}),
+				func(*gopherbouncedb.UserModel) bool { return true })
+		},
+	}
+	for _, newIt := range iterators {
+		rows, err := db.Query(stmtQuery3, "foo")
+		if err != nil {
+			t.Fatal("Query failed:", err)
+		}
+		if err := newIt(rows).Close(); err != nil {
+			t.Error("Close failed:", err)
+		}
+		checkNoLeakedRows(db, d, t)
+	}
+	// scanning fails because the number of columns doesn't match, the rows must be
+	// closed anyway
+	rows, err := db.Query(stmtQuery3, "foo")
+	if err != nil {
+		t.Fatal("Query failed:", err)
+	}
+	if _, err := gopherbouncedb.AsUsersSlice(gopherbouncedb.NewSQLUserIterator(rows, nativeTimeBridge{})); err == nil {
+		t.Error("Expected scan error")
+	}
+	checkNoLeakedRows(db, d, t)
+}
@@ -0,0 +1,88 @@
+// Copyright 2019 Fabian Wenzelmann
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package testsuite
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/FabianWe/gopherbouncedb"
+)
+
+// testLifecycle tests the lifecycle methods of an initialized storage, the storage
+// is closed afterwards.
+func testLifecycle(storage interface{}, t *testing.T) {
+	l, ok := storage.(gopherbouncedb.StorageLifecycle)
+	if !ok {
+		t.Fatalf("Storage of type %T doesn't implement StorageLifecycle", storage)
+	}
+	ctx := context.Background()
+	if err := l.Ping(ctx); err != nil {
+		t.Error("Ping failed:", err)
+	}
+	if err := l.Ready(ctx); err != nil {
+		t.Error("Storage not ready:", err)
+	}
+	if err := l.Close(); err != nil {
+		t.Error("Close failed:", err)
+	}
+	if err := l.Close(); err != nil {
+		t.Error("Second Close failed:", err)
+	}
+	if err := l.Ping(ctx); !errors.Is(err, gopherbouncedb.ErrStorageClosed) {
+		t.Error("Expected ErrStorageClosed from Ping after Close, got", err)
+	}
+	err := l.Ready(ctx)
+	if _, notReady := err.(gopherbouncedb.NotReady); !notReady {
+		t.Error("Expected NotReady after Close, got", err)
+	}
+}
+
+func TestUserLifecycleSuite(suite UserTestSuiteBinding, t *testing.T) {
+	inst := suite.BeginInstance()
+	defer suite.CloseInstance(inst)
+	if initErr := inst.InitUsers(); initErr != nil {
+		t.Fatal("Init failed:", initErr)
+	}
+	testLifecycle(inst, t)
+}
+
+func TestSessionLifecycleSuite(suite SessionTestSuiteBinding, t *testing.T) {
+	inst := suite.BeginInstance()
+	defer suite.CloseInstance(inst)
+	if initErr := inst.InitSessions(); initErr != nil {
+		t.Fatal("Init failed:", initErr)
+	}
+	testLifecycle(inst, t)
+}
+
+func TestStorageLifecycleSuite(userSuite UserTestSuiteBinding, sessionSuite SessionTestSuiteBinding, t *testing.T) {
+	users := userSuite.BeginInstance()
+	defer userSuite.CloseInstance(users)
+	sessions := sessionSuite.BeginInstance()
+	defer sessionSuite.CloseInstance(sessions)
+	if initErr := users.InitUsers(); initErr != nil {
+		t.Fatal("Init failed:", initErr)
+	}
+	if initErr := sessions.InitSessions(); initErr != nil {
+		t.Fatal("Init failed:", initErr)
+	}
+	testLifecycle(gopherbouncedb.NewStorage(users, sessions), t)
+	// both storages must be closed
+	if err := sessions.(gopherbouncedb.StorageLifecycle).Ping(context.Background()); err == nil {
+		t.Error("Session storage not closed")
+	}
+}
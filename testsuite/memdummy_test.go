@@ -49,6 +49,26 @@ func TestMemdummyDelete(t *testing.T) {
 	TestDeleteUserSuite(memdummyUserTestBinding{}, true, t)
 }
 
+func TestMemdummyExtraColumns(t *testing.T) {
+	TestExtraColumnsSuite(memdummyUserTestBinding{}, t)
+}
+
+func TestMemdummyTypedUsers(t *testing.T) {
+	TestTypedUserSuite(memdummyUserTestBinding{}, t)
+}
+
+func TestMemdummyPasswordExpiry(t *testing.T) {
+	TestPasswordExpirySuite(memdummyUserTestBinding{}, t)
+}
+
+func TestMemdummyAuthenticator(t *testing.T) {
+	TestAuthenticatorSuite(memdummyUserTestBinding{}, t)
+}
+
+func TestMemdummyDjangoAuthenticator(t *testing.T) {
+	TestDjangoAuthenticatorSuite(memdummyUserTestBinding{}, t)
+}
+
 type memdummySessionTestBinding struct{}
 
 func (b memdummySessionTestBinding) BeginInstance() gopherbouncedb.SessionStorage {
@@ -59,6 +79,34 @@ func (b memdummySessionTestBinding) CloseInstance(s gopherbouncedb.SessionStorag
 
 }
 
+func TestMemdummyDjangoImport(t *testing.T) {
+	TestDjangoImportSuite(memdummyUserTestBinding{}, memdummySessionTestBinding{}, t)
+}
+
+func TestMemdummyExportImport(t *testing.T) {
+	TestExportImportSuite(memdummyUserTestBinding{}, t)
+}
+
+func TestMemdummyImportConflict(t *testing.T) {
+	TestImportConflictSuite(memdummyUserTestBinding{}, t)
+}
+
+func TestMemdummyBatch(t *testing.T) {
+	TestBatchUserSuite(memdummyUserTestBinding{}, true, t)
+}
+
+func TestMemdummyUserLifecycle(t *testing.T) {
+	TestUserLifecycleSuite(memdummyUserTestBinding{}, t)
+}
+
+func TestMemdummyStorageLifecycle(t *testing.T) {
+	TestStorageLifecycleSuite(memdummyUserTestBinding{}, memdummySessionTestBinding{}, t)
+}
+
+func TestMemdummyStream(t *testing.T) {
+	TestStreamSuite(memdummyUserTestBinding{}, t)
+}
+
 func TestInitSessionMemdummy(t *testing.T) {
 	TestInitSessionSuite(memdummySessionTestBinding{}, t)
 }
@@ -82,3 +130,41 @@ func TestCleanUpSessionMemdummy(t *testing.T) {
 func TestDeleteForUserMemdummy(t *testing.T) {
 	TestSessionDeleteForUser(memdummySessionTestBinding{}, t)
 }
+
+type memdummyHistoryTestBinding struct{}
+
+func (b memdummyHistoryTestBinding) BeginInstance(maxEntries int) gopherbouncedb.PasswordHistoryStorage {
+	return gopherbouncedb.NewMemdummyPasswordHistoryStorage(maxEntries)
+}
+
+func (b memdummyHistoryTestBinding) CloseInstance(s gopherbouncedb.PasswordHistoryStorage) {
+
+}
+
+func TestPasswordHistoryMemdummy(t *testing.T) {
+	TestPasswordHistorySuite(memdummyHistoryTestBinding{}, t)
+}
+
+func TestPasswordHistoryUserStorageMemdummy(t *testing.T) {
+	TestPasswordHistoryUserStorageSuite(memdummyUserTestBinding{}, memdummyHistoryTestBinding{}, t)
+}
+
+func TestMemdummySessionBatch(t *testing.T) {
+	TestBatchSessionSuite(memdummySessionTestBinding{}, t)
+}
+
+func TestMemdummySessionLifecycle(t *testing.T) {
+	TestSessionLifecycleSuite(memdummySessionTestBinding{}, t)
+}
+
+type memdummyAttributeTestBinding struct{}
+
+func (b memdummyAttributeTestBinding) BeginInstance() gopherbouncedb.UserAttributeStorage {
+	return gopherbouncedb.NewMemdummyUserAttributeStorage()
+}
+
+func (b memdummyAttributeTestBinding) CloseInstance(s gopherbouncedb.UserAttributeStorage) {}
+
+func TestMemdummyUserAttributes(t *testing.T) {
+	TestUserAttributeSuite(memdummyAttributeTestBinding{}, t)
+}
@@ -0,0 +1,216 @@
+// Copyright 2019 Fabian Wenzelmann
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package testsuite
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/FabianWe/gopherbouncedb"
+)
+
+// violationCodes returns the codes of all violated rules, nil if err is nil.
+func violationCodes(t *testing.T, err error) []string {
+	if err == nil {
+		return nil
+	}
+	var violations gopherbouncedb.PasswordPolicyErr
+	if !errors.As(err, &violations) {
+		t.Fatalf("Expected PasswordPolicyErr, got %v", err)
+	}
+	res := make([]string, len(violations))
+	for i, violation := range violations {
+		res[i] = violation.Code
+	}
+	return res
+}
+
+func TestPasswordPolicyRules(t *testing.T) {
+	policy := &gopherbouncedb.PasswordPolicy{
+		Name:               "test",
+		MinLength:          8,
+		MaxLength:          12,
+		RequiredClasses:    []string{"digit"},
+		Classes:            []string{"lower", "upper", "digit", "special"},
+		MinClasses:         3,
+		MaxRepeated:        2,
+		ForbiddenSequences: []string{"1234", "qwert"},
+		ForbidUserInfo:     true,
+	}
+	u := &gopherbouncedb.UserModel{
+		Username:  "gopher",
+		EMail:     "alice@example.com",
+		FirstName: "Al",
+		LastName:  "Smith",
+	}
+	tests := []struct {
+		pw       string
+		u        *gopherbouncedb.UserModel
+		expected []string
+	}{
+		{"Valid1!x", u, nil},
+		{"Ab1!xyz", u, []string{"min_length"}},
+		{"Ab1!xyzwvutsr", u, []string{"max_length"}},
+		{"Abc!xyzw", u, []string{"required_classes"}},
+		{"abc1xyzw", u, []string{"min_classes"}},
+		{"Ab1!xxyw", u, nil},
+		{"Ab1!xxxw", u, []string{"max_repeated"}},
+		{"Ab!1234x", u, []string{"forbidden_sequences"}},
+		{"QWERT1!x", u, []string{"forbidden_sequences"}},
+		{"Gopher1!", u, []string{"user_info"}},
+		{"Smith12!", u, []string{"user_info"}},
+		{"xAlice1!", u, []string{"user_info"}},
+		// the first name is too short to be tested
+		{"Al#Al1xy", u, nil},
+		// without a user the user information is not tested
+		{"Gopher1!", nil, nil},
+		// all violations are reported in one error
+		{"aaa", u, []string{"min_length", "required_classes", "min_classes", "max_repeated"}},
+	}
+	for _, tc := range tests {
+		codes := violationCodes(t, policy.Check(tc.pw, tc.u))
+		if !reflect.DeepEqual(codes, tc.expected) {
+			t.Errorf("Check(%q): expected violations %v, got %v", tc.pw, tc.expected, codes)
+		}
+	}
+	err := policy.Check("aaa", u)
+	var violations gopherbouncedb.PasswordPolicyErr
+	if !errors.As(err, &violations) {
+		t.Fatalf("Expected PasswordPolicyErr, got %v", err)
+	}
+	if messages := violations.Messages(); len(messages) != 4 ||
+		messages[0] != "password must be at least 8 characters long" {
+		t.Errorf("Unexpected messages: %v", messages)
+	}
+	verifier := policy.Verifier()
+	if !verifier("Gopher1!") || verifier("aaa") {
+		t.Error("Verifier doesn't match Check")
+	}
+}
+
+func TestPasswordPolicyMaxRepeated(t *testing.T) {
+	verifier := gopherbouncedb.PWMaxRepeated(2)
+	tests := []struct {
+		pw       string
+		expected bool
+	}{
+		{"", true},
+		{"aabbaa", true},
+		{"abaaa", false},
+		{"ääxä", true},
+		{"äää", false},
+		{"aAa", true},
+	}
+	for _, tc := range tests {
+		if got := verifier(tc.pw); got != tc.expected {
+			t.Errorf("PWMaxRepeated(2)(%q): expected %v, got %v", tc.pw, tc.expected, got)
+		}
+	}
+}
+
+func TestPasswordPolicyForbiddenSequences(t *testing.T) {
+	verifier := gopherbouncedb.PWForbiddenSequences([]string{"ABC", "", "pass"})
+	tests := []struct {
+		pw       string
+		expected bool
+	}{
+		{"xyz", true},
+		{"xabcx", false},
+		{"xAbCx", false},
+		{"PASSword", false},
+		{"pas-s", true},
+	}
+	for _, tc := range tests {
+		if got := verifier(tc.pw); got != tc.expected {
+			t.Errorf("PWForbiddenSequences(%q): expected %v, got %v", tc.pw, tc.expected, got)
+		}
+	}
+}
+
+func TestPasswordPolicyMinStrength(t *testing.T) {
+	policy := &gopherbouncedb.PasswordPolicy{MinStrength: 3}
+	if codes := violationCodes(t, policy.Check("password", nil)); !reflect.DeepEqual(codes, []string{"min_strength"}) {
+		t.Errorf("Expected min_strength violation, got %v", codes)
+	}
+	if err := policy.Check("correcthorsebatterystaple", nil); err != nil {
+		t.Error("Expected strong password, got", err)
+	}
+}
+
+func TestPasswordPolicyExtra(t *testing.T) {
+	policy := &gopherbouncedb.PasswordPolicy{MinLength: 4}
+	policy.Extra = append(policy.Extra, gopherbouncedb.NewPasswordRule("no_foo", "password must not contain foo",
+		func(pw string) bool {
+			return !strings.Contains(pw, "foo")
+		}))
+	if codes := violationCodes(t, policy.Check("foo", nil)); !reflect.DeepEqual(codes, []string{"min_length", "no_foo"}) {
+		t.Errorf("Expected violations [min_length no_foo], got %v", codes)
+	}
+}
+
+func TestPasswordPolicyValidate(t *testing.T) {
+	invalid := []*gopherbouncedb.PasswordPolicy{
+		{RequiredClasses: []string{"emoji"}},
+		{Classes: []string{"lower", "emoji"}},
+		{Classes: []string{"lower"}, MinClasses: 2},
+		{MinStrength: 5},
+		{MinLength: 10, MaxLength: 8},
+	}
+	for _, policy := range invalid {
+		if err := policy.Validate(); err == nil {
+			t.Errorf("Expected error for policy %+v", policy)
+		}
+		if err := policy.Check("Valid1!x", nil); err == nil {
+			t.Errorf("Expected error from Check for policy %+v", policy)
+		}
+	}
+	if err := gopherbouncedb.DefaultPasswordPolicy().Validate(); err != nil {
+		t.Error("Default policy is not valid:", err)
+	}
+}
+
+func TestPasswordPolicyJSON(t *testing.T) {
+	policy := gopherbouncedb.DefaultPasswordPolicy()
+	policy.RequiredClasses = []string{"digit"}
+	policy.MinStrength = 2
+	var buf bytes.Buffer
+	if err := policy.WriteJSON(&buf); err != nil {
+		t.Fatal("WriteJSON failed:", err)
+	}
+	loaded, loadErr := gopherbouncedb.LoadPasswordPolicy(&buf)
+	if loadErr != nil {
+		t.Fatal("LoadPasswordPolicy failed:", loadErr)
+	}
+	if !reflect.DeepEqual(policy, loaded) {
+		t.Errorf("Policy changed in round trip: expected %+v, got %+v", policy, loaded)
+	}
+	invalid := []string{
+		// unknown rule
+		`{"name": "test", "min_length": 8, "min_entropy": 40}`,
+		// unknown class
+		`{"name": "test", "required_classes": ["emoji"]}`,
+		// inconsistent policy
+		`{"name": "test", "min_length": 10, "max_length": 8}`,
+		`{"name": "test", "min_length": "eight"}`,
+	}
+	for _, data := range invalid {
+		if _, err := gopherbouncedb.LoadPasswordPolicy(strings.NewReader(data)); err == nil {
+			t.Errorf("Expected error when loading %s", data)
+		}
+	}
+}
@@ -0,0 +1,81 @@
+// Copyright 2019 Fabian Wenzelmann
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build go1.23
+
+package testsuite
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/FabianWe/gopherbouncedb"
+)
+
+func TestSeqSuite(suite UserTestSuiteBinding, t *testing.T) {
+	restoreDefaults()
+	inst := suite.BeginInstance()
+	defer suite.CloseInstance(inst)
+	if initErr := inst.InitUsers(); initErr != nil {
+		t.Fatal("Init failed:", initErr)
+	}
+	insertSuccess(inst, t)
+	names := make(map[string]bool)
+	for u, err := range gopherbouncedb.AllUsers(inst) {
+		if err != nil {
+			t.Fatal("Iteration failed:", err)
+		}
+		names[u.Username] = true
+	}
+	for _, u := range getInsertOK() {
+		if !names[u.Username] {
+			t.Errorf("User %s not returned by AllUsers", u.Username)
+		}
+	}
+
+	// break closes the iterator
+	it := listUsers(inst, nil, t)
+	for range gopherbouncedb.UsersSeq(it) {
+		break
+	}
+	if !it.closed {
+		t.Error("Iterator not closed after break")
+	}
+	errTest := errors.New("test error")
+	var lastErr error
+	for _, err := range gopherbouncedb.UsersSeq(listUsers(inst, errTest, t)) {
+		lastErr = err
+	}
+	if lastErr != errTest {
+		t.Error("Expected test error, got", lastErr)
+	}
+
+	// adapter to UserIterator
+	slice, sliceErr := gopherbouncedb.AsUsersSlice(gopherbouncedb.SeqUserIterator(gopherbouncedb.AllUsers(inst)))
+	if sliceErr != nil || len(slice) != 3 {
+		t.Errorf("Expected 3 users from seq iterator, got %d: %v", len(slice), sliceErr)
+	}
+	_, sliceErr = gopherbouncedb.AsUsersSlice(
+		gopherbouncedb.SeqUserIterator(gopherbouncedb.UsersSeq(listUsers(inst, errTest, t))))
+	if sliceErr != errTest {
+		t.Error("Expected test error from seq iterator, got", sliceErr)
+	}
+	it = listUsers(inst, nil, t)
+	seqIt := gopherbouncedb.SeqUserIterator(gopherbouncedb.UsersSeq(it))
+	seqIt.HasNext()
+	seqIt.Close()
+	if !it.closed {
+		t.Error("Iterator not closed after closing the seq iterator")
+	}
+}
@@ -0,0 +1,164 @@
+// Copyright 2019 Fabian Wenzelmann
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+
+package testsuite
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/FabianWe/gopherbouncedb"
+)
+
+func TestGenerateUserSQL(t *testing.T) {
+	replacer := gopherbouncedb.DefaultSQLReplacer()
+	q, err := gopherbouncedb.GenerateUserSQL(gopherbouncedb.NewPostgresDialect(),
+		gopherbouncedb.DefaultUserRowNames, replacer)
+	if err != nil {
+		t.Fatal("GenerateUserSQL failed:", err)
+	}
+	expected := `UPDATE auth_user SET "last_name"=$1, "email"=$2 WHERE "id"=$3;`
+	if got := q.UpdateUser([]string{"LastName", "email"}); got != expected {
+		t.Errorf("Expected %q, got %q", expected, got)
+	}
+	if got := q.UpdateUser(nil); !strings.HasSuffix(got, `"must_change_password"=$12 WHERE "id"=$13;`) {
+		t.Error("Unexpected update of all fields:", got)
+	}
+	if !q.InsertReturnsID() || !strings.HasSuffix(q.InsertUser(), `VALUES($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12) RETURNING "id";`) {
+		t.Error("Unexpected insert query:", q.InsertUser())
+	}
+	if got := q.GetUserByEmail(); !strings.HasPrefix(got, `SELECT "id", "username", "password", "email",`) ||
+		!strings.HasSuffix(got, `FROM auth_user WHERE "email"=$1;`) {
+		t.Error("Unexpected select query:", got)
+	}
+	if len(q.InitUsers()) != 2 || !strings.Contains(q.InitUsers()[0], `"email" VARCHAR(254) NOT NULL UNIQUE`) {
+		t.Errorf("Unexpected init queries: %v", q.InitUsers())
+	}
+	if got := q.AllowNullLastLogin(); len(got) != 1 || got[0] != `ALTER TABLE auth_user ALTER COLUMN "last_login" DROP NOT NULL;` {
+		t.Errorf("Unexpected migration: %v", got)
+	}
+	if got := q.ClearLastLoginSentinel(); got != `UPDATE auth_user SET "last_login"=NULL WHERE "last_login"=$1;` {
+		t.Error("Unexpected sentinel query:", got)
+	}
+
+	// mysql with custom columns and a non-unique email
+	rowNames := make(map[string]string)
+	for field, row := range gopherbouncedb.DefaultUserRowNames {
+		rowNames[field] = row
+	}
+	rowNames["EMail"] = "mail"
+	replacer = gopherbouncedb.DefaultSQLReplacer()
+	replacer.Set("$EMAIL_UNIQUE$", "")
+	q, err = gopherbouncedb.GenerateUserSQL(gopherbouncedb.NewMySQLDialect(), rowNames, replacer)
+	if err != nil {
+		t.Fatal("GenerateUserSQL failed:", err)
+	}
+	expected = "UPDATE auth_user SET `mail`=? WHERE `id`=?;"
+	if got := q.UpdateUser([]string{"EMail"}); got != expected {
+		t.Errorf("Expected %q, got %q", expected, got)
+	}
+	if q.InsertReturnsID() || len(q.InitUsers()) != 1 ||
+		!strings.Contains(q.InitUsers()[0], "KEY auth_user_email_idx (`mail`)") ||
+		!strings.HasSuffix(q.InitUsers()[0], "utf8mb4_bin;") {
+		t.Errorf("Unexpected init queries: %v", q.InitUsers())
+	}
+	if got := q.AllowNullLastLogin(); len(got) != 1 || got[0] != "ALTER TABLE auth_user MODIFY `last_login` DATETIME(6) NULL;" {
+		t.Errorf("Unexpected migration: %v", got)
+	}
+	delete(rowNames, "LastLogin")
+	if _, err := gopherbouncedb.GenerateUserSQL(gopherbouncedb.NewMySQLDialect(), rowNames, replacer); err == nil {
+		t.Error("Expected error for missing column")
+	}
+}
+
+func TestGenerateSessionSQL(t *testing.T) {
+	tests := []struct {
+		dialect *gopherbouncedb.SQLDialect
+		upsert  string
+	}{
+		{gopherbouncedb.NewPostgresDialect(),
+			`INSERT INTO auth_session("session_key", "user", "expire_date") VALUES($1, $2, $3) ON CONFLICT ("session_key") DO UPDATE SET "user"=EXCLUDED."user", "expire_date"=EXCLUDED."expire_date";`},
+		{gopherbouncedb.NewMySQLDialect(),
+			"INSERT INTO auth_session(`session_key`, `user`, `expire_date`) VALUES(?, ?, ?) ON DUPLICATE KEY UPDATE `user`=VALUES(`user`), `expire_date`=VALUES(`expire_date`);"},
+		{&gopherbouncedb.SQLDialect{Placeholder: gopherbouncedb.AtPlaceholder, VarcharType: "NVARCHAR"}, ""},
+	}
+	for _, test := range tests {
+		q, err := gopherbouncedb.GenerateSessionSQL(test.dialect, gopherbouncedb.DefaultSessionRowNames,
+			gopherbouncedb.DefaultSQLReplacer())
+		if err != nil {
+			t.Fatal("GenerateSessionSQL failed:", err)
+		}
+		if got := q.UpsertSession(); got != test.upsert {
+			t.Errorf("Expected upsert %q, got %q", test.upsert, got)
+		}
+	}
+	q, _ := gopherbouncedb.GenerateSessionSQL(tests[2].dialect, gopherbouncedb.DefaultSessionRowNames,
+		gopherbouncedb.DefaultSQLReplacer())
+	if expected := "DELETE FROM auth_session WHERE expire_date < @p1;"; q.CleanUpSession() != expected {
+		t.Errorf("Expected %q, got %q", expected, q.CleanUpSession())
+	}
+}
+
+func TestGenerateMappedUserSQL(t *testing.T) {
+	mapping := &gopherbouncedb.SQLTableMapping{
+		Schema:   "auth",
+		Table:    "accounts",
+		RowNames: map[string]string{"Username": "login"},
+	}
+	extra := []gopherbouncedb.ExtraColumn{{Name: "Phone", Type: gopherbouncedb.ExtraString}}
+	q, err := gopherbouncedb.GenerateMappedUserSQL(gopherbouncedb.NewPostgresDialect(), mapping, extra,
+		gopherbouncedb.DefaultSQLReplacer())
+	if err != nil {
+		t.Fatal("GenerateMappedUserSQL failed:", err)
+	}
+	if got := q.GetUserByName(); !strings.HasSuffix(got, `"must_change_password", "Phone" FROM auth.accounts WHERE "login"=$1;`) {
+		t.Error("Unexpected select query:", got)
+	}
+	if got := q.UpdateUser([]string{"phone"}); got != `UPDATE auth.accounts SET "Phone"=$1 WHERE "id"=$2;` {
+		t.Error("Unexpected update query:", got)
+	}
+	if got := q.UpdateUser(nil); !strings.HasSuffix(got, `"must_change_password"=$12, "Phone"=$13 WHERE "id"=$14;`) {
+		t.Error("Unexpected update of all fields:", got)
+	}
+	init := q.InitUsers()
+	if len(init) != 2 || !strings.HasPrefix(init[0], "CREATE TABLE IF NOT EXISTS auth.accounts (") ||
+		!strings.Contains(init[0], `"Phone" VARCHAR(255)`) ||
+		init[1] != `CREATE INDEX IF NOT EXISTS accounts_password_changed_at_idx ON auth.accounts("password_changed_at");` {
+		t.Errorf("Unexpected init queries: %v", init)
+	}
+	// SQLite qualifies the index name
+	q, err = gopherbouncedb.GenerateMappedUserSQL(gopherbouncedb.NewSQLiteDialect(), mapping, nil,
+		gopherbouncedb.DefaultSQLReplacer())
+	if err != nil {
+		t.Fatal("GenerateMappedUserSQL failed:", err)
+	}
+	if init := q.InitUsers(); init[1] != `CREATE INDEX IF NOT EXISTS auth.accounts_password_changed_at_idx ON accounts("password_changed_at");` {
+		t.Error("Unexpected index:", init[1])
+	}
+	invalid := [][]gopherbouncedb.ExtraColumn{
+		{{Name: "EMail", Column: "mail"}},
+		// field names are case insensitive
+		{{Name: "email", Column: "alt_mail"}},
+		{{Name: ""}},
+		{{Name: "Phone"}, {Name: "phone", Column: "other_phone"}},
+		{{Name: "Phone"}, {Name: "Mobile", Column: "phone"}},
+	}
+	for _, extra := range invalid {
+		if _, err := gopherbouncedb.GenerateMappedUserSQL(gopherbouncedb.NewSQLiteDialect(), mapping, extra,
+			gopherbouncedb.DefaultSQLReplacer()); err == nil {
+			t.Errorf("Expected error for extra columns %v", extra)
+		}
+	}
+}
@@ -0,0 +1,332 @@
+// Copyright 2019 Fabian Wenzelmann
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package testsuite
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/FabianWe/gopherbouncedb"
+)
+
+// countingDriver is a minimal driver that counts the prepared and closed statements
+// and the open rows.
+// Prepare tokenizes the query to simulate the parsing done by a real driver.
+// If blockQuery is set Prepare of this query sends to blocked and waits until
+// unblock is closed (until then, later prepares don't block).
+type countingDriver struct {
+	prepares, closes, openRows int64
+	blockQuery                 string
+	blocked, unblock           chan struct{}
+}
+
+func (d *countingDriver) Open(name string) (driver.Conn, error) {
+	return &countingConn{d: d}, nil
+}
+
+type countingConn struct {
+	d *countingDriver
+}
+
+func (c *countingConn) Prepare(query string) (driver.Stmt, error) {
+	atomic.AddInt64(&c.d.prepares, 1)
+	if query == c.d.blockQuery {
+		select {
+		case <-c.d.unblock:
+		default:
+			c.d.blocked <- struct{}{}
+			<-c.d.unblock
+		}
+	}
+	tokens := make(map[string]int)
+	for _, token := range strings.FieldsFunc(query, func(r rune) bool {
+		return r == ' ' || r == ',' || r == '(' || r == ')' || r == '='
+	}) {
+		tokens[strings.ToLower(token)]++
+	}
+	if len(tokens) == 0 {
+		return nil, fmt.Errorf("empty query")
+	}
+	return &countingStmt{d: c.d, numInput: strings.Count(query, "?")}, nil
+}
+
+func (c *countingConn) Close() error {
+	return nil
+}
+
+func (c *countingConn) Begin() (driver.Tx, error) {
+	return nil, driver.ErrSkip
+}
+
+type countingStmt struct {
+	d        *countingDriver
+	numInput int
+}
+
+func (s *countingStmt) Close() error {
+	atomic.AddInt64(&s.d.closes, 1)
+	return nil
+}
+
+func (s *countingStmt) NumInput() int {
+	return s.numInput
+}
+
+func (s *countingStmt) Exec(args []driver.Value) (driver.Result, error) {
+	return driver.RowsAffected(1), nil
+}
+
+func (s *countingStmt) Query(args []driver.Value) (driver.Rows, error) {
+	atomic.AddInt64(&s.d.openRows, 1)
+	return &countingRows{d: s.d}, nil
+}
+
+// countingRows returns a single row with the value 42.
+type countingRows struct {
+	d    *countingDriver
+	done bool
+}
+
+func (r *countingRows) Columns() []string {
+	return []string{"value"}
+}
+
+func (r *countingRows) Close() error {
+	atomic.AddInt64(&r.d.openRows, -1)
+	return nil
+}
+
+func (r *countingRows) Next(dest []driver.Value) error {
+	if r.done {
+		return io.EOF
+	}
+	r.done = true
+	dest[0] = int64(42)
+	return nil
+}
+
+var driverCount int64
+
+// openCountingDB registers a new counting driver and opens a database with it.
+func openCountingDB(t testing.TB) (*sql.DB, *countingDriver) {
+	d := &countingDriver{}
+	name := fmt.Sprintf("gopherbouncedb-counting-%d", atomic.AddInt64(&driverCount, 1))
+	sql.Register(name, d)
+	db, err := sql.Open(name, "")
+	if err != nil {
+		t.Fatal("Can't open database:", err)
+	}
+	db.SetMaxOpenConns(1)
+	return db, d
+}
+
+const (
+	stmtQuery1 = "UPDATE auth_user SET username=? WHERE id=?;"
+	stmtQuery2 = "UPDATE auth_user SET email=? WHERE id=?;"
+	stmtQuery3 = "SELECT id FROM auth_user WHERE username=?;"
+)
+
+func TestStmtCache(t *testing.T) {
+	db, d := openCountingDB(t)
+	defer db.Close()
+	cache := gopherbouncedb.NewStmtCache(db, 2)
+	for i := 0; i < 3; i++ {
+		if _, err := cache.Exec(stmtQuery1, "foo", 1); err != nil {
+			t.Fatal("Exec failed:", err)
+		}
+	}
+	if d.prepares != 1 {
+		t.Errorf("Expected 1 prepare, got %d", d.prepares)
+	}
+	var value int
+	if err := cache.QueryRow(stmtQuery3, "foo").Scan(&value); err != nil || value != 42 {
+		t.Errorf("QueryRow returned %d, %v", value, err)
+	}
+	// the cache is bounded, stmtQuery1 is removed
+	if _, err := cache.Exec(stmtQuery2, "foo", 1); err != nil {
+		t.Fatal("Exec failed:", err)
+	}
+	if cache.Len() != 2 || d.closes != 1 {
+		t.Errorf("Expected 2 cached and 1 closed statement, got %d and %d", cache.Len(), d.closes)
+	}
+	if err := cache.Close(); err != nil {
+		t.Error("Close failed:", err)
+	}
+	if cache.Len() != 0 || d.closes != d.prepares {
+		t.Errorf("Expected all statements closed, got %d cached and %d of %d closed",
+			cache.Len(), d.closes, d.prepares)
+	}
+}
+
+// TestStmtCacheConcurrent tests that a statement removed from the cache is not closed
+// while another goroutine executes it.
+func TestStmtCacheConcurrent(t *testing.T) {
+	db, d := openCountingDB(t)
+	defer db.Close()
+	db.SetMaxOpenConns(4)
+	cache := gopherbouncedb.NewStmtCache(db, 1)
+	var wg sync.WaitGroup
+	errs := make(chan error, 8)
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 200; j++ {
+				var err error
+				switch (i + j) % 3 {
+				case 0:
+					_, err = cache.Exec(stmtQuery1, "foo", 1)
+				case 1:
+					_, err = cache.Exec(stmtQuery2, "foo", 1)
+				default:
+					var value int
+					err = cache.QueryRow(stmtQuery3, "foo").Scan(&value)
+				}
+				if err != nil {
+					errs <- err
+					return
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error("Execution failed:", err)
+	}
+	if err := cache.Close(); err != nil {
+		t.Error("Close failed:", err)
+	}
+	if prepares, closes := atomic.LoadInt64(&d.prepares), atomic.LoadInt64(&d.closes); closes != prepares {
+		t.Errorf("Expected all statements closed, got %d of %d closed", closes, prepares)
+	}
+}
+
+// TestStmtCachePrepareUnlocked tests that preparing a statement doesn't block other
+// queries and that only one statement is cached if a query is prepared concurrently.
+func TestStmtCachePrepareUnlocked(t *testing.T) {
+	db, d := openCountingDB(t)
+	defer db.Close()
+	db.SetMaxOpenConns(4)
+	d.blockQuery, d.blocked, d.unblock = stmtQuery2, make(chan struct{}), make(chan struct{})
+	cache := gopherbouncedb.NewStmtCache(db, gopherbouncedb.DefaultStmtCacheSize)
+	var wg sync.WaitGroup
+	errs := make(chan error, 2)
+	for i := 0; i < 2; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := cache.Exec(stmtQuery2, "foo", 1)
+			errs <- err
+		}()
+	}
+	// both goroutines prepare the query at the same time
+	for i := 0; i < 2; i++ {
+		select {
+		case <-d.blocked:
+		case <-time.After(5 * time.Second):
+			close(d.unblock)
+			t.Fatal("Prepare blocked by a running prepare")
+		}
+	}
+	done := make(chan error)
+	go func() {
+		_, err := cache.Exec(stmtQuery1, "foo", 1)
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Error("Exec failed:", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Exec blocked by a running prepare")
+	}
+	close(d.unblock)
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Error("Exec failed:", err)
+		}
+	}
+	if cache.Len() != 2 {
+		t.Errorf("Expected 2 cached statements, got %d", cache.Len())
+	}
+	// the duplicate statement is closed as well
+	if err := cache.Close(); err != nil {
+		t.Error("Close failed:", err)
+	}
+	if prepares, closes := atomic.LoadInt64(&d.prepares), atomic.LoadInt64(&d.closes); closes != prepares {
+		t.Errorf("Expected all statements closed, got %d of %d closed", closes, prepares)
+	}
+}
+
+func BenchmarkExecDirect(b *testing.B) {
+	db, _ := openCountingDB(b)
+	defer db.Close()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := db.Exec(stmtQuery1, "foo", i); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkExecStmtCache(b *testing.B) {
+	db, _ := openCountingDB(b)
+	defer db.Close()
+	cache := gopherbouncedb.NewStmtCache(db, gopherbouncedb.DefaultStmtCacheSize)
+	defer cache.Close()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := cache.Exec(stmtQuery1, "foo", i); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkQueryRowDirect(b *testing.B) {
+	db, _ := openCountingDB(b)
+	defer db.Close()
+	var value int
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := db.QueryRow(stmtQuery3, "foo").Scan(&value); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkQueryRowStmtCache(b *testing.B) {
+	db, _ := openCountingDB(b)
+	defer db.Close()
+	cache := gopherbouncedb.NewStmtCache(db, gopherbouncedb.DefaultStmtCacheSize)
+	defer cache.Close()
+	var value int
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := cache.QueryRow(stmtQuery3, "foo").Scan(&value); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,122 @@
+// Copyright 2019 Fabian Wenzelmann
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package testsuite
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/FabianWe/gopherbouncedb"
+)
+
+// trackingIterator wraps a UserIterator, records if it was closed and returns err
+// after the first user (if err is not nil).
+type trackingIterator struct {
+	gopherbouncedb.UserIterator
+	err    error
+	read   int
+	closed bool
+}
+
+func (it *trackingIterator) Next() (*gopherbouncedb.UserModel, error) {
+	it.read++
+	if it.err != nil && it.read > 1 {
+		return nil, it.err
+	}
+	return it.UserIterator.Next()
+}
+
+func (it *trackingIterator) Close() error {
+	it.closed = true
+	return it.UserIterator.Close()
+}
+
+// listUsers inserts the default users and returns a tracking iterator over them.
+func listUsers(inst gopherbouncedb.UserStorage, err error, t *testing.T) *trackingIterator {
+	it, listErr := inst.ListUsers()
+	if listErr != nil {
+		t.Fatal("ListUsers failed:", listErr)
+	}
+	return &trackingIterator{UserIterator: it, err: err}
+}
+
+func TestStreamSuite(suite UserTestSuiteBinding, t *testing.T) {
+	restoreDefaults()
+	inst := suite.BeginInstance()
+	defer suite.CloseInstance(inst)
+	if initErr := inst.InitUsers(); initErr != nil {
+		t.Fatal("Init failed:", initErr)
+	}
+	insertSuccess(inst, t)
+	ctx := context.Background()
+	n := 0
+	for res := range gopherbouncedb.StreamAllUsers(ctx, inst, 1) {
+		if res.Err != nil {
+			t.Fatal("Stream failed:", res.Err)
+		}
+		n++
+	}
+	if n != 3 {
+		t.Errorf("Expected 3 streamed users, got %d", n)
+	}
+
+	// errors are sent as last element
+	errTest := errors.New("test error")
+	it := listUsers(inst, errTest, t)
+	var last gopherbouncedb.UserResult
+	for res := range gopherbouncedb.StreamUsers(ctx, it, 0) {
+		last = res
+	}
+	if last.Err != errTest || !it.closed {
+		t.Errorf("Expected test error and closed iterator, got %v (closed: %v)", last.Err, it.closed)
+	}
+
+	// cancel after the first user
+	cancelCtx, cancel := context.WithCancel(ctx)
+	it = listUsers(inst, nil, t)
+	ch := gopherbouncedb.StreamUsers(cancelCtx, it, 0)
+	<-ch
+	cancel()
+	for range ch {
+	}
+	if !it.closed {
+		t.Error("Iterator not closed after cancel")
+	}
+
+	// adapter to UserIterator
+	cancelCtx, cancel = context.WithCancel(ctx)
+	slice, sliceErr := gopherbouncedb.AsUsersSlice(
+		gopherbouncedb.ChanUserIterator(gopherbouncedb.StreamAllUsers(cancelCtx, inst, 0), cancel))
+	if sliceErr != nil || len(slice) != 3 {
+		t.Errorf("Expected 3 users from channel iterator, got %d: %v", len(slice), sliceErr)
+	}
+	cancelCtx, cancel = context.WithCancel(ctx)
+	it = listUsers(inst, errTest, t)
+	_, sliceErr = gopherbouncedb.AsUsersSlice(
+		gopherbouncedb.ChanUserIterator(gopherbouncedb.StreamUsers(cancelCtx, it, 0), cancel))
+	if sliceErr != errTest {
+		t.Error("Expected test error from channel iterator, got", sliceErr)
+	}
+	// closing early stops the sender
+	it = listUsers(inst, nil, t)
+	cancelCtx, cancel = context.WithCancel(ctx)
+	chanIt := gopherbouncedb.ChanUserIterator(gopherbouncedb.StreamUsers(cancelCtx, it, 0), cancel)
+	chanIt.HasNext()
+	chanIt.Close()
+	if !it.closed {
+		t.Error("Iterator not closed after closing the channel iterator")
+	}
+}
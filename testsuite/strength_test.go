@@ -0,0 +1,139 @@
+// Copyright 2019 Fabian Wenzelmann
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package testsuite
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/FabianWe/gopherbouncedb"
+)
+
+func TestEstimatePasswordStrength(t *testing.T) {
+	tests := []struct {
+		pw         string
+		userInputs []string
+		score      int
+		warning    string
+		patterns   []string
+		suggestion string
+	}{
+		{"password", nil, 0, "This is a top-10 common password", []string{"dictionary"}, ""},
+		{"Password1!", nil, 1, "This is similar to a commonly used password",
+			[]string{"dictionary", "bruteforce"}, "Capitalization doesn't help very much"},
+		{"P@ssw0rd", nil, 0, "This is similar to a commonly used password", []string{"dictionary"},
+			"Predictable substitutions like '@' instead of 'a' don't help very much"},
+		{"drowssap", nil, 0, "This is similar to a commonly used password", []string{"dictionary"},
+			"Reversed words aren't much harder to guess"},
+		{"mary", nil, 0, "A word by itself is easy to guess", []string{"dictionary"}, ""},
+		{"correcthorsebatterystaple", nil, 4, "",
+			[]string{"dictionary", "dictionary", "dictionary", "dictionary"}, ""},
+		{"correct horse battery staple", nil, 4, "", nil, ""},
+		{"asdfghjkl;", nil, 1, "Short keyboard patterns are easy to guess", []string{"spatial"},
+			"Use a longer keyboard pattern with more turns"},
+		{"qazxswedc", nil, 2, "Short keyboard patterns are easy to guess", []string{"spatial"}, ""},
+		{"abcdef", nil, 0, "Sequences like abc or 6543 are easy to guess", []string{"sequence"}, "Avoid sequences"},
+		{"abcabcabc", nil, 0, "Repeats like \"abcabcabc\" are only slightly harder to guess than \"abc\"",
+			[]string{"repeat"}, "Avoid repeated words and characters"},
+		{"12/05/1990", nil, 1, "Dates are often easy to guess", []string{"date"},
+			"Avoid dates and years that are associated with you"},
+		{"19900512", nil, 1, "Dates are often easy to guess", []string{"date"}, ""},
+		{"fabian123", []string{"fabian"}, 1, "Your password contains personal information",
+			[]string{"dictionary", "sequence"}, ""},
+		{"kX9#mQ2$vL7@pW4!nR8", nil, 4, "", []string{"bruteforce"}, ""},
+	}
+	for _, test := range tests {
+		res := gopherbouncedb.EstimatePasswordStrength(test.pw, test.userInputs...)
+		if res.Score != test.score {
+			t.Errorf("Expected score %d for %q, got %d (guesses 10^%.2f)", test.score, test.pw, res.Score, res.GuessesLog10)
+		}
+		if res.Warning != test.warning {
+			t.Errorf("Expected warning %q for %q, got %q", test.warning, test.pw, res.Warning)
+		}
+		if test.patterns != nil {
+			patterns := make([]string, len(res.Sequence))
+			for i, m := range res.Sequence {
+				patterns[i] = m.Pattern
+			}
+			if !reflect.DeepEqual(test.patterns, patterns) {
+				t.Errorf("Expected patterns %v for %q, got %v", test.patterns, test.pw, patterns)
+			}
+		}
+		if test.suggestion != "" {
+			found := false
+			for _, suggestion := range res.Suggestions {
+				found = found || suggestion == test.suggestion
+			}
+			if !found {
+				t.Errorf("Expected suggestion %q for %q, got %v", test.suggestion, test.pw, res.Suggestions)
+			}
+		}
+		if test.score > 2 && len(res.Suggestions) != 0 {
+			t.Errorf("Expected no suggestions for %q, got %v", test.pw, res.Suggestions)
+		}
+	}
+}
+
+func TestPasswordStrengthFeedback(t *testing.T) {
+	res := gopherbouncedb.EstimatePasswordStrength("")
+	if res.Score != 0 || res.Warning != "" || len(res.Suggestions) != 2 {
+		t.Errorf("Unexpected result for empty password: %+v", res)
+	}
+	res = gopherbouncedb.EstimatePasswordStrength("qwerty")
+	feedback := res.Feedback()
+	if len(feedback) != len(res.Suggestions)+1 || feedback[0] != res.Warning {
+		t.Errorf("Expected warning followed by suggestions, got %v", feedback)
+	}
+}
+
+func TestPWMinStrength(t *testing.T) {
+	verifier := gopherbouncedb.PWMinStrength(3, "fabian")
+	tests := []struct {
+		pw       string
+		expected bool
+	}{
+		{"password", false},
+		{"Password1!", false},
+		{"fabian2019!", false},
+		{"correcthorsebatterystaple", true},
+		{"kX9#mQ2$vL7@pW4!nR8", true},
+	}
+	for _, test := range tests {
+		if got := verifier(test.pw); got != test.expected {
+			t.Errorf("Expected %v for %q, got %v", test.expected, test.pw, got)
+		}
+	}
+}
+
+// longL33tPassword is a password with many l33t chars, longer than the runes
+// considered by the estimator.
+var longL33tPassword = strings.Repeat("p@$$w0rd!1|7", 100)
+
+func TestEstimatePasswordStrengthLong(t *testing.T) {
+	res := gopherbouncedb.EstimatePasswordStrength(longL33tPassword)
+	if len(res.Sequence) == 0 {
+		t.Fatal("Expected matches for long password")
+	}
+	if end := res.Sequence[len(res.Sequence)-1].End; end != 100 {
+		t.Errorf("Expected only the first 100 runes to be considered, sequence ends at %d", end)
+	}
+}
+
+func BenchmarkEstimatePasswordStrengthLong(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		gopherbouncedb.EstimatePasswordStrength(longL33tPassword, "user", "user@example.com")
+	}
+}
@@ -0,0 +1,165 @@
+// Copyright 2019 Fabian Wenzelmann
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package testsuite
+
+import (
+	"testing"
+	"time"
+
+	"github.com/FabianWe/gopherbouncedb"
+)
+
+// TypedTestUser is the application user type used by TestTypedUserSuite, the
+// tagged fields are the ExtraTestColumns.
+type TypedTestUser struct {
+	gopherbouncedb.UserModel
+	Phone      string    `db:"Phone" sqltype:"VARCHAR(50)"`
+	LoginCount int       `db:"login_count"`
+	Verified   *bool     `db:"Verified"`
+	VerifiedAt time.Time `db:"verified_at"`
+	// Note is not stored
+	Note string
+}
+
+func compareTypedUsers(u1, u2 *TypedTestUser) bool {
+	if !compareUsers(&u1.UserModel, &u2.UserModel) {
+		return false
+	}
+	if (u1.Verified == nil) != (u2.Verified == nil) || (u1.Verified != nil && *u1.Verified != *u2.Verified) {
+		return false
+	}
+	return u1.Phone == u2.Phone && u1.LoginCount == u2.LoginCount &&
+		compareTime(u1.VerifiedAt, u2.VerifiedAt) && u1.Note == u2.Note
+}
+
+func getTypedUser(inst *gopherbouncedb.TypedUserStorage[TypedTestUser, *TypedTestUser], id gopherbouncedb.UserID,
+	expected *TypedTestUser, t *testing.T) *TypedTestUser {
+	u, err := inst.GetUser(id)
+	if err != nil {
+		t.Fatal("GetUser failed:", err)
+	}
+	if !compareTypedUsers(expected, u) {
+		t.Errorf("Expected user %+v, got %+v", expected, u)
+	}
+	return u
+}
+
+// TestTypedUserSuite tests TypedUserStorage with TypedTestUser, the storage
+// must support ExtraTestColumns.
+func TestTypedUserSuite(suite UserTestSuiteBinding, t *testing.T) {
+	columns, err := gopherbouncedb.UserColumns[TypedTestUser]()
+	if err != nil {
+		t.Fatal("Can't get columns:", err)
+	}
+	if len(columns) != len(ExtraTestColumns) {
+		t.Fatalf("Expected %d columns, got %v", len(ExtraTestColumns), columns)
+	}
+	for i, column := range columns {
+		expected := ExtraTestColumns[i]
+		if column.Name != expected.Name || column.ColumnName() != expected.ColumnName() || column.Type != expected.Type {
+			t.Errorf("Expected column %v, got %v", expected, column)
+		}
+	}
+	type invalidUser struct {
+		gopherbouncedb.UserModel
+		Data []byte `db:"data"`
+	}
+	if _, err := gopherbouncedb.UserColumns[invalidUser](); err == nil {
+		t.Error("Expected error for field of type []byte")
+	}
+	type shadowingUser struct {
+		gopherbouncedb.UserModel
+		Email string `db:"alt_mail"`
+	}
+	if _, err := gopherbouncedb.UserColumns[shadowingUser](); err == nil {
+		t.Error("Expected error for field with the name of a field of UserModel")
+	}
+
+	wrapped := suite.BeginInstance()
+	defer suite.CloseInstance(wrapped)
+	inst, err := gopherbouncedb.NewTypedUserStorage[TypedTestUser](wrapped)
+	if err != nil {
+		t.Fatal("Can't create typed storage:", err)
+	}
+	if initErr := inst.InitUsers(); initErr != nil {
+		t.Fatal("Init failed:", initErr)
+	}
+	verified := true
+	u := &TypedTestUser{
+		UserModel:  gopherbouncedb.UserModel{Username: "typed", EMail: "typed@example.com", Password: "secret"},
+		Phone:      "+49 123",
+		LoginCount: 42,
+		Verified:   &verified,
+		VerifiedAt: time.Date(2019, 10, 1, 12, 0, 0, 0, time.UTC),
+		Note:       "not stored",
+	}
+	id, err := inst.InsertUser(u)
+	if err != nil {
+		t.Fatal("Insert failed:", err)
+	}
+	if id != u.ID || u.DateJoined.IsZero() {
+		t.Errorf("Insert didn't set the id and date joined: %+v", u)
+	}
+	other := &TypedTestUser{UserModel: gopherbouncedb.UserModel{Username: "plain", EMail: "plain@example.com"}}
+	if _, err := inst.InsertUser(other); err != nil {
+		t.Fatal("Insert failed:", err)
+	}
+	u.Note = ""
+	stored := getTypedUser(inst, u.ID, u, t)
+	getTypedUser(inst, other.ID, other, t)
+	if byName, err := inst.GetUserByName("typed"); err != nil || !compareTypedUsers(stored, byName) {
+		t.Errorf("Expected user %+v, got %+v (%v)", stored, byName, err)
+	}
+	if byMail, err := inst.GetUserByEmail("plain@example.com"); err != nil || !compareTypedUsers(other, byMail) {
+		t.Errorf("Expected user %+v, got %+v (%v)", other, byMail, err)
+	}
+
+	// core semantics are the same as for UserStorage
+	if _, err := inst.GetUser(stored.ID + other.ID); err == nil {
+		t.Error("Expected NoSuchUser error")
+	} else if _, ok := err.(gopherbouncedb.NoSuchUser); !ok {
+		t.Errorf("Expected NoSuchUser error, got %v", err)
+	}
+	duplicate := &TypedTestUser{UserModel: gopherbouncedb.UserModel{Username: "typed", EMail: "other@example.com"}}
+	if _, err := inst.InsertUser(duplicate); err == nil {
+		t.Error("Expected UserExists error")
+	} else if _, ok := err.(gopherbouncedb.UserExists); !ok {
+		t.Errorf("Expected UserExists error, got %v", err)
+	}
+
+	// update only some fields, a nil pointer is stored as NULL
+	update := *stored
+	update.Phone = "+49 456"
+	update.Verified = nil
+	update.FirstName = "Typed"
+	if err := inst.UpdateUser(u.ID, &update, []string{"Phone", "verified", "FirstName"}); err != nil {
+		t.Fatal("Update failed:", err)
+	}
+	stored = getTypedUser(inst, u.ID, &update, t)
+
+	users, err := inst.ListUsers()
+	if err != nil {
+		t.Fatal("ListUsers failed:", err)
+	}
+	all, err := users.All()
+	if err != nil || len(all) != 2 {
+		t.Fatalf("Expected 2 users, got %d (%v)", len(all), err)
+	}
+	for _, listed := range all {
+		if listed.ID == stored.ID && !compareTypedUsers(stored, listed) {
+			t.Errorf("Expected user %+v, got %+v", stored, listed)
+		}
+	}
+}
@@ -101,6 +101,9 @@ func insertSuccess(inst gopherbouncedb.UserStorage, t *testing.T) {
 			if u.DateJoined.IsZero() {
 				t.Fatal("DateJoined not set correctly by InsertUser")
 			}
+			if u.PasswordChangedAt.IsZero() {
+				t.Fatal("PasswordChangedAt not set correctly by InsertUser")
+			}
 			if u.ID == gopherbouncedb.InvalidUserID {
 				t.Fatal("ID not set correctly by InsertUser")
 			}
@@ -168,7 +171,9 @@ func compareUsers(u1, u2 *gopherbouncedb.UserModel) bool {
 		u1.Password == u2.Password && u1.IsActive == u2.IsActive &&
 		u1.IsSuperUser == u2.IsSuperUser && u1.IsStaff == u2.IsStaff &&
 		compareTime(u1.DateJoined, u2.DateJoined) &&
-		compareTime(u1.LastLogin, u2.LastLogin)
+		compareTime(u1.LastLogin, u2.LastLogin) &&
+		compareTime(u1.PasswordChangedAt, u2.PasswordChangedAt) &&
+		u1.MustChangePassword == u2.MustChangePassword
 }
 
 func doLookupTests(inst gopherbouncedb.UserStorage, mailUnique bool, checks []*gopherbouncedb.UserModel, t *testing.T) {
@@ -316,6 +321,10 @@ func TestUpdateUserSuite(suite UserTestSuiteBinding, mailUnique bool, t *testing
 	}
 	// compare again
 	doLookupTests(inst, mailUnique, nil, t)
+	// the id can't be updated
+	if updateErr := inst.UpdateUser(u1.ID, u1, []string{"ID"}); updateErr == nil {
+		t.Error("Expected error when updating the id")
+	}
 }
 
 func TestDeleteUserSuite(suite UserTestSuiteBinding, mailUnique bool, t *testing.T) {
@@ -348,3 +357,63 @@ func TestDeleteUserSuite(suite UserTestSuiteBinding, mailUnique bool, t *testing
 			u2.ID, reflect.TypeOf(getErr), getErr.Error())
 	}
 }
+
+func expiredIDs(inst gopherbouncedb.UserStorage, policy *gopherbouncedb.PasswordExpiryPolicy, t *testing.T) map[gopherbouncedb.UserID]bool {
+	it, err := gopherbouncedb.ListPasswordExpired(inst, policy, time.Now().UTC())
+	if err != nil {
+		t.Fatal("ListPasswordExpired returned an error:", err)
+	}
+	expired, err := gopherbouncedb.AsUsersSlice(it)
+	if err != nil {
+		t.Fatal("Iterating expired users returned an error:", err)
+	}
+	res := make(map[gopherbouncedb.UserID]bool, len(expired))
+	for _, u := range expired {
+		res[u.ID] = true
+	}
+	return res
+}
+
+func TestPasswordExpirySuite(suite UserTestSuiteBinding, t *testing.T) {
+	restoreDefaults()
+	inst := suite.BeginInstance()
+	defer suite.CloseInstance(inst)
+	initErr := inst.InitUsers()
+	if initErr != nil {
+		t.Fatal("Init failed:", initErr)
+	}
+	insertSuccess(inst, t)
+	policy := gopherbouncedb.NewStaffPasswordExpiryPolicy(90 * 24 * time.Hour)
+	if expired := expiredIDs(inst, policy, t); len(expired) != 0 {
+		t.Fatalf("Expected no expired passwords after insert, got %v", expired)
+	}
+	// user 1 must change the password, the password of user 2 (staff) is old and
+	// user 3 (super user) has a recent password
+	u1, u2 := users[0], users[1]
+	u1.MustChangePassword = true
+	if updateErr := inst.UpdateUser(u1.ID, u1, []string{"MustChangePassword"}); updateErr != nil {
+		t.Fatal("Update returned an error:", updateErr)
+	}
+	u2.PasswordChangedAt = time.Now().UTC().Add(-100 * 24 * time.Hour)
+	if updateErr := inst.UpdateUser(u2.ID, u2, []string{"PasswordChangedAt"}); updateErr != nil {
+		t.Fatal("Update returned an error:", updateErr)
+	}
+	expired := expiredIDs(inst, policy, t)
+	if len(expired) != 2 || !expired[u1.ID] || !expired[u2.ID] {
+		t.Errorf("Expected users %d and %d to be expired, got %v", u1.ID, u2.ID, expired)
+	}
+	// changing the passwords must reset the expiry
+	for _, u := range []*gopherbouncedb.UserModel{u1, u2} {
+		u.Password = "new-hash"
+		if updateErr := inst.UpdateUser(u.ID, u, []string{"Password"}); updateErr != nil {
+			t.Fatal("Update returned an error:", updateErr)
+		}
+		if u.MustChangePassword || !compareTime(u.PasswordChangedAt, time.Now().UTC()) {
+			t.Errorf("Password fields not updated on password change: %v", u)
+		}
+	}
+	if expired := expiredIDs(inst, policy, t); len(expired) != 0 {
+		t.Errorf("Expected no expired passwords after password change, got %v", expired)
+	}
+	doLookupTests(inst, true, nil, t)
+}
@@ -0,0 +1,172 @@
+// Copyright 2019 Fabian Wenzelmann
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package testsuite
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/FabianWe/gopherbouncedb"
+)
+
+// tooLongUser returns a user where all fields with a limit are one char too long.
+func tooLongUser(limits *gopherbouncedb.UserSchemaLimits) *gopherbouncedb.UserModel {
+	return &gopherbouncedb.UserModel{
+		Username:  strings.Repeat("u", limits.UsernameMaxLen+1),
+		Password:  strings.Repeat("p", limits.PasswordMaxLen+1),
+		EMail:     strings.Repeat("e", limits.EMailMaxLen+1),
+		FirstName: strings.Repeat("f", limits.FirstNameMaxLen+1),
+		LastName:  strings.Repeat("l", limits.LastNameMaxLen+1),
+	}
+}
+
+func TestValidationError(t *testing.T) {
+	err := gopherbouncedb.NewMaxLenError("Username", 150, 151, gopherbouncedb.ErrUsernameTooLong)
+	if err.Field != "Username" || err.Rule != gopherbouncedb.RuleMaxLen || err.Limit != 150 || err.Actual != 151 {
+		t.Errorf("Unexpected error: %+v", err)
+	}
+	if !errors.Is(err, gopherbouncedb.ErrUsernameTooLong) || errors.Is(err, gopherbouncedb.ErrEmailTooLong) {
+		t.Error("errors.Is doesn't match the sentinel error")
+	}
+	if msg := err.Error(); msg != "Username: must not be longer than 150 characters, got 151" {
+		t.Errorf("Unexpected message %q", msg)
+	}
+	required := gopherbouncedb.NewValidationError("EMail", gopherbouncedb.RuleRequired, gopherbouncedb.ErrEmptyEmail)
+	if msg := required.Error(); msg != "EMail: no EMail given" {
+		t.Errorf("Unexpected message %q", msg)
+	}
+}
+
+func TestVerifyStandardUserMaxLens(t *testing.T) {
+	limits := gopherbouncedb.StandardUserSchemaLimits
+	if err := gopherbouncedb.VerifyStandardUserMaxLens(&gopherbouncedb.UserModel{Username: "foo"}); err != nil {
+		t.Error("Expected valid user, got", err)
+	}
+	err := gopherbouncedb.VerifyStandardUserMaxLens(tooLongUser(limits))
+	var errs gopherbouncedb.ValidationErrors
+	if !errors.As(err, &errs) {
+		t.Fatalf("Expected ValidationErrors, got %v", err)
+	}
+	if len(errs) != 5 {
+		t.Fatalf("Expected 5 errors in one pass, got %d: %v", len(errs), errs)
+	}
+	tests := []struct {
+		field    string
+		limit    int
+		sentinel error
+	}{
+		{"Username", limits.UsernameMaxLen, gopherbouncedb.ErrUsernameTooLong},
+		{"Password", limits.PasswordMaxLen, gopherbouncedb.ErrPasswordTooLong},
+		{"EMail", limits.EMailMaxLen, gopherbouncedb.ErrEmailTooLong},
+		{"FirstName", limits.FirstNameMaxLen, gopherbouncedb.ErrFirstNameTooLong},
+		{"LastName", limits.LastNameMaxLen, gopherbouncedb.ErrLastNameTooLong},
+	}
+	byField := errs.ByField()
+	for i, tc := range tests {
+		if errs[i].Field != tc.field {
+			t.Errorf("Expected error %d for %s, got %s", i, tc.field, errs[i].Field)
+		}
+		if !errors.Is(err, tc.sentinel) {
+			t.Errorf("errors.Is(err, %v) returned false", tc.sentinel)
+		}
+		fieldErrs := byField[tc.field]
+		if len(fieldErrs) != 1 {
+			t.Errorf("Expected one error for %s, got %d", tc.field, len(fieldErrs))
+			continue
+		}
+		fieldErr := fieldErrs[0]
+		if fieldErr.Rule != gopherbouncedb.RuleMaxLen || fieldErr.Limit != tc.limit ||
+			fieldErr.Actual != tc.limit+1 || !errors.Is(fieldErr, tc.sentinel) {
+			t.Errorf("Unexpected error for %s: %+v", tc.field, fieldErr)
+		}
+	}
+	// the single check functions return the same errors
+	single := gopherbouncedb.CheckEmailMaxLen(strings.Repeat("e", limits.EMailMaxLen+1))
+	if !errors.Is(single, gopherbouncedb.ErrEmailTooLong) {
+		t.Error("Expected ErrEmailTooLong, got", single)
+	}
+}
+
+func TestVerifyUser(t *testing.T) {
+	u := &gopherbouncedb.UserModel{EMail: "not an email"}
+	err := gopherbouncedb.VerifyUser(u, gopherbouncedb.VerifiyNameExists, gopherbouncedb.VerifyPasswordExists,
+		gopherbouncedb.VerifyEmailSyntax)
+	var errs gopherbouncedb.ValidationErrors
+	if !errors.As(err, &errs) || len(errs) != 3 {
+		t.Fatalf("Expected 3 validation errors, got %v", err)
+	}
+	for _, sentinel := range []error{gopherbouncedb.ErrEmptyUsername, gopherbouncedb.ErrEmptyPassword,
+		gopherbouncedb.ErrInvalidEmailSyntax} {
+		if !errors.Is(err, sentinel) {
+			t.Errorf("errors.Is(err, %v) returned false", sentinel)
+		}
+	}
+	if errs[0].Rule != gopherbouncedb.RuleRequired || errs[2].Rule != gopherbouncedb.RuleSyntax {
+		t.Errorf("Unexpected rules %s and %s", errs[0].Rule, errs[2].Rule)
+	}
+	u.Username, u.Password, u.EMail = "foo", "hash", "foo@example.com"
+	if err := gopherbouncedb.VerifyUser(u, gopherbouncedb.VerifiyNameExists, gopherbouncedb.VerifyPasswordExists,
+		gopherbouncedb.VerifyEmailSyntax); err != nil {
+		t.Error("Expected valid user, got", err)
+	}
+}
+
+func TestUserSchemaLimits(t *testing.T) {
+	limits := gopherbouncedb.DefaultUserSchemaLimits()
+	if limits.UsernameMaxLen != 150 || limits.PasswordMaxLen != 270 || limits.EMailMaxLen != 254 ||
+		limits.FirstNameMaxLen != 50 || limits.LastNameMaxLen != 150 {
+		t.Errorf("Unexpected default limits: %+v", limits)
+	}
+	limits.EMailMaxLen = 100
+	limits.FirstNameMaxLen = 20
+	// the replacer and the validators use the changed limits
+	replacements := limits.Replacements()
+	if len(replacements) != 5 || replacements["$EMAIL_MAX_LEN$"] != "100" ||
+		replacements["$FIRST_NAME_MAX_LEN$"] != "20" || replacements["$USERNAME_MAX_LEN$"] != "150" {
+		t.Errorf("Unexpected replacements: %v", replacements)
+	}
+	const template = "email VARCHAR($EMAIL_MAX_LEN$), first_name VARCHAR($FIRST_NAME_MAX_LEN$)"
+	replacer := gopherbouncedb.NewSQLTemplateReplacer()
+	limits.ApplyTo(replacer)
+	if got := replacer.Apply(template); got != "email VARCHAR(100), first_name VARCHAR(20)" {
+		t.Errorf("Unexpected query from ApplyTo: %s", got)
+	}
+	if got := gopherbouncedb.SQLReplacerWithLimits(limits).Apply(template); got != "email VARCHAR(100), first_name VARCHAR(20)" {
+		t.Errorf("Unexpected query from SQLReplacerWithLimits: %s", got)
+	}
+	if got := gopherbouncedb.DefaultSQLReplacer().Apply(template); got != "email VARCHAR(254), first_name VARCHAR(50)" {
+		t.Errorf("Unexpected query from DefaultSQLReplacer: %s", got)
+	}
+	if err := limits.CheckEmail(strings.Repeat("e", 100)); err != nil {
+		t.Error("Expected valid email, got", err)
+	}
+	email := strings.Repeat("e", 101)
+	if err := limits.CheckEmail(email); !errors.Is(err, gopherbouncedb.ErrEmailTooLong) {
+		t.Error("Expected ErrEmailTooLong, got", err)
+	}
+	u := &gopherbouncedb.UserModel{Username: "foo", EMail: email, FirstName: strings.Repeat("f", 21)}
+	var errs gopherbouncedb.ValidationErrors
+	if err := limits.VerifyMaxLens(u); !errors.As(err, &errs) || len(errs) != 2 {
+		t.Fatalf("Expected 2 validation errors, got %v", err)
+	}
+	if byField := errs.ByField(); byField["EMail"][0].Limit != 100 || byField["FirstName"][0].Limit != 20 {
+		t.Errorf("Unexpected limits in errors: %v", errs)
+	}
+	// the standard limits are not changed
+	if err := gopherbouncedb.VerifyStandardUserMaxLens(u); err != nil {
+		t.Error("Expected valid user with the standard limits, got", err)
+	}
+}
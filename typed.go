@@ -0,0 +1,337 @@
+// Copyright 2019 Fabian Wenzelmann
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gopherbouncedb
+
+import (
+	"fmt"
+	"reflect"
+	"time"
+)
+
+// UserLike is implemented by application user types that embed UserModel, the
+// method Model of UserModel is promoted to the pointer of the embedding type.
+// Types that don't embed UserModel can implement it by returning a pointer to
+// their core fields.
+type UserLike interface {
+	// Model returns the core fields of the user, changes to the returned model must
+	// be visible in the user.
+	Model() *UserModel
+}
+
+// Model returns u, it implements UserLike.
+func (u *UserModel) Model() *UserModel {
+	return u
+}
+
+// UserPtr is the constraint of TypedUserStorage: PT is the pointer type of an
+// application user type T.
+type UserPtr[T any] interface {
+	*T
+	UserLike
+}
+
+const (
+	// ColumnTag is the struct tag that binds a field of an application user type to
+	// a column, for example `db:"phone"`.
+	// Fields without the tag (and embedded fields like UserModel) are not stored.
+	ColumnTag = "db"
+	// ColumnTypeTag is the optional struct tag with the column type used in CREATE
+	// TABLE statements, see ExtraColumn.Definition.
+	ColumnTypeTag = "sqltype"
+)
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// typedField is a field of an application user type that is bound to a column.
+type typedField struct {
+	index   int
+	pointer bool
+	column  ExtraColumn
+}
+
+// extraColumnType returns the type of the column for a field type.
+func extraColumnType(t reflect.Type) (ExtraColumnType, bool) {
+	if t == timeType {
+		return ExtraTime, true
+	}
+	switch t.Kind() {
+	case reflect.String:
+		return ExtraString, true
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return ExtraInt, true
+	case reflect.Bool:
+		return ExtraBool, true
+	default:
+		return 0, false
+	}
+}
+
+// typedFields returns the fields with a ColumnTag.
+// Fields must be of type string, bool, time.Time, a signed integer or a pointer to
+// one of them. Nil pointers are stored as NULL.
+// The names must be valid extra column names, for example a field Email is not
+// allowed because it would shadow UserModel.EMail in UpdateUser.
+func typedFields(t reflect.Type) ([]typedField, error) {
+	if t.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("user type %s must be a struct", t)
+	}
+	res := make([]typedField, 0, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		column, has := field.Tag.Lookup(ColumnTag)
+		if !has || field.Anonymous || column == "-" {
+			continue
+		}
+		if field.PkgPath != "" {
+			return nil, fmt.Errorf("field %s of user type %s with column tag is not exported", field.Name, t)
+		}
+		fieldType, pointer := field.Type, field.Type.Kind() == reflect.Ptr
+		if pointer {
+			fieldType = fieldType.Elem()
+		}
+		columnType, ok := extraColumnType(fieldType)
+		if !ok {
+			return nil, fmt.Errorf("field %s of user type %s has unsupported type %s", field.Name, t, field.Type)
+		}
+		res = append(res, typedField{
+			index:   i,
+			pointer: pointer,
+			column: ExtraColumn{
+				Name:       field.Name,
+				Column:     column,
+				Type:       columnType,
+				Definition: field.Tag.Get(ColumnTypeTag),
+			},
+		})
+	}
+	columns := make([]ExtraColumn, len(res))
+	for i, field := range res {
+		columns[i] = field.column
+	}
+	if err := checkExtraColumns(columns); err != nil {
+		return nil, fmt.Errorf("invalid user type %s: %w", t, err)
+	}
+	return res, nil
+}
+
+// UserColumns returns the extra columns for the tagged fields of the application
+// user type T, see ColumnTag.
+// The name of each column is the name of the field, so the fields can be used in
+// UpdateUser. The columns must be passed to the storage wrapped by
+// TypedUserStorage, for example with GenerateMappedUserSQL.
+func UserColumns[T any]() ([]ExtraColumn, error) {
+	fields, err := typedFields(reflect.TypeOf((*T)(nil)).Elem())
+	if err != nil {
+		return nil, err
+	}
+	res := make([]ExtraColumn, len(fields))
+	for i, field := range fields {
+		res[i] = field.column
+	}
+	return res, nil
+}
+
+// TypedUserStorage wraps a UserStorage to work with an application user type T
+// instead of UserModel.
+//
+// The core fields are stored by the wrapped storage, the fields of T with a
+// ColumnTag are stored in UserModel.Extensions and must be supported by the
+// wrapped storage, for example a SQL storage with the columns from UserColumns.
+// All methods have the same semantics as the ones of UserStorage, for example
+// GetUser returns an error of type NoSuchUser and InsertUser an error of type
+// UserExists. The fields in UpdateUser may contain the names of the tagged
+// fields.
+type TypedUserStorage[T any, PT UserPtr[T]] struct {
+	Storage UserStorage
+	fields  []typedField
+}
+
+// NewTypedUserStorage returns a new storage wrapping storage.
+// An error is returned if T has tagged fields with an unsupported type.
+func NewTypedUserStorage[T any, PT UserPtr[T]](storage UserStorage) (*TypedUserStorage[T, PT], error) {
+	fields, err := typedFields(reflect.TypeOf((*T)(nil)).Elem())
+	if err != nil {
+		return nil, err
+	}
+	return &TypedUserStorage[T, PT]{Storage: storage, fields: fields}, nil
+}
+
+// Columns returns the extra columns of the tagged fields, see UserColumns.
+func (s *TypedUserStorage[T, PT]) Columns() []ExtraColumn {
+	res := make([]ExtraColumn, len(s.fields))
+	for i, field := range s.fields {
+		res[i] = field.column
+	}
+	return res
+}
+
+// model returns the core fields of user with the extensions set to the values of
+// the tagged fields.
+func (s *TypedUserStorage[T, PT]) model(user PT) *UserModel {
+	res := user.Model()
+	v := reflect.ValueOf(user).Elem()
+	for _, field := range s.fields {
+		fieldVal := v.Field(field.index)
+		name := field.column.Name
+		if field.pointer {
+			if fieldVal.IsNil() {
+				res.Extensions.Delete(name)
+				continue
+			}
+			fieldVal = fieldVal.Elem()
+		}
+		switch field.column.Type {
+		case ExtraString:
+			res.Extensions.SetString(name, fieldVal.String())
+		case ExtraInt:
+			res.Extensions.SetInt(name, fieldVal.Int())
+		case ExtraBool:
+			res.Extensions.SetBool(name, fieldVal.Bool())
+		case ExtraTime:
+			res.Extensions.SetTime(name, fieldVal.Interface().(time.Time))
+		}
+	}
+	return res
+}
+
+// user returns a new user with the core fields from u and the tagged fields from
+// the extensions of u. Missing extensions are set to the zero value.
+func (s *TypedUserStorage[T, PT]) user(u *UserModel) (PT, error) {
+	res := PT(new(T))
+	*res.Model() = *u
+	v := reflect.ValueOf(res).Elem()
+	for _, field := range s.fields {
+		val, has := u.Extensions[field.column.Name]
+		if !has || val == nil {
+			continue
+		}
+		fieldVal := v.Field(field.index)
+		if field.pointer {
+			fieldVal.Set(reflect.New(fieldVal.Type().Elem()))
+			fieldVal = fieldVal.Elem()
+		}
+		var ok bool
+		switch field.column.Type {
+		case ExtraString:
+			var str string
+			if str, ok = val.(string); ok {
+				fieldVal.SetString(str)
+			}
+		case ExtraInt:
+			var i int64
+			if i, ok = val.(int64); ok && !fieldVal.OverflowInt(i) {
+				fieldVal.SetInt(i)
+			} else if ok {
+				return nil, fmt.Errorf("value %d of field %s overflows %s", i, field.column.Name, fieldVal.Type())
+			}
+		case ExtraBool:
+			var b bool
+			if b, ok = val.(bool); ok {
+				fieldVal.SetBool(b)
+			}
+		case ExtraTime:
+			var t time.Time
+			if t, ok = val.(time.Time); ok {
+				fieldVal.Set(reflect.ValueOf(t))
+			}
+		}
+		if !ok {
+			return nil, fmt.Errorf("field %s must be of type %s, got type %T", field.column.Name, field.column.Type, val)
+		}
+	}
+	return res, nil
+}
+
+func (s *TypedUserStorage[T, PT]) wrap(u *UserModel, err error) (PT, error) {
+	if err != nil {
+		return nil, err
+	}
+	return s.user(u)
+}
+
+// InitUsers calls InitUsers of the wrapped storage.
+func (s *TypedUserStorage[T, PT]) InitUsers() error {
+	return s.Storage.InitUsers()
+}
+
+func (s *TypedUserStorage[T, PT]) GetUser(id UserID) (PT, error) {
+	return s.wrap(s.Storage.GetUser(id))
+}
+
+func (s *TypedUserStorage[T, PT]) GetUserByName(username string) (PT, error) {
+	return s.wrap(s.Storage.GetUserByName(username))
+}
+
+func (s *TypedUserStorage[T, PT]) GetUserByEmail(email string) (PT, error) {
+	return s.wrap(s.Storage.GetUserByEmail(email))
+}
+
+// InsertUser inserts the user, the id and dates are set in user.
+func (s *TypedUserStorage[T, PT]) InsertUser(user PT) (UserID, error) {
+	return s.Storage.InsertUser(s.model(user))
+}
+
+// UpdateUser updates the user, fields may contain the names of the core fields as
+// well as the names of the tagged fields.
+func (s *TypedUserStorage[T, PT]) UpdateUser(id UserID, newCredentials PT, fields []string) error {
+	return s.Storage.UpdateUser(id, s.model(newCredentials), fields)
+}
+
+func (s *TypedUserStorage[T, PT]) DeleteUser(id UserID) error {
+	return s.Storage.DeleteUser(id)
+}
+
+// ListUsers returns all users, the iterator must be used like the one from
+// UserStorage.ListUsers.
+func (s *TypedUserStorage[T, PT]) ListUsers() (*TypedUserIterator[T, PT], error) {
+	it, err := s.Storage.ListUsers()
+	if err != nil {
+		return nil, err
+	}
+	return &TypedUserIterator[T, PT]{UserIterator: it, storage: s}, nil
+}
+
+// TypedUserIterator is an iterator over application users, see
+// TypedUserStorage.ListUsers.
+type TypedUserIterator[T any, PT UserPtr[T]] struct {
+	UserIterator
+	storage *TypedUserStorage[T, PT]
+}
+
+// Next returns the next user.
+func (it *TypedUserIterator[T, PT]) Next() (PT, error) {
+	u, err := it.UserIterator.Next()
+	if err != nil || u == nil {
+		return nil, err
+	}
+	return it.storage.user(u)
+}
+
+// All returns all remaining users and closes the iterator, see AsUsersSlice.
+func (it *TypedUserIterator[T, PT]) All() ([]PT, error) {
+	defer it.Close()
+	res := make([]PT, 0, 10)
+	for it.HasNext() {
+		next, nextErr := it.Next()
+		if nextErr != nil {
+			return nil, nextErr
+		}
+		res = append(res, next)
+	}
+	if err := it.Err(); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
@@ -15,8 +15,6 @@
 package gopherbouncedb
 
 import (
-	"fmt"
-	"strings"
 	"time"
 )
 
@@ -36,29 +34,46 @@ type UserID int64
 // DateJoined and LastLogin should also be self-explaining.
 // Note that LastLogin can be zero, meaning if the user never logged in
 // LastLogin.IsZero() == true.
+// SQL storages may store this as NULL, see NullLastLoginSQL.
+// PasswordChangedAt is the date the password was set the last time and
+// MustChangePassword is true if the user must change the password (for example
+// after an administrator reset it). Both are maintained by the storages on
+// insert and when the password is updated, see PasswordExpiryPolicy.
+// Extensions contains the values of additional application columns, it is only
+// used by storages that support them (see ExtraColumn) and may be nil.
 //
 // In general UserID, Username and EMail should be unique.
 //
+// The struct tags describe the fields, see UserFields: The "db" tag contains the
+// default column name and the options "readonly" (the field can't be updated) and
+// "nullable" (the zero value may be stored as NULL), the "maxlen" tag the default
+// maximal length.
+//
 // Because this model is usually stored in a database here is a summary of some
 // conventions for the fields:
 // The strings are usually varchars with the following maximum lengths:
 // Username (150), password (270), EMail (254), FirstName (50), LastName(150).
 // These properties can also be verified before inserting the user to a database with
 // VerifyStandardUserMaxLens.
+// The limits can be changed with UserSchemaLimits, they're used for the validation as
+// well as for the SQL schema.
 // The database implementations don't check that automatically, but the convenient
 // wrappers I'm trying to implement will.
 type UserModel struct {
-	ID          UserID
-	FirstName   string
-	LastName    string
-	Username    string
-	EMail       string
-	Password    string
-	IsActive    bool
-	IsSuperUser bool
-	IsStaff     bool
-	DateJoined  time.Time
-	LastLogin   time.Time
+	ID                 UserID         `db:"id,readonly"`
+	FirstName          string         `db:"first_name" maxlen:"50"`
+	LastName           string         `db:"last_name" maxlen:"150"`
+	Username           string         `db:"username" maxlen:"150"`
+	EMail              string         `db:"email" maxlen:"254"`
+	Password           string         `db:"password" maxlen:"270"`
+	IsActive           bool           `db:"is_active"`
+	IsSuperUser        bool           `db:"is_superuser"`
+	IsStaff            bool           `db:"is_staff"`
+	DateJoined         time.Time      `db:"date_joined"`
+	LastLogin          time.Time      `db:"last_login,nullable"`
+	PasswordChangedAt  time.Time      `db:"password_changed_at"`
+	MustChangePassword bool           `db:"must_change_password"`
+	Extensions         UserExtensions `db:"-"`
 }
 
 // Copy creates a copy of the user model and returns a new one with the same contens.
@@ -75,42 +90,122 @@ func (u *UserModel) Copy() *UserModel {
 	res.IsStaff = u.IsStaff
 	res.DateJoined = u.DateJoined
 	res.LastLogin = u.LastLogin
+	res.PasswordChangedAt = u.PasswordChangedAt
+	res.MustChangePassword = u.MustChangePassword
+	res.Extensions = u.Extensions.Copy()
 	return res
 }
 
 // GetFieldByName returns the value of the field given by its string name.
 //
 // This helps with methods that for example only update certain fields.
-// The key must be the name of one of the fields of the user model.
+// The key must be the name of one of the fields of the user model (case
+// insensitive, see LookupUserField).
 // If the key is invalid an error is returned.
 func (u *UserModel) GetFieldByName(name string) (val interface{}, err error) {
-	switch strings.ToLower(name) {
-	case "id":
-		val = u.ID
-	case "firstname":
-		val = u.FirstName
-	case "lastname":
-		val = u.LastName
-	case "username":
-		val = u.Username
-	case "email":
-		val = u.EMail
-	case "password":
-		val = u.Password
-	case "isactive":
-		val = u.IsActive
-	case "issuperuser":
-		val = u.IsSuperUser
-	case "isstaff":
-		val = u.IsStaff
-	case "datejoined":
-		val = u.DateJoined
-	case "lastlogin":
-		val = u.LastLogin
-	default:
-		err = fmt.Errorf("invalid field name \"%s\": Must be a valid field name of the user model", name)
+	field, err := LookupUserField(name)
+	if err != nil {
+		return nil, err
+	}
+	return field.Get(u), nil
+}
+
+// SetFieldByName sets the value of the field given by its string name, see
+// UserField.Set.
+func (u *UserModel) SetFieldByName(name string, val interface{}) error {
+	field, err := LookupUserField(name)
+	if err != nil {
+		return err
+	}
+	return field.Set(u, val)
+}
+
+// DiffFields returns the names of all updatable fields that differ in u and other,
+// in the order of UserFields. Times are compared with time.Equal.
+// The result can be used as the fields in UserStorage.UpdateUser, fields that
+// aren't updatable (the ID) are not compared.
+// Extensions are not compared.
+func (u *UserModel) DiffFields(other *UserModel) []string {
+	var res []string
+	for _, field := range UserFields {
+		if field.Updatable && !field.Equal(u, other) {
+			res = append(res, field.Name)
+		}
+	}
+	return res
+}
+
+// UserExtensions contains the values of additional fields of a user, for example
+// the values of extra columns in a SQL storage (see ExtraColumn).
+//
+// The values have one of the types string, int64, bool or time.Time, the typed
+// getters and setters should be used to access them.
+// The setters can be used on a nil map, it is created if required.
+type UserExtensions map[string]interface{}
+
+// Copy returns a copy of the extensions, nil is returned for nil.
+func (e UserExtensions) Copy() UserExtensions {
+	if e == nil {
+		return nil
+	}
+	res := make(UserExtensions, len(e))
+	for name, val := range e {
+		res[name] = val
+	}
+	return res
+}
+
+func (e *UserExtensions) set(name string, val interface{}) {
+	if *e == nil {
+		*e = make(UserExtensions)
 	}
-	return
+	(*e)[name] = val
+}
+
+// Delete removes the value, it is stored as NULL in SQL storages.
+func (e *UserExtensions) Delete(name string) {
+	delete(*e, name)
+}
+
+func (e *UserExtensions) SetString(name, val string) {
+	e.set(name, val)
+}
+
+func (e *UserExtensions) SetInt(name string, val int64) {
+	e.set(name, val)
+}
+
+func (e *UserExtensions) SetBool(name string, val bool) {
+	e.set(name, val)
+}
+
+func (e *UserExtensions) SetTime(name string, val time.Time) {
+	e.set(name, val)
+}
+
+// GetString returns the string value, the second return value is false if there
+// is no such value or it is not a string.
+func (e UserExtensions) GetString(name string) (string, bool) {
+	val, ok := e[name].(string)
+	return val, ok
+}
+
+// GetInt works as GetString for int64 values.
+func (e UserExtensions) GetInt(name string) (int64, bool) {
+	val, ok := e[name].(int64)
+	return val, ok
+}
+
+// GetBool works as GetString for bool values.
+func (e UserExtensions) GetBool(name string) (bool, bool) {
+	val, ok := e[name].(bool)
+	return val, ok
+}
+
+// GetTime works as GetString for time.Time values.
+func (e UserExtensions) GetTime(name string) (time.Time, bool) {
+	val, ok := e[name].(time.Time)
+	return val, ok
 }
 
 const (
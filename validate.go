@@ -15,11 +15,16 @@
 package gopherbouncedb
 
 import (
-	"strings"
-	"regexp"
-	"unicode/utf8"
 	"errors"
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
 	"unicode"
+	"unicode/utf8"
 )
 
 // UserVerifier is a function that takes a user and returns an error if a given
@@ -34,26 +39,171 @@ import (
 type UserVerifier func(u *UserModel) error
 
 // These variables define errors returned by some of the validators.
+//
+// The validators don't return them directly but wrap them in a ValidationError,
+// use errors.Is to test for them.
 var (
 	ErrEmptyUsername = errors.New("no username given")
 	ErrEmptyEmail = errors.New("no EMail given")
 	ErrEmptyPassword = errors.New("no password set")
 	ErrInvalidEmailSyntax = errors.New("invalid syntax in email")
-	ErrUsernameTooLong = errors.New("username is longer than 150 characters")
-	ErrPasswordTooLong = errors.New("password is longer than 270 characters")
-	ErrEmailTooLong = errors.New("email is longer than 254 characters")
-	ErrFirstNameTooLong = errors.New("first name is longer than 50 characters")
-	ErrLastNameTooLong = errors.New("last name is longer than 150 characters")
+	ErrUsernameTooLong = errors.New("username is too long")
+	ErrPasswordTooLong = errors.New("password is too long")
+	ErrEmailTooLong = errors.New("email is too long")
+	ErrFirstNameTooLong = errors.New("first name is too long")
+	ErrLastNameTooLong = errors.New("last name is too long")
 	ErrInvalidUsernameSyntax = errors.New("invalid username syntax")
 	ErrInvalidFirstNameSyntax = errors.New("invalid first name")
 	ErrInvalidLastNameSyntax = errors.New("invalid last name")
 )
 
+// These constants are the rule codes used in ValidationError.
+const (
+	// RuleRequired is used if a field must not be empty.
+	RuleRequired = "required"
+	// RuleMaxLen is used if a field is longer than allowed.
+	RuleMaxLen = "max_len"
+	// RuleSyntax is used if a field has an invalid syntax.
+	RuleSyntax = "syntax"
+)
+
+// ValidationError describes a single failed validation on a field of the user model.
+//
+// Field is the name of the field in UserModel (for example "Username"), Rule is one
+// of the rule codes like RuleMaxLen.
+// Limit and Actual are only set for rules that deal with a length, for example for
+// RuleMaxLen Limit is the maximal length and Actual the length of the value.
+// Err is the sentinel error (like ErrUsernameTooLong) that describes the problem,
+// thus errors.Is(err, ErrUsernameTooLong) still works.
+type ValidationError struct {
+	Field  string
+	Rule   string
+	Limit  int
+	Actual int
+	Err    error
+}
+
+// NewValidationError returns a new ValidationError without limit and actual value.
+func NewValidationError(field, rule string, err error) *ValidationError {
+	return &ValidationError{Field: field, Rule: rule, Err: err}
+}
+
+// NewMaxLenError returns a new ValidationError for the rule RuleMaxLen.
+func NewMaxLenError(field string, limit, actual int, err error) *ValidationError {
+	return &ValidationError{
+		Field:  field,
+		Rule:   RuleMaxLen,
+		Limit:  limit,
+		Actual: actual,
+		Err:    err,
+	}
+}
+
+// Error returns the error string.
+func (e *ValidationError) Error() string {
+	if e.Rule == RuleMaxLen {
+		return fmt.Sprintf("%s: must not be longer than %d characters, got %d",
+			e.Field, e.Limit, e.Actual)
+	}
+	if e.Err != nil {
+		return fmt.Sprintf("%s: %s", e.Field, e.Err.Error())
+	}
+	return fmt.Sprintf("%s: validation failed (%s)", e.Field, e.Rule)
+}
+
+// Unwrap returns the sentinel error.
+func (e *ValidationError) Unwrap() error {
+	return e.Err
+}
+
+// ValidationErrors is a collection of validation errors, usually all errors found
+// when validating a single user.
+//
+// errors.Is and errors.As test all contained errors.
+type ValidationErrors []*ValidationError
+
+// Error returns the error string.
+func (e ValidationErrors) Error() string {
+	switch len(e) {
+	case 0:
+		return "no validation errors"
+	case 1:
+		return e[0].Error()
+	}
+	var sb strings.Builder
+	sb.WriteString("validation failed with the following errors:")
+	for _, err := range e {
+		sb.WriteString("\n   ")
+		sb.WriteString(err.Error())
+	}
+	return sb.String()
+}
+
+// Unwrap returns all contained errors.
+func (e ValidationErrors) Unwrap() []error {
+	res := make([]error, len(e))
+	for i, err := range e {
+		res[i] = err
+	}
+	return res
+}
+
+// ByField returns all errors grouped by the field name.
+func (e ValidationErrors) ByField() map[string][]*ValidationError {
+	res := make(map[string][]*ValidationError, len(e))
+	for _, err := range e {
+		res[err.Field] = append(res[err.Field], err)
+	}
+	return res
+}
+
+// Append adds err to the collection.
+// If err is a ValidationErrors all of them are added, if it is a ValidationError
+// it is added directly.
+// All other errors are wrapped in a ValidationError with an empty field and rule.
+// A nil error is ignored.
+func (e ValidationErrors) Append(err error) ValidationErrors {
+	if err == nil {
+		return e
+	}
+	var all ValidationErrors
+	if errors.As(err, &all) {
+		return append(e, all...)
+	}
+	var single *ValidationError
+	if errors.As(err, &single) {
+		return append(e, single)
+	}
+	return append(e, &ValidationError{Err: err})
+}
+
+// ErrOrNil returns nil if the collection is empty and the collection itself otherwise.
+//
+// This should be used instead of returning the collection directly, otherwise an
+// empty collection would not be a nil error.
+func (e ValidationErrors) ErrOrNil() error {
+	if len(e) == 0 {
+		return nil
+	}
+	return e
+}
+
+// VerifyUser runs all verifiers on the user and returns all errors in one pass.
+// It returns nil iff all verifiers passed, otherwise the error is of type
+// ValidationErrors.
+func VerifyUser(u *UserModel, verifiers ...UserVerifier) error {
+	var errs ValidationErrors
+	for _, verifier := range verifiers {
+		errs = errs.Append(verifier(u))
+	}
+	return errs.ErrOrNil()
+}
+
 // VerifiyNameExists tests if the user has a username.
 // It is a UserVerifier.
 func VerifiyNameExists(u *UserModel) error {
 	if strings.TrimSpace(u.Username) == "" {
-		return ErrEmptyUsername
+		return NewValidationError("Username", RuleRequired, ErrEmptyUsername)
 	}
 	return nil
 }
@@ -62,7 +212,7 @@ func VerifiyNameExists(u *UserModel) error {
 // It is a UserVerifier.
 func VerifyEmailExists(u *UserModel) error {
 	if strings.TrimSpace(u.EMail) == "" {
-		return ErrEmptyEmail
+		return NewValidationError("EMail", RuleRequired, ErrEmptyEmail)
 	}
 	return nil
 }
@@ -71,7 +221,7 @@ func VerifyEmailExists(u *UserModel) error {
 // It is a UserVerifier.
 func VerifyPasswordExists(u *UserModel) error {
 	if strings.TrimSpace(u.Password) == "" {
-		return ErrEmptyPassword
+		return NewValidationError("Password", RuleRequired, ErrEmptyPassword)
 	}
 	return nil
 }
@@ -88,7 +238,7 @@ func IsEmailSyntaxValid(email string) error {
 	if EmailRx.MatchString(email) {
 		return nil
 	}
-	return ErrInvalidEmailSyntax
+	return NewValidationError("EMail", RuleSyntax, ErrInvalidEmailSyntax)
 }
 
 // VerifyEmailSyntax tests if the user email is syntactically.
@@ -97,70 +247,164 @@ func VerifyEmailSyntax(u *UserModel) error {
 	return IsEmailSyntaxValid(u.EMail)
 }
 
-// CheckUsernameMaxLen tests if the username is not longer than the allowed length
-// (150 chars).
-func CheckUsernameMaxLen(username string) error {
-	if utf8.RuneCountInString(username) > 150 {
-		return ErrUsernameTooLong
+// UserSchemaLimits describes the maximal lengths of the string fields of the user
+// model.
+//
+// The same limits are used by the validators and in the CREATE TABLE statements of
+// the SQL implementations, see Replacements.
+// Thus a limit must only be changed in one place: Change the limits, apply them to
+// the SQLTemplateReplacer and use the same object to validate the users.
+type UserSchemaLimits struct {
+	UsernameMaxLen  int
+	PasswordMaxLen  int
+	EMailMaxLen     int
+	FirstNameMaxLen int
+	LastNameMaxLen  int
+}
+
+// DefaultUserSchemaLimits returns the default limits as described in UserModel:
+// Username (150), password (270), EMail (254), FirstName (50), LastName(150).
+// The limits are taken from UserFields.
+func DefaultUserSchemaLimits() *UserSchemaLimits {
+	res := &UserSchemaLimits{}
+	for _, field := range UserFields {
+		if limit := res.limit(field.Name); limit != nil {
+			*limit = field.MaxLen
+		}
+	}
+	return res
+}
+
+// limit returns a pointer to the limit of the field with the given name, nil if the
+// field has no limit.
+func (l *UserSchemaLimits) limit(name string) *int {
+	switch name {
+	case "Username":
+		return &l.UsernameMaxLen
+	case "Password":
+		return &l.PasswordMaxLen
+	case "EMail":
+		return &l.EMailMaxLen
+	case "FirstName":
+		return &l.FirstNameMaxLen
+	case "LastName":
+		return &l.LastNameMaxLen
+	default:
+		return nil
+	}
+}
+
+var (
+	// StandardUserSchemaLimits are the limits used by the CheckXMaxLen functions,
+	// VerifyStandardUserMaxLens and DefaultSQLReplacer.
+	StandardUserSchemaLimits = DefaultUserSchemaLimits()
+)
+
+// Replacements returns the meta variables for the SQLTemplateReplacer describing the
+// limits.
+// The keys are "$USERNAME_MAX_LEN$", "$PASSWORD_MAX_LEN$", "$EMAIL_MAX_LEN$",
+// "$FIRST_NAME_MAX_LEN$" and "$LAST_NAME_MAX_LEN$", see UserField.MaxLenVar.
+func (l *UserSchemaLimits) Replacements() map[string]string {
+	res := make(map[string]string)
+	for _, field := range UserFields {
+		if limit := l.limit(field.Name); limit != nil {
+			res[field.MaxLenVar()] = strconv.Itoa(*limit)
+		}
+	}
+	return res
+}
+
+// ApplyTo sets the meta variables from Replacements in the replacer.
+func (l *UserSchemaLimits) ApplyTo(replacer *SQLTemplateReplacer) {
+	replacer.UpdateDict(l.Replacements())
+}
+
+func checkMaxLen(field, s string, limit int, sentinel error) error {
+	if n := utf8.RuneCountInString(s); n > limit {
+		return NewMaxLenError(field, limit, n, sentinel)
 	}
 	return nil
 }
 
+// CheckUsername tests if the username is not longer than UsernameMaxLen.
+func (l *UserSchemaLimits) CheckUsername(username string) error {
+	return checkMaxLen("Username", username, l.UsernameMaxLen, ErrUsernameTooLong)
+}
+
+// CheckPasswordHash tests if the password hash is not longer than PasswordMaxLen.
+func (l *UserSchemaLimits) CheckPasswordHash(password string) error {
+	return checkMaxLen("Password", password, l.PasswordMaxLen, ErrPasswordTooLong)
+}
+
+// CheckEmail tests if the email is not longer than EMailMaxLen.
+func (l *UserSchemaLimits) CheckEmail(email string) error {
+	return checkMaxLen("EMail", email, l.EMailMaxLen, ErrEmailTooLong)
+}
+
+// CheckFirstName tests if the name is not longer than FirstNameMaxLen.
+func (l *UserSchemaLimits) CheckFirstName(name string) error {
+	return checkMaxLen("FirstName", name, l.FirstNameMaxLen, ErrFirstNameTooLong)
+}
+
+// CheckLastName tests if the name is not longer than LastNameMaxLen.
+func (l *UserSchemaLimits) CheckLastName(name string) error {
+	return checkMaxLen("LastName", name, l.LastNameMaxLen, ErrLastNameTooLong)
+}
+
+// VerifyMaxLens tests the username, password hash, email, first name and last name
+// for their max lengths and returns nil only iff all tests passed.
+// All fields are tested, if one or more tests failed an error of type
+// ValidationErrors is returned, the errors are in the order of the fields above.
+//
+// The method value (limits.VerifyMaxLens) is a UserVerifier.
+func (l *UserSchemaLimits) VerifyMaxLens(u *UserModel) error {
+	var errs ValidationErrors
+	errs = errs.Append(l.CheckUsername(u.Username))
+	errs = errs.Append(l.CheckPasswordHash(u.Password))
+	errs = errs.Append(l.CheckEmail(u.EMail))
+	errs = errs.Append(l.CheckFirstName(u.FirstName))
+	errs = errs.Append(l.CheckLastName(u.LastName))
+	return errs.ErrOrNil()
+}
+
+// CheckUsernameMaxLen tests if the username is not longer than the allowed length
+// (150 chars by default, see StandardUserSchemaLimits).
+func CheckUsernameMaxLen(username string) error {
+	return StandardUserSchemaLimits.CheckUsername(username)
+}
+
 // CheckPasswordHashMaxLen tests if the password hash length is not longer than the
-// allowed length (270 chars).
+// allowed length (270 chars by default, see StandardUserSchemaLimits).
 func CheckPasswordHashMaxLen(password string) error {
-	if utf8.RuneCountInString(password) > 270 {
-		return ErrPasswordTooLong
-	}
-	return nil
+	return StandardUserSchemaLimits.CheckPasswordHash(password)
 }
 
 // CheckEmailMaxLen tests if the email length is not longer than the allowed length
-// (254 chars).
+// (254 chars by default, see StandardUserSchemaLimits).
 func CheckEmailMaxLen(email string) error {
-	if utf8.RuneCountInString(email) > 254 {
-		return ErrEmailTooLong
-	}
-	return nil
+	return StandardUserSchemaLimits.CheckEmail(email)
 }
 
 // CheckFirstNameMaxLen tests if the name is not longer than the allowed length
-// (50 chars).
+// (50 chars by default, see StandardUserSchemaLimits).
 func CheckFirstNameMaxLen(name string) error {
-	if utf8.RuneCountInString(name) > 50 {
-		return ErrFirstNameTooLong
-	}
-	return nil
+	return StandardUserSchemaLimits.CheckFirstName(name)
 }
 
 // CheckLastNameMaxLen tests if the name is not longer than the allowed length
-// (150 chars).
+// (150 chars by default, see StandardUserSchemaLimits).
 func CheckLastNameMaxLen(name string) error {
-	if utf8.RuneCountInString(name) > 150 {
-		return ErrLastNameTooLong
-	}
-	return nil
+	return StandardUserSchemaLimits.CheckLastName(name)
 }
 
 // VerifyStandardUserMaxLens tests the username, password hash, email, first name
 // and last name for their max lengths and returns nil only iff all tests passed.
+// All fields are tested, if one or more tests failed an error of type
+// ValidationErrors is returned, the errors are in the order of the fields above.
+//
+// The limits are taken from StandardUserSchemaLimits.
 func VerifyStandardUserMaxLens(u *UserModel) error {
-	if err := CheckUsernameMaxLen(u.Username); err != nil {
-		return err
-	}
-	if err := CheckPasswordHashMaxLen(u.Password); err != nil {
-		return err
-	}
-	if err := CheckEmailMaxLen(u.EMail); err != nil {
-		return err
-	}
-	if err := CheckFirstNameMaxLen(u.FirstName); err != nil {
-		return err
-	}
-	if err := CheckLastNameMaxLen(u.LastName); err != nil {
-		return err
-	}
-	return nil
+	return StandardUserSchemaLimits.VerifyMaxLens(u)
 }
 
 var (
@@ -192,7 +436,7 @@ func CheckUsernameSyntax(username string) error {
 	if UsernameRx.MatchString(username) {
 		return nil
 	}
-	return ErrInvalidUsernameSyntax
+	return NewValidationError("Username", RuleSyntax, ErrInvalidUsernameSyntax)
 }
 
 // CheckFirstNameSyntax tests if all chars of the name are a unicode letter (class L).
@@ -200,7 +444,7 @@ func CheckFirstNameSyntax(name string) error {
 	if verifyName(name) {
 		return nil
 	}
-	return ErrInvalidFirstNameSyntax
+	return NewValidationError("FirstName", RuleSyntax, ErrInvalidFirstNameSyntax)
 }
 
 // CheckLastNameSyntax tests if all chars of the name are a unicode letter (class L).
@@ -208,7 +452,7 @@ func CheckLastNameSyntax(name string) error {
 	if verifyName(name) {
 		return nil
 	}
-	return ErrInvalidLastNameSyntax
+	return NewValidationError("LastName", RuleSyntax, ErrInvalidLastNameSyntax)
 }
 
 // PasswordVerifier is any function that checks if a given password meets certain
@@ -316,3 +560,934 @@ func PWContainsAtLeast(classes []RuneClass, k int) PasswordVerifier {
 		return ClassCounter(classes, pw) >= k
 	}
 }
+
+// The following implements a password strength estimator inspired by zxcvbn
+// (https://github.com/dropbox/zxcvbn).
+// It doesn't count character classes but estimates how many guesses an attacker
+// would need to find the password: The password is split into patterns (dictionary
+// words, keyboard patterns, dates, repeats, sequences) and the combination of
+// patterns that requires the least number of guesses is used.
+// That way "Password1!" gets a low score (dictionary word with a predictable suffix)
+// while long passphrases get a high score.
+
+// PasswordMatch is a part of a password that matches a certain pattern.
+//
+// Pattern is one of "dictionary", "spatial", "repeat", "sequence", "date" or
+// "bruteforce".
+// Token is the part of the password, Start and End are the rune positions in the
+// password (End is exclusive) and Guesses is the estimated number of guesses for
+// the token.
+// For dictionary matches Dictionary contains the name of the dictionary, Reversed
+// and L33t are true if the word was reversed or l33t substitutions were applied.
+type PasswordMatch struct {
+	Pattern    string
+	Token      string
+	Start, End int
+	Guesses    float64
+	Dictionary string
+	Rank       int
+	Reversed   bool
+	L33t       bool
+}
+
+// PasswordStrength is the result of EstimatePasswordStrength.
+//
+// GuessesLog10 is the estimated number of guesses (log10), Score is a number between
+// 0 (too guessable) and 4 (very unguessable).
+// Warning explains what's wrong with the password (may be empty) and Suggestions
+// contains tips to create a stronger password.
+// Sequence is the sequence of matches that was used to compute the guesses.
+type PasswordStrength struct {
+	GuessesLog10 float64
+	Score        int
+	Warning      string
+	Suggestions  []string
+	Sequence     []*PasswordMatch
+}
+
+// Feedback returns the warning (if not empty) followed by all suggestions.
+func (s *PasswordStrength) Feedback() []string {
+	res := make([]string, 0, len(s.Suggestions)+1)
+	if s.Warning != "" {
+		res = append(res, s.Warning)
+	}
+	return append(res, s.Suggestions...)
+}
+
+const (
+	// strengthMaxLen is the maximal number of runes of a password considered by the
+	// estimator, longer passwords are truncated.
+	strengthMaxLen = 100
+	// minGuessesGrowingSequence is added for each additional match in a sequence of
+	// matches.
+	minGuessesGrowingSequence = 10000.0
+	minSubmatchGuessesSingleChar = 10.0
+	minSubmatchGuessesMultiChar  = 50.0
+	minYearSpace                 = 20
+)
+
+// EnglishWords is a dictionary of common English words and names used by
+// EstimatePasswordStrength, ordered by frequency.
+var EnglishWords = []string{
+	"the", "and", "you", "that", "was", "for", "are", "with", "his", "they",
+	"this", "have", "from", "one", "had", "word", "but", "not", "what", "all",
+	"were", "when", "your", "can", "said", "there", "use", "each", "which",
+	"she", "how", "their", "will", "other", "about", "out", "many", "then",
+	"them", "these", "some", "her", "would", "make", "like", "him", "into",
+	"time", "has", "look", "two", "more", "write", "see", "number", "way",
+	"could", "people", "than", "first", "water", "been", "call", "who", "now",
+	"find", "long", "down", "day", "did", "get", "come", "made", "may", "part",
+	"love", "home", "house", "world", "life", "money", "family", "friend",
+	"secret", "summer", "winter", "spring", "autumn", "sunday", "monday",
+	"friday", "january", "april", "june", "july", "august", "october",
+	"december", "happy", "hello", "welcome", "purple", "orange", "yellow",
+	"green", "silver", "golden", "black", "white", "blue", "red", "dog", "cat",
+	"horse", "tiger", "eagle", "dragon", "monkey", "apple", "banana", "cherry",
+	"coffee", "chocolate", "cookie", "pizza", "music", "guitar", "soccer",
+	"football", "baseball", "hockey", "computer", "internet", "login", "admin",
+	"user", "guest", "master", "super", "star", "king", "queen", "prince",
+	"princess", "angel", "devil", "heaven", "ocean", "river", "mountain",
+	"forest", "flower", "garden", "school", "summer", "correct", "horse",
+	"battery", "staple", "michael", "john", "david", "james", "robert",
+	"william", "mary", "jennifer", "linda", "thomas", "daniel", "jessica",
+	"sarah", "anna", "maria", "peter", "paul", "mark", "lisa", "laura",
+}
+
+// PasswordDictionaries are the ranked dictionaries used by EstimatePasswordStrength.
+// The rank of a word is its position in the list (starting with 1).
+// This map should only be changed before the first call to EstimatePasswordStrength.
+var PasswordDictionaries = map[string][]string{
+	"passwords": CommonPasswords,
+	"english":   EnglishWords,
+}
+
+var (
+	rankedDictsOnce sync.Once
+	rankedDicts     map[string]*rankedDict
+)
+
+// rankedDict maps the words of a dictionary to their rank, maxLen is the length
+// (in runes) of the longest word.
+type rankedDict struct {
+	ranks  map[string]int
+	maxLen int
+}
+
+func buildRankedDict(words []string) *rankedDict {
+	res := &rankedDict{ranks: make(map[string]int, len(words))}
+	for i, word := range words {
+		word = strings.ToLower(word)
+		if _, has := res.ranks[word]; !has {
+			res.ranks[word] = i + 1
+		}
+		if n := utf8.RuneCountInString(word); n > res.maxLen {
+			res.maxLen = n
+		}
+	}
+	return res
+}
+
+func getRankedDicts() map[string]*rankedDict {
+	rankedDictsOnce.Do(func() {
+		rankedDicts = make(map[string]*rankedDict, len(PasswordDictionaries))
+		for name, words := range PasswordDictionaries {
+			rankedDicts[name] = buildRankedDict(words)
+		}
+	})
+	return rankedDicts
+}
+
+var l33tTable = map[rune][]rune{
+	'4': {'a'}, '@': {'a'}, '8': {'b'}, '(': {'c'}, '{': {'c'}, '[': {'c'},
+	'<': {'c'}, '3': {'e'}, '6': {'g'}, '9': {'g'}, '1': {'i', 'l'}, '!': {'i'},
+	'|': {'i', 'l'}, '7': {'l', 't'}, '0': {'o'}, '$': {'s'}, '5': {'s'},
+	'+': {'t'}, '%': {'x'}, '2': {'z'},
+}
+
+// maxL33tVariants limits the number of unleeted variants of a token that are tested.
+const maxL33tVariants = 16
+
+func binom(n, k int) float64 {
+	if k > n || k < 0 {
+		return 0
+	}
+	res := 1.0
+	for i := 1; i <= k; i++ {
+		res = res * float64(n-k+i) / float64(i)
+	}
+	return res
+}
+
+// uppercaseVariations estimates how many capitalization variants an attacker must
+// try for a word.
+func uppercaseVariations(token []rune) float64 {
+	upper, lower := 0, 0
+	for _, r := range token {
+		if unicode.IsUpper(r) {
+			upper++
+		} else if unicode.IsLower(r) {
+			lower++
+		}
+	}
+	if upper == 0 {
+		return 1
+	}
+	first, last := unicode.IsUpper(token[0]), unicode.IsUpper(token[len(token)-1])
+	if lower == 0 || (upper == 1 && (first || last)) {
+		return 2
+	}
+	variations := 0.0
+	for i := 1; i <= upper && i <= lower; i++ {
+		variations += binom(upper+lower, i)
+	}
+	return variations
+}
+
+// l33tVariations estimates how many substitution variants an attacker must try.
+// subs maps the substituted chars to the letter they replace.
+func l33tVariations(token []rune, subs map[rune]rune) float64 {
+	res := 1.0
+	for subbed, letter := range subs {
+		s, u := 0, 0
+		for _, r := range token {
+			switch unicode.ToLower(r) {
+			case subbed:
+				s++
+			case letter:
+				u++
+			}
+		}
+		if s == 0 || u == 0 {
+			res *= 2
+			continue
+		}
+		variations := 0.0
+		for i := 1; i <= s && i <= u; i++ {
+			variations += binom(s+u, i)
+		}
+		res *= variations
+	}
+	return res
+}
+
+func reverseRunes(runes []rune) []rune {
+	res := make([]rune, len(runes))
+	for i, r := range runes {
+		res[len(runes)-1-i] = r
+	}
+	return res
+}
+
+// unl33t returns all variants of token with l33t chars replaced by letters, together
+// with the substitutions used.
+func unl33t(token []rune) ([][]rune, []map[rune]rune) {
+	variants := [][]rune{make([]rune, 0, len(token))}
+	subs := []map[rune]rune{make(map[rune]rune)}
+	for _, r := range token {
+		letters, isL33t := l33tTable[r]
+		if !isL33t {
+			for i := range variants {
+				variants[i] = append(variants[i], r)
+			}
+			continue
+		}
+		var newVariants [][]rune
+		var newSubs []map[rune]rune
+		for i, variant := range variants {
+			for _, letter := range letters {
+				if prev, has := subs[i][r]; has && prev != letter {
+					continue
+				}
+				if len(newVariants) >= maxL33tVariants {
+					break
+				}
+				v := make([]rune, len(variant), len(token))
+				copy(v, variant)
+				newVariants = append(newVariants, append(v, letter))
+				s := make(map[rune]rune, len(subs[i])+1)
+				for k, val := range subs[i] {
+					s[k] = val
+				}
+				s[r] = letter
+				newSubs = append(newSubs, s)
+			}
+		}
+		variants, subs = newVariants, newSubs
+	}
+	return variants, subs
+}
+
+// dictionaryMatches returns the matches of all substrings in the dictionaries.
+// Only substrings up to the length of the longest word are tested, the reversed and
+// unleeted variants of each substring are computed once for all dictionaries.
+func dictionaryMatches(pw []rune, dicts map[string]*rankedDict) []*PasswordMatch {
+	res := make([]*PasswordMatch, 0)
+	lower := []rune(strings.ToLower(string(pw)))
+	if len(lower) != len(pw) {
+		// should not happen, but ToLower could in theory change the length
+		lower = pw
+	}
+	n := len(pw)
+	maxLen := 0
+	for _, dict := range dicts {
+		if dict.maxLen > maxLen {
+			maxLen = dict.maxLen
+		}
+	}
+	addMatch := func(name string, i, j, rank int, reversed, l33t bool, subs map[rune]rune) {
+		token := pw[i:j]
+		guesses := float64(rank) * uppercaseVariations(token)
+		if reversed {
+			guesses *= 2
+		}
+		if l33t {
+			guesses *= l33tVariations(token, subs)
+		}
+		res = append(res, &PasswordMatch{
+			Pattern: "dictionary", Token: string(token), Start: i, End: j,
+			Guesses: guesses, Dictionary: name, Rank: rank, Reversed: reversed, L33t: l33t,
+		})
+	}
+	for i := 0; i < n; i++ {
+		for j := i + 1; j <= n && j-i <= maxLen; j++ {
+			word := lower[i:j]
+			str := string(word)
+			var reversed string
+			if j-i > 2 {
+				reversed = string(reverseRunes(word))
+			}
+			var variants [][]rune
+			var subs []map[rune]rune
+			if j-i >= 2 {
+				variants, subs = unl33t(word)
+			}
+			for name, dict := range dicts {
+				if j-i > dict.maxLen {
+					continue
+				}
+				if rank, has := dict.ranks[str]; has {
+					addMatch(name, i, j, rank, false, false, nil)
+				}
+				if reversed != "" {
+					if rank, has := dict.ranks[reversed]; has {
+						addMatch(name, i, j, rank, true, false, nil)
+					}
+				}
+				for k, variant := range variants {
+					if len(subs[k]) == 0 {
+						continue
+					}
+					if rank, has := dict.ranks[string(variant)]; has {
+						addMatch(name, i, j, rank, false, true, subs[k])
+					}
+				}
+			}
+		}
+	}
+	return res
+}
+
+// keyPos is the position of a key on a QWERTY keyboard, x is the horizontal
+// position in units of key widths.
+type keyPos struct {
+	row int
+	x   float64
+}
+
+var (
+	keyboardOnce      sync.Once
+	keyboardPositions map[rune]keyPos
+	keyboardShifted   map[rune]bool
+	keyboardAvgDegree float64
+)
+
+func buildKeyboard() {
+	rows := []struct {
+		unshifted, shifted string
+		offset             float64
+	}{
+		{"`1234567890-=", "~!@#$%^&*()_+", 0},
+		{"qwertyuiop[]\\", "QWERTYUIOP{}|", 1.5},
+		{"asdfghjkl;'", "ASDFGHJKL:\"", 1.75},
+		{"zxcvbnm,./", "ZXCVBNM<>?", 2.25},
+	}
+	keyboardPositions = make(map[rune]keyPos)
+	keyboardShifted = make(map[rune]bool)
+	for row, r := range rows {
+		shifted := []rune(r.shifted)
+		for i, key := range []rune(r.unshifted) {
+			pos := keyPos{row: row, x: float64(i) + r.offset}
+			keyboardPositions[key] = pos
+			keyboardPositions[shifted[i]] = pos
+			keyboardShifted[shifted[i]] = true
+		}
+	}
+	// compute average degree (only unshifted keys)
+	numKeys, numNeighbors := 0, 0
+	for key, pos := range keyboardPositions {
+		if keyboardShifted[key] {
+			continue
+		}
+		numKeys++
+		for other, otherPos := range keyboardPositions {
+			if !keyboardShifted[other] && other != key && keysAdjacent(pos, otherPos) {
+				numNeighbors++
+			}
+		}
+	}
+	keyboardAvgDegree = float64(numNeighbors) / float64(numKeys)
+}
+
+func keysAdjacent(p1, p2 keyPos) bool {
+	dx := p1.x - p2.x
+	if dx < 0 {
+		dx = -dx
+	}
+	switch p1.row - p2.row {
+	case 0:
+		return dx == 1
+	case -1, 1:
+		return dx <= 0.75
+	default:
+		return false
+	}
+}
+
+// keyDirection returns the direction from p1 to p2, used to count the turns.
+func keyDirection(p1, p2 keyPos) int {
+	dir := 3 * (p2.row - p1.row)
+	if p2.x > p1.x {
+		dir++
+	} else if p2.x < p1.x {
+		dir--
+	}
+	return dir
+}
+
+func spatialGuesses(length, turns, shifted int) float64 {
+	starts := float64(len(keyboardPositions) - len(keyboardShifted))
+	guesses := 0.0
+	for i := 2; i <= length; i++ {
+		possibleTurns := turns
+		if i-1 < possibleTurns {
+			possibleTurns = i - 1
+		}
+		for j := 1; j <= possibleTurns; j++ {
+			guesses += binom(i-1, j-1) * starts * math.Pow(keyboardAvgDegree, float64(j))
+		}
+	}
+	if shifted > 0 {
+		unshifted := length - shifted
+		if unshifted == 0 {
+			guesses *= 2
+		} else {
+			variations := 0.0
+			for i := 1; i <= shifted && i <= unshifted; i++ {
+				variations += binom(shifted+unshifted, i)
+			}
+			guesses *= variations
+		}
+	}
+	return guesses
+}
+
+func spatialMatches(pw []rune) []*PasswordMatch {
+	keyboardOnce.Do(buildKeyboard)
+	res := make([]*PasswordMatch, 0)
+	n := len(pw)
+	i := 0
+	for i < n-2 {
+		j := i + 1
+		turns, shifted := 0, 0
+		lastDir := -100
+		if keyboardShifted[pw[i]] {
+			shifted++
+		}
+		for j < n {
+			prev, prevOK := keyboardPositions[pw[j-1]]
+			cur, curOK := keyboardPositions[pw[j]]
+			if !prevOK || !curOK || !keysAdjacent(prev, cur) {
+				break
+			}
+			if dir := keyDirection(prev, cur); dir != lastDir {
+				turns++
+				lastDir = dir
+			}
+			if keyboardShifted[pw[j]] {
+				shifted++
+			}
+			j++
+		}
+		if j-i >= 3 {
+			res = append(res, &PasswordMatch{
+				Pattern: "spatial", Token: string(pw[i:j]), Start: i, End: j,
+				Guesses: spatialGuesses(j-i, turns, shifted),
+			})
+		}
+		i = j
+	}
+	return res
+}
+
+func sequenceMatches(pw []rune) []*PasswordMatch {
+	res := make([]*PasswordMatch, 0)
+	n := len(pw)
+	addSequence := func(i, j int, delta rune) {
+		if j-i < 3 {
+			return
+		}
+		first := pw[i]
+		var base float64
+		switch {
+		case strings.ContainsRune("aAzZ019", first):
+			base = 4
+		case unicode.IsDigit(first):
+			base = 10
+		default:
+			base = 26
+		}
+		if delta < 0 {
+			base *= 2
+		}
+		res = append(res, &PasswordMatch{
+			Pattern: "sequence", Token: string(pw[i:j]), Start: i, End: j,
+			Guesses: base * float64(j-i),
+		})
+	}
+	i := 0
+	for i < n-2 {
+		delta := pw[i+1] - pw[i]
+		if delta == 0 || delta > 5 || delta < -5 {
+			i++
+			continue
+		}
+		j := i + 2
+		for j < n && pw[j]-pw[j-1] == delta {
+			j++
+		}
+		addSequence(i, j, delta)
+		if j-i >= 3 {
+			i = j - 1
+		} else {
+			i++
+		}
+	}
+	return res
+}
+
+func repeatMatches(pw []rune, dicts map[string]*rankedDict) []*PasswordMatch {
+	res := make([]*PasswordMatch, 0)
+	n := len(pw)
+	i := 0
+	for i < n-1 {
+		bestEnd, bestBase := i, 0
+		for baseLen := 1; i+2*baseLen <= n; baseLen++ {
+			end := i + baseLen
+			for end+baseLen <= n && string(pw[end:end+baseLen]) == string(pw[i:i+baseLen]) {
+				end += baseLen
+			}
+			if end-i > bestEnd-i && end-i >= 2*baseLen {
+				bestEnd, bestBase = end, baseLen
+			}
+		}
+		if bestBase == 0 {
+			i++
+			continue
+		}
+		base := pw[i : i+bestBase]
+		baseGuesses := math.Pow(10, estimateGuessesLog10(base, dicts))
+		res = append(res, &PasswordMatch{
+			Pattern: "repeat", Token: string(pw[i:bestEnd]), Start: i, End: bestEnd,
+			Guesses: baseGuesses * float64((bestEnd-i)/bestBase),
+		})
+		i = bestEnd
+	}
+	return res
+}
+
+var dateSepRx = regexp.MustCompile(`^(\d{1,4})([\s/\\_.-])(\d{1,2})([\s/\\_.-])(\d{1,4})$`)
+
+// validDate tests if the numbers describe a date (in any order of day, month and
+// year) and returns the year.
+func validDate(a, b, c int) (int, bool) {
+	candidates := [][3]int{{a, b, c}, {c, b, a}, {c, a, b}, {a, c, b}}
+	for _, cand := range candidates {
+		day, month, year := cand[0], cand[1], cand[2]
+		if month < 1 || month > 12 {
+			day, month = month, day
+		}
+		if month < 1 || month > 12 || day < 1 || day > 31 {
+			continue
+		}
+		switch {
+		case year >= 1000 && year <= 2050:
+			return year, true
+		case year >= 0 && year < 100:
+			if year > 50 {
+				return 1900 + year, true
+			}
+			return 2000 + year, true
+		}
+	}
+	return 0, false
+}
+
+func dateGuesses(year int, separator bool) float64 {
+	yearSpace := year - time.Now().Year()
+	if yearSpace < 0 {
+		yearSpace = -yearSpace
+	}
+	if yearSpace < minYearSpace {
+		yearSpace = minYearSpace
+	}
+	guesses := float64(yearSpace) * 365
+	if separator {
+		guesses *= 4
+	}
+	return guesses
+}
+
+func dateMatches(pw []rune) []*PasswordMatch {
+	res := make([]*PasswordMatch, 0)
+	n := len(pw)
+	for i := 0; i < n; i++ {
+		for j := i + 4; j <= n && j-i <= 10; j++ {
+			token := string(pw[i:j])
+			if m := dateSepRx.FindStringSubmatch(token); m != nil && m[2] == m[4] {
+				a, _ := strconv.Atoi(m[1])
+				b, _ := strconv.Atoi(m[3])
+				c, _ := strconv.Atoi(m[5])
+				if year, ok := validDate(a, b, c); ok {
+					res = append(res, &PasswordMatch{
+						Pattern: "date", Token: token, Start: i, End: j,
+						Guesses: dateGuesses(year, true),
+					})
+				}
+				continue
+			}
+			if j-i > 8 || !isAllDigits(token) {
+				continue
+			}
+			if j-i == 4 {
+				if year, _ := strconv.Atoi(token); year >= 1900 && year <= 2050 {
+					yearSpace := year - time.Now().Year()
+					if yearSpace < 0 {
+						yearSpace = -yearSpace
+					}
+					if yearSpace < minYearSpace {
+						yearSpace = minYearSpace
+					}
+					res = append(res, &PasswordMatch{
+						Pattern: "date", Token: token, Start: i, End: j,
+						Guesses: float64(yearSpace),
+					})
+					continue
+				}
+			}
+			if year, ok := splitDate(token); ok {
+				res = append(res, &PasswordMatch{
+					Pattern: "date", Token: token, Start: i, End: j,
+					Guesses: dateGuesses(year, false),
+				})
+			}
+		}
+	}
+	return res
+}
+
+func isAllDigits(s string) bool {
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return s != ""
+}
+
+// splitDate tries all ways to split the digits into day, month and year.
+func splitDate(digits string) (int, bool) {
+	n := len(digits)
+	for k := 1; k < n-1; k++ {
+		for l := k + 1; l < n; l++ {
+			parts := []string{digits[:k], digits[k:l], digits[l:]}
+			valid := true
+			for _, p := range parts {
+				if len(p) > 4 || len(p) == 3 {
+					valid = false
+				}
+			}
+			if !valid {
+				continue
+			}
+			a, _ := strconv.Atoi(parts[0])
+			b, _ := strconv.Atoi(parts[1])
+			c, _ := strconv.Atoi(parts[2])
+			// the year must be the first or last part and have two or four digits
+			if len(parts[1]) > 2 || (len(parts[0]) < 2 && len(parts[2]) < 2) {
+				continue
+			}
+			if year, ok := validDate(a, b, c); ok {
+				return year, true
+			}
+		}
+	}
+	return 0, false
+}
+
+func bruteforceGuessesLog10(length int) float64 {
+	return float64(length)
+}
+
+func allMatches(pw []rune, dicts map[string]*rankedDict) []*PasswordMatch {
+	res := dictionaryMatches(pw, dicts)
+	res = append(res, spatialMatches(pw)...)
+	res = append(res, sequenceMatches(pw)...)
+	res = append(res, repeatMatches(pw, dicts)...)
+	res = append(res, dateMatches(pw)...)
+	return res
+}
+
+// logSum10 returns log10(10^a + 10^b).
+func logSum10(a, b float64) float64 {
+	if a < b {
+		a, b = b, a
+	}
+	return a + math.Log10(1+math.Pow(10, b-a))
+}
+
+// matchGuessesLog10 returns the guesses of a match (log10), applying the minimal
+// number of guesses for matches that don't cover the whole password.
+func matchGuessesLog10(m *PasswordMatch, n int) float64 {
+	guesses := m.Guesses
+	if m.End-m.Start < n {
+		minGuesses := minSubmatchGuessesMultiChar
+		if m.End-m.Start == 1 {
+			minGuesses = minSubmatchGuessesSingleChar
+		}
+		if guesses < minGuesses {
+			guesses = minGuesses
+		}
+	}
+	if guesses < 1 {
+		guesses = 1
+	}
+	return math.Log10(guesses)
+}
+
+// mostGuessableSequence finds the sequence of matches covering the password that
+// requires the least number of guesses.
+// Gaps between the matches are filled with bruteforce matches.
+func mostGuessableSequence(pw []rune, matches []*PasswordMatch) (float64, []*PasswordMatch) {
+	n := len(pw)
+	if n == 0 {
+		return 0, nil
+	}
+	byEnd := make([][]*PasswordMatch, n+1)
+	for _, m := range matches {
+		byEnd[m.End] = append(byEnd[m.End], m)
+	}
+	// bruteforce matches for all substrings
+	for i := 0; i < n; i++ {
+		for j := i + 1; j <= n; j++ {
+			guesses := math.Pow(10, bruteforceGuessesLog10(j-i))
+			minGuesses := minSubmatchGuessesMultiChar + 1
+			if j-i == 1 {
+				minGuesses = minSubmatchGuessesSingleChar + 1
+			}
+			if guesses < minGuesses {
+				guesses = minGuesses
+			}
+			byEnd[j] = append(byEnd[j], &PasswordMatch{
+				Pattern: "bruteforce", Token: string(pw[i:j]), Start: i, End: j,
+				Guesses: guesses,
+			})
+		}
+	}
+	// best[j][k] is the minimal sum of guesses (log10) of k matches covering pw[:j]
+	inf := math.Inf(1)
+	best := make([][]float64, n+1)
+	back := make([][]*PasswordMatch, n+1)
+	for j := range best {
+		best[j] = make([]float64, n+1)
+		back[j] = make([]*PasswordMatch, n+1)
+		for k := range best[j] {
+			best[j][k] = inf
+		}
+	}
+	best[0][0] = 0
+	for j := 1; j <= n; j++ {
+		for _, m := range byEnd[j] {
+			g := matchGuessesLog10(m, n)
+			for k := 1; k <= j; k++ {
+				prev := best[m.Start][k-1]
+				if prev == inf {
+					continue
+				}
+				// don't allow two consecutive bruteforce matches
+				if m.Pattern == "bruteforce" && back[m.Start][k-1] != nil &&
+					back[m.Start][k-1].Pattern == "bruteforce" {
+					continue
+				}
+				if prev+g < best[j][k] {
+					best[j][k] = prev + g
+					back[j][k] = m
+				}
+			}
+		}
+	}
+	// now find the best k, guesses are k! * product + minGuessesGrowingSequence^(k-1)
+	bestK, bestGuesses := 0, inf
+	logFactorial := 0.0
+	for k := 1; k <= n; k++ {
+		logFactorial += math.Log10(float64(k))
+		if best[n][k] == inf {
+			continue
+		}
+		total := logFactorial + best[n][k]
+		if k > 1 {
+			total = logSum10(total, float64(k-1)*math.Log10(minGuessesGrowingSequence))
+		}
+		if total < bestGuesses {
+			bestK, bestGuesses = k, total
+		}
+	}
+	sequence := make([]*PasswordMatch, bestK)
+	j := n
+	for k := bestK; k > 0; k-- {
+		m := back[j][k]
+		sequence[k-1] = m
+		j = m.Start
+	}
+	return bestGuesses, sequence
+}
+
+func estimateGuessesLog10(pw []rune, dicts map[string]*rankedDict) float64 {
+	guesses, _ := mostGuessableSequence(pw, allMatches(pw, dicts))
+	return guesses
+}
+
+func strengthScore(guessesLog10 float64) int {
+	switch {
+	case guessesLog10 < 3:
+		return 0
+	case guessesLog10 < 6:
+		return 1
+	case guessesLog10 < 8:
+		return 2
+	case guessesLog10 < 10:
+		return 3
+	default:
+		return 4
+	}
+}
+
+func strengthFeedback(res *PasswordStrength) {
+	if len(res.Sequence) == 0 {
+		res.Warning = ""
+		res.Suggestions = []string{
+			"Use a few words, avoid common phrases",
+			"No need for symbols, digits, or uppercase letters",
+		}
+		return
+	}
+	if res.Score > 2 {
+		return
+	}
+	longest := res.Sequence[0]
+	for _, m := range res.Sequence[1:] {
+		if m.End-m.Start > longest.End-longest.Start {
+			longest = m
+		}
+	}
+	suggestions := []string{"Add another word or two. Uncommon words are better."}
+	switch longest.Pattern {
+	case "dictionary":
+		switch {
+		case longest.Dictionary == "passwords" && len(res.Sequence) == 1 && !longest.L33t && !longest.Reversed:
+			if longest.Rank <= 10 {
+				res.Warning = "This is a top-10 common password"
+			} else if longest.Rank <= 100 {
+				res.Warning = "This is a top-100 common password"
+			} else {
+				res.Warning = "This is a very common password"
+			}
+		case longest.Dictionary == "passwords":
+			res.Warning = "This is similar to a commonly used password"
+		case longest.Dictionary == "user_inputs":
+			res.Warning = "Your password contains personal information"
+		case len(res.Sequence) == 1:
+			res.Warning = "A word by itself is easy to guess"
+		}
+		token := []rune(longest.Token)
+		if unicode.IsUpper(token[0]) {
+			suggestions = append(suggestions, "Capitalization doesn't help very much")
+		} else if strings.ToUpper(longest.Token) == longest.Token && strings.ToLower(longest.Token) != longest.Token {
+			suggestions = append(suggestions, "All-uppercase is almost as easy to guess as all-lowercase")
+		}
+		if longest.Reversed && len(token) >= 4 {
+			suggestions = append(suggestions, "Reversed words aren't much harder to guess")
+		}
+		if longest.L33t {
+			suggestions = append(suggestions, "Predictable substitutions like '@' instead of 'a' don't help very much")
+		}
+	case "spatial":
+		res.Warning = "Short keyboard patterns are easy to guess"
+		suggestions = append(suggestions, "Use a longer keyboard pattern with more turns")
+	case "repeat":
+		res.Warning = "Repeats like \"abcabcabc\" are only slightly harder to guess than \"abc\""
+		suggestions = append(suggestions, "Avoid repeated words and characters")
+	case "sequence":
+		res.Warning = "Sequences like abc or 6543 are easy to guess"
+		suggestions = append(suggestions, "Avoid sequences")
+	case "date":
+		res.Warning = "Dates are often easy to guess"
+		suggestions = append(suggestions, "Avoid dates and years that are associated with you")
+	}
+	res.Suggestions = suggestions
+}
+
+// EstimatePasswordStrength estimates the strength of a password by the number of
+// guesses an attacker would need.
+//
+// userInputs can contain additional words that should be considered guessable, for
+// example the username or email of the user.
+// Only the first 100 runes of the password are considered.
+func EstimatePasswordStrength(pw string, userInputs ...string) *PasswordStrength {
+	runes := []rune(pw)
+	if len(runes) > strengthMaxLen {
+		runes = runes[:strengthMaxLen]
+	}
+	dicts := getRankedDicts()
+	if len(userInputs) > 0 {
+		withInputs := make(map[string]*rankedDict, len(dicts)+1)
+		for name, dict := range dicts {
+			withInputs[name] = dict
+		}
+		inputs := make([]string, 0, len(userInputs))
+		for _, input := range userInputs {
+			if input = strings.TrimSpace(input); input != "" {
+				inputs = append(inputs, input)
+			}
+		}
+		withInputs["user_inputs"] = buildRankedDict(inputs)
+		dicts = withInputs
+	}
+	guesses, sequence := mostGuessableSequence(runes, allMatches(runes, dicts))
+	res := &PasswordStrength{
+		GuessesLog10: guesses,
+		Score:        strengthScore(guesses),
+		Sequence:     sequence,
+	}
+	strengthFeedback(res)
+	return res
+}
+
+// PWMinStrength is a generator that returns a PasswordVerifier.
+//
+// The returned verifier tests if the score from EstimatePasswordStrength is at least
+// minScore (between 0 and 4).
+func PWMinStrength(minScore int, userInputs ...string) PasswordVerifier {
+	return func(pw string) bool {
+		return EstimatePasswordStrength(pw, userInputs...).Score >= minScore
+	}
+}